@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"os/user"
 	"path"
 	"path/filepath"
 	"runtime"
@@ -69,23 +70,34 @@ Exit status is 12 if the password is incorrect.
 // BackupOptions bundles all options for the backup command.
 type BackupOptions struct {
 	filter.ExcludePatternOptions
+	SigningOptions
 
 	Parent            string
 	GroupBy           data.SnapshotGroupByOptions
 	Force             bool
 	ExcludeOtherFS    bool
 	ExcludeIfPresent  []string
+	ExcludeIgnoreFile []string
 	ExcludeCaches     bool
 	ExcludeLargerThan string
+	ExcludeOlderThan  data.Duration
+	ExcludeOwner      []string
+	ExcludeGroup      []string
+	ExcludeType       []string
+	ExcludePerm       string
 	ExcludeCloudFiles bool
 	Stdin             bool
 	StdinFilename     string
 	StdinCommand      bool
+	StdinTar          bool
+	StdinCommands     []string
 	Tags              data.TagLists
 	Host              string
 	FilesFrom         []string
 	FilesFromVerbatim []string
 	FilesFromRaw      []string
+	ChangedFilesFrom  string
+	FullScanEvery     uint
 	TimeStamp         string
 	WithAtime         bool
 	IgnoreInode       bool
@@ -95,6 +107,22 @@ type BackupOptions struct {
 	ReadConcurrency   uint
 	NoScan            bool
 	SkipIfUnchanged   bool
+	ExpireAfter       data.Duration
+	Hold              bool
+
+	Resumable           bool
+	CheckpointInterval  time.Duration
+	ModifiedFileRetries uint
+
+	IOPriority  string
+	CPUNice     int
+	MaxReadRate int
+
+	PreHook               string
+	PostHook              string
+	OnFailureHook         string
+	HookTimeout           time.Duration
+	ContinueOnHookFailure bool
 
 	readConcurrencyFlag *pflag.Flag
 }
@@ -102,20 +130,33 @@ type BackupOptions struct {
 func (opts *BackupOptions) AddFlags(f *pflag.FlagSet) {
 	f.StringVar(&opts.Parent, "parent", "", "use this parent `snapshot` (default: latest snapshot in the group determined by --group-by and not newer than the timestamp determined by --time)")
 	opts.GroupBy = data.SnapshotGroupByOptions{Host: true, Path: true}
-	f.VarP(&opts.GroupBy, "group-by", "g", "`group` snapshots by host, paths and/or tags, separated by comma (disable grouping with '')")
+	f.VarP(&opts.GroupBy, "group-by", "g", "`group` snapshots by host, paths, tags, user, first-path, tag:<prefix>* and/or label:<key>, separated by comma (disable grouping with '')")
 	f.BoolVarP(&opts.Force, "force", "f", false, `force re-reading the source files/directories (overrides the "parent" flag)`)
 
 	opts.ExcludePatternOptions.Add(f)
 
 	f.BoolVarP(&opts.ExcludeOtherFS, "one-file-system", "x", false, "exclude other file systems, don't cross filesystem boundaries and subvolumes")
 	f.StringArrayVar(&opts.ExcludeIfPresent, "exclude-if-present", nil, "takes `filename[:header]`, exclude contents of directories containing filename (except filename itself) if header of that file is as provided (can be specified multiple times)")
+	f.StringArrayVar(&opts.ExcludeIgnoreFile, "exclude-ignore-file", nil, "exclude items matching the gitignore-style patterns in files named `filename` in the backed up directories and their parents (can be specified multiple times)")
 	f.BoolVar(&opts.ExcludeCaches, "exclude-caches", false, `excludes cache directories that are marked with a CACHEDIR.TAG file. See https://bford.info/cachedir/ for the Cache Directory Tagging Standard`)
 	f.StringVar(&opts.ExcludeLargerThan, "exclude-larger-than", "", "max `size` of the files to be backed up (allowed suffixes: k/K, m/M, g/G, t/T)")
+	f.Var(&opts.ExcludeOlderThan, "exclude-older-than", "exclude files which were last modified more than `duration` ago (e.g. 1y6m)")
+	f.StringArrayVar(&opts.ExcludeOwner, "exclude-owner", nil, "exclude files owned by `user` (name or ID, can be specified multiple times)")
+	f.StringArrayVar(&opts.ExcludeGroup, "exclude-group", nil, "exclude files owned by `group` (name or ID, can be specified multiple times)")
+	f.StringArrayVar(&opts.ExcludeType, "exclude-type", nil, "exclude items of the given `type`s: file, symlink, dev, chardev, device, fifo, socket or irregular (comma separated, can be specified multiple times)")
+	f.StringVar(&opts.ExcludePerm, "exclude-perm", "", "exclude files which have any of the octal permission `bits` set (e.g. 0002 for world-writable files)")
 	f.BoolVar(&opts.Stdin, "stdin", false, "read backup from stdin")
 	f.StringVar(&opts.StdinFilename, "stdin-filename", "stdin", "`filename` to use when reading from stdin")
 	f.BoolVar(&opts.StdinCommand, "stdin-from-command", false, "interpret arguments as command to execute and store its stdout")
+	f.StringArrayVar(&opts.StdinCommands, "stdin-command", nil, "run `name=command` and store its stdout as file name, fails if the command fails (can be specified multiple times)")
+	f.BoolVar(&opts.StdinTar, "stdin-tar", false, "read a tar archive from stdin (or the command output) and store its entries as files, the archive is stored in the directory set by --stdin-filename")
 	f.Var(&opts.Tags, "tag", "add `tags` for the new snapshot in the format `tag[,tag,...]` (can be specified multiple times)")
 	f.UintVar(&opts.ReadConcurrency, "read-concurrency", 0, "read `n` files concurrently (default: $RESTIC_READ_CONCURRENCY or 2)")
+	f.IntVar(&opts.MaxReadRate, "max-read-rate", 0, "limits reading files to a maximum `rate` in KiB/s (default: unlimited)")
+	if runtime.GOOS == "linux" {
+		f.StringVar(&opts.IOPriority, "io-priority", "", "set the I/O scheduling `priority` of restic to idle or best-effort:N with N from 0 (highest) to 7 (lowest)")
+		f.IntVar(&opts.CPUNice, "cpu-nice", 0, "set the nice `value` of restic, from -20 (highest CPU priority) to 19 (lowest)")
+	}
 	f.StringVarP(&opts.Host, "host", "H", "", "set the `hostname` for the snapshot manually (default: $RESTIC_HOST). To prevent an expensive rescan use the \"parent\" flag")
 	f.StringVar(&opts.Host, "hostname", "", "set the `hostname` for the snapshot manually")
 	err := f.MarkDeprecated("hostname", "use --host")
@@ -126,19 +167,30 @@ func (opts *BackupOptions) AddFlags(f *pflag.FlagSet) {
 	f.StringArrayVar(&opts.FilesFrom, "files-from", nil, "read the files to backup from `file` (can be combined with file args; can be specified multiple times)")
 	f.StringArrayVar(&opts.FilesFromVerbatim, "files-from-verbatim", nil, "read the files to backup from `file` (can be combined with file args; can be specified multiple times)")
 	f.StringArrayVar(&opts.FilesFromRaw, "files-from-raw", nil, "read the files to backup from `file` (can be combined with file args; can be specified multiple times)")
+	f.StringVar(&opts.ChangedFilesFrom, "changed-files-from", "", "only scan the paths changed since the parent snapshot listed in `file`, take all other items from the parent snapshot")
+	f.UintVar(&opts.FullScanEvery, "full-scan-every", 0, "ignore --changed-files-from and scan all files on every `n`th backup (default: never)")
 	f.StringVar(&opts.TimeStamp, "time", "", "`time` of the backup (ex. '2012-11-01 22:08:41') (default: now)")
 	f.BoolVar(&opts.WithAtime, "with-atime", false, "store the atime for all files and directories")
 	f.BoolVar(&opts.IgnoreInode, "ignore-inode", false, "ignore inode number and ctime changes when checking for modified files (default: $RESTIC_IGNORE_INODE or false)")
 	f.BoolVar(&opts.IgnoreCtime, "ignore-ctime", false, "ignore ctime changes when checking for modified files (default: $RESTIC_IGNORE_CTIME or false)")
+	f.UintVar(&opts.ModifiedFileRetries, "modified-file-retries", 2, "read files which are modified while being read up to `n` more times")
 	f.BoolVarP(&opts.DryRun, "dry-run", "n", false, "do not upload or write any data, just show what would be done")
 	f.BoolVar(&opts.NoScan, "no-scan", false, "do not run scanner to estimate size of backup")
-	if runtime.GOOS == "windows" {
-		f.BoolVar(&opts.UseFsSnapshot, "use-fs-snapshot", false, "use filesystem snapshot where possible (currently only Windows VSS)")
-	}
+	f.BoolVar(&opts.UseFsSnapshot, "use-fs-snapshot", false, "use filesystem snapshot where possible (Windows VSS, or the provider set by the fs-snapshot extended options on other platforms)")
 	if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
 		f.BoolVar(&opts.ExcludeCloudFiles, "exclude-cloud-files", false, "excludes online-only cloud files (such as OneDrive, iCloud drive, …)")
 	}
 	f.BoolVar(&opts.SkipIfUnchanged, "skip-if-unchanged", false, "skip snapshot creation if identical to parent snapshot")
+	f.Var(&opts.ExpireAfter, "expire-after", "let `forget` remove the snapshot once this `duration` has passed since the snapshot time (e.g. 90d, 1y6m)")
+	f.BoolVar(&opts.Hold, "hold", false, "put the snapshot on legal hold, which prevents its removal by forget")
+	f.BoolVar(&opts.Resumable, "resumable", false, "periodically save the progress, such that an interrupted backup can be resumed by the next backup with --resumable")
+	f.DurationVar(&opts.CheckpointInterval, "checkpoint-interval", 0, "save a checkpoint snapshot of the data backed up so far every `duration` (e.g. 30m)")
+	f.StringVar(&opts.PreHook, "pre-hook", "", "run `command` before the backup, a failure aborts the backup unless --continue-on-hook-failure is set")
+	f.StringVar(&opts.PostHook, "post-hook", "", "run `command` after the backup, also if the backup failed")
+	f.StringVar(&opts.OnFailureHook, "on-failure-hook", "", "run `command` if the backup failed or is incomplete")
+	f.DurationVar(&opts.HookTimeout, "hook-timeout", 0, "stop hooks which run longer than `duration` (e.g. 10m, default: no timeout)")
+	f.BoolVar(&opts.ContinueOnHookFailure, "continue-on-hook-failure", false, "continue the backup if the pre-hook fails")
+	opts.SigningOptions.AddFlags(f)
 
 	opts.readConcurrencyFlag = f.Lookup("read-concurrency")
 
@@ -244,6 +296,30 @@ func readLines(filename string, stdin io.ReadCloser) ([]string, error) {
 	return lines, nil
 }
 
+// readChangedPaths reads the paths which changed since the parent snapshot
+// from the named file, or stdin if filename is "-". Each path is listed on a
+// separate line, relative paths are converted to absolute paths. The returned
+// slice is never nil.
+func readChangedPaths(filename string, stdin io.ReadCloser) ([]string, error) {
+	lines, err := readLines(filename, stdin)
+	if err != nil {
+		return nil, errors.Fatalf("unable to read change list: %v", err)
+	}
+
+	paths := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if line == "" {
+			continue
+		}
+		p, err := filepath.Abs(line)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, p)
+	}
+	return paths, nil
+}
+
 // readFilenamesFromFileRaw reads a list of filenames from the given file,
 // or stdin if filename is "-". Each filename is terminated by a zero byte,
 // which is stripped off.
@@ -304,6 +380,7 @@ func (opts BackupOptions) Check(gopts global.Options, args []string) error {
 		}
 
 		filesFrom := append(append(opts.FilesFrom, opts.FilesFromVerbatim...), opts.FilesFromRaw...)
+		filesFrom = append(filesFrom, opts.ChangedFilesFrom)
 		for _, filename := range filesFrom {
 			if filename == "-" {
 				return errors.Fatal("unable to read password from stdin when data is to be read from stdin, use --password-file or $RESTIC_PASSWORD")
@@ -325,6 +402,53 @@ func (opts BackupOptions) Check(gopts global.Options, args []string) error {
 		if len(args) > 0 && !opts.StdinCommand {
 			return errors.Fatal("--stdin was specified and files/dirs were listed as arguments")
 		}
+		if opts.ChangedFilesFrom != "" {
+			return errors.Fatal("--stdin and --changed-files-from cannot be used together")
+		}
+	}
+
+	if len(opts.StdinCommands) > 0 {
+		if opts.Stdin || opts.StdinCommand {
+			return errors.Fatal("--stdin-command cannot be used together with --stdin, --stdin-from-command or --stdin-tar")
+		}
+		if len(opts.FilesFrom) > 0 || len(opts.FilesFromVerbatim) > 0 || len(opts.FilesFromRaw) > 0 {
+			return errors.Fatal("--stdin-command and --files-from cannot be used together")
+		}
+		if len(args) > 0 {
+			return errors.Fatal("--stdin-command was specified and files/dirs were listed as arguments")
+		}
+		if opts.ChangedFilesFrom != "" {
+			return errors.Fatal("--stdin-command and --changed-files-from cannot be used together")
+		}
+	}
+
+	if opts.ChangedFilesFrom == "-" {
+		filesFrom := append(append(opts.FilesFrom, opts.FilesFromVerbatim...), opts.FilesFromRaw...)
+		for _, filename := range filesFrom {
+			if filename == "-" {
+				return errors.Fatal("--changed-files-from and --files-from cannot both read from stdin")
+			}
+		}
+	}
+
+	if opts.CheckpointInterval < 0 {
+		return errors.Fatal("--checkpoint-interval must not be negative")
+	}
+
+	if opts.IOPriority != "" {
+		if _, err := parseIOPriority(opts.IOPriority); err != nil {
+			return err
+		}
+	}
+	if opts.CPUNice < -20 || opts.CPUNice > 19 {
+		return errors.Fatal("--cpu-nice must be between -20 and 19")
+	}
+	if opts.MaxReadRate < 0 {
+		return errors.Fatal("--max-read-rate must not be negative")
+	}
+
+	if d := opts.ExpireAfter; d.Hours < 0 || d.Days < 0 || d.Months < 0 || d.Years < 0 {
+		return errors.Fatal("--expire-after must not contain negative values")
 	}
 
 	return nil
@@ -379,6 +503,67 @@ func collectRejectFuncs(opts BackupOptions, targets []string, fs fs.FS, warnf fu
 		funcs = append(funcs, f)
 	}
 
+	if !opts.ExcludeOlderThan.Zero() && !opts.Stdin && !opts.StdinCommand {
+		d := opts.ExcludeOlderThan
+		before := time.Now().AddDate(-d.Years, -d.Months, -d.Days).Add(time.Hour * time.Duration(-d.Hours))
+
+		f, err := archiver.RejectByModTime(before)
+		if err != nil {
+			return nil, err
+		}
+		funcs = append(funcs, f)
+	}
+
+	if (len(opts.ExcludeOwner) > 0 || len(opts.ExcludeGroup) > 0) && !opts.Stdin && !opts.StdinCommand {
+		uids, err := lookupIDs(opts.ExcludeOwner, lookupUID)
+		if err != nil {
+			return nil, err
+		}
+		gids, err := lookupIDs(opts.ExcludeGroup, lookupGID)
+		if err != nil {
+			return nil, err
+		}
+
+		f, err := archiver.RejectByOwner(uids, gids)
+		if err != nil {
+			return nil, err
+		}
+		funcs = append(funcs, f)
+	}
+
+	if len(opts.ExcludeType) > 0 && !opts.Stdin && !opts.StdinCommand {
+		var types []data.NodeType
+		for _, list := range opts.ExcludeType {
+			for _, t := range strings.Split(list, ",") {
+				t = strings.TrimSpace(t)
+				if t == "device" {
+					types = append(types, data.NodeTypeDev, data.NodeTypeCharDev)
+					continue
+				}
+				types = append(types, data.NodeType(t))
+			}
+		}
+
+		f, err := archiver.RejectByNodeType(types)
+		if err != nil {
+			return nil, errors.Fatalf("invalid --exclude-type: %v", err)
+		}
+		funcs = append(funcs, f)
+	}
+
+	if len(opts.ExcludePerm) != 0 && !opts.Stdin && !opts.StdinCommand {
+		perm, err := parsePermissionBits(opts.ExcludePerm)
+		if err != nil {
+			return nil, err
+		}
+
+		f, err := archiver.RejectByPermissions(perm)
+		if err != nil {
+			return nil, errors.Fatalf("invalid --exclude-perm: %v", err)
+		}
+		funcs = append(funcs, f)
+	}
+
 	if opts.ExcludeCloudFiles && !opts.Stdin && !opts.StdinCommand {
 		f, err := archiver.RejectCloudFiles(warnf)
 		if err != nil {
@@ -400,9 +585,77 @@ func collectRejectFuncs(opts BackupOptions, targets []string, fs fs.FS, warnf fu
 		funcs = append(funcs, f)
 	}
 
+	for _, filename := range opts.ExcludeIgnoreFile {
+		f, err := archiver.RejectByIgnoreFile(filename, warnf)
+		if err != nil {
+			return nil, err
+		}
+
+		funcs = append(funcs, f)
+	}
+
 	return funcs, nil
 }
 
+// lookupIDs resolves a list of user or group names to their IDs using lookup.
+// Numeric IDs are used as is.
+func lookupIDs(names []string, lookup func(name string) (string, error)) ([]uint32, error) {
+	var ids []uint32
+	for _, name := range names {
+		id := name
+		if _, err := strconv.ParseUint(name, 10, 32); err != nil {
+			id, err = lookup(name)
+			if err != nil {
+				return nil, errors.Fatalf("unable to look up %q: %v", name, err)
+			}
+		}
+
+		v, err := strconv.ParseUint(id, 10, 32)
+		if err != nil {
+			return nil, errors.Fatalf("invalid ID %q for %q", id, name)
+		}
+		ids = append(ids, uint32(v))
+	}
+	return ids, nil
+}
+
+func lookupUID(name string) (string, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		return "", err
+	}
+	return u.Uid, nil
+}
+
+func lookupGID(name string) (string, error) {
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		return "", err
+	}
+	return g.Gid, nil
+}
+
+// parsePermissionBits parses octal permission bits like "0644" or "4000" and
+// converts them to an os.FileMode.
+func parsePermissionBits(s string) (os.FileMode, error) {
+	v, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || v > 0o7777 {
+		return 0, errors.Fatalf("invalid permission bits %q, expected octal number like 0022", s)
+	}
+
+	perm := os.FileMode(v) & os.ModePerm
+	if v&0o4000 != 0 {
+		perm |= os.ModeSetuid
+	}
+	if v&0o2000 != 0 {
+		perm |= os.ModeSetgid
+	}
+	if v&0o1000 != 0 {
+		perm |= os.ModeSticky
+	}
+	return perm, nil
+}
+
 // collectTargets returns a list of target files/dirs from several sources.
 func collectTargets(opts BackupOptions, args []string, warnf func(msg string, args ...interface{}), stdin io.ReadCloser) (targets []string, err error) {
 	if opts.Stdin || opts.StdinCommand {
@@ -465,6 +718,10 @@ func collectTargets(opts BackupOptions, args []string, warnf func(msg string, ar
 	return filterExisting(targets, warnf)
 }
 
+// backupResumeInterval is the interval at which the state of a running backup
+// is saved, such that an interrupted backup can be resumed.
+const backupResumeInterval = 5 * time.Minute
+
 // parent returns the ID of the parent snapshot. If there is none, nil is
 // returned.
 func findParentSnapshot(ctx context.Context, repo restic.ListerLoaderUnpacked, opts BackupOptions, targets []string, timeStampLimit time.Time) (*data.Snapshot, error) {
@@ -487,7 +744,14 @@ func findParentSnapshot(ctx context.Context, repo restic.ListerLoaderUnpacked, o
 		f.Tags = []data.TagList{opts.Tags.Flatten()}
 	}
 
-	sn, _, err := f.FindLatest(ctx, repo, repo, snName)
+	var sn *data.Snapshot
+	var err error
+	groupBy := parentGroupBy(opts.GroupBy)
+	if snName == "latest" && !groupBy.Empty() {
+		sn, err = findLatestInGroup(ctx, repo, f, groupBy, opts, targets)
+	} else {
+		sn, _, err = f.FindLatest(ctx, repo, repo, snName)
+	}
 	// Snapshot not found is ok if no explicit parent was set
 	if opts.Parent == "" && errors.Is(err, data.ErrNoSnapshotFound) {
 		err = nil
@@ -495,9 +759,57 @@ func findParentSnapshot(ctx context.Context, repo restic.ListerLoaderUnpacked, o
 	return sn, err
 }
 
-func runBackup(ctx context.Context, opts BackupOptions, gopts global.Options, term ui.Terminal, args []string) error {
+// parentGroupBy returns the grouping options which cannot be expressed as a
+// snapshot filter.
+func parentGroupBy(groupBy data.SnapshotGroupByOptions) data.SnapshotGroupByOptions {
+	rest := data.SnapshotGroupByOptions{User: groupBy.User, FirstPath: groupBy.FirstPath}
+	if !groupBy.Tag {
+		rest.TagPrefixes = groupBy.TagPrefixes
+	}
+	return rest
+}
+
+// findLatestInGroup returns the latest snapshot matched by f which belongs to
+// the same group as the new snapshot.
+func findLatestInGroup(ctx context.Context, repo restic.ListerLoaderUnpacked, f data.SnapshotFilter, groupBy data.SnapshotGroupByOptions,
+	opts BackupOptions, targets []string) (*data.Snapshot, error) {
+
+	newSn, err := data.NewSnapshot(targets, opts.Tags.Flatten(), opts.Host, f.TimestampLimit)
+	if err != nil {
+		return nil, err
+	}
+	if len(f.Paths) > 0 {
+		f.Paths = newSn.Paths
+	}
+
+	var latest *data.Snapshot
+	err = data.ForAllSnapshots(ctx, repo, repo, nil, func(id restic.ID, sn *data.Snapshot, err error) error {
+		if err != nil {
+			return errors.Errorf("Error loading snapshot %v: %v", id.Str(), err)
+		}
+		if sn.Time.After(f.TimestampLimit) || (latest != nil && sn.Time.Before(latest.Time)) || !f.Matches(sn) {
+			return nil
+		}
+		same, err := groupBy.SameGroup(sn, newSn)
+		if err != nil {
+			return err
+		}
+		if same {
+			latest = sn
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if latest == nil {
+		return nil, data.ErrNoSnapshotFound
+	}
+	return latest, nil
+}
+
+func runBackup(ctx context.Context, opts BackupOptions, gopts global.Options, term ui.Terminal, args []string) (err error) {
 	var vsscfg fs.VSSConfig
-	var err error
 
 	var printer backup.ProgressPrinter
 	if gopts.JSON {
@@ -511,13 +823,56 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts global.Options, te
 		}
 	}
 
+	var snapshotProvider fs.SnapshotProvider
+	if runtime.GOOS != "windows" && opts.UseFsSnapshot {
+		snapshotCfg, err := fs.ParseSnapshotConfig(gopts.Extended)
+		if err != nil {
+			return err
+		}
+		if snapshotProvider, err = fs.NewSnapshotProvider(snapshotCfg); err != nil {
+			return errors.Fatalf("invalid file system snapshot options: %v", err)
+		}
+	}
+
+	// a tar archive is read from stdin unless it is the output of a command
+	if opts.StdinTar && !opts.StdinCommand {
+		opts.Stdin = true
+	}
+
 	err = opts.Check(gopts, args)
 	if err != nil {
 		return err
 	}
 
+	// the output of several commands is handled like the output of a single command
+	stdinCommands, err := parseStdinCommands(opts.StdinCommands)
+	if err != nil {
+		return err
+	}
+	if len(stdinCommands) > 0 {
+		opts.StdinCommand = true
+	}
+
+	if err := setSchedulingPriority(opts); err != nil {
+		return err
+	}
+
+	hooks := newBackupHooks(opts, printer)
+	if err := hooks.runPre(ctx, args); err != nil {
+		if !opts.ContinueOnHookFailure {
+			return hooks.runPreFailed(ctx, args, err)
+		}
+		printer.E("Warning: %v", err)
+	}
+
+	var targets []string
+	var snapshotID restic.ID
+	defer func() {
+		err = hooks.runPost(ctx, targets, snapshotID, err)
+	}()
+
 	success := true
-	targets, err := collectTargets(opts, args, printer.E, term.InputRaw())
+	targets, err = collectTargets(opts, args, printer.E, term.InputRaw())
 	if err != nil {
 		if errors.Is(err, ErrInvalidSourceData) {
 			success = false
@@ -535,6 +890,11 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts global.Options, te
 		}
 	}
 
+	signingKey, err := opts.SigningOptions.load()
+	if err != nil {
+		return err
+	}
+
 	if gopts.Verbosity >= 2 && !gopts.JSON {
 		printer.P("open repository")
 	}
@@ -570,6 +930,38 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts global.Options, te
 		}
 	}
 
+	var changedPaths []string
+	var partialScans uint
+	if opts.ChangedFilesFrom != "" && parentSnapshot != nil {
+		if opts.FullScanEvery > 0 && parentSnapshot.PartialScans+1 >= opts.FullScanEvery {
+			if !gopts.JSON {
+				printer.P("scanning all files, %d backups since the last full scan\n", parentSnapshot.PartialScans+1)
+			}
+		} else {
+			changedPaths, err = readChangedPaths(opts.ChangedFilesFrom, term.InputRaw())
+			if err != nil {
+				return err
+			}
+			partialScans = parentSnapshot.PartialScans + 1
+
+			if !gopts.JSON {
+				printer.V("only scanning %d changed paths", len(changedPaths))
+			}
+		}
+	}
+
+	var resumeState *archiver.ResumeState
+	if opts.Resumable && !opts.Stdin && !opts.StdinCommand {
+		resumeState, err = archiver.FindResumeState(ctx, repo, opts.Host, targets)
+		if err != nil {
+			return err
+		}
+
+		if resumeState != nil && !gopts.JSON {
+			printer.P("resuming interrupted backup from %v\n", resumeState.Time.Local().Format(global.TimeFormat))
+		}
+	}
+
 	if !gopts.JSON {
 		printer.V("load index files")
 	}
@@ -578,13 +970,14 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts global.Options, te
 	if err != nil {
 		return err
 	}
+	// packs marked for deletion by a non-exclusive prune must not be used for deduplication
+	err = repo.ExcludePendingDeletions(ctx)
+	if err != nil {
+		return err
+	}
 
 	targetFS := fs.NewLocal()
-	if runtime.GOOS == "windows" && opts.UseFsSnapshot {
-		if err = fs.HasSufficientPrivilegesForVSS(); err != nil {
-			return err
-		}
-
+	if opts.UseFsSnapshot {
 		errorHandler := func(item string, err error) {
 			_ = progressReporter.Error(item, err)
 		}
@@ -595,12 +988,30 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts global.Options, te
 			}
 		}
 
-		localVss := fs.NewLocalVss(errorHandler, messageHandler, vsscfg)
-		defer localVss.DeleteSnapshots()
-		targetFS = localVss
+		if runtime.GOOS == "windows" {
+			if err = fs.HasSufficientPrivilegesForVSS(); err != nil {
+				return err
+			}
+
+			localVss := fs.NewLocalVss(errorHandler, messageHandler, vsscfg)
+			defer localVss.DeleteSnapshots()
+			targetFS = localVss
+		} else {
+			localSnapshot := fs.NewLocalSnapshot(snapshotProvider, errorHandler, messageHandler)
+			defer localSnapshot.DeleteSnapshots()
+			targetFS = localSnapshot
+		}
 	}
 
-	if opts.Stdin || opts.StdinCommand {
+	if len(stdinCommands) > 0 {
+		if !gopts.JSON {
+			printer.V("read data from %d commands", len(stdinCommands))
+		}
+		targetFS, targets, err = newStdinCommandsFS(ctx, stdinCommands, timeStamp, printer.E)
+		if err != nil {
+			return fmt.Errorf("failed to backup command output: %w", err)
+		}
+	} else if opts.Stdin || opts.StdinCommand {
 		if !gopts.JSON {
 			printer.V("read data from stdin")
 		}
@@ -612,10 +1023,26 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts global.Options, te
 				return err
 			}
 		}
-		targetFS, err = fs.NewReader(filename, source, fs.ReaderOptions{
-			ModTime: timeStamp,
-			Mode:    0644,
-		})
+		if opts.StdinTar {
+			var tarFS *fs.TarReader
+			tarFS, err = fs.NewTarReader(filename, source, fs.TarReaderOptions{
+				ModTime: timeStamp,
+				Warnf:   printer.E,
+			})
+			if err == nil {
+				defer func() { _ = tarFS.Close() }()
+				targetFS = tarFS
+			}
+			// the command reports its exit status when it is closed
+			if cerr := source.Close(); err == nil && cerr != nil {
+				err = cerr
+			}
+		} else {
+			targetFS, err = fs.NewReader(filename, source, fs.ReaderOptions{
+				ModTime: timeStamp,
+				Mode:    0644,
+			})
+		}
 		if err != nil {
 			return fmt.Errorf("failed to backup from stdin: %w", err)
 		}
@@ -639,7 +1066,9 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts global.Options, te
 	cancelCtx, cancel := context.WithCancel(wgCtx)
 	defer cancel()
 
-	if !opts.NoScan {
+	// the scanner would have to walk all files, which defeats the purpose of
+	// the change list
+	if !opts.NoScan && changedPaths == nil {
 		sc := archiver.NewScanner(targetFS)
 		sc.SelectByName = selectByNameFilter
 		sc.Select = selectFilter
@@ -652,7 +1081,10 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts global.Options, te
 		wg.Go(func() error { return sc.Scan(cancelCtx, targets) })
 	}
 
-	arch := archiver.New(repo, targetFS, archiver.Options{ReadConcurrency: opts.ReadConcurrency})
+	arch := archiver.New(repo, targetFS, archiver.Options{
+		ReadConcurrency: opts.ReadConcurrency,
+		MaxReadRate:     opts.MaxReadRate,
+	})
 	arch.SelectByName = selectByNameFilter
 	arch.Select = selectFilter
 	arch.WithAtime = opts.WithAtime
@@ -671,6 +1103,11 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts global.Options, te
 	arch.StartFile = progressReporter.StartFile
 	arch.CompleteBlob = progressReporter.CompleteBlob
 	arch.ExcludedItem = progressReporter.ExcludedItem
+	arch.ModifiedItem = progressReporter.ModifiedItem
+	arch.Warn = func(msg string, args ...interface{}) {
+		printer.E("Warning: "+msg, args...)
+	}
+	arch.ModifiedFileRetries = opts.ModifiedFileRetries
 
 	if opts.IgnoreInode {
 		// --ignore-inode implies --ignore-ctime: on FUSE, the ctime is not
@@ -690,12 +1127,25 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts global.Options, te
 		ParentSnapshot:  parentSnapshot,
 		ProgramVersion:  "restic " + global.Version,
 		SkipIfUnchanged: opts.SkipIfUnchanged,
+		SigningKey:      signingKey,
+		ExpireAfter:     opts.ExpireAfter,
+		Hold:            opts.Hold,
+		Resume:          resumeState,
+		ChangedPaths:    changedPaths,
+		PartialScans:    partialScans,
+	}
+	if !opts.Stdin && !opts.StdinCommand && !opts.DryRun {
+		if opts.Resumable {
+			snapshotOpts.ResumeInterval = backupResumeInterval
+		}
+		snapshotOpts.CheckpointInterval = opts.CheckpointInterval
 	}
 
 	if !gopts.JSON {
 		printer.V("start backup on %v", targets)
 	}
 	_, id, summary, err := arch.Snapshot(ctx, targets, snapshotOpts)
+	snapshotID = id
 
 	// cleanly shutdown all running goroutines
 	cancel()
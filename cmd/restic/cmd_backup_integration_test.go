@@ -1,6 +1,7 @@
 package main
 
 import (
+	"archive/tar"
 	"bytes"
 	"context"
 	"encoding/json"
@@ -16,6 +17,7 @@ import (
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/fs"
 	"github.com/restic/restic/internal/global"
+	"github.com/restic/restic/internal/options"
 	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
 	rtest "github.com/restic/restic/internal/test"
@@ -171,6 +173,34 @@ func (f *vssDeleteOriginalFS) Lstat(name string) (*fs.ExtendedFileInfo, error) {
 	return f.FS.Lstat(name)
 }
 
+func TestBackupFsSnapshotCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file system snapshot providers are not used on Windows")
+	}
+
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	marker := filepath.Join(env.base, "snapshot-deleted")
+	// the "snapshot" is the live file system
+	env.gopts.Extended = options.Options{
+		"fs-snapshot.provider": "command",
+		"fs-snapshot.create":   `echo "$RESTIC_FS_SNAPSHOT_MOUNTPOINT"`,
+		"fs-snapshot.delete":   `touch "` + marker + `"`,
+	}
+	opts := BackupOptions{UseFsSnapshot: true}
+
+	testRunBackup(t, "", []string{env.testdata}, opts, env.gopts)
+	snapshotIDs := testListSnapshots(t, env.gopts, 1)
+	testRunCheck(t, env.gopts)
+
+	_, err := os.Stat(marker)
+	rtest.OK(t, err)
+	sn := testLoadSnapshot(t, env.gopts, snapshotIDs[0])
+	rtest.Equals(t, []string{env.testdata}, sn.Paths)
+}
+
 func TestBackupVSS(t *testing.T) {
 	if runtime.GOOS != "windows" || fs.HasSufficientPrivilegesForVSS() != nil {
 		t.Skip("vss fs test can only be run on windows with admin privileges")
@@ -223,6 +253,32 @@ func TestBackupParentSelection(t *testing.T) {
 	rtest.Assert(t, latestSn.Parent != nil && latestSn.Parent.Equal(firstSnapshotID), "third snapshot selected unexpected parent %v instead of %v", latestSn.Parent, firstSnapshotID)
 }
 
+func TestBackupParentSelectionTagPrefix(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	backup := func(tags ...string) restic.ID {
+		opts := BackupOptions{
+			Tags:    data.TagLists{tags},
+			GroupBy: data.SnapshotGroupByOptions{Host: true, Path: true, TagPrefixes: []string{"app="}},
+		}
+		rtest.OK(t, withTermStatus(t, env.gopts, func(ctx context.Context, gopts global.Options) error {
+			cleanup := rtest.Chdir(t, filepath.Dir(env.testdata))
+			defer cleanup()
+			return runBackup(ctx, opts, gopts, gopts.Term, []string{"testdata/0/0"})
+		}))
+		latestSn, _ := testRunSnapshots(t, env.gopts)
+		return *latestSn.ID
+	}
+
+	first := backup("app=web")
+	backup("app=db")
+	// additional tags do not change the group
+	third := testLoadSnapshot(t, env.gopts, backup("app=web", "manual"))
+	rtest.Assert(t, third.Parent != nil && third.Parent.Equal(first), "third snapshot selected unexpected parent %v instead of %v", third.Parent, first)
+}
+
 func TestDryRunBackup(t *testing.T) {
 	env, cleanup := withTestEnvironment(t)
 	defer cleanup()
@@ -416,6 +472,85 @@ func TestBackupExclude(t *testing.T) {
 		"expected file %q not in first snapshot, but it's included", "passwords.txt")
 }
 
+func TestBackupExcludeIgnoreFile(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	datadir := filepath.Join(env.base, "testdata")
+
+	for _, filename := range backupExcludeFilenames {
+		fp := filepath.Join(datadir, filename)
+		rtest.OK(t, os.MkdirAll(filepath.Dir(fp), 0755))
+		rtest.OK(t, os.WriteFile(fp, []byte(filename), 0o666))
+	}
+	rtest.OK(t, os.WriteFile(filepath.Join(datadir, ".resticignore"), []byte("*.gz\n/private/\n"), 0o666))
+	rtest.OK(t, os.WriteFile(filepath.Join(datadir, "work", ".resticignore"), []byte("*.c\n!test.c\nsource/\n"), 0o666))
+
+	opts := BackupOptions{ExcludeIgnoreFile: []string{".resticignore"}}
+	testRunBackup(t, filepath.Dir(env.testdata), []string{"testdata"}, opts, env.gopts)
+	_, snapshotID := lastSnapshot(make(map[string]struct{}), loadSnapshotMap(t, env.gopts))
+	files := testRunLs(t, env.gopts, snapshotID)
+
+	for _, filename := range []string{"/testdata/testfile1", "/testdata/.resticignore", "/testdata/work/.resticignore"} {
+		rtest.Assert(t, includes(files, filename), "expected file %q in snapshot, but it's not included", filename)
+	}
+	for _, filename := range []string{"/testdata/foo.tar.gz", "/testdata/private", "/testdata/work/source"} {
+		rtest.Assert(t, !includes(files, filename), "expected file %q not in snapshot, but it's included", filename)
+	}
+}
+
+func TestBackupChangedFilesFrom(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	datadir := filepath.Join(env.base, "testdata")
+	for _, dir := range []string{"changed", "unchanged"} {
+		rtest.OK(t, os.MkdirAll(filepath.Join(datadir, dir), 0755))
+		rtest.OK(t, os.WriteFile(filepath.Join(datadir, dir, "file"), []byte("content"), 0o666))
+	}
+
+	opts := BackupOptions{}
+	testRunBackup(t, filepath.Dir(env.testdata), []string{"testdata"}, opts, env.gopts)
+	snapshotIDs := loadSnapshotMap(t, env.gopts)
+
+	for _, dir := range []string{"changed", "unchanged"} {
+		rtest.OK(t, os.WriteFile(filepath.Join(datadir, dir, "file"), []byte("modified content"), 0o666))
+	}
+	changeList := filepath.Join(env.base, "changes")
+	rtest.OK(t, os.WriteFile(changeList, []byte(filepath.Join(datadir, "changed", "file")+"\n"), 0o666))
+
+	opts = BackupOptions{ChangedFilesFrom: changeList, FullScanEvery: 2}
+	for i, want := range []struct {
+		partialScans uint
+		unchanged    string
+	}{
+		// only the listed file is scanned
+		{1, "content"},
+		// every second backup scans all files
+		{0, "modified content"},
+	} {
+		testRunBackup(t, filepath.Dir(env.testdata), []string{"testdata"}, opts, env.gopts)
+		var snapshotID string
+		snapshotIDs, snapshotID = lastSnapshot(snapshotIDs, loadSnapshotMap(t, env.gopts))
+		id, err := restic.ParseID(snapshotID)
+		rtest.OK(t, err)
+		sn := testLoadSnapshot(t, env.gopts, id)
+		rtest.Equals(t, want.partialScans, sn.PartialScans, fmt.Sprintf("backup %d", i))
+
+		restoredir := filepath.Join(env.base, fmt.Sprintf("restore%d", i))
+		testRunRestore(t, env.gopts, restoredir, snapshotID)
+		for dir, content := range map[string]string{"changed": "modified content", "unchanged": want.unchanged} {
+			buf, err := os.ReadFile(filepath.Join(restoredir, "testdata", dir, "file"))
+			rtest.OK(t, err)
+			rtest.Equals(t, content, string(buf), fmt.Sprintf("backup %d, %v", i, dir))
+		}
+	}
+}
+
 func TestBackupErrors(t *testing.T) {
 	if runtime.GOOS == "windows" {
 		return
@@ -664,6 +799,49 @@ func TestStdinFromCommand(t *testing.T) {
 	testRunCheck(t, env.gopts)
 }
 
+func TestStdinTarFromCommand(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+
+	archive := &bytes.Buffer{}
+	tw := tar.NewWriter(archive)
+	mtime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	content := []byte("file content")
+	rtest.OK(t, tw.WriteHeader(&tar.Header{Name: "dir/", Typeflag: tar.TypeDir, Mode: 0755, ModTime: mtime}))
+	rtest.OK(t, tw.WriteHeader(&tar.Header{Name: "dir/file", Typeflag: tar.TypeReg, Mode: 0644, ModTime: mtime, Size: int64(len(content))}))
+	_, err := tw.Write(content)
+	rtest.OK(t, err)
+	rtest.OK(t, tw.WriteHeader(&tar.Header{Name: "dir/link", Typeflag: tar.TypeSymlink, Linkname: "file", ModTime: mtime}))
+	rtest.OK(t, tw.Close())
+	archiveFile := filepath.Join(env.base, "archive.tar")
+	rtest.OK(t, os.WriteFile(archiveFile, archive.Bytes(), 0644))
+
+	opts := BackupOptions{
+		StdinCommand:  true,
+		StdinTar:      true,
+		StdinFilename: "export",
+	}
+	script := "import sys; sys.stdout.buffer.write(open(sys.argv[1], 'rb').read())"
+	testRunBackup(t, filepath.Dir(env.testdata), []string{"python", "-c", script, archiveFile}, opts, env.gopts)
+	snapshots := testListSnapshots(t, env.gopts, 1)
+	files := testRunLs(t, env.gopts, snapshots[0].String())
+	for _, name := range []string{"/export", "/export/dir", "/export/dir/file", "/export/dir/link"} {
+		rtest.Assert(t, includes(files, name), "file %q missing from snapshot, got %v", name, files)
+	}
+	testRunCheck(t, env.gopts)
+
+	restoredir := filepath.Join(env.base, "restore")
+	testRunRestore(t, env.gopts, restoredir, snapshots[0].String())
+	buf, err := os.ReadFile(filepath.Join(restoredir, "export", "dir", "file"))
+	rtest.OK(t, err)
+	rtest.Equals(t, content, buf)
+	fi, err := os.Lstat(filepath.Join(restoredir, "export", "dir", "file"))
+	rtest.OK(t, err)
+	rtest.Assert(t, fi.ModTime().Equal(mtime), "unexpected modification time %v", fi.ModTime())
+}
+
 func TestStdinFromCommandNoOutput(t *testing.T) {
 	env, cleanup := withTestEnvironment(t)
 	defer cleanup()
@@ -717,6 +895,48 @@ func TestStdinFromCommandFailNoOutputAndExitCode(t *testing.T) {
 	testRunCheck(t, env.gopts)
 }
 
+func TestStdinCommands(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	opts := BackupOptions{
+		StdinCommands: []string{
+			`db1.sql=python -c "print('db1')"`,
+			`dumps/db2.sql=python -c "print('db2')"`,
+		},
+	}
+
+	testRunBackup(t, filepath.Dir(env.testdata), nil, opts, env.gopts)
+	snapshots := testListSnapshots(t, env.gopts, 1)
+	testRunCheck(t, env.gopts)
+
+	restoredir := filepath.Join(env.base, "restore")
+	testRunRestore(t, env.gopts, restoredir, snapshots[0].String())
+	for name, content := range map[string]string{"db1.sql": "db1", "dumps/db2.sql": "db2"} {
+		buf, err := os.ReadFile(filepath.Join(restoredir, filepath.FromSlash(name)))
+		rtest.OK(t, err)
+		rtest.Equals(t, content, strings.TrimSpace(string(buf)))
+	}
+}
+
+func TestStdinCommandsFailExitCode(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	opts := BackupOptions{
+		StdinCommands: []string{
+			`db1.sql=python -c "print('db1')"`,
+			`db2.sql=python -c "import sys; print('db2'); sys.exit(1)"`,
+		},
+	}
+
+	err := testRunBackupAssumeFailure(t, filepath.Dir(env.testdata), nil, opts, env.gopts)
+	rtest.Assert(t, err != nil, "Expected error while backing up")
+	testListSnapshots(t, env.gopts, 0)
+}
+
 func TestBackupEmptyPassword(t *testing.T) {
 	// basic sanity test that empty passwords work
 	env, cleanup := withTestEnvironment(t)
@@ -782,3 +1002,72 @@ func TestBackupExcludeWithOutput(t *testing.T) {
 	}
 	rtest.Assert(t, foundExclude, "expected at least one excluded item, but found none")
 }
+
+func TestBackupHooks(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+
+	logfile := filepath.Join(env.base, "hooks.log")
+	t.Setenv("RESTIC_TEST_HOOK_LOG", logfile)
+	hook := `python -c "import os; f = open(os.environ['RESTIC_TEST_HOOK_LOG'], 'a'); ` +
+		`print(os.environ['RESTIC_HOOK'], os.environ.get('RESTIC_BACKUP_RESULT', '-'), ` +
+		`os.environ.get('RESTIC_SNAPSHOT_ID', '-'), os.environ['RESTIC_BACKUP_TAGS'], file=f)"`
+	readLog := func() []string {
+		buf, err := os.ReadFile(logfile)
+		rtest.OK(t, err)
+		rtest.OK(t, os.Remove(logfile))
+		return strings.Split(strings.TrimSpace(string(buf)), "\n")
+	}
+
+	opts := BackupOptions{
+		PreHook:       hook,
+		PostHook:      hook,
+		OnFailureHook: hook,
+		Tags:          data.TagLists{data.TagList{"foo"}},
+	}
+	testRunBackup(t, "", []string{env.testdata}, opts, env.gopts)
+	ids := testListSnapshots(t, env.gopts, 1)
+	rtest.Equals(t, []string{"pre - - foo", "post success " + ids[0].String() + " foo"}, readLog())
+
+	// a failing pre-hook aborts the backup and only runs the on-failure hook
+	opts.PreHook = `python -c "import sys; sys.exit(1)"`
+	err := testRunBackupAssumeFailure(t, "", []string{env.testdata}, opts, env.gopts)
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "backup aborted"), "unexpected error %v", err)
+	testListSnapshots(t, env.gopts, 1)
+	rtest.Equals(t, []string{"failure failure - foo"}, readLog())
+
+	// unless hook failures are ignored
+	opts.ContinueOnHookFailure = true
+	testRunBackup(t, "", []string{env.testdata}, opts, env.gopts)
+	testListSnapshots(t, env.gopts, 2)
+	lines := readLog()
+	rtest.Equals(t, 1, len(lines))
+	rtest.Assert(t, strings.HasPrefix(lines[0], "post success "), "unexpected hook output %v", lines)
+
+	// a failing backup runs both the post-hook and the on-failure hook
+	opts.PreHook = ""
+	err = testRunBackupAssumeFailure(t, "", []string{filepath.Join(env.testdata, "missing")}, opts, env.gopts)
+	rtest.Assert(t, err != nil, "missing error for failed backup")
+	rtest.Equals(t, []string{"post failure - foo", "failure failure - foo"}, readLog())
+}
+
+func TestBackupHookTimeout(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+
+	// the background process keeps the output of the hook open
+	opts := BackupOptions{
+		PreHook: `python -c "import subprocess, sys, time; ` +
+			`subprocess.Popen([sys.executable, '-c', 'import time; time.sleep(60)']); time.sleep(60)"`,
+		HookTimeout: 500 * time.Millisecond,
+	}
+	start := time.Now()
+	err := testRunBackupAssumeFailure(t, "", []string{env.testdata}, opts, env.gopts)
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "timed out"), "unexpected error %v", err)
+	rtest.Assert(t, time.Since(start) < 30*time.Second, "backup blocked by the background process of the hook")
+	testListSnapshots(t, env.gopts, 0)
+}
@@ -139,3 +139,40 @@ func TestReadFilenamesRaw(t *testing.T) {
 	rtest.Assert(t, strings.Contains(err.Error(), "zero byte"),
 		"wrong error message: %v", err.Error())
 }
+
+func TestParsePermissionBits(t *testing.T) {
+	for _, test := range []struct {
+		input string
+		perm  os.FileMode
+	}{
+		{"0002", 0o002},
+		{"022", 0o022},
+		{"4000", os.ModeSetuid},
+		{"7777", os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky},
+	} {
+		perm, err := parsePermissionBits(test.input)
+		rtest.OK(t, err)
+		rtest.Equals(t, test.perm, perm)
+	}
+
+	for _, input := range []string{"", "0009", "10000", "rwx"} {
+		_, err := parsePermissionBits(input)
+		rtest.Assert(t, err != nil, "missing error for %q", input)
+	}
+}
+
+func TestLookupIDs(t *testing.T) {
+	lookup := func(name string) (string, error) {
+		if name == "alice" {
+			return "1000", nil
+		}
+		return "", fmt.Errorf("unknown name %v", name)
+	}
+
+	ids, err := lookupIDs([]string{"alice", "42"}, lookup)
+	rtest.OK(t, err)
+	rtest.Equals(t, []uint32{1000, 42}, ids)
+
+	_, err = lookupIDs([]string{"bob"}, lookup)
+	rtest.Assert(t, err != nil, "missing error for unknown name")
+}
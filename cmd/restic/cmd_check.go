@@ -40,6 +40,13 @@ backed-up data, use the --read-data or --read-data-subset flags.
 By default, check creates a new temporary cache directory to verify data.
 To reuse the existing cache, use the --with-cache flag.
 
+Damaged or missing pack files which are protected by parity data, see the
+"parity" command, can be restored using the --repair-from-parity flag.
+
+Snapshots with an invalid signature are always reported. If trusted keys are
+specified using --trusted-keys-file, all snapshots without a valid signature
+by a key trusted for the snapshot's host are reported.
+
 EXIT STATUS
 ===========
 
@@ -73,11 +80,13 @@ Exit status is 12 if the password is incorrect.
 
 // CheckOptions bundles all options for the 'check' command.
 type CheckOptions struct {
-	ReadData       bool
-	ReadDataSubset string
-	CheckUnused    bool
-	WithCache      bool
+	ReadData         bool
+	ReadDataSubset   string
+	CheckUnused      bool
+	WithCache        bool
+	RepairFromParity bool
 	data.SnapshotFilter
+	SignatureOptions
 }
 
 func (opts *CheckOptions) AddFlags(f *pflag.FlagSet) {
@@ -91,7 +100,9 @@ func (opts *CheckOptions) AddFlags(f *pflag.FlagSet) {
 		panic(err)
 	}
 	f.BoolVar(&opts.WithCache, "with-cache", false, "use existing cache, only read uncached data from repository")
+	f.BoolVar(&opts.RepairFromParity, "repair-from-parity", false, "restore damaged or missing pack files using parity data")
 	initMultiSnapshotFilter(f, &opts.SnapshotFilter, true)
+	opts.SignatureOptions.AddFlags(f)
 }
 
 func checkFlags(opts CheckOptions) error {
@@ -236,6 +247,11 @@ func runCheck(ctx context.Context, opts CheckOptions, gopts global.Options, args
 		printer = newJSONErrorPrinter(term)
 	}
 
+	trusted, err := opts.SignatureOptions.load()
+	if err != nil {
+		return summary, err
+	}
+
 	cleanup := prepareCheckCache(opts, &gopts, printer)
 	defer cleanup()
 
@@ -249,6 +265,7 @@ func runCheck(ctx context.Context, opts CheckOptions, gopts global.Options, args
 	defer unlock()
 
 	chkr := checker.New(repo, opts.CheckUnused)
+	chkr.SetTrustedKeys(trusted)
 	err = chkr.LoadSnapshots(ctx, &opts.SnapshotFilter, args)
 	if err != nil {
 		return summary, err
@@ -362,6 +379,10 @@ func runCheck(ctx context.Context, opts CheckOptions, gopts global.Options, args
 		case *checker.SnapshotError:
 			printer.E("snapshot error %v: %v", e.ID, e.Message)
 			brokenSnapshots = append(brokenSnapshots, e.ID)
+		case *checker.SignatureError:
+			summary.NumErrors++
+			printer.E("%v\n", e)
+			summary.UnsignedSnapshots = append(summary.UnsignedSnapshots, e.ID.String())
 		default:
 			summary.NumErrors++
 			printer.E("error: %v\n", err)
@@ -408,6 +429,20 @@ func runCheck(ctx context.Context, opts CheckOptions, gopts global.Options, args
 		}
 	}
 
+	if opts.RepairFromParity && len(salvagePacks) > 0 {
+		restored, err := repository.RepairPacksFromParity(ctx, repo, salvagePacks, printer)
+		if err != nil {
+			return summary, err
+		}
+		for id := range restored {
+			summary.RestoredPacks = append(summary.RestoredPacks, id.String())
+		}
+		salvagePacks = salvagePacks.Sub(restored)
+		if len(restored) > 0 {
+			printer.E("\n%d damaged pack files were restored from parity data. Run `restic check` again to verify the repository.\n", len(restored))
+		}
+	}
+
 	if len(salvagePacks) > 0 {
 		printer.E("\nThe repository contains damaged pack files. These damaged files must be removed to repair the repository. This can be done using the following commands. Please read the troubleshooting guide at https://restic.readthedocs.io/en/stable/077_troubleshooting.html first.\n\n")
 		for id := range salvagePacks {
@@ -423,12 +458,16 @@ func runCheck(ctx context.Context, opts CheckOptions, gopts global.Options, args
 		printer.E("Damaged snapshot files can be caused by backend problems, hardware problems or bugs in restic. Please open an issue at https://github.com/restic/restic/issues/new/choose for further troubleshooting!\n")
 	}
 
+	if len(summary.UnsignedSnapshots) > 0 {
+		printer.E("\nThe repository contains %d snapshots without a valid signature. These snapshots may have been created or modified by an untrusted host.\n", len(summary.UnsignedSnapshots))
+	}
+
 	if ctx.Err() != nil {
 		return summary, ctx.Err()
 	}
 
 	if errorsFound {
-		if len(salvagePacks) == 0 && len(brokenSnapshots) == 0 {
+		if len(salvagePacks) == 0 && len(brokenSnapshots) == 0 && len(summary.UnsignedSnapshots) == 0 {
 			printer.E("\nThe repository is damaged and must be repaired. Please follow the troubleshooting guide at https://restic.readthedocs.io/en/stable/077_troubleshooting.html .\n\n")
 		}
 		return summary, errors.Fatal("repository contains errors")
@@ -540,11 +579,13 @@ func selectRandomPacksByFileSize(allPacks map[restic.ID]int64, subsetSize int64,
 }
 
 type checkSummary struct {
-	MessageType     string   `json:"message_type"` // "summary"
-	NumErrors       int      `json:"num_errors"`
-	BrokenPacks     []string `json:"broken_packs"`         // run "restic repair packs ID..." and "restic repair snapshots --forget" to remove damaged files
-	HintRepairIndex bool     `json:"suggest_repair_index"` // run "restic repair index"
-	HintPrune       bool     `json:"suggest_prune"`        // run "restic prune"
+	MessageType       string   `json:"message_type"` // "summary"
+	NumErrors         int      `json:"num_errors"`
+	BrokenPacks       []string `json:"broken_packs"`                 // run "restic repair packs ID..." and "restic repair snapshots --forget" to remove damaged files
+	RestoredPacks     []string `json:"restored_packs,omitempty"`     // damaged pack files restored from parity data
+	UnsignedSnapshots []string `json:"unsigned_snapshots,omitempty"` // snapshots without a valid signature
+	HintRepairIndex   bool     `json:"suggest_repair_index"`         // run "restic repair index"
+	HintPrune         bool     `json:"suggest_prune"`                // run "restic prune"
 }
 
 type checkError struct {
@@ -2,19 +2,22 @@ package main
 
 import (
 	"context"
+	"crypto/ed25519"
 	"fmt"
 	"iter"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/restic/restic/internal/data"
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/global"
+	"github.com/restic/restic/internal/rechunker"
 	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
 	"github.com/restic/restic/internal/ui"
-	"github.com/restic/restic/internal/ui/progress"
+	copyui "github.com/restic/restic/internal/ui/copy"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
@@ -38,7 +41,14 @@ between the files copied and files already stored in the destination repository.
 This means that copied files, which existed in both the source and destination
 repository, /may occupy up to twice their space/ in the destination repository.
 This can be mitigated by the "--copy-chunker-params" option when initializing a
-new destination repository using the "init" command.
+new destination repository using the "init" command. For an existing
+destination repository, the "--rechunk" option splits the file contents again
+using the chunker parameters of the destination repository. This requires
+reading all file contents from the source repository.
+
+While copying, restic periodically saves its progress to the destination
+repository. If copy is interrupted, the next copy from the same source
+repository skips the trees and data which were already copied.
 
 EXIT STATUS
 ===========
@@ -65,19 +75,24 @@ Exit status is 12 if the password is incorrect.
 type CopyOptions struct {
 	global.SecondaryRepoOptions
 	data.SnapshotFilter
+	SigningOptions
+	Rechunk bool
 }
 
 func (opts *CopyOptions) AddFlags(f *pflag.FlagSet) {
 	opts.SecondaryRepoOptions.AddFlags(f, "destination", "to copy snapshots from")
 	initMultiSnapshotFilter(f, &opts.SnapshotFilter, true)
+	f.BoolVar(&opts.Rechunk, "rechunk", false, "split file contents using the chunker parameters of the destination repository")
+	opts.SigningOptions.AddFlags(f)
 }
 
 var errSentinelEndIteration = errors.New("end iteration")
 
-// collectAllSnapshots: select all snapshot trees to be copied
+// collectAllSnapshots: select all snapshot trees to be copied, except for the
+// snapshots in skip
 func collectAllSnapshots(ctx context.Context, opts CopyOptions,
 	srcSnapshotLister restic.Lister, srcRepo restic.Repository,
-	dstSnapshotByOriginal map[restic.ID][]*data.Snapshot, args []string, printer restic.Printer,
+	dstSnapshotByOriginal map[restic.ID][]*data.Snapshot, args []string, skip restic.IDSet, progress *copyui.Progress,
 ) iter.Seq2[*data.Snapshot, error] {
 	return func(yield func(*data.Snapshot, error) bool) {
 		err := opts.SnapshotFilter.FindAll(ctx, srcSnapshotLister, srcRepo, args, func(_ string, sn *data.Snapshot, err error) error {
@@ -88,6 +103,9 @@ func collectAllSnapshots(ctx context.Context, opts CopyOptions,
 				}
 				return nil
 			}
+			if skip.Has(*sn.ID()) {
+				return nil
+			}
 			srcOriginal := *sn.ID()
 			if sn.Original != nil {
 				srcOriginal = *sn.Original
@@ -96,8 +114,7 @@ func collectAllSnapshots(ctx context.Context, opts CopyOptions,
 				isCopy := false
 				for _, originalSn := range originalSns {
 					if similarSnapshots(originalSn, sn) {
-						printer.V("\n%v", sn)
-						printer.V("skipping source snapshot %s, was already copied to snapshot %s", sn.ID().Str(), originalSn.ID().Str())
+						progress.SkipSnapshot(sn, originalSn)
 						isCopy = true
 						break
 					}
@@ -118,7 +135,13 @@ func collectAllSnapshots(ctx context.Context, opts CopyOptions,
 }
 
 func runCopy(ctx context.Context, opts CopyOptions, gopts global.Options, args []string, term ui.Terminal) error {
-	printer := progress.NewTerminalPrinter(false, gopts.Verbosity, term)
+	var progressPrinter copyui.ProgressPrinter
+	if gopts.JSON {
+		progressPrinter = copyui.NewJSONProgress(term, gopts.Verbosity)
+	} else {
+		progressPrinter = copyui.NewTextProgress(term, gopts.Verbosity)
+	}
+	var printer restic.Printer = progressPrinter
 	secondaryGopts, isFromRepo, err := opts.SecondaryRepoOptions.FillGlobalOpts(ctx, gopts, "destination")
 	if err != nil {
 		return err
@@ -158,9 +181,36 @@ func runCopy(ctx context.Context, opts CopyOptions, gopts global.Options, args [
 	if err := dstRepo.LoadIndex(ctx, printer); err != nil {
 		return err
 	}
+	// packs marked for deletion by a non-exclusive prune must not be used for deduplication
+	if err := dstRepo.ExcludePendingDeletions(ctx); err != nil {
+		return err
+	}
+
+	_, err = copySnapshots(ctx, opts, srcRepo, dstRepo, srcSnapshotLister, dstSnapshotLister, args, nil, progressPrinter, gopts, term)
+	return err
+}
+
+// copySnapshots copies the snapshots selected by opts and args from srcRepo
+// to dstRepo, except for the snapshots in skip. The indexes of both
+// repositories must already be loaded. Returns the snapshots which were copied.
+func copySnapshots(ctx context.Context, opts CopyOptions, srcRepo *repository.Repository, dstRepo restic.Repository,
+	srcSnapshotLister restic.Lister, dstSnapshotLister restic.Lister, args []string, skip restic.IDSet,
+	progressPrinter copyui.ProgressPrinter, gopts global.Options, term ui.Terminal) ([]*data.Snapshot, error) {
+
+	var printer restic.Printer = progressPrinter
+
+	// only rechunked snapshots are modified and must be signed again
+	var signingKey ed25519.PrivateKey
+	if opts.Rechunk {
+		var err error
+		signingKey, err = opts.SigningOptions.load()
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	dstSnapshotByOriginal := make(map[restic.ID][]*data.Snapshot)
-	err = opts.SnapshotFilter.FindAll(ctx, dstSnapshotLister, dstRepo, nil, func(_ string, sn *data.Snapshot, err error) error {
+	err := opts.SnapshotFilter.FindAll(ctx, dstSnapshotLister, dstRepo, nil, func(_ string, sn *data.Snapshot, err error) error {
 		if err != nil {
 			return err
 		}
@@ -172,21 +222,47 @@ func runCopy(ctx context.Context, opts CopyOptions, gopts global.Options, args [
 		return nil
 	})
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	selectedSnapshots := collectAllSnapshots(ctx, opts, srcSnapshotLister, srcRepo, dstSnapshotByOriginal, args, printer)
+	resume, err := loadCopyResumeTracker(ctx, dstRepo, srcRepo.Config().ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(resume.completedTrees()) > 0 {
+		printer.P("resuming interrupted copy from %v", resume.resumed.Local().Format(global.TimeFormat))
+	}
 
-	if err := copyTreeBatched(ctx, srcRepo, dstRepo, selectedSnapshots, printer); err != nil {
-		return err
+	progress := copyui.NewProgress(progressPrinter, gopts.Quiet, gopts.JSON, term.CanUpdateStatus())
+	defer progress.Finish()
+
+	selectedSnapshots := collectAllSnapshots(ctx, opts, srcSnapshotLister, srcRepo, dstSnapshotByOriginal, args, skip, progress)
+
+	var rc *rechunker.Rechunker
+	if opts.Rechunk {
+		if srcRepo.Config().ChunkerPolynomial == dstRepo.Config().ChunkerPolynomial {
+			printer.P("source and destination repository use the same chunker parameters, copying without rechunking")
+		} else {
+			rc = rechunker.New(dstRepo.ChunkerFactory())
+		}
+	}
+
+	copied, err := copyTreeBatched(ctx, srcRepo, dstRepo, selectedSnapshots, resume, rc, signingKey, progress, printer)
+	if err != nil {
+		return nil, err
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
 	}
 
-	return ctx.Err()
+	// all snapshots were copied, the progress is no longer needed
+	resume.removeObsolete(ctx)
+	return copied, nil
 }
 
 func similarSnapshots(sna *data.Snapshot, snb *data.Snapshot) bool {
 	// everything except Parent and Original must match
-	if !sna.Time.Equal(snb.Time) || !sna.Tree.Equal(*snb.Tree) || sna.Hostname != snb.Hostname ||
+	if !sna.Time.Equal(snb.Time) || !snapshotTree(sna).Equal(snapshotTree(snb)) || sna.Hostname != snb.Hostname ||
 		sna.Username != snb.Username || sna.UID != snb.UID || sna.GID != snb.GID ||
 		len(sna.Paths) != len(snb.Paths) || len(sna.Excludes) != len(snb.Excludes) ||
 		len(sna.Tags) != len(snb.Tags) {
@@ -203,13 +279,30 @@ func similarSnapshots(sna *data.Snapshot, snb *data.Snapshot) bool {
 	return true
 }
 
+// snapshotTree returns the tree of the snapshot before its file contents were
+// split again by copy.
+func snapshotTree(sn *data.Snapshot) restic.ID {
+	if sn.OriginalTree != nil {
+		return *sn.OriginalTree
+	}
+	return *sn.Tree
+}
+
 // copyTreeBatched copies multiple snapshots in one go. Snapshots are written after
-// data equivalent to at least 10 packfiles was written.
+// data equivalent to at least 10 packfiles was written. The tree of each snapshot
+// is saved to the resume state once it has been copied. If rechunker is not nil, the
+// file contents are split again instead of copying the blobs and the modified
+// snapshots are signed using signingKey. Returns the copied snapshots.
 func copyTreeBatched(ctx context.Context, srcRepo *repository.Repository, dstRepo restic.Repository,
-	selectedSnapshots iter.Seq2[*data.Snapshot, error], printer restic.Printer) error {
+	selectedSnapshots iter.Seq2[*data.Snapshot, error], resume *copyResumeTracker, rechunker *rechunker.Rechunker,
+	signingKey ed25519.PrivateKey, progress *copyui.Progress, printer restic.Printer) ([]*data.Snapshot, error) {
 
 	// remember already processed trees across all snapshots
 	visitedTrees := srcRepo.NewAssociatedBlobSet()
+	// trees copied by an interrupted copy do not have to be processed again
+	for _, id := range resume.completedTrees() {
+		visitedTrees.Insert(restic.BlobHandle{ID: id, Type: restic.TreeBlob})
+	}
 
 	targetSize := uint64(dstRepo.PackSize()) * 100
 	minDuration := 1 * time.Minute
@@ -218,6 +311,7 @@ func copyTreeBatched(ctx context.Context, srcRepo *repository.Repository, dstRep
 	next, stop := iter.Pull2(selectedSnapshots)
 	defer stop()
 
+	var copied []*data.Snapshot
 	for {
 		var batch []*data.Snapshot
 		batchSize := uint64(0)
@@ -225,6 +319,11 @@ func copyTreeBatched(ctx context.Context, srcRepo *repository.Repository, dstRep
 
 		// call WithBlobUploader() once and then loop over all selectedSnapshots
 		err := dstRepo.WithBlobUploader(ctx, func(ctx context.Context, uploader restic.BlobSaverWithAsync) error {
+			// periodically save the index such that the copied data can be
+			// used if copy is interrupted
+			stop := flushIndexPeriodically(ctx, dstRepo, copyFlushInterval, printer)
+			defer stop()
+
 			for batchSize < targetSize || time.Since(startTime) < minDuration {
 				sn, err, ok := next()
 				if err != nil {
@@ -236,9 +335,17 @@ func copyTreeBatched(ctx context.Context, srcRepo *repository.Repository, dstRep
 
 				batch = append(batch, sn)
 
-				printer.P("\n%v", sn)
-				printer.P("  copy started, this may take a while...")
-				sizeBlobs, err := copyTree(ctx, srcRepo, dstRepo, visitedTrees, *sn.Tree, printer, uploader)
+				progress.StartSnapshot(sn)
+				uploader := &progressUploader{BlobSaverWithAsync: uploader, progress: progress}
+				var sizeBlobs uint64
+				if rechunker != nil {
+					sizeBlobs, err = copyRechunkedTree(ctx, srcRepo, rechunker, sn, uploader, signingKey, printer)
+				} else {
+					sizeBlobs, err = copyTree(ctx, srcRepo, dstRepo, visitedTrees, *sn.Tree, progress, printer, uploader)
+					if err == nil {
+						err = resume.complete(ctx, *sn.Tree)
+					}
+				}
 				if err != nil {
 					return err
 				}
@@ -249,7 +356,7 @@ func copyTreeBatched(ctx context.Context, srcRepo *repository.Repository, dstRep
 			return nil
 		})
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		// if no snapshots were processed in this batch, we're done
@@ -263,18 +370,19 @@ func copyTreeBatched(ctx context.Context, srcRepo *repository.Repository, dstRep
 		}
 		// save all the snapshots
 		for _, sn := range batch {
-			err := copySaveSnapshot(ctx, sn, dstRepo, printer)
+			err := copySaveSnapshot(ctx, sn, dstRepo, progress)
 			if err != nil {
-				return err
+				return nil, err
 			}
 		}
+		copied = append(copied, batch...)
 	}
 
-	return nil
+	return copied, nil
 }
 
 func copyTree(ctx context.Context, srcRepo *repository.Repository, dstRepo restic.Repository,
-	visitedTrees restic.AssociatedBlobSet, rootTreeID restic.ID, printer restic.Printer, uploader restic.BlobSaverWithAsync) (uint64, error) {
+	visitedTrees restic.AssociatedBlobSet, rootTreeID restic.ID, progress *copyui.Progress, printer restic.Printer, uploader restic.BlobSaverWithAsync) (uint64, error) {
 
 	copyBlobs := srcRepo.NewAssociatedBlobSet()
 	packList := restic.NewIDSet()
@@ -321,7 +429,7 @@ func copyTree(ctx context.Context, srcRepo *repository.Repository, dstRepo resti
 		return 0, err
 	}
 
-	sizeBlobs := copyStats(srcRepo, copyBlobs, packList, printer)
+	sizeBlobs := copyStats(srcRepo, copyBlobs, packList, progress, printer)
 	bar := printer.NewCounter("packs copied")
 	err = repository.CopyBlobs(ctx, srcRepo, dstRepo, uploader, packList, copyBlobs, bar, printer.P)
 	if err != nil {
@@ -330,25 +438,72 @@ func copyTree(ctx context.Context, srcRepo *repository.Repository, dstRepo resti
 	return sizeBlobs, nil
 }
 
+// copyRechunkedTree saves the tree of sn with all file contents split again by
+// rechunker and replaces the tree of sn. The modified snapshot is signed using
+// signingKey, without a signing key its signature is removed. Returns the size
+// of the newly stored blobs.
+func copyRechunkedTree(ctx context.Context, srcRepo *repository.Repository, rechunker *rechunker.Rechunker,
+	sn *data.Snapshot, uploader *progressUploader, signingKey ed25519.PrivateKey, printer restic.Printer) (uint64, error) {
+
+	added := uploader.added.Load()
+	treeID, err := rechunker.RewriteTree(ctx, srcRepo, uploader, *sn.Tree)
+	if err != nil {
+		return 0, err
+	}
+
+	if sn.OriginalTree == nil {
+		sn.OriginalTree = sn.Tree
+	}
+	sn.Tree = &treeID
+	// the signature does not cover the new tree
+	if sn.Signature != nil && signingKey == nil {
+		printer.E("Warning: removing the signature of rechunked snapshot %v, use --signing-key-file to sign it again", sn.ID().Str())
+	}
+	if err := resignSnapshot(sn, signingKey); err != nil {
+		return 0, err
+	}
+	return uploader.added.Load() - added, nil
+}
+
 // copyStats: print statistics for the blobs to be copied
-func copyStats(srcRepo restic.Repository, copyBlobs restic.AssociatedBlobSet, packList restic.IDSet, printer restic.Printer) uint64 {
+func copyStats(srcRepo restic.Repository, copyBlobs restic.AssociatedBlobSet, packList restic.IDSet, progress *copyui.Progress, printer restic.Printer) uint64 {
 	// count and size
 	countBlobs := 0
 	sizeBlobs := uint64(0)
+	plaintextSize := uint64(0)
 	for blob := range copyBlobs.Keys() {
 		for _, pb := range srcRepo.LookupBlob(blob) {
 			countBlobs++
 			sizeBlobs += uint64(pb.CiphertextLength())
+			plaintextSize += uint64(pb.PlaintextLength())
 			break
 		}
 	}
 
 	printer.V("  copy %d blobs with disk size %s in %d packfiles\n",
 		countBlobs, ui.FormatBytes(uint64(sizeBlobs)), len(packList))
+	progress.AddBlobs(uint64(countBlobs), plaintextSize)
 	return sizeBlobs
 }
 
-func copySaveSnapshot(ctx context.Context, sn *data.Snapshot, dstRepo restic.Repository, printer restic.Printer) error {
+// progressUploader reports the saved blobs to the copy progress.
+type progressUploader struct {
+	restic.BlobSaverWithAsync
+	progress *copyui.Progress
+	// added is the size of the newly stored blobs
+	added atomic.Uint64
+}
+
+func (u *progressUploader) SaveBlob(ctx context.Context, tpe restic.BlobType, buf []byte, id restic.ID, storeDuplicate bool) (restic.ID, bool, int, error) {
+	newID, known, size, err := u.BlobSaverWithAsync.SaveBlob(ctx, tpe, buf, id, storeDuplicate)
+	if err == nil {
+		u.progress.CompleteBlob(uint64(len(buf)))
+		u.added.Add(uint64(size))
+	}
+	return newID, known, size, err
+}
+
+func copySaveSnapshot(ctx context.Context, sn *data.Snapshot, dstRepo restic.Repository, progress *copyui.Progress) error {
 	sn.Parent = nil // Parent does not have relevance in the new repo.
 	// Use Original as a persistent snapshot ID
 	if sn.Original == nil {
@@ -358,6 +513,6 @@ func copySaveSnapshot(ctx context.Context, sn *data.Snapshot, dstRepo restic.Rep
 	if err != nil {
 		return err
 	}
-	printer.P("snapshot %s saved, copied from source snapshot %s", newID.Str(), sn.ID().Str())
+	progress.CompleteSnapshot(sn, newID)
 	return nil
 }
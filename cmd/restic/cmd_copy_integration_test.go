@@ -1,10 +1,14 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"encoding/json"
 	"fmt"
+	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/restic/restic/internal/global"
 	"github.com/restic/restic/internal/restic"
@@ -12,7 +16,7 @@ import (
 	"github.com/restic/restic/internal/ui/progress"
 )
 
-func testRunCopy(t testing.TB, srcGopts global.Options, dstGopts global.Options) {
+func testCopyOptions(srcGopts global.Options, dstGopts global.Options) (CopyOptions, global.Options) {
 	gopts := srcGopts
 	gopts.Repo = dstGopts.Repo
 	gopts.Password = dstGopts.Password
@@ -24,12 +28,35 @@ func testRunCopy(t testing.TB, srcGopts global.Options, dstGopts global.Options)
 			InsecureNoPassword: srcGopts.InsecureNoPassword,
 		},
 	}
+	return copyOpts, gopts
+}
 
+func testRunCopy(t testing.TB, srcGopts global.Options, dstGopts global.Options) {
+	copyOpts, gopts := testCopyOptions(srcGopts, dstGopts)
 	rtest.OK(t, withTermStatus(t, gopts, func(ctx context.Context, gopts global.Options) error {
 		return runCopy(context.TODO(), copyOpts, gopts, nil, gopts.Term)
 	}))
 }
 
+func testRunCopyJSON(t testing.TB, srcGopts global.Options, dstGopts global.Options) []map[string]interface{} {
+	copyOpts, gopts := testCopyOptions(srcGopts, dstGopts)
+	gopts.JSON = true
+	buf, err := withCaptureStdout(t, gopts, func(ctx context.Context, gopts global.Options) error {
+		return runCopy(ctx, copyOpts, gopts, nil, gopts.Term)
+	})
+	rtest.OK(t, err)
+
+	var messages []map[string]interface{}
+	sc := bufio.NewScanner(buf)
+	for sc.Scan() {
+		var msg map[string]interface{}
+		rtest.OK(t, json.Unmarshal(sc.Bytes(), &msg))
+		messages = append(messages, msg)
+	}
+	rtest.OK(t, sc.Err())
+	return messages
+}
+
 func TestCopy(t *testing.T) {
 	env, cleanup := withTestEnvironment(t)
 	defer cleanup()
@@ -195,3 +222,219 @@ func TestCopyToEmptyPassword(t *testing.T) {
 	testListSnapshots(t, env2.gopts, 1)
 	testRunCheck(t, env2.gopts)
 }
+
+func TestCopyJSON(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	env2, cleanup2 := withTestEnvironment(t)
+	defer cleanup2()
+
+	testSetupBackupData(t, env)
+	opts := BackupOptions{}
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9")}, opts, env.gopts)
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9", "2")}, opts, env.gopts)
+	testRunInit(t, env2.gopts)
+
+	actions := func(messages []map[string]interface{}) (map[string]int, map[string]interface{}) {
+		counts := make(map[string]int)
+		var summary map[string]interface{}
+		for _, msg := range messages {
+			switch msg["message_type"] {
+			case "snapshot":
+				counts[msg["action"].(string)]++
+			case "summary":
+				summary = msg
+			}
+		}
+		return counts, summary
+	}
+
+	counts, summary := actions(testRunCopyJSON(t, env.gopts, env2.gopts))
+	rtest.Equals(t, map[string]int{"started": 2, "copied": 2}, counts)
+	rtest.Assert(t, summary != nil, "missing summary message")
+	rtest.Equals(t, interface{}(float64(2)), summary["snapshots_copied"])
+	rtest.Assert(t, summary["blobs_copied"].(float64) > 0, "expected copied blobs, got %v", summary["blobs_copied"])
+
+	// the second copy only skips snapshots
+	counts, summary = actions(testRunCopyJSON(t, env.gopts, env2.gopts))
+	rtest.Equals(t, map[string]int{"skipped": 2}, counts)
+	rtest.Equals(t, interface{}(float64(0)), summary["snapshots_copied"])
+	rtest.Equals(t, interface{}(float64(2)), summary["snapshots_skipped"])
+}
+
+func TestCopyResume(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	env2, cleanup2 := withTestEnvironment(t)
+	defer cleanup2()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9")}, BackupOptions{}, env.gopts)
+	testRunInit(t, env2.gopts)
+	testRunCopy(t, env.gopts, env2.gopts)
+	// a completed copy leaves no state behind
+	rtest.Equals(t, 0, len(testRunList(t, env2.gopts, "copy")))
+
+	sn := testLoadSnapshot(t, env.gopts, testListSnapshots(t, env.gopts, 1)[0])
+	var sourceID string
+	rtest.OK(t, withTermStatus(t, env.gopts, func(ctx context.Context, gopts global.Options) error {
+		printer := progress.NewTerminalPrinter(gopts.JSON, gopts.Verbosity, gopts.Term)
+		_, repo, unlock, err := openWithReadLock(ctx, gopts, false, printer)
+		rtest.OK(t, err)
+		defer unlock()
+		sourceID = repo.Config().ID
+		return nil
+	}))
+
+	withResumeTracker := func(source string, fn func(ctx context.Context, repo restic.Repository, tracker *copyResumeTracker)) {
+		rtest.OK(t, withTermStatus(t, env2.gopts, func(ctx context.Context, gopts global.Options) error {
+			printer := progress.NewTerminalPrinter(gopts.JSON, gopts.Verbosity, gopts.Term)
+			_, repo, unlock, err := openWithAppendLock(ctx, gopts, false, printer)
+			rtest.OK(t, err)
+			defer unlock()
+			rtest.OK(t, repo.LoadIndex(ctx, printer))
+
+			tracker, err := loadCopyResumeTracker(ctx, repo, source)
+			rtest.OK(t, err)
+			fn(ctx, repo, tracker)
+			return nil
+		}))
+	}
+
+	// simulate an interrupted copy which completed the tree of the snapshot
+	withResumeTracker(sourceID, func(ctx context.Context, repo restic.Repository, tracker *copyResumeTracker) {
+		rtest.Equals(t, 0, len(tracker.completedTrees()))
+
+		rtest.OK(t, tracker.complete(ctx, *sn.Tree))
+		// the tree of a pruned snapshot is not resumed
+		rtest.OK(t, tracker.complete(ctx, restic.NewRandomID()))
+	})
+	withResumeTracker(sourceID, func(_ context.Context, _ restic.Repository, tracker *copyResumeTracker) {
+		rtest.Equals(t, restic.IDs{*sn.Tree}, tracker.completedTrees())
+	})
+	// states of copies from other repositories are ignored
+	withResumeTracker("other", func(_ context.Context, _ restic.Repository, tracker *copyResumeTracker) {
+		rtest.Equals(t, 0, len(tracker.completedTrees()))
+	})
+	rtest.Equals(t, 1, len(testRunList(t, env2.gopts, "copy")))
+
+	// the next copy resumes and removes the state
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9", "2")}, BackupOptions{}, env.gopts)
+	testRunCopy(t, env.gopts, env2.gopts)
+	rtest.Equals(t, 0, len(testRunList(t, env2.gopts, "copy")))
+	testListSnapshots(t, env2.gopts, 2)
+	testRunCheck(t, env2.gopts)
+}
+
+func TestCopyRechunk(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	env2, cleanup2 := withTestEnvironment(t)
+	defer cleanup2()
+
+	// files must be larger than the minimum chunk size to be split differently
+	backupDir := filepath.Join(env.base, "rechunk")
+	rtest.OK(t, os.MkdirAll(backupDir, 0o700))
+	rtest.OK(t, os.WriteFile(filepath.Join(backupDir, "file"), rtest.Random(23, 8*1024*1024), 0o600))
+
+	testRunInit(t, env.gopts)
+	testRunBackup(t, "", []string{backupDir}, BackupOptions{}, env.gopts)
+	testRunInit(t, env2.gopts)
+
+	copyOpts, gopts := testCopyOptions(env.gopts, env2.gopts)
+	copyOpts.Rechunk = true
+	runRechunk := func() {
+		rtest.OK(t, withTermStatus(t, gopts, func(ctx context.Context, gopts global.Options) error {
+			return runCopy(ctx, copyOpts, gopts, nil, gopts.Term)
+		}))
+	}
+	runRechunk()
+	testRunCheck(t, env2.gopts)
+
+	sn := testLoadSnapshot(t, env.gopts, testListSnapshots(t, env.gopts, 1)[0])
+	copied := testLoadSnapshot(t, env2.gopts, testListSnapshots(t, env2.gopts, 1)[0])
+	rtest.Assert(t, !sn.Tree.Equal(*copied.Tree), "expected a rechunked tree")
+	rtest.Equals(t, sn.Tree, copied.OriginalTree)
+	rtest.Equals(t, sn.ID(), copied.Original)
+
+	// the rechunked snapshot is recognized as a copy
+	runRechunk()
+	testListSnapshots(t, env2.gopts, 1)
+
+	// a backup of the same data deduplicates against the rechunked data
+	_, dataPacks, _ := testPackAndBlobCounts(t, env2.gopts)
+	testRunBackup(t, "", []string{backupDir}, BackupOptions{}, env2.gopts)
+	_, dataPacksAfterBackup, _ := testPackAndBlobCounts(t, env2.gopts)
+	rtest.Equals(t, dataPacks, dataPacksAfterBackup)
+	testListSnapshots(t, env2.gopts, 2)
+}
+
+func TestCopyRechunkSigned(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	env2, cleanup2 := withTestEnvironment(t)
+	defer cleanup2()
+
+	keyFile := filepath.Join(env.base, "signing.key")
+	trustedKeysFile := filepath.Join(env.base, "trusted_keys")
+	trustedLine := testRunKeyGenerateSigningKey(t, env.gopts, "testhost", keyFile)
+	rtest.OK(t, os.WriteFile(trustedKeysFile, []byte(trustedLine), 0o600))
+	signing := SigningOptions{SigningKeyFile: keyFile}
+
+	backupDir := filepath.Join(env.base, "rechunk")
+	rtest.OK(t, os.MkdirAll(backupDir, 0o700))
+	rtest.OK(t, os.WriteFile(filepath.Join(backupDir, "file"), rtest.Random(23, 8*1024*1024), 0o600))
+
+	testRunInit(t, env.gopts)
+	testRunBackup(t, "", []string{backupDir}, BackupOptions{Host: "testhost", SigningOptions: signing}, env.gopts)
+	testRunInit(t, env2.gopts)
+
+	copyOpts, gopts := testCopyOptions(env.gopts, env2.gopts)
+	copyOpts.Rechunk = true
+	runRechunk := func() {
+		rtest.OK(t, withTermStatus(t, gopts, func(ctx context.Context, gopts global.Options) error {
+			return runCopy(ctx, copyOpts, gopts, nil, gopts.Term)
+		}))
+	}
+
+	// without signing key, the signature no longer matching the tree is removed
+	runRechunk()
+	id := testListSnapshots(t, env2.gopts, 1)[0]
+	rtest.Assert(t, testLoadSnapshot(t, env2.gopts, id).Signature == nil, "rechunked snapshot is still signed")
+	testRunForget(t, env2.gopts, ForgetOptions{}, id.String())
+
+	// with signing key, the rechunked snapshot is signed again
+	copyOpts.SigningOptions = signing
+	runRechunk()
+	verify := SignatureOptions{TrustedKeysFile: trustedKeysFile}
+	_, err := testRunCheckOutputWithOpts(t, env2.gopts, CheckOptions{SignatureOptions: verify}, nil)
+	rtest.OK(t, err)
+}
+
+func TestCopyPendingDeletion(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	env2, cleanup2 := withTestEnvironment(t)
+	defer cleanup2()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9")}, BackupOptions{}, env.gopts)
+
+	testRunInit(t, env2.gopts)
+	testRunCopy(t, env.gopts, env2.gopts)
+	copied := testListSnapshots(t, env2.gopts, 1)[0]
+	testRunForget(t, env2.gopts, ForgetOptions{}, copied.String())
+
+	// all packs of the destination are now marked for deletion
+	testRunPrune(t, env2.gopts, PruneOptions{MaxUnused: "5%", NonExclusive: true, GracePeriod: time.Hour})
+	marked := listPacks(env2.gopts, t)
+
+	// copying the snapshot again must not deduplicate against the marked packs
+	testRunCopy(t, env.gopts, env2.gopts)
+	testListSnapshots(t, env2.gopts, 1)
+	rtest.Assert(t, len(listPacks(env2.gopts, t).Sub(marked)) > 0, "copy did not store blobs of packs pending deletion again")
+
+	testRunPrune(t, env2.gopts, PruneOptions{MaxUnused: "5%", NonExclusive: true, GracePeriod: 0})
+	rtest.Equals(t, 0, len(marked.Intersect(listPacks(env2.gopts, t))), "marked packs were not deleted")
+	testRunCheck(t, env2.gopts)
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/data"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/restic"
+)
+
+// copyFlushInterval is the interval at which the index is saved while a
+// snapshot is being copied, such that an interrupted copy can reuse the blobs
+// copied so far.
+const copyFlushInterval = 5 * time.Minute
+
+// copyResumeState records the progress of a copy. It lists the root trees of
+// the source repository which were copied to the destination repository along
+// with all subtrees and data blobs. The state is stored in the destination
+// repository and removed once the copy has completed.
+type copyResumeState struct {
+	Time   time.Time  `json:"time"`
+	Source string     `json:"source"`
+	Trees  restic.IDs `json:"trees"`
+}
+
+// copyResumeTracker loads the states of interrupted copies from the same
+// source repository and saves the progress of the running copy whenever the
+// tree of a snapshot has been copied.
+type copyResumeTracker struct {
+	repo   restic.Repository
+	source string
+
+	// resumed is the time of the most recent loaded state
+	resumed time.Time
+	trees   restic.IDs
+	// files contains the states which are replaced by the next save
+	files restic.IDs
+}
+
+// loadCopyResumeTracker loads the states of interrupted copies from source to
+// repo. Must be called after loading the index of repo.
+func loadCopyResumeTracker(ctx context.Context, repo restic.Repository, source string) (*copyResumeTracker, error) {
+	t := &copyResumeTracker{
+		repo:   repo,
+		source: source,
+	}
+	err := repo.List(ctx, restic.CopyFile, func(id restic.ID, _ int64) error {
+		var state copyResumeState
+		err := restic.LoadJSONUnpacked(ctx, repo, restic.CopyFile, id, &state)
+		if err != nil {
+			// an unreadable state only means that trees are copied again
+			debug.Log("unable to load copy state %v: %v", id.Str(), err)
+			return nil
+		}
+		if state.Source != source {
+			return nil
+		}
+		t.files = append(t.files, id)
+		if state.Time.After(t.resumed) {
+			t.resumed = state.Time
+		}
+		t.trees = append(t.trees, state.Trees...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list copy states: %w", err)
+	}
+
+	// the blobs of a tree might not have been stored before the copy was
+	// interrupted or might have been removed by prune in the meantime
+	verified := restic.NewIDSet()
+	var trees restic.IDs
+	for _, tree := range t.trees {
+		if !verified.Has(tree) && copiedTreeComplete(ctx, repo, tree, verified) {
+			trees = append(trees, tree)
+		}
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	t.trees = trees
+	return t, nil
+}
+
+// copiedTreeComplete returns whether tree and all its subtrees and data blobs
+// are contained in the index of repo. The trees in verified are known to be
+// complete, the subtrees of tree are added to it.
+func copiedTreeComplete(ctx context.Context, repo restic.Repository, tree restic.ID, verified restic.IDSet) bool {
+	visited := restic.NewIDSet()
+	err := data.StreamTrees(ctx, repo, restic.IDs{tree}, restic.NoopCounter, func(treeID restic.ID) bool {
+		skip := verified.Has(treeID) || visited.Has(treeID)
+		visited.Insert(treeID)
+		return skip
+	}, func(treeID restic.ID, err error, nodes data.TreeNodeIterator) error {
+		if err != nil {
+			return err
+		}
+		for item := range nodes {
+			if item.Error != nil {
+				return item.Error
+			}
+			for _, blobID := range item.Node.Content {
+				if _, ok := repo.LookupBlobSize(restic.BlobHandle{ID: blobID, Type: restic.DataBlob}); !ok {
+					return fmt.Errorf("tree %v references missing blob %v", treeID.Str(), blobID.Str())
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		debug.Log("not resuming copied tree %v: %v", tree.Str(), err)
+		return false
+	}
+	verified.Merge(visited)
+	return true
+}
+
+// completedTrees returns the trees copied by interrupted copies.
+func (t *copyResumeTracker) completedTrees() restic.IDs {
+	return t.trees
+}
+
+// complete records that tree has been copied along with all subtrees and data
+// blobs and saves the completed trees as new state, which replaces the previous
+// states. Trees whose blobs are not yet stored in the destination repository
+// are ignored when resuming, as blobs are still uploaded in the background.
+func (t *copyResumeTracker) complete(ctx context.Context, tree restic.ID) error {
+	t.trees = append(t.trees, tree)
+
+	// save the index entries of the pack files uploaded so far
+	if err := t.repo.FlushIndex(ctx); err != nil {
+		return fmt.Errorf("failed to save index: %w", err)
+	}
+
+	state := &copyResumeState{
+		Time:   time.Now(),
+		Source: t.source,
+		Trees:  t.trees,
+	}
+	id, err := restic.SaveJSONUnpacked(ctx, t.repo, restic.WriteableCopyFile, state)
+	if err != nil {
+		return fmt.Errorf("failed to save copy state: %w", err)
+	}
+	debug.Log("saved copy state %v with %d trees", id.Str(), len(state.Trees))
+
+	t.removeObsolete(ctx)
+	t.files = append(t.files, id)
+	return nil
+}
+
+// removeObsolete removes all states loaded or saved by this copy. Leftover
+// states are harmless, thus errors are ignored.
+func (t *copyResumeTracker) removeObsolete(ctx context.Context) {
+	for _, id := range t.files {
+		if err := t.repo.RemoveUnpacked(ctx, restic.WriteableCopyFile, id); err != nil {
+			debug.Log("unable to remove copy state %v: %v", id.Str(), err)
+		}
+	}
+	t.files = nil
+}
+
+// flushIndexPeriodically saves the index of repo at the given interval until
+// the returned function is called. This allows an interrupted copy to reuse
+// the blobs copied so far, even while a large snapshot is being copied.
+func flushIndexPeriodically(ctx context.Context, repo restic.Repository, interval time.Duration, printer restic.Printer) (stop func()) {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := repo.FlushIndex(ctx); err != nil {
+					printer.E("failed to save index: %v", err)
+				}
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
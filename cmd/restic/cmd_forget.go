@@ -1,11 +1,16 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"os"
+	"slices"
+	"sort"
 	"strconv"
+	"time"
 
 	"github.com/restic/restic/internal/data"
 	"github.com/restic/restic/internal/errors"
@@ -32,6 +37,21 @@ If there are not enough snapshots to keep one for each duration related
 "--keep-{within-,}*" option, the oldest snapshot in the group is kept
 additionally.
 
+The "--keep-calendar" option keeps the first or last snapshot of each calendar
+day, week, month, quarter or year, for example "period=quarter,select=first,within=7y".
+Different policies for snapshots with different tags can be specified in a
+file passed to "--policy-file".
+
+Snapshots for which an expiry time was set using "backup --expire-after" are
+removed once this time has passed, in addition to the snapshots removed by the
+policy. If no policy is specified, only expired snapshots are removed.
+Snapshots on legal hold, see "tag --hold", are never removed.
+
+The "--simulate" option does not remove any snapshots. Instead, it replays the
+policy as if backups continued at the cadence observed in each group until the
+duration given by "--until" has passed, and shows how many snapshots would be
+kept for each reason.
+
 Please note that this command really only deletes the snapshot object in the
 repository, which is a reference to data stored there. In order to remove the
 unreferenced data after "forget" was run successfully, see the "prune" command.
@@ -98,6 +118,15 @@ func (c *ForgetPolicyCount) Type() string {
 	return "n"
 }
 
+// UnmarshalJSON accepts either a number or the string "unlimited".
+func (c *ForgetPolicyCount) UnmarshalJSON(buf []byte) error {
+	var s string
+	if err := json.Unmarshal(buf, &s); err != nil {
+		s = string(buf)
+	}
+	return c.Set(s)
+}
+
 // ForgetOptions collects all options for the forget command.
 type ForgetOptions struct {
 	Last          ForgetPolicyCount
@@ -113,6 +142,8 @@ type ForgetOptions struct {
 	WithinMonthly data.Duration
 	WithinYearly  data.Duration
 	KeepTags      data.TagLists
+	Calendar      data.CalendarRules
+	PolicyFile    string
 
 	UnsafeAllowRemoveAll bool
 
@@ -123,6 +154,10 @@ type ForgetOptions struct {
 	GroupBy data.SnapshotGroupByOptions
 	DryRun  bool
 	Prune   bool
+
+	Simulate     bool
+	Until        data.Duration
+	SimulateStep data.Duration
 }
 
 func (opts *ForgetOptions) AddFlags(f *pflag.FlagSet) {
@@ -139,6 +174,8 @@ func (opts *ForgetOptions) AddFlags(f *pflag.FlagSet) {
 	f.VarP(&opts.WithinMonthly, "keep-within-monthly", "", "keep monthly snapshots that are newer than `duration` (eg. 1y5m7d2h) relative to the latest snapshot")
 	f.VarP(&opts.WithinYearly, "keep-within-yearly", "", "keep yearly snapshots that are newer than `duration` (eg. 1y5m7d2h) relative to the latest snapshot")
 	f.Var(&opts.KeepTags, "keep-tag", "keep snapshots with this `taglist` (can be specified multiple times)")
+	f.Var(&opts.Calendar, "keep-calendar", "keep the first or last snapshot of each calendar period according to `rule` (e.g. period=month,select=last) (can be specified multiple times)")
+	f.StringVar(&opts.PolicyFile, "policy-file", "", "read policies for snapshots with different tags from `file`")
 	f.BoolVar(&opts.UnsafeAllowRemoveAll, "unsafe-allow-remove-all", false, "allow deleting all snapshots of a snapshot group")
 
 	f.StringArrayVar(&opts.Hosts, "hostname", nil, "only consider snapshots with the given `hostname` (can be specified multiple times)")
@@ -152,9 +189,13 @@ func (opts *ForgetOptions) AddFlags(f *pflag.FlagSet) {
 
 	f.BoolVarP(&opts.Compact, "compact", "c", false, "use compact output format")
 	opts.GroupBy = data.SnapshotGroupByOptions{Host: true, Path: true}
-	f.VarP(&opts.GroupBy, "group-by", "g", "`group` snapshots by host, paths and/or tags, separated by comma (disable grouping with '')")
+	f.VarP(&opts.GroupBy, "group-by", "g", "`group` snapshots by host, paths, tags, user, first-path, tag:<prefix>* and/or label:<key>, separated by comma (disable grouping with '')")
 	f.BoolVarP(&opts.DryRun, "dry-run", "n", false, "do not delete anything, just print what would be done")
 	f.BoolVar(&opts.Prune, "prune", false, "automatically run the 'prune' command if snapshots have been removed")
+	f.BoolVar(&opts.Simulate, "simulate", false, "simulate the policy as if backups continued at their observed cadence, do not remove anything")
+	f.Var(&opts.Until, "until", "simulate backups for `duration` (eg. 1y5m7d2h) after the latest snapshot")
+	opts.SimulateStep = data.Duration{Months: 1}
+	f.Var(&opts.SimulateStep, "simulate-step", "show the simulated snapshots every `duration`")
 
 	f.SortFlags = false
 }
@@ -172,6 +213,22 @@ func verifyForgetOptions(opts *ForgetOptions) error {
 		}
 	}
 
+	if opts.Simulate {
+		for _, d := range []data.Duration{opts.Until, opts.SimulateStep} {
+			if d.Hours < 0 || d.Days < 0 || d.Months < 0 || d.Years < 0 {
+				return errors.Fatal("durations containing negative values are not allowed for --until and --simulate-step")
+			}
+		}
+		if opts.Until.Zero() {
+			return errors.Fatal("--simulate requires --until")
+		}
+		if opts.Prune {
+			return errors.Fatal("--simulate cannot be combined with --prune")
+		}
+	} else if !opts.Until.Zero() {
+		return errors.Fatal("--until requires --simulate")
+	}
+
 	return nil
 }
 
@@ -186,12 +243,28 @@ func runForget(ctx context.Context, opts ForgetOptions, pruneOptions PruneOption
 		return err
 	}
 
+	if opts.Simulate {
+		if len(args) > 0 {
+			return errors.Fatal("--simulate cannot be used together with snapshot IDs")
+		}
+		if opts.SimulateStep.Zero() {
+			opts.SimulateStep = data.Duration{Months: 1}
+		}
+		// the simulation never removes snapshots
+		opts.DryRun = true
+	}
+
 	if gopts.NoLock && !opts.DryRun {
 		return errors.Fatal("--no-lock is only applicable in combination with --dry-run for forget command")
 	}
 
 	printer := progress.NewTerminalPrinter(gopts.JSON, gopts.Verbosity, term)
-	ctx, repo, unlock, err := openWithExclusiveLock(ctx, gopts, opts.DryRun && gopts.NoLock, printer)
+	openWithLock := openWithExclusiveLock
+	if pruneOptions.NonExclusive {
+		// removing snapshots does not conflict with concurrent backups
+		openWithLock = openWithAppendLock
+	}
+	ctx, repo, unlock, err := openWithLock(ctx, gopts, opts.DryRun && gopts.NoLock, printer)
 	if err != nil {
 		return err
 	}
@@ -212,10 +285,14 @@ func runForget(ctx context.Context, opts ForgetOptions, pruneOptions PruneOption
 	}
 
 	var jsonGroups []*ForgetGroup
+	var jsonSimulations []*ForgetSimulation
 
 	if len(args) > 0 {
 		// When explicit snapshots args are given, remove them immediately.
 		for _, sn := range snapshots {
+			if sn.Hold {
+				return errors.Fatalf("snapshot %v is on legal hold and cannot be removed", sn.ID().Str())
+			}
 			removeSnIDs.Insert(*sn.ID())
 		}
 	} else {
@@ -224,41 +301,55 @@ func runForget(ctx context.Context, opts ForgetOptions, pruneOptions PruneOption
 			return err
 		}
 
-		policy := data.ExpirePolicy{
-			Last:          int(opts.Last),
-			Hourly:        int(opts.Hourly),
-			Daily:         int(opts.Daily),
-			Weekly:        int(opts.Weekly),
-			Monthly:       int(opts.Monthly),
-			Yearly:        int(opts.Yearly),
-			Within:        opts.Within,
-			WithinHourly:  opts.WithinHourly,
-			WithinDaily:   opts.WithinDaily,
-			WithinWeekly:  opts.WithinWeekly,
-			WithinMonthly: opts.WithinMonthly,
-			WithinYearly:  opts.WithinYearly,
-			Tags:          opts.KeepTags,
-		}
+		policy := opts.expirePolicy()
+		policies := []data.TaggedPolicy{{Policy: policy}}
+		// only remove expired snapshots if no policy was specified
+		expiryOnly := false
 
-		if policy.Empty() {
-			if opts.UnsafeAllowRemoveAll {
-				if opts.SnapshotFilter.Empty() {
-					return errors.Fatal("--unsafe-allow-remove-all is not allowed unless a snapshot filter option is specified")
+		if opts.PolicyFile != "" {
+			if !policy.Empty() {
+				return errors.Fatal("--policy-file cannot be combined with --keep-* options")
+			}
+			policies, err = loadForgetPolicyFile(opts.PolicyFile)
+			if err != nil {
+				return err
+			}
+			for _, p := range policies {
+				if len(p.Tags) == 0 {
+					printer.P("Applying Policy to all other snapshots: %v\n", p.Policy)
+				} else {
+					printer.P("Applying Policy to snapshots with tags %v: %v\n", p.Tags, p.Policy)
+				}
+			}
+		} else {
+			if policy.Empty() {
+				if opts.UnsafeAllowRemoveAll {
+					if opts.SnapshotFilter.Empty() {
+						return errors.Fatal("--unsafe-allow-remove-all is not allowed unless a snapshot filter option is specified")
+					}
+					// UnsafeAllowRemoveAll together with snapshot filter is fine
+				} else if slices.ContainsFunc(snapshots, func(sn *data.Snapshot) bool { return sn.Expiry != nil }) {
+					expiryOnly = true
+				} else {
+					return errors.Fatal("no policy was specified, no snapshots will be removed")
 				}
-				// UnsafeAllowRemoveAll together with snapshot filter is fine
+			}
+
+			if expiryOnly {
+				printer.P("Removing expired snapshots\n")
 			} else {
-				return errors.Fatal("no policy was specified, no snapshots will be removed")
+				printer.P("Applying Policy: %v\n", policy)
 			}
 		}
 
-		printer.P("Applying Policy: %v\n", policy)
+		now := time.Now()
 
 		for k, snapshotGroup := range snapshotGroups {
 			if ctx.Err() != nil {
 				return ctx.Err()
 			}
 
-			if gopts.Verbose >= 1 && !gopts.JSON {
+			if (gopts.Verbose >= 1 || opts.Simulate) && !gopts.JSON {
 				err = PrintSnapshotGroupHeader(gopts.Term.OutputWriter(), k)
 				if err != nil {
 					return err
@@ -270,19 +361,36 @@ func runForget(ctx context.Context, opts ForgetOptions, pruneOptions PruneOption
 				return err
 			}
 
+			if opts.Simulate {
+				sim, err := simulateForget(snapshotGroup, opts, policies, expiryOnly, gopts, printer)
+				if err != nil {
+					return fmt.Errorf("snapshot group \"%v\": %w", key.String(), err)
+				}
+				if sim != nil {
+					sim.Tags = key.Tags
+					sim.Host = key.Hostname
+					sim.Paths = key.Paths
+					sim.Username = key.Username
+					sim.FirstPaths = key.FirstPaths
+					jsonSimulations = append(jsonSimulations, sim)
+				}
+				continue
+			}
+
 			var fg ForgetGroup
 			fg.Tags = key.Tags
 			fg.Host = key.Hostname
 			fg.Paths = key.Paths
+			fg.Username = key.Username
+			fg.FirstPaths = key.FirstPaths
 
-			keep, remove, reasons := data.ApplyPolicy(snapshotGroup, policy)
-
-			if !policy.Empty() && len(keep) == 0 {
+			keep, remove, reasons, ok := applyForgetRetention(snapshotGroup, policies, expiryOnly, now)
+			if !ok {
 				return fmt.Errorf("refusing to delete last snapshot of snapshot group \"%v\"", key.String())
 			}
 			if len(keep) != 0 && !gopts.Quiet && !gopts.JSON {
 				printer.P("keep %d snapshots:\n", len(keep))
-				if err := PrintSnapshots(gopts.Term.OutputWriter(), keep, reasons, opts.Compact); err != nil {
+				if err := PrintSnapshots(gopts.Term.OutputWriter(), keep, reasons, nil, opts.Compact); err != nil {
 					return err
 				}
 				printer.P("\n")
@@ -291,7 +399,7 @@ func runForget(ctx context.Context, opts ForgetOptions, pruneOptions PruneOption
 
 			if len(remove) != 0 && !gopts.Quiet && !gopts.JSON {
 				printer.P("remove %d snapshots:\n", len(remove))
-				if err := PrintSnapshots(gopts.Term.OutputWriter(), remove, nil, opts.Compact); err != nil {
+				if err := PrintSnapshots(gopts.Term.OutputWriter(), remove, nil, nil, opts.Compact); err != nil {
 					return err
 				}
 				printer.P("\n")
@@ -312,6 +420,13 @@ func runForget(ctx context.Context, opts ForgetOptions, pruneOptions PruneOption
 		return ctx.Err()
 	}
 
+	if opts.Simulate {
+		if gopts.JSON {
+			return json.NewEncoder(gopts.Term.OutputWriter()).Encode(jsonSimulations)
+		}
+		return nil
+	}
+
 	// these are the snapshots that failed to be removed
 	failedSnIDs := restic.NewIDSet()
 	if len(removeSnIDs) > 0 {
@@ -359,14 +474,193 @@ func runForget(ctx context.Context, opts ForgetOptions, pruneOptions PruneOption
 	return nil
 }
 
+// expirePolicy returns the policy specified by the --keep-* options.
+func (opts *ForgetOptions) expirePolicy() data.ExpirePolicy {
+	return data.ExpirePolicy{
+		Last:          int(opts.Last),
+		Hourly:        int(opts.Hourly),
+		Daily:         int(opts.Daily),
+		Weekly:        int(opts.Weekly),
+		Monthly:       int(opts.Monthly),
+		Yearly:        int(opts.Yearly),
+		Within:        opts.Within,
+		WithinHourly:  opts.WithinHourly,
+		WithinDaily:   opts.WithinDaily,
+		WithinWeekly:  opts.WithinWeekly,
+		WithinMonthly: opts.WithinMonthly,
+		WithinYearly:  opts.WithinYearly,
+		Tags:          opts.KeepTags,
+		Calendar:      opts.Calendar,
+	}
+}
+
+// forgetPolicyFile is the format of the file passed to --policy-file.
+type forgetPolicyFile struct {
+	Policies []forgetPolicyEntry `json:"policies"`
+}
+
+// forgetPolicyEntry is a policy for snapshots with the given tags. The
+// remaining fields correspond to the --keep-* options.
+type forgetPolicyEntry struct {
+	Tags []string `json:"tags"`
+
+	Last          ForgetPolicyCount `json:"keep-last"`
+	Hourly        ForgetPolicyCount `json:"keep-hourly"`
+	Daily         ForgetPolicyCount `json:"keep-daily"`
+	Weekly        ForgetPolicyCount `json:"keep-weekly"`
+	Monthly       ForgetPolicyCount `json:"keep-monthly"`
+	Yearly        ForgetPolicyCount `json:"keep-yearly"`
+	Within        data.Duration     `json:"keep-within"`
+	WithinHourly  data.Duration     `json:"keep-within-hourly"`
+	WithinDaily   data.Duration     `json:"keep-within-daily"`
+	WithinWeekly  data.Duration     `json:"keep-within-weekly"`
+	WithinMonthly data.Duration     `json:"keep-within-monthly"`
+	WithinYearly  data.Duration     `json:"keep-within-yearly"`
+	KeepTags      []string          `json:"keep-tag"`
+	Calendar      []string          `json:"keep-calendar"`
+}
+
+// loadForgetPolicyFile reads the policies from filename. Each snapshot is
+// handled by the first policy whose tags it has.
+func loadForgetPolicyFile(filename string) ([]data.TaggedPolicy, error) {
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Fatalf("unable to read policy file: %v", err)
+	}
+
+	var file forgetPolicyFile
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&file); err != nil {
+		return nil, errors.Fatalf("unable to parse policy file %v: %v", filename, err)
+	}
+	if len(file.Policies) == 0 {
+		return nil, errors.Fatalf("policy file %v contains no policies", filename)
+	}
+
+	policies := make([]data.TaggedPolicy, 0, len(file.Policies))
+	for i, entry := range file.Policies {
+		opts := ForgetOptions{
+			Last:          entry.Last,
+			Hourly:        entry.Hourly,
+			Daily:         entry.Daily,
+			Weekly:        entry.Weekly,
+			Monthly:       entry.Monthly,
+			Yearly:        entry.Yearly,
+			Within:        entry.Within,
+			WithinHourly:  entry.WithinHourly,
+			WithinDaily:   entry.WithinDaily,
+			WithinWeekly:  entry.WithinWeekly,
+			WithinMonthly: entry.WithinMonthly,
+			WithinYearly:  entry.WithinYearly,
+		}
+		for _, tags := range entry.KeepTags {
+			if err := opts.KeepTags.Set(tags); err != nil {
+				return nil, errors.Fatalf("policy %d: %v", i+1, err)
+			}
+		}
+		for _, rule := range entry.Calendar {
+			if err := opts.Calendar.Set(rule); err != nil {
+				return nil, errors.Fatalf("policy %d: %v", i+1, err)
+			}
+		}
+		if err := verifyForgetOptions(&opts); err != nil {
+			return nil, errors.Fatalf("policy %d: %v", i+1, err)
+		}
+
+		policy := opts.expirePolicy()
+		if policy.Empty() {
+			return nil, errors.Fatalf("policy %d does not keep any snapshots", i+1)
+		}
+		policies = append(policies, data.TaggedPolicy{Tags: entry.Tags, Policy: policy})
+	}
+	return policies, nil
+}
+
+// applyForgetPolicies applies the first matching policy to each snapshot.
+// Snapshots which match no policy are kept. ok is false if a non-empty policy
+// would remove all snapshots it applies to.
+func applyForgetPolicies(list data.Snapshots, policies []data.TaggedPolicy) (keep, remove data.Snapshots, reasons []data.KeepReason, ok bool) {
+	lists, unmatched := data.SplitByPolicy(list, policies)
+	for i, p := range policies {
+		if len(lists[i]) == 0 {
+			continue
+		}
+		k, r, kr := data.ApplyPolicy(lists[i], p.Policy)
+		if !p.Policy.Empty() && len(k) == 0 {
+			return nil, nil, nil, false
+		}
+		remove = append(remove, r...)
+		reasons = append(reasons, kr...)
+	}
+	for _, sn := range unmatched {
+		reasons = append(reasons, data.KeepReason{Snapshot: sn, Matches: []string{"no matching policy"}})
+	}
+
+	if len(policies) > 1 {
+		// restore the order of the snapshots, newest first
+		sort.SliceStable(reasons, func(i, j int) bool { return reasons[i].Snapshot.Time.After(reasons[j].Snapshot.Time) })
+		sort.Stable(remove)
+	}
+	for _, r := range reasons {
+		keep = append(keep, r.Snapshot)
+	}
+	return keep, remove, reasons, true
+}
+
+// applyForgetRetention removes the expired snapshots of list and applies the
+// policies to the remaining snapshots, unless expiryOnly is set. Snapshots on
+// legal hold are always kept.
+func applyForgetRetention(list data.Snapshots, policies []data.TaggedPolicy, expiryOnly bool, now time.Time) (keep, remove data.Snapshots, reasons []data.KeepReason, ok bool) {
+	var expired, current data.Snapshots
+	for _, sn := range list {
+		if sn.Expired(now) {
+			expired = append(expired, sn)
+		} else {
+			current = append(current, sn)
+		}
+	}
+
+	if expiryOnly {
+		for _, sn := range current {
+			reasons = append(reasons, data.KeepReason{Snapshot: sn, Matches: []string{"not expired"}})
+		}
+	} else {
+		_, remove, reasons, ok = applyForgetPolicies(current, policies)
+		if !ok {
+			return nil, nil, nil, false
+		}
+	}
+
+	var removeAll data.Snapshots
+	for _, sn := range append(remove, expired...) {
+		if sn.Hold {
+			reasons = append(reasons, data.KeepReason{Snapshot: sn, Matches: []string{"legal hold"}})
+		} else {
+			removeAll = append(removeAll, sn)
+		}
+	}
+	remove = removeAll
+
+	// restore the order of the snapshots, newest first
+	sort.SliceStable(reasons, func(i, j int) bool { return reasons[i].Snapshot.Time.After(reasons[j].Snapshot.Time) })
+	sort.Stable(remove)
+	for _, r := range reasons {
+		keep = append(keep, r.Snapshot)
+	}
+	return keep, remove, reasons, true
+}
+
 // ForgetGroup helps to print what is forgotten in JSON.
 type ForgetGroup struct {
-	Tags    []string     `json:"tags"`
-	Host    string       `json:"host"`
-	Paths   []string     `json:"paths"`
-	Keep    []Snapshot   `json:"keep"`
-	Remove  []Snapshot   `json:"remove"`
-	Reasons []KeepReason `json:"reasons"`
+	Tags       []string     `json:"tags"`
+	Host       string       `json:"host"`
+	Paths      []string     `json:"paths"`
+	Username   string       `json:"username,omitempty"`
+	FirstPaths []string     `json:"first_paths,omitempty"`
+	Keep       []Snapshot   `json:"keep"`
+	Remove     []Snapshot   `json:"remove"`
+	Reasons    []KeepReason `json:"reasons"`
 }
 
 func asJSONSnapshots(list data.Snapshots) []Snapshot {
@@ -2,9 +2,12 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/restic/restic/internal/data"
 	"github.com/restic/restic/internal/global"
@@ -64,3 +67,104 @@ func TestRunForgetSafetyNet(t *testing.T) {
 	})
 	testListSnapshots(t, env.gopts, 0)
 }
+
+func TestRunForgetPolicyFile(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+
+	dir := []string{filepath.Join(env.testdata, "0", "0", "9")}
+	for i := 0; i < 3; i++ {
+		testRunBackup(t, "", dir, BackupOptions{Tags: data.TagLists{{"db"}}}, env.gopts)
+		testRunBackup(t, "", dir, BackupOptions{Tags: data.TagLists{{"web"}}}, env.gopts)
+	}
+	testListSnapshots(t, env.gopts, 6)
+
+	policyFile := filepath.Join(env.base, "policy.json")
+	rtest.OK(t, os.WriteFile(policyFile, []byte(`{"policies": [{"tags": ["db"], "keep-last": 1}, {"tags": ["web"], "keep-last": 2}]}`), 0o600))
+
+	// the policy file cannot be combined with --keep-* options
+	err := testRunForgetMayFail(t, env.gopts, ForgetOptions{PolicyFile: policyFile, Last: 1})
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "--policy-file cannot be combined"), "wrong error message got %v", err)
+
+	testRunForget(t, env.gopts, ForgetOptions{
+		PolicyFile: policyFile,
+		GroupBy:    data.SnapshotGroupByOptions{Host: true, Path: true},
+	})
+	testListSnapshots(t, env.gopts, 3)
+}
+
+func TestRunForgetExpiry(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+
+	dir := []string{filepath.Join(env.testdata, "0", "0", "9")}
+	expireAfter := data.Duration{Days: 1}
+	testRunBackup(t, "", dir, BackupOptions{TimeStamp: "2020-01-01 00:00:00", ExpireAfter: expireAfter}, env.gopts)
+	testRunBackup(t, "", dir, BackupOptions{TimeStamp: "2020-01-02 00:00:00", ExpireAfter: expireAfter, Hold: true}, env.gopts)
+	testRunBackup(t, "", dir, BackupOptions{ExpireAfter: expireAfter}, env.gopts)
+	testListSnapshots(t, env.gopts, 3)
+
+	// without policy, only the expired snapshot which is not on hold is removed
+	testRunForget(t, env.gopts, ForgetOptions{GroupBy: data.SnapshotGroupByOptions{Host: true, Path: true}})
+	snapshotIDs := testListSnapshots(t, env.gopts, 2)
+
+	// snapshots on hold cannot be removed explicitly
+	var held string
+	for _, id := range snapshotIDs {
+		sn := testLoadSnapshot(t, env.gopts, id)
+		if sn.Hold {
+			held = id.String()
+		}
+	}
+	err := testRunForgetMayFail(t, env.gopts, ForgetOptions{}, held)
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "legal hold"), "wrong error message got %v", err)
+
+	// once released, the expired snapshot is removed
+	testRunTag(t, TagOptions{snapshotRetention: snapshotRetention{Release: true}}, env.gopts)
+	testRunForget(t, env.gopts, ForgetOptions{GroupBy: data.SnapshotGroupByOptions{Host: true, Path: true}})
+	testListSnapshots(t, env.gopts, 1)
+}
+
+func TestRunForgetSimulate(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+
+	dir := []string{filepath.Join(env.testdata, "0", "0", "9")}
+	for _, ts := range []string{"2020-01-01 10:00:00", "2020-01-02 10:00:00", "2020-01-03 10:00:00"} {
+		testRunBackup(t, "", dir, BackupOptions{TimeStamp: ts}, env.gopts)
+	}
+
+	buf, err := withCaptureStdout(t, env.gopts, func(ctx context.Context, gopts global.Options) error {
+		gopts.JSON = true
+		opts := ForgetOptions{
+			Daily:    3,
+			GroupBy:  data.SnapshotGroupByOptions{Host: true, Path: true},
+			Simulate: true,
+			Until:    data.Duration{Days: 10},
+		}
+		return runForget(ctx, opts, PruneOptions{MaxUnused: "5%"}, gopts, gopts.Term, nil)
+	})
+	rtest.OK(t, err)
+
+	var simulations []ForgetSimulation
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &simulations))
+	rtest.Equals(t, 1, len(simulations))
+	rtest.Equals(t, "24h0m0s", simulations[0].Cadence)
+	points := simulations[0].Points
+	rtest.Equals(t, 2, len(points))
+	rtest.Equals(t, 3, points[0].Existing)
+	rtest.Assert(t, points[1].Time.Equal(time.Date(2020, 1, 13, 10, 0, 0, 0, time.Local)), "unexpected end of simulation %v", points[1].Time)
+	rtest.Assert(t, points[1].Oldest.Equal(time.Date(2020, 1, 11, 10, 0, 0, 0, time.Local)), "unexpected oldest snapshot %v", points[1].Oldest)
+	rtest.Equals(t, 3, points[1].Snapshots)
+	rtest.Equals(t, 0, points[1].Existing)
+	rtest.Equals(t, map[string]int{"daily snapshot": 3}, points[1].Buckets)
+
+	// the simulation does not remove any snapshots
+	testListSnapshots(t, env.gopts, 3)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/restic/restic/internal/data"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/global"
+	"github.com/restic/restic/internal/restic"
+)
+
+// ForgetSimulation helps to print the simulation of a snapshot group in JSON.
+type ForgetSimulation struct {
+	Tags       []string          `json:"tags"`
+	Host       string            `json:"host"`
+	Paths      []string          `json:"paths"`
+	Username   string            `json:"username,omitempty"`
+	FirstPaths []string          `json:"first_paths,omitempty"`
+	Cadence    string            `json:"cadence"`
+	Points     []SimulationPoint `json:"points"`
+}
+
+// SimulationPoint is the state of a simulated snapshot group at a point in time.
+type SimulationPoint struct {
+	Time      time.Time      `json:"time"`
+	Snapshots int            `json:"snapshots"`
+	Existing  int            `json:"existing"`
+	Oldest    time.Time      `json:"oldest"`
+	Buckets   map[string]int `json:"buckets"`
+}
+
+func asSimulationPoint(p data.SimulationPoint) SimulationPoint {
+	sp := SimulationPoint{
+		Time:      p.Time,
+		Snapshots: len(p.Snapshots),
+		Buckets:   make(map[string]int),
+	}
+	for _, sn := range p.Snapshots {
+		if sn.ID() != nil {
+			sp.Existing++
+		}
+	}
+	if len(p.Snapshots) > 0 {
+		sp.Oldest = p.Snapshots[len(p.Snapshots)-1].Time
+	}
+	for _, r := range p.Reasons {
+		for _, m := range r.Matches {
+			sp.Buckets[m]++
+		}
+	}
+	return sp
+}
+
+// simulateForget replays the policies for a snapshot group as if backups
+// continued at the cadence observed in the group. Returns nil if the cadence
+// cannot be determined.
+func simulateForget(list data.Snapshots, opts ForgetOptions, policies []data.TaggedPolicy, expiryOnly bool, gopts global.Options, printer restic.Printer) (*ForgetSimulation, error) {
+	cadence := data.Cadence(list)
+	if cadence == 0 {
+		printer.E("cannot determine the backup cadence, at least two snapshots with different times are required\n")
+		return nil, nil
+	}
+
+	apply := func(list data.Snapshots, now time.Time) (data.Snapshots, []data.KeepReason, error) {
+		keep, _, reasons, ok := applyForgetRetention(list, policies, expiryOnly, now)
+		if !ok {
+			return nil, nil, errors.Fatalf("the policy would remove all snapshots at %s", now.Format(global.TimeFormat))
+		}
+		return keep, reasons, nil
+	}
+	points, err := data.SimulatePolicy(list, cadence, opts.Until, opts.SimulateStep, apply)
+	if err != nil {
+		return nil, err
+	}
+
+	sim := &ForgetSimulation{Cadence: cadence.String()}
+	for _, p := range points {
+		sim.Points = append(sim.Points, asSimulationPoint(p))
+	}
+	if gopts.JSON {
+		return sim, nil
+	}
+
+	printer.P("simulating backups every %v until %s\n", cadence, points[len(points)-1].Time.Format(global.TimeFormat))
+	for i, sp := range sim.Points {
+		printer.P("%s: %d snapshots (%d existing), oldest from %s\n", sp.Time.Format(global.TimeFormat),
+			sp.Snapshots, sp.Existing, sp.Oldest.Format(global.TimeFormat))
+
+		buckets := make([]string, 0, len(sp.Buckets))
+		for reason := range sp.Buckets {
+			buckets = append(buckets, reason)
+		}
+		sort.Strings(buckets)
+		for j, reason := range buckets {
+			buckets[j] = fmt.Sprintf("%s: %d", reason, sp.Buckets[reason])
+		}
+		printer.P("    %s\n", strings.Join(buckets, ", "))
+
+		for _, sn := range points[i].Snapshots {
+			id := "simulated"
+			if sn.ID() != nil {
+				id = sn.ID().Str()
+			}
+			printer.V("        %s  %s\n", sn.Time.Format(global.TimeFormat), id)
+		}
+	}
+	printer.P("\n")
+	return sim, nil
+}
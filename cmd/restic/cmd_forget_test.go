@@ -1,7 +1,10 @@
 package main
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/restic/restic/internal/data"
 	rtest "github.com/restic/restic/internal/test"
@@ -81,6 +84,11 @@ func TestForgetOptionValues(t *testing.T) {
 		{ForgetOptions{WithinWeekly: data.ParseDurationOrPanic("1y2m3d-3h")}, negDurationValErrorMsg},
 		{ForgetOptions{WithinMonthly: data.ParseDurationOrPanic("-2y4m6d8h")}, negDurationValErrorMsg},
 		{ForgetOptions{WithinYearly: data.ParseDurationOrPanic("2y-4m6d8h")}, negDurationValErrorMsg},
+		{ForgetOptions{Simulate: true, Until: data.ParseDurationOrPanic("2y")}, ""},
+		{ForgetOptions{Simulate: true}, "Fatal: --simulate requires --until"},
+		{ForgetOptions{Simulate: true, Until: data.ParseDurationOrPanic("-2y")}, "Fatal: durations containing negative values are not allowed for --until and --simulate-step"},
+		{ForgetOptions{Simulate: true, Until: data.ParseDurationOrPanic("2y"), Prune: true}, "Fatal: --simulate cannot be combined with --prune"},
+		{ForgetOptions{Until: data.ParseDurationOrPanic("2y")}, "Fatal: --until requires --simulate"},
 	}
 
 	for _, testCase := range testCases {
@@ -131,3 +139,114 @@ func TestForgetHostnameDefaulting(t *testing.T) {
 		})
 	}
 }
+
+func TestForgetPolicyFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "policy.json")
+	rtest.OK(t, os.WriteFile(filename, []byte(`{
+  "policies": [
+    {"tags": ["db"], "keep-daily": 7, "keep-calendar": ["period=quarter,select=first,within=7y"]},
+    {"keep-last": "unlimited", "keep-within": "1y", "keep-tag": ["important,db"]}
+  ]
+}`), 0o600))
+
+	policies, err := loadForgetPolicyFile(filename)
+	rtest.OK(t, err)
+	rtest.Equals(t, []data.TaggedPolicy{
+		{
+			Tags: data.TagList{"db"},
+			Policy: data.ExpirePolicy{
+				Daily:    7,
+				Calendar: data.CalendarRules{{Period: data.PeriodQuarter, First: true, Within: data.Duration{Years: 7}, WeekStart: time.Monday}},
+			},
+		},
+		{
+			Policy: data.ExpirePolicy{
+				Last:   -1,
+				Within: data.Duration{Years: 1},
+				Tags:   data.TagLists{{"important", "db"}},
+			},
+		},
+	}, policies)
+
+	for _, content := range []string{
+		`{}`,
+		`{"policies": [{"tags": ["db"]}]}`,
+		`{"policies": [{"keep-dialy": 7}]}`,
+		`{"policies": [{"keep-daily": -2}]}`,
+		`{"policies": [{"keep-within": "-1y"}]}`,
+		`{"policies": [{"keep-calendar": ["period=decade"]}]}`,
+	} {
+		rtest.OK(t, os.WriteFile(filename, []byte(content), 0o600))
+		_, err := loadForgetPolicyFile(filename)
+		rtest.Assert(t, err != nil, "expected error for %v", content)
+	}
+}
+
+func TestApplyForgetPolicies(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2020, 1, d, 10, 0, 0, 0, time.UTC) }
+	list := data.Snapshots{
+		{Time: day(1), Tags: []string{"db"}},
+		{Time: day(2), Tags: []string{"web"}},
+		{Time: day(3), Tags: []string{"db"}},
+		{Time: day(4), Tags: []string{"other"}},
+		{Time: day(5), Tags: []string{"web"}},
+	}
+	policies := []data.TaggedPolicy{
+		{Tags: data.TagList{"db"}, Policy: data.ExpirePolicy{Last: 1}},
+		{Tags: data.TagList{"web"}, Policy: data.ExpirePolicy{Last: 2}},
+	}
+
+	keep, remove, reasons, ok := applyForgetPolicies(list, policies)
+	rtest.Assert(t, ok, "policies were rejected")
+	var kept []time.Time
+	for i, sn := range keep {
+		kept = append(kept, sn.Time)
+		rtest.Equals(t, sn, reasons[i].Snapshot)
+	}
+	// snapshots without matching policy are kept
+	rtest.Equals(t, []time.Time{day(5), day(4), day(3), day(2)}, kept)
+	rtest.Equals(t, 1, len(remove))
+	rtest.Equals(t, day(1), remove[0].Time)
+
+	// a policy must not remove all snapshots it applies to
+	policies[0].Policy = data.ExpirePolicy{Tags: data.TagLists{{"missing"}}}
+	_, _, _, ok = applyForgetPolicies(list, policies)
+	rtest.Assert(t, !ok, "policy removing all snapshots was not rejected")
+}
+
+func TestApplyForgetRetention(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2020, 1, d, 10, 0, 0, 0, time.UTC) }
+	list := data.Snapshots{
+		{Time: day(1)},
+		{Time: day(2), Hold: true},
+		{Time: day(3)},
+		{Time: day(4)},
+		{Time: day(5)},
+	}
+	list[0].SetExpiry(data.Duration{Days: 7})
+	list[2].SetExpiry(data.Duration{Days: 1})
+	list[3].SetExpiry(data.Duration{Days: 1})
+	now := day(5)
+	policies := []data.TaggedPolicy{{Policy: data.ExpirePolicy{Last: 1}}}
+
+	times := func(list data.Snapshots) []time.Time {
+		var result []time.Time
+		for _, sn := range list {
+			result = append(result, sn.Time)
+		}
+		return result
+	}
+
+	// expired snapshots are removed even if the policy keeps them, snapshots
+	// on hold are always kept
+	keep, remove, reasons, ok := applyForgetRetention(list, policies, false, now)
+	rtest.Assert(t, ok, "policies were rejected")
+	rtest.Equals(t, []time.Time{day(5), day(2)}, times(keep))
+	rtest.Equals(t, []time.Time{day(4), day(3), day(1)}, times(remove))
+	rtest.Equals(t, []string{"legal hold"}, reasons[1].Matches)
+
+	keep, remove, _, ok = applyForgetRetention(list, nil, true, now)
+	rtest.Assert(t, ok, "policies were rejected")
+	rtest.Equals(t, []time.Time{day(5), day(2), day(1)}, times(keep))
+	rtest.Equals(t, []time.Time{day(4), day(3)}, times(remove))
+}
@@ -19,6 +19,7 @@ per repository.
 
 	cmd.AddCommand(
 		newKeyAddCommand(globalOptions),
+		newKeyGenerateSigningKeyCommand(globalOptions),
 		newKeyListCommand(globalOptions),
 		newKeyPasswdCommand(globalOptions),
 		newKeyRemoveCommand(globalOptions),
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"os"
+
+	"github.com/restic/restic/internal/data"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/global"
+	"github.com/restic/restic/internal/ui"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+func newKeyGenerateSigningKeyCommand(globalOptions *global.Options) *cobra.Command {
+	var opts KeyGenerateSigningKeyOptions
+
+	cmd := &cobra.Command{
+		Use:   "generate-signing-key [flags] file",
+		Short: "Generate a key for signing snapshots",
+		Long: `
+The "key generate-signing-key" command generates a new Ed25519 key for signing
+snapshots and stores it in the given file. The file must be kept secret on the
+host which creates the snapshots, it is not stored in the repository.
+
+The command prints a line for the trusted keys file, which must be passed to
+the "snapshots", "restore" and "check" commands using the --trusted-keys-file
+option to verify that snapshots were created by the host.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful.
+Exit status is 1 if there was any error.
+	`,
+		DisableAutoGenTag: true,
+		RunE: func(_ *cobra.Command, args []string) error {
+			return runKeyGenerateSigningKey(opts, args, globalOptions.Term)
+		},
+	}
+
+	opts.AddFlags(cmd.Flags())
+	return cmd
+}
+
+// KeyGenerateSigningKeyOptions bundles all options for the key generate-signing-key command.
+type KeyGenerateSigningKeyOptions struct {
+	Hostname string
+}
+
+func (opts *KeyGenerateSigningKeyOptions) AddFlags(f *pflag.FlagSet) {
+	f.StringVar(&opts.Hostname, "host", "", "the `hostname` the key is trusted for (default: $RESTIC_HOST or the current hostname)")
+}
+
+func runKeyGenerateSigningKey(opts KeyGenerateSigningKeyOptions, args []string, term ui.Terminal) error {
+	if len(args) != 1 {
+		return errors.Fatal("key generate-signing-key expects one argument as the key file")
+	}
+
+	hostname := opts.Hostname
+	if hostname == "" {
+		hostname = os.Getenv("RESTIC_HOST")
+	}
+	if hostname == "" {
+		var err error
+		hostname, err = os.Hostname()
+		if err != nil {
+			debug.Log("os.Hostname() returned err: %v", err)
+			return errors.Fatal("unable to determine hostname, please specify it using --host")
+		}
+	}
+
+	key, err := data.NewSigningKey()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(args[0], os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return errors.Fatalf("unable to create signing key file: %v", err)
+	}
+	_, err = f.Write(data.MarshalSigningKey(key))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return errors.Fatalf("unable to write signing key file: %v", err)
+	}
+
+	term.Print(data.FormatTrustedKey(hostname, key.Public().(ed25519.PublicKey)))
+	return nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/restic/restic/internal/data"
+	"github.com/restic/restic/internal/global"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func testRunKeyGenerateSigningKey(t testing.TB, gopts global.Options, hostname string, file string) string {
+	buf, err := withCaptureStdout(t, gopts, func(_ context.Context, gopts global.Options) error {
+		return runKeyGenerateSigningKey(KeyGenerateSigningKeyOptions{Hostname: hostname}, []string{file}, gopts.Term)
+	})
+	rtest.OK(t, err)
+	return buf.String()
+}
+
+func TestSnapshotSignatures(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	keyFile := filepath.Join(env.base, "signing.key")
+	trustedKeysFile := filepath.Join(env.base, "trusted_keys")
+	trustedLine := testRunKeyGenerateSigningKey(t, env.gopts, "testhost", keyFile)
+	rtest.OK(t, os.WriteFile(trustedKeysFile, []byte(trustedLine), 0600))
+
+	// refuse to overwrite an existing key
+	err := withTermStatus(t, env.gopts, func(_ context.Context, gopts global.Options) error {
+		return runKeyGenerateSigningKey(KeyGenerateSigningKeyOptions{Hostname: "testhost"}, []string{keyFile}, gopts.Term)
+	})
+	rtest.Assert(t, err != nil, "expected error when overwriting signing key")
+
+	testSetupBackupData(t, env)
+	opts := BackupOptions{Host: "testhost", SigningOptions: SigningOptions{SigningKeyFile: keyFile}}
+	testRunBackup(t, "", []string{env.testdata}, opts, env.gopts)
+	signed, _ := testRunSnapshots(t, env.gopts)
+	rtest.Assert(t, signed.Signature != nil, "snapshot is not signed")
+
+	// a snapshot without signature from the same host
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{Host: "testhost"}, env.gopts)
+	unsigned, _ := testRunSnapshots(t, env.gopts)
+	rtest.Assert(t, unsigned.Signature == nil, "snapshot is signed")
+
+	verify := SignatureOptions{TrustedKeysFile: trustedKeysFile}
+	buf, err := withCaptureStdout(t, env.gopts, func(ctx context.Context, gopts global.Options) error {
+		return runSnapshots(ctx, SnapshotOptions{SignatureOptions: verify}, gopts, nil, gopts.Term)
+	})
+	rtest.OK(t, err)
+	rtest.Assert(t, strings.Contains(buf.String(), "Signature"), "missing signature column in output: %q", buf.String())
+	rtest.Assert(t, strings.Contains(buf.String(), data.SignatureValid.String()), "missing valid signature in output: %q", buf.String())
+	rtest.Assert(t, strings.Contains(buf.String(), data.SignatureUnsigned.String()), "missing unsigned snapshot in output: %q", buf.String())
+
+	// restore requires a valid signature once trusted keys are specified
+	restoreOpts := RestoreOptions{Target: filepath.Join(env.base, "restore"), SignatureOptions: verify}
+	rtest.OK(t, testRunRestoreAssumeFailure(t, signed.ID.String(), restoreOpts, env.gopts))
+	err = testRunRestoreAssumeFailure(t, unsigned.ID.String(), restoreOpts, env.gopts)
+	rtest.Assert(t, err != nil, "expected restore of unsigned snapshot to fail")
+
+	// check only complains about untrusted snapshots if trusted keys are specified
+	testRunCheck(t, env.gopts)
+	_, err = testRunCheckOutputWithOpts(t, env.gopts, CheckOptions{SignatureOptions: verify}, nil)
+	rtest.Assert(t, err != nil, "expected check to report unsigned snapshot")
+	_, err = testRunCheckOutputWithOpts(t, env.gopts, CheckOptions{SignatureOptions: verify}, []string{signed.ID.String()})
+	rtest.OK(t, err)
+
+	// modifying a snapshot without signing key removes the signature
+	testRunTag(t, TagOptions{AddTags: data.TagLists{data.TagList{"foo"}}}, env.gopts)
+	_, snapshots := testRunSnapshots(t, env.gopts)
+	for _, sn := range snapshots {
+		rtest.Assert(t, sn.Signature == nil, "snapshot %v is still signed", sn.ID.Str())
+	}
+
+	// while the signing key is used to sign it again
+	testRunTag(t, TagOptions{AddTags: data.TagLists{data.TagList{"bar"}}, SigningOptions: opts.SigningOptions}, env.gopts)
+	_, err = testRunCheckOutputWithOpts(t, env.gopts, CheckOptions{SignatureOptions: verify}, nil)
+	rtest.OK(t, err)
+}
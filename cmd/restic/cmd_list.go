@@ -17,7 +17,7 @@ import (
 )
 
 func newListCommand(globalOptions *global.Options) *cobra.Command {
-	var listAllowedArgs = []string{"blobs", "packs", "index", "snapshots", "keys", "locks"}
+	var listAllowedArgs = []string{"blobs", "packs", "index", "snapshots", "keys", "locks", "parity", "resume", "prune", "deletion", "ledger", "copy", "sync"}
 	var listAllowedArgsUseString = strings.Join(listAllowedArgs, "|")
 
 	cmd := &cobra.Command{
@@ -76,6 +76,20 @@ func runList(ctx context.Context, gopts global.Options, args []string, term ui.T
 		t = restic.KeyFile
 	case "locks":
 		t = restic.LockFile
+	case "parity":
+		t = restic.ParityFile
+	case "resume":
+		t = restic.ResumeFile
+	case "prune":
+		t = restic.PruneFile
+	case "deletion":
+		t = restic.DeletionFile
+	case "ledger":
+		t = restic.LedgerFile
+	case "copy":
+		t = restic.CopyFile
+	case "sync":
+		t = restic.SyncFile
 	case "blobs":
 		for entry := range repository.AllIndexBlobs(ctx, repo, repo) {
 			if entry.Error != nil {
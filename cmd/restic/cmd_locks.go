@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/restic/restic/internal/global"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+func newLocksCommand(globalOptions *global.Options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "locks",
+		Short: "Inspect and remove repository locks",
+		Long: `
+The "locks" command allows you to inspect the locks held by restic processes
+accessing the repository and to remove specific locks.
+	`,
+		DisableAutoGenTag: true,
+		GroupID:           cmdGroupDefault,
+	}
+
+	cmd.AddCommand(
+		newLocksListCommand(globalOptions),
+		newLocksRemoveCommand(globalOptions),
+		newLocksShowCommand(globalOptions),
+	)
+	return cmd
+}
+
+// lockInfo is the representation of a lock used for the output of the locks commands.
+type lockInfo struct {
+	ID         string    `json:"id"`
+	ShortID    string    `json:"-"`
+	Hostname   string    `json:"hostname"`
+	Username   string    `json:"username"`
+	PID        int       `json:"pid"`
+	UID        uint32    `json:"uid"`
+	GID        uint32    `json:"gid"`
+	Exclusive  bool      `json:"exclusive"`
+	Created    time.Time `json:"created"`
+	Refreshed  time.Time `json:"refreshed"`
+	RefreshAge uint64    `json:"refresh_age"` // seconds since the last refresh
+	RefreshAgo string    `json:"-"`
+	Stale      bool      `json:"stale"`
+}
+
+func newLockInfo(info *repository.LockInfo, now time.Time) lockInfo {
+	age := now.Sub(info.Time)
+	if age < 0 {
+		age = 0
+	}
+	return lockInfo{
+		ID:         info.ID.String(),
+		ShortID:    info.ID.Str(),
+		Hostname:   info.Hostname,
+		Username:   info.Username,
+		PID:        info.PID,
+		UID:        info.UID,
+		GID:        info.GID,
+		Exclusive:  info.Exclusive,
+		Created:    info.CreatedAt(),
+		Refreshed:  info.Time,
+		RefreshAge: uint64(age / time.Second),
+		RefreshAgo: ui.FormatDuration(age),
+		Stale:      info.Stale,
+	}
+}
+
+// loadLocks loads the given locks. If ids is nil, all locks are loaded.
+// Locks which cannot be loaded are reported using printer.
+func loadLocks(ctx context.Context, repo *repository.Repository, ids restic.IDSet, printer restic.Printer) ([]lockInfo, error) {
+	var locks []lockInfo
+	now := time.Now()
+	err := repository.ListLocks(ctx, repo, func(id restic.ID, info *repository.LockInfo, err error) error {
+		if ids != nil && !ids.Has(id) {
+			return nil
+		}
+		if err != nil {
+			printer.E("unable to load lock %v: %v", id.Str(), err)
+			return nil
+		}
+		locks = append(locks, newLockInfo(info, now))
+		return nil
+	})
+	return locks, err
+}
+
+// findLocks resolves the given lock ID prefixes.
+func findLocks(ctx context.Context, repo *repository.Repository, args []string) (restic.IDs, error) {
+	var ids restic.IDs
+	for _, arg := range args {
+		id, err := restic.Find(ctx, repo, restic.LockFile, arg)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/restic/restic/internal/global"
+	rtest "github.com/restic/restic/internal/test"
+	"github.com/restic/restic/internal/ui/progress"
+)
+
+func testRunLocksList(t testing.TB, gopts global.Options) []lockInfo {
+	gopts.JSON = true
+	buf, err := withCaptureStdout(t, gopts, func(ctx context.Context, gopts global.Options) error {
+		return runLocksList(ctx, gopts, nil, gopts.Term)
+	})
+	rtest.OK(t, err)
+
+	var locks []lockInfo
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &locks))
+	return locks
+}
+
+func TestLocks(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+	rtest.Equals(t, 0, len(testRunLocksList(t, env.gopts)))
+
+	err := withTermStatus(t, env.gopts, func(ctx context.Context, gopts global.Options) error {
+		printer := progress.NewTerminalPrinter(gopts.JSON, gopts.Verbosity, gopts.Term)
+		_, _, unlock, err := openWithReadLock(ctx, gopts, false, printer)
+		rtest.OK(t, err)
+		defer unlock()
+
+		locks := testRunLocksList(t, env.gopts)
+		rtest.Equals(t, 1, len(locks))
+		lock := locks[0]
+		rtest.Assert(t, !lock.Exclusive, "lock should not be exclusive")
+		rtest.Assert(t, !lock.Stale, "lock should not be stale")
+		rtest.Assert(t, !lock.Created.IsZero(), "lock has no creation time")
+
+		buf, err := withCaptureStdout(t, env.gopts, func(ctx context.Context, gopts global.Options) error {
+			return runLocksShow(ctx, gopts, []string{lock.ID[:8]}, gopts.Term)
+		})
+		rtest.OK(t, err)
+		rtest.Assert(t, strings.Contains(buf.String(), lock.ID), "missing lock ID in output: %q", buf.String())
+
+		rtest.OK(t, withTermStatus(t, env.gopts, func(ctx context.Context, gopts global.Options) error {
+			return runLocksRemove(ctx, gopts, []string{lock.ID}, gopts.Term)
+		}))
+		rtest.Equals(t, 0, len(testRunLocksList(t, env.gopts)))
+		return nil
+	})
+	rtest.OK(t, err)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/global"
+	"github.com/restic/restic/internal/ui"
+	"github.com/restic/restic/internal/ui/progress"
+	"github.com/restic/restic/internal/ui/table"
+	"github.com/spf13/cobra"
+)
+
+func newLocksListCommand(globalOptions *global.Options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List repository locks",
+		Long: `
+The "locks list" command lists all locks in the repository. For each lock the
+hostname, username and PID of the process holding the lock, whether the lock
+is exclusive, when it was created and refreshed and whether it is stale are
+shown.
+
+A lock is stale if it was not refreshed for 30 minutes or if it was created on
+this host by a process which is no longer running. Stale locks can be removed
+using the "unlock" command.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful.
+Exit status is 1 if there was any error.
+Exit status is 10 if the repository does not exist.
+Exit status is 12 if the password is incorrect.
+	`,
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runLocksList(cmd.Context(), *globalOptions, args, globalOptions.Term)
+		},
+	}
+	return cmd
+}
+
+func runLocksList(ctx context.Context, gopts global.Options, args []string, term ui.Terminal) error {
+	if len(args) > 0 {
+		return errors.Fatal("the locks list command expects no arguments, only options - please see `restic help locks list` for usage and flags")
+	}
+
+	printer := progress.NewTerminalPrinter(gopts.JSON, gopts.Verbosity, term)
+	// do not lock the repository, the lock would show up in the list
+	repo, err := global.OpenRepository(ctx, gopts, printer)
+	if err != nil {
+		return err
+	}
+
+	locks, err := loadLocks(ctx, repo, nil, printer)
+	if err != nil {
+		return err
+	}
+	slices.SortFunc(locks, func(a, b lockInfo) int {
+		if c := a.Created.Compare(b.Created); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	if gopts.JSON {
+		if locks == nil {
+			locks = []lockInfo{}
+		}
+		return json.NewEncoder(gopts.Term.OutputWriter()).Encode(locks)
+	}
+
+	tab := table.New()
+	tab.AddColumn("ID", "{{ .ShortID }}")
+	tab.AddColumn("Host", "{{ .Hostname }}")
+	tab.AddColumn("PID", "{{ .PID }}")
+	tab.AddColumn("User", "{{ .Username }}")
+	tab.AddColumn("Type", "{{ if .Exclusive }}exclusive{{ else }}shared{{ end }}")
+	tab.AddColumn("Created", "{{ .Created.Local.Format \""+global.TimeFormat+"\" }}")
+	tab.AddColumn("Last Refresh", "{{ .RefreshAgo }} ago")
+	tab.AddColumn("Stale", "{{ if .Stale }}yes{{ else }}no{{ end }}")
+
+	for _, lock := range locks {
+		tab.AddRow(lock)
+	}
+	tab.AddFooter(fmt.Sprintf("%d locks", len(locks)))
+
+	return tab.Write(gopts.Term.OutputWriter())
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/global"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/ui"
+	"github.com/restic/restic/internal/ui/progress"
+	"github.com/spf13/cobra"
+)
+
+func newLocksRemoveCommand(globalOptions *global.Options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "remove [flags] ID [ID...]",
+		Short: "Remove specific repository locks",
+		Long: `
+The "locks remove" command removes the given locks from the repository. Locks
+can be specified using a unique prefix of their ID. Unlike the "unlock"
+command, it also removes locks which are not stale.
+
+Only remove a lock if you are sure that the process which created it is no
+longer running. Removing the lock of a running process, especially of an
+exclusive lock held by "prune", can lead to data loss.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful.
+Exit status is 1 if there was any error.
+Exit status is 10 if the repository does not exist.
+Exit status is 12 if the password is incorrect.
+	`,
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runLocksRemove(cmd.Context(), *globalOptions, args, globalOptions.Term)
+		},
+	}
+	return cmd
+}
+
+func runLocksRemove(ctx context.Context, gopts global.Options, args []string, term ui.Terminal) error {
+	if len(args) == 0 {
+		return errors.Fatal("no lock ID specified")
+	}
+
+	printer := progress.NewTerminalPrinter(gopts.JSON, gopts.Verbosity, term)
+	repo, err := global.OpenRepository(ctx, gopts, printer)
+	if err != nil {
+		return err
+	}
+
+	ids, err := findLocks(ctx, repo, args)
+	if err != nil {
+		return err
+	}
+
+	removed, err := repository.RemoveLocks(ctx, repo, ids)
+	if err != nil {
+		return err
+	}
+	printer.P("successfully removed %d locks", removed)
+	return nil
+}
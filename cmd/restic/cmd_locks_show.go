@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/global"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui"
+	"github.com/restic/restic/internal/ui/progress"
+	"github.com/spf13/cobra"
+)
+
+func newLocksShowCommand(globalOptions *global.Options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "show [flags] ID [ID...]",
+		Short: "Show details of repository locks",
+		Long: `
+The "locks show" command prints all details of the given locks. Locks can be
+specified using a unique prefix of their ID.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful.
+Exit status is 1 if there was any error.
+Exit status is 10 if the repository does not exist.
+Exit status is 12 if the password is incorrect.
+	`,
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runLocksShow(cmd.Context(), *globalOptions, args, globalOptions.Term)
+		},
+	}
+	return cmd
+}
+
+func runLocksShow(ctx context.Context, gopts global.Options, args []string, term ui.Terminal) error {
+	if len(args) == 0 {
+		return errors.Fatal("no lock ID specified")
+	}
+
+	printer := progress.NewTerminalPrinter(gopts.JSON, gopts.Verbosity, term)
+	repo, err := global.OpenRepository(ctx, gopts, printer)
+	if err != nil {
+		return err
+	}
+
+	ids, err := findLocks(ctx, repo, args)
+	if err != nil {
+		return err
+	}
+	idSet := restic.NewIDSet(ids...)
+	locks, err := loadLocks(ctx, repo, idSet, printer)
+	if err != nil {
+		return err
+	}
+	if len(locks) != len(idSet) {
+		return errors.Fatal("unable to load all locks")
+	}
+
+	if gopts.JSON {
+		return json.NewEncoder(gopts.Term.OutputWriter()).Encode(locks)
+	}
+
+	for i, lock := range locks {
+		if i > 0 {
+			printer.S("")
+		}
+		printer.S("lock %v", lock.ID)
+		printer.S("  Host:         %v", lock.Hostname)
+		printer.S("  User:         %v (UID %d, GID %d)", lock.Username, lock.UID, lock.GID)
+		printer.S("  PID:          %d", lock.PID)
+		if lock.Exclusive {
+			printer.S("  Type:         exclusive")
+		} else {
+			printer.S("  Type:         shared")
+		}
+		printer.S("  Created:      %v", lock.Created.Local().Format(global.TimeFormat))
+		printer.S("  Last refresh: %v (%v ago)", lock.Refreshed.Local().Format(global.TimeFormat), lock.RefreshAgo)
+		if lock.Stale {
+			printer.S("  Stale:        yes")
+		} else {
+			printer.S("  Stale:        no")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/global"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/ui"
+	"github.com/restic/restic/internal/ui/progress"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+func newParityCommand(globalOptions *global.Options) *cobra.Command {
+	var opts ParityOptions
+
+	cmd := &cobra.Command{
+		Use:   "parity [flags]",
+		Short: "Create parity data to repair damaged pack files",
+		Long: `
+The "parity" command creates Reed-Solomon parity data for all pack files that
+are not yet protected by parity data. The parity data is stored in separate
+parity files and allows "check --read-data --repair-from-parity" and
+"repair packs" to restore damaged or missing pack files.
+
+Each parity file protects a group of --packs-per-group pack files. Every pack
+file is split into --shards-per-pack data shards and --parity-shards parity
+shards are computed over all data shards of the group. Up to --parity-shards
+damaged data shards per group can be restored. Thus, to be able to restore
+missing pack files, use --shards-per-pack=1. To repair bit rot within a pack
+file at a lower storage overhead, use --packs-per-group=1 together with
+several shards per pack.
+
+Parity files that refer to pack files which no longer exist, for example after
+running "prune", are replaced the next time this command is run.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful.
+Exit status is 1 if there was any error.
+Exit status is 10 if the repository does not exist.
+Exit status is 11 if the repository is already locked.
+Exit status is 12 if the password is incorrect.
+`,
+		GroupID:           cmdGroupDefault,
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runParity(cmd.Context(), opts, *globalOptions, globalOptions.Term)
+		},
+	}
+
+	opts.AddFlags(cmd.Flags())
+	return cmd
+}
+
+// ParityOptions collects all options for the parity command.
+type ParityOptions struct {
+	repository.ParityOptions
+}
+
+func (opts *ParityOptions) AddFlags(f *pflag.FlagSet) {
+	f.UintVar(&opts.PacksPerGroup, "packs-per-group", 8, "number of pack files protected by one parity file")
+	f.UintVar(&opts.ShardsPerPack, "shards-per-pack", 1, "number of data shards each pack file is split into")
+	f.UintVar(&opts.ParityShards, "parity-shards", 1, "number of parity shards per parity file")
+}
+
+func runParity(ctx context.Context, opts ParityOptions, gopts global.Options, term ui.Terminal) error {
+	if err := opts.Check(); err != nil {
+		return errors.Fatalf("%s", err)
+	}
+
+	printer := progress.NewTerminalPrinter(false, gopts.Verbosity, term)
+
+	ctx, repo, unlock, err := openWithAppendLock(ctx, gopts, false, printer)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return repository.UpdateParity(ctx, repo, opts.ParityOptions, printer)
+}
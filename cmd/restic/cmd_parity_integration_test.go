@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/restic/restic/internal/global"
+	"github.com/restic/restic/internal/repository"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func testRunParity(t testing.TB, gopts global.Options, opts ParityOptions) {
+	rtest.OK(t, withTermStatus(t, gopts, func(ctx context.Context, gopts global.Options) error {
+		return runParity(ctx, opts, gopts, gopts.Term)
+	}))
+}
+
+func TestParityRepairMissingPack(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+	testRunParity(t, env.gopts, ParityOptions{repository.ParityOptions{PacksPerGroup: 4, ShardsPerPack: 1, ParityShards: 1}})
+	rtest.Assert(t, len(testRunList(t, env.gopts, "parity")) > 0, "no parity files were created")
+
+	packID := listPacks(env.gopts, t).List()[0].String()
+	rtest.OK(t, os.Remove(filepath.Join(env.gopts.Repo, "data", packID[:2], packID)))
+
+	_, _, err := withCaptureStdoutStderr(t, env.gopts, func(ctx context.Context, gopts global.Options) error {
+		summary, err := runCheck(ctx, CheckOptions{RepairFromParity: true}, gopts, nil, gopts.Term)
+		rtest.Equals(t, []string{packID}, summary.RestoredPacks)
+		return err
+	})
+	rtest.Assert(t, err != nil, "expected check to report the missing pack")
+
+	testRunCheck(t, env.gopts)
+}
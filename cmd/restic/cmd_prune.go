@@ -2,10 +2,13 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"math"
+	"os"
 	"runtime"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/restic/restic/internal/data"
 	"github.com/restic/restic/internal/debug"
@@ -30,6 +33,28 @@ func newPruneCommand(globalOptions *global.Options) *cobra.Command {
 The "prune" command checks the repository and removes data that is not
 referenced and therefore not needed any more.
 
+The --max-duration option limits how long data is repacked and deleted. Once
+the duration is exceeded, prune stops after the current batch of pack files
+and saves the remaining work in the repository. The repository is fully usable
+in the meantime. Use the --resume option to continue the stopped prune run
+without searching the snapshots for used data again.
+
+The --plan-out option saves the planned changes to a file instead of executing
+them. The plan can be reviewed and later executed using --plan-in, which fails
+if snapshots or index files were added or removed in the meantime.
+
+The --non-exclusive option allows backups to continue while prune is running.
+Unused pack files are only marked for deletion and are deleted by a later prune
+run once they were marked for longer than --grace-period. The grace period must
+be longer than the longest running backup. Pack files are not repacked.
+
+The --cold-storage option is intended for repositories stored in a storage
+class which requires a costly warmup before data can be read, like Amazon S3
+Glacier. Partly used data pack files are only repacked once storing their
+unused data has cost more than retrieving them, according to --retrieval-cost
+and --storage-cost. Prune then requests the warmup of these pack files, which
+are repacked by the next prune run.
+
 EXIT STATUS
 ===========
 
@@ -68,11 +93,27 @@ type PruneOptions struct {
 
 	SmallPackSize  string
 	SmallPackBytes uint64
+
+	MaxDuration time.Duration
+	Resume      bool
+
+	PlanOut string
+	PlanIn  string
+
+	NonExclusive bool
+	GracePeriod  time.Duration
+
+	ColdStorage   bool
+	RetrievalCost float64
+	StorageCost   float64
 }
 
 func (opts *PruneOptions) AddFlags(f *pflag.FlagSet) {
 	opts.AddLimitedFlags(f)
 	f.BoolVarP(&opts.DryRun, "dry-run", "n", false, "do not modify the repository, just print what would be done")
+	f.BoolVar(&opts.Resume, "resume", false, "continue a prune run stopped by --max-duration")
+	f.StringVar(&opts.PlanOut, "plan-out", "", "save the prune plan to `file` instead of executing it")
+	f.StringVar(&opts.PlanIn, "plan-in", "", "execute the prune plan saved in `file` by --plan-out")
 	f.StringVarP(&opts.UnsafeNoSpaceRecovery, "unsafe-recover-no-free-space", "", "", "UNSAFE, READ THE DOCUMENTATION BEFORE USING! Try to recover a repository stuck with no free space. Do not use without trying out 'prune --max-repack-size 0' first.")
 }
 
@@ -84,6 +125,12 @@ func (opts *PruneOptions) AddLimitedFlags(f *pflag.FlagSet) {
 	f.BoolVar(&unused, "repack-small", false, "deprecated. Use --repack-smaller-than to specify a minimum size")
 	f.BoolVar(&opts.RepackUncompressed, "repack-uncompressed", false, "repack all uncompressed data")
 	f.StringVar(&opts.SmallPackSize, "repack-smaller-than", "", "pack `below-limit` packfiles (allowed suffixes: m/M)")
+	f.DurationVar(&opts.MaxDuration, "max-duration", 0, "stop repacking and deleting packs after `duration` (e.g. 2h), the remaining work can be continued using --resume")
+	f.BoolVar(&opts.NonExclusive, "non-exclusive", false, "only mark unused packs for deletion, such that backups can run concurrently")
+	f.DurationVar(&opts.GracePeriod, "grace-period", 24*time.Hour, "with --non-exclusive, delete packs marked for deletion for at least `duration`, must exceed the longest backup")
+	f.BoolVar(&opts.ColdStorage, "cold-storage", false, "only repack data packs once storing their unused data costs more than retrieving them")
+	f.Float64Var(&opts.RetrievalCost, "retrieval-cost", 0.02, "with --cold-storage, the `cost` to retrieve one GB of data")
+	f.Float64Var(&opts.StorageCost, "storage-cost", 0.001, "with --cold-storage, the `cost` to store one GB of data for one month")
 
 	err := f.MarkDeprecated("repack-small", "small files are automatically repacked. Use --repack-smaller-than to specify a minimum size")
 	if err != nil {
@@ -104,6 +151,47 @@ func verifyPruneOptions(opts *PruneOptions) error {
 	if opts.UnsafeNoSpaceRecovery != "" {
 		// prevent repacking data to make sure users cannot get stuck.
 		opts.MaxRepackBytes = 0
+
+		if opts.MaxDuration != 0 || opts.Resume {
+			return errors.Fatal("--max-duration and --resume cannot be used with --unsafe-recover-no-free-space")
+		}
+	}
+	if opts.MaxDuration < 0 {
+		return errors.Fatalf("invalid value for --max-duration: %v", opts.MaxDuration)
+	}
+	if opts.NonExclusive {
+		switch {
+		case opts.UnsafeNoSpaceRecovery != "":
+			return errors.Fatal("--non-exclusive cannot be used with --unsafe-recover-no-free-space")
+		case opts.MaxDuration != 0 || opts.Resume:
+			return errors.Fatal("--non-exclusive cannot be used with --max-duration or --resume")
+		case opts.PlanIn != "" || opts.PlanOut != "":
+			return errors.Fatal("--non-exclusive cannot be used with --plan-in or --plan-out")
+		}
+	}
+	if opts.ColdStorage {
+		switch {
+		case opts.NonExclusive:
+			return errors.Fatal("--cold-storage cannot be used with --non-exclusive")
+		case opts.PlanIn != "" || opts.PlanOut != "":
+			return errors.Fatal("--cold-storage cannot be used with --plan-in or --plan-out")
+		}
+	}
+	if opts.RetrievalCost < 0 || opts.StorageCost < 0 {
+		return errors.Fatal("--retrieval-cost and --storage-cost must not be negative")
+	}
+	if opts.GracePeriod < 0 {
+		return errors.Fatalf("invalid value for --grace-period: %v", opts.GracePeriod)
+	}
+	if opts.PlanIn != "" || opts.PlanOut != "" {
+		switch {
+		case opts.PlanIn != "" && opts.PlanOut != "":
+			return errors.Fatal("--plan-in and --plan-out are mutually exclusive")
+		case opts.Resume:
+			return errors.Fatal("--plan-in and --plan-out cannot be used with --resume")
+		case opts.UnsafeNoSpaceRecovery != "":
+			return errors.Fatal("--plan-in and --plan-out cannot be used with --unsafe-recover-no-free-space")
+		}
 	}
 
 	maxUnused := strings.TrimSpace(opts.MaxUnused)
@@ -171,12 +259,18 @@ func runPrune(ctx context.Context, opts PruneOptions, gopts global.Options, term
 		return errors.Fatal("disabled compression and `--repack-uncompressed` are mutually exclusive")
 	}
 
-	if gopts.NoLock && !opts.DryRun {
-		return errors.Fatal("--no-lock is only applicable in combination with --dry-run for prune command")
+	// saving a plan does not modify the repository
+	readOnly := opts.DryRun || opts.PlanOut != ""
+	if gopts.NoLock && !readOnly {
+		return errors.Fatal("--no-lock is only applicable in combination with --dry-run or --plan-out for prune command")
 	}
 
 	printer := progress.NewTerminalPrinter(gopts.JSON, gopts.Verbosity, term)
-	ctx, repo, unlock, err := openWithExclusiveLock(ctx, gopts, opts.DryRun && gopts.NoLock, printer)
+	openWithLock := openWithExclusiveLock
+	if opts.NonExclusive {
+		openWithLock = openWithAppendLock
+	}
+	ctx, repo, unlock, err := openWithLock(ctx, gopts, readOnly && gopts.NoLock, printer)
 	if err != nil {
 		return err
 	}
@@ -194,10 +288,22 @@ func runPrune(ctx context.Context, opts PruneOptions, gopts global.Options, term
 }
 
 func runPruneWithRepo(ctx context.Context, opts PruneOptions, gopts global.Options, repo *repository.Repository, ignoreSnapshots restic.IDSet, printer restic.Printer) error {
+	start := time.Now()
 	if repo.Cache() == nil && !gopts.JSON {
 		printer.S("warning: running prune without a cache, this may be very slow!")
 	}
 
+	var snapshotTrees restic.IDs
+	if opts.NonExclusive {
+		// without an exclusive lock, the snapshots must be loaded before the
+		// index to ensure that the index contains all blobs they reference
+		var err error
+		snapshotTrees, err = loadSnapshotTrees(ctx, repo, ignoreSnapshots, printer)
+		if err != nil {
+			return err
+		}
+	}
+
 	// loading the index before the snapshots is ok, as we use an exclusive lock here
 	err := repo.LoadIndex(ctx, printer)
 	if err != nil {
@@ -214,13 +320,64 @@ func runPruneWithRepo(ctx context.Context, opts PruneOptions, gopts global.Optio
 
 		RepackCacheableOnly: opts.RepackCacheableOnly,
 		RepackUncompressed:  opts.RepackUncompressed,
+
+		GracePeriod: opts.GracePeriod,
+	}
+	if opts.ColdStorage {
+		popts.ColdStorage = &repository.ColdStorageCosts{
+			RetrievalPerGB:    opts.RetrievalCost,
+			StoragePerGBMonth: opts.StorageCost,
+		}
+	}
+	if opts.MaxDuration > 0 {
+		popts.Deadline = start.Add(opts.MaxDuration)
 	}
 
-	plan, err := repository.PlanPrune(ctx, popts, repo, func(ctx context.Context, repo restic.Repository, usedBlobs restic.FindBlobSet) error {
-		return getUsedBlobs(ctx, repo, usedBlobs, ignoreSnapshots, printer)
-	}, printer)
-	if err != nil {
-		return err
+	var plan *repository.PrunePlan
+	if opts.NonExclusive {
+		plan, err = repository.PlanNonExclusivePrune(ctx, popts, repo, func(ctx context.Context, repo restic.Repository, usedBlobs restic.FindBlobSet) error {
+			return findUsedBlobs(ctx, repo, snapshotTrees, usedBlobs, printer)
+		}, printer)
+		if err != nil {
+			return err
+		}
+	} else if opts.PlanIn != "" {
+		exported, err := loadPrunePlan(opts.PlanIn)
+		if err != nil {
+			return err
+		}
+		printer.P("executing prune plan created at %v", exported.Time.Local().Format(global.TimeFormat))
+
+		plan, err = repository.ImportPrunePlan(ctx, popts, repo, exported)
+		if err != nil {
+			return err
+		}
+	} else if opts.Resume {
+		state, err := repository.LoadPruneState(ctx, repo)
+		if err != nil {
+			return err
+		}
+		if state == nil {
+			return errors.Fatal("no stopped prune run found that could be resumed")
+		}
+		printer.P("resuming prune run stopped at %v", state.Time.Local().Format(global.TimeFormat))
+
+		// only snapshots created since the prune run was stopped have to be searched
+		ignore := ignoreSnapshots.Clone()
+		ignore.Merge(restic.NewIDSet(state.Snapshots...))
+		plan, err = repository.ResumePrune(ctx, popts, repo, state, func(ctx context.Context, repo restic.Repository, usedBlobs restic.FindBlobSet) error {
+			return getUsedBlobs(ctx, repo, usedBlobs, ignore, printer)
+		}, printer)
+		if err != nil {
+			return err
+		}
+	} else {
+		plan, err = repository.PlanPrune(ctx, popts, repo, func(ctx context.Context, repo restic.Repository, usedBlobs restic.FindBlobSet) error {
+			return getUsedBlobs(ctx, repo, usedBlobs, ignoreSnapshots, printer)
+		}, printer)
+		if err != nil {
+			return err
+		}
 	}
 	if ctx.Err() != nil {
 		return ctx.Err()
@@ -231,20 +388,65 @@ func runPruneWithRepo(ctx context.Context, opts PruneOptions, gopts global.Optio
 	}
 
 	if !gopts.JSON {
-		err = printPruneStats(printer, plan.Stats())
-		if err != nil {
-			return err
+		if opts.Resume {
+			printPruneResumeStats(printer, plan.Stats())
+		} else if opts.NonExclusive {
+			printPruneNonExclusiveStats(printer, plan.Stats())
+		} else {
+			err = printPruneStats(printer, plan.Stats())
+			if err != nil {
+				return err
+			}
 		}
 	} else {
 		gopts.Term.Print(ui.ToJSONString(plan.Stats()))
 	}
 
+	if opts.PlanOut != "" {
+		exported, err := plan.Export()
+		if err != nil {
+			return err
+		}
+		if err := savePrunePlan(opts.PlanOut, exported); err != nil {
+			return err
+		}
+		printer.P("saved prune plan to %v, run `restic prune --plan-in %v` to execute it", opts.PlanOut, opts.PlanOut)
+		return nil
+	}
+
 	// Trigger GC to reset garbage collection threshold
 	runtime.GC()
 
 	return plan.Execute(ctx, printer)
 }
 
+// savePrunePlan writes the exported prune plan to filename.
+func savePrunePlan(filename string, exported *repository.ExportedPrunePlan) error {
+	buf, err := json.MarshalIndent(exported, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(filename, append(buf, '\n'), 0o600)
+	if err != nil {
+		return errors.Fatalf("unable to save prune plan: %v", err)
+	}
+	return nil
+}
+
+// loadPrunePlan reads an exported prune plan from filename.
+func loadPrunePlan(filename string) (*repository.ExportedPrunePlan, error) {
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Fatalf("unable to load prune plan: %v", err)
+	}
+	var exported repository.ExportedPrunePlan
+	err = json.Unmarshal(buf, &exported)
+	if err != nil {
+		return nil, errors.Fatalf("unable to parse prune plan %v: %v", filename, err)
+	}
+	return &exported, nil
+}
+
 // printPruneStats prints out the statistics
 func printPruneStats(printer restic.Printer, stats repository.PruneStats) error {
 	printer.V("\nused:         %10d blobs / %s", stats.Blobs.Used, ui.FormatBytes(stats.Size.Used))
@@ -279,10 +481,42 @@ func printPruneStats(printer restic.Printer, stats repository.PruneStats) error
 	if stats.Packs.Unref > 0 {
 		printer.V("to delete:    %10d unreferenced packs\n\n", stats.Packs.Unref)
 	}
+	if stats.Packs.Warmup > 0 {
+		printer.P("to warm up:   %10d packs, will be repacked by the next prune run\n", stats.Packs.Warmup)
+	}
 	return nil
 }
 
+// printPruneResumeStats prints the remaining work of a resumed prune run
+func printPruneResumeStats(printer restic.Printer, stats repository.PruneStats) {
+	printer.P("\nto repack:    %10d packs, keeping %d blobs", stats.Packs.Repack, stats.Blobs.Repack)
+	printer.P("to delete:    %10d unreferenced packs\n", stats.Packs.Unref)
+}
+
+// printPruneNonExclusiveStats prints the statistics of a non-exclusive prune run
+func printPruneNonExclusiveStats(printer restic.Printer, stats repository.PruneStats) {
+	printer.V("\nused:         %10d blobs / %s", stats.Blobs.Used, ui.FormatBytes(stats.Size.Used))
+	printer.V("unused:       %10d blobs / %s", stats.Blobs.Unused, ui.FormatBytes(stats.Size.Unused))
+	if stats.Size.Unref > 0 {
+		printer.V("unreferenced:                    %s", ui.FormatBytes(stats.Size.Unref))
+	}
+	printer.V("used packs:   %10d", stats.Packs.Used)
+	printer.V("unused packs: %10d", stats.Packs.Unused+stats.Packs.Unref)
+	printer.P("\nto delete:    %10d packs / %s", stats.Packs.RemoveTotal, ui.FormatBytes(stats.Size.RemoveTotal))
+	printer.P("to mark:      %10d packs", stats.Packs.Marked)
+	printer.P("remaining:    %10d packs / %s\n", stats.Packs.Keep, ui.FormatBytes(stats.Size.Remain))
+}
+
 func getUsedBlobs(ctx context.Context, repo restic.Repository, usedBlobs restic.FindBlobSet, ignoreSnapshots restic.IDSet, printer restic.Printer) error {
+	snapshotTrees, err := loadSnapshotTrees(ctx, repo, ignoreSnapshots, printer)
+	if err != nil {
+		return err
+	}
+	return findUsedBlobs(ctx, repo, snapshotTrees, usedBlobs, printer)
+}
+
+// loadSnapshotTrees returns the trees of all snapshots except those in ignoreSnapshots.
+func loadSnapshotTrees(ctx context.Context, repo restic.ListerLoaderUnpacked, ignoreSnapshots restic.IDSet, printer restic.Printer) (restic.IDs, error) {
 	var snapshotTrees restic.IDs
 	printer.P("loading all snapshots...")
 	err := data.ForAllSnapshots(ctx, repo, repo, ignoreSnapshots,
@@ -296,16 +530,20 @@ func getUsedBlobs(ctx context.Context, repo restic.Repository, usedBlobs restic.
 			return nil
 		})
 	if err != nil {
-		return errors.Fatalf("failed loading snapshot: %v", err)
+		return nil, errors.Fatalf("failed loading snapshot: %v", err)
 	}
+	return snapshotTrees, nil
+}
 
+// findUsedBlobs adds all blobs referenced by snapshotTrees to usedBlobs.
+func findUsedBlobs(ctx context.Context, repo restic.Loader, snapshotTrees restic.IDs, usedBlobs restic.FindBlobSet, printer restic.Printer) error {
 	printer.P("finding data that is still in use for %d snapshots", len(snapshotTrees))
 
 	bar := printer.NewCounter("snapshots")
 	bar.SetMax(uint64(len(snapshotTrees)))
 	defer bar.Done()
 
-	err = data.FindUsedBlobs(ctx, repo, snapshotTrees, usedBlobs, bar)
+	err := data.FindUsedBlobs(ctx, repo, snapshotTrees, usedBlobs, bar)
 	if err != nil {
 		return errors.Fatalf("failed finding blobs: %v", err)
 	}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/restic/restic/internal/backend"
 	"github.com/restic/restic/internal/global"
@@ -121,6 +122,89 @@ func testPrune(t *testing.T, pruneOpts PruneOptions, checkOpts CheckOptions) {
 	}))
 }
 
+func TestPruneResume(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	createPrunableRepo(t, env)
+	// the maximum duration is exceeded before any pack is deleted
+	testRunPrune(t, env.gopts, PruneOptions{MaxUnused: "0", MaxDuration: time.Nanosecond})
+	rtest.Equals(t, 1, len(testRunList(t, env.gopts, "prune")))
+
+	testRunPrune(t, env.gopts, PruneOptions{MaxUnused: "0", Resume: true})
+	rtest.Equals(t, 0, len(testRunList(t, env.gopts, "prune")))
+	rtest.OK(t, withTermStatus(t, env.gopts, func(ctx context.Context, gopts global.Options) error {
+		_, err := runCheck(context.TODO(), CheckOptions{ReadData: true, CheckUnused: true}, gopts, nil, gopts.Term)
+		return err
+	}))
+
+	// nothing left to resume
+	testRunPruneMustFail(t, env.gopts, PruneOptions{MaxUnused: "0", Resume: true})
+}
+
+func TestPrunePlan(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	createPrunableRepo(t, env)
+	planFile := filepath.Join(env.base, "plan.json")
+	packs := listPacks(env.gopts, t)
+
+	// saving the plan must not modify the repository
+	testRunPrune(t, env.gopts, PruneOptions{MaxUnused: "0", PlanOut: planFile})
+	rtest.Assert(t, packs.Equals(listPacks(env.gopts, t)), "packs were modified by --plan-out")
+
+	testRunPrune(t, env.gopts, PruneOptions{MaxUnused: "0", PlanIn: planFile})
+	rtest.OK(t, withTermStatus(t, env.gopts, func(ctx context.Context, gopts global.Options) error {
+		_, err := runCheck(context.TODO(), CheckOptions{ReadData: true, CheckUnused: true}, gopts, nil, gopts.Term)
+		return err
+	}))
+
+	// the plan no longer matches the repository after a backup
+	testRunPrune(t, env.gopts, PruneOptions{MaxUnused: "0", PlanOut: planFile})
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9", "2")}, BackupOptions{}, env.gopts)
+	err := testRunPruneOutput(t, env.gopts, PruneOptions{MaxUnused: "0", PlanIn: planFile})
+	rtest.Equals(t, repository.ErrPrunePlanOutdated, err)
+}
+
+func TestPruneNonExclusive(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	createPrunableRepo(t, env)
+	packs := listPacks(env.gopts, t)
+
+	// unused packs are only marked for deletion
+	testRunPrune(t, env.gopts, PruneOptions{MaxUnused: "5%", NonExclusive: true, GracePeriod: time.Hour})
+	rtest.Assert(t, packs.Equals(listPacks(env.gopts, t)), "packs were deleted before the grace period has passed")
+	rtest.Equals(t, 1, len(testRunList(t, env.gopts, "deletion")))
+
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9", "2")}, BackupOptions{}, env.gopts)
+	testRunPrune(t, env.gopts, PruneOptions{MaxUnused: "5%", NonExclusive: true, GracePeriod: 0})
+	rtest.Assert(t, len(packs.Sub(listPacks(env.gopts, t))) > 0, "marked packs were not deleted")
+	// partly used packs are not repacked
+	_, _, err := testRunCheckOutput(t, env.gopts, false)
+	rtest.OK(t, err)
+}
+
+func TestPruneColdStorage(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	createPrunableRepo(t, env)
+
+	// the first run only requests the warmup of partly used data packs
+	testRunPrune(t, env.gopts, PruneOptions{MaxUnused: "0", ColdStorage: true})
+	rtest.Equals(t, 1, len(testRunList(t, env.gopts, "ledger")))
+	_, _, err := testRunCheckOutput(t, env.gopts, false)
+	rtest.OK(t, err)
+
+	// the next run repacks them
+	testRunPrune(t, env.gopts, PruneOptions{MaxUnused: "0", ColdStorage: true})
+	rtest.Equals(t, 0, len(testRunList(t, env.gopts, "ledger")))
+	testRunCheck(t, env.gopts)
+}
+
 var pruneDefaultOptions = PruneOptions{MaxUnused: "5%"}
 
 func TestPruneWithDamagedRepository(t *testing.T) {
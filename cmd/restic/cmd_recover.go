@@ -70,6 +70,10 @@ func runRecover(ctx context.Context, gopts global.Options, term ui.Terminal) err
 	if err = repo.LoadIndex(ctx, printer); err != nil {
 		return err
 	}
+	// packs marked for deletion by a non-exclusive prune must not be used for deduplication
+	if err = repo.ExcludePendingDeletions(ctx); err != nil {
+		return err
+	}
 
 	// trees maps a tree ID to whether or not it is referenced by a different
 	// tree. If it is not referenced, we have a root tree.
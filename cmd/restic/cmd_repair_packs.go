@@ -23,6 +23,9 @@ func newRepairPacksCommand(globalOptions *global.Options) *cobra.Command {
 The "repair packs" command extracts intact blobs from the specified pack files, rebuilds
 the index to remove the damaged pack files and removes the pack files from the repository.
 
+Pack files protected by parity data, see the "parity" command, are restored from the
+parity data if possible. Only pack files which cannot be restored are salvaged.
+
 EXIT STATUS
 ===========
 
@@ -91,6 +94,16 @@ func runRepairPacks(ctx context.Context, gopts global.Options, term ui.Terminal,
 		}
 	}
 
+	restored, err := repository.RepairPacksFromParity(ctx, repo, ids, printer)
+	if err != nil {
+		return errors.Fatalf("%s", err)
+	}
+	ids = ids.Sub(restored)
+	if len(ids) == 0 {
+		printer.P("all pack files were restored from parity data")
+		return nil
+	}
+
 	err = repository.RepairPacks(ctx, repo, ids, printer)
 	if err != nil {
 		return errors.Fatalf("%s", err)
@@ -126,6 +126,10 @@ func runRepairSnapshots(ctx context.Context, gopts global.Options, opts RepairOp
 	if err := repo.LoadIndex(ctx, printer); err != nil {
 		return err
 	}
+	// packs marked for deletion by a non-exclusive prune must not be used for deduplication
+	if err := repo.ExcludePendingDeletions(ctx); err != nil {
+		return err
+	}
 
 	// Four error cases are checked:
 	// - tree is a nil tree (-> will be replaced by an empty tree)
@@ -192,7 +196,7 @@ func runRepairSnapshots(ctx context.Context, gopts global.Options, opts RepairOp
 			func(ctx context.Context, sn *data.Snapshot, uploader restic.BlobSaver) (restic.ID, *data.SnapshotSummary, error) {
 				id, err := rewriter.RewriteTree(ctx, repo, uploader, "/", *sn.Tree)
 				return id, nil, err
-			}, opts.DryRun, opts.Forget, nil, "repaired", printer, false)
+			}, opts.DryRun, opts.Forget, nil, "repaired", nil, printer, false)
 		if err != nil {
 			return errors.Fatalf("unable to rewrite snapshot ID %q: %v", sn.ID().Str(), err)
 		}
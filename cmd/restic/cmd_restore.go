@@ -74,6 +74,7 @@ type RestoreOptions struct {
 	ExcludeXattrPattern []string
 	IncludeXattrPattern []string
 	OwnershipByName     bool
+	SignatureOptions
 }
 
 func (opts *RestoreOptions) AddFlags(f *pflag.FlagSet) {
@@ -94,6 +95,7 @@ func (opts *RestoreOptions) AddFlags(f *pflag.FlagSet) {
 	if runtime.GOOS != "windows" {
 		f.BoolVar(&opts.OwnershipByName, "ownership-by-name", false, "restore file ownership by user name and group name (except POSIX ACLs)")
 	}
+	opts.SignatureOptions.AddFlags(f)
 }
 
 func runRestore(ctx context.Context, opts RestoreOptions, gopts global.Options,
@@ -142,6 +144,11 @@ func runRestore(ctx context.Context, opts RestoreOptions, gopts global.Options,
 		return errors.Fatal("'--target / --delete' must be combined with an include or exclude filter")
 	}
 
+	trusted, err := opts.SignatureOptions.load()
+	if err != nil {
+		return err
+	}
+
 	snapshotIDString := args[0]
 
 	debug.Log("restore %v to %v", snapshotIDString, opts.Target)
@@ -157,6 +164,15 @@ func runRestore(ctx context.Context, opts RestoreOptions, gopts global.Options,
 		return errors.Fatalf("failed to find snapshot: %v", err)
 	}
 
+	// the signature must be verified before modifying the snapshot
+	signatureStatus, err := checkSnapshotSignature(sn, trusted)
+	if err != nil {
+		return err
+	}
+	if signatureStatus != data.SignatureUnsigned && !gopts.JSON {
+		printer.P("signature of snapshot %s is %v\n", sn.ID().Str(), signatureStatus)
+	}
+
 	err = repo.LoadIndex(ctx, printer)
 	if err != nil {
 		return err
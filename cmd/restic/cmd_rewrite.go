@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"crypto/ed25519"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -28,8 +29,8 @@ func newRewriteCommand(globalOptions *global.Options) *cobra.Command {
 		Long: `
 The "rewrite" command creates new snapshots from existing ones. You can use
 exclude or include filters to control which files are included in the new
-snapshots. Unless --new-host or --new-time is specified, metadata (time, host,
-tags) is preserved.
+snapshots. Unless --new-host, --new-time or --expire-after is specified,
+metadata (time, host, tags, expiry) is preserved.
 
 The snapshots to rewrite are specified using the --host, --tag and --path options,
 or by providing a list of snapshot IDs. Please note that specifying neither any of
@@ -41,7 +42,8 @@ used, the original snapshots will instead be directly removed from the repositor
 
 Please note that the --forget option only removes the snapshots and not the actual
 data stored in the repository. In order to delete the no longer referenced data,
-use the "prune" command.
+use the "prune" command. Snapshots on legal hold cannot be removed, neither by
+--forget nor because they are empty after rewriting.
 
 When rewrite is used with the --snapshot-summary option, a new snapshot is
 created containing statistics summary data. Only two fields in the summary will
@@ -72,17 +74,19 @@ Exit status is 12 if the password is incorrect.
 }
 
 type snapshotMetadata struct {
-	Hostname string
-	Time     *time.Time
+	Hostname    string
+	Time        *time.Time
+	ExpireAfter data.Duration
 }
 
 type snapshotMetadataArgs struct {
-	Hostname string
-	Time     string
+	Hostname    string
+	Time        string
+	ExpireAfter data.Duration
 }
 
 func (sma snapshotMetadataArgs) empty() bool {
-	return sma.Hostname == "" && sma.Time == ""
+	return sma.Hostname == "" && sma.Time == "" && sma.ExpireAfter.Zero()
 }
 
 func (sma snapshotMetadataArgs) convert() (*snapshotMetadata, error) {
@@ -98,7 +102,10 @@ func (sma snapshotMetadataArgs) convert() (*snapshotMetadata, error) {
 		}
 		timeStamp = &t
 	}
-	return &snapshotMetadata{Hostname: sma.Hostname, Time: timeStamp}, nil
+	if d := sma.ExpireAfter; d.Hours < 0 || d.Days < 0 || d.Months < 0 || d.Years < 0 {
+		return nil, errors.Fatal("--expire-after must not contain negative values")
+	}
+	return &snapshotMetadata{Hostname: sma.Hostname, Time: timeStamp, ExpireAfter: sma.ExpireAfter}, nil
 }
 
 // RewriteOptions collects all options for the rewrite command.
@@ -111,6 +118,7 @@ type RewriteOptions struct {
 	data.SnapshotFilter
 	filter.ExcludePatternOptions
 	filter.IncludePatternOptions
+	SigningOptions
 }
 
 func (opts *RewriteOptions) AddFlags(f *pflag.FlagSet) {
@@ -118,18 +126,20 @@ func (opts *RewriteOptions) AddFlags(f *pflag.FlagSet) {
 	f.BoolVarP(&opts.DryRun, "dry-run", "n", false, "do not do anything, just print what would be done")
 	f.StringVar(&opts.Metadata.Hostname, "new-host", "", "replace hostname")
 	f.StringVar(&opts.Metadata.Time, "new-time", "", "replace time of the backup")
+	f.Var(&opts.Metadata.ExpireAfter, "expire-after", "let `forget` remove the new snapshots once this `duration` has passed since the snapshot time")
 	f.BoolVarP(&opts.SnapshotSummary, "snapshot-summary", "s", false, "create snapshot summary record if it does not exist")
 
 	initMultiSnapshotFilter(f, &opts.SnapshotFilter, true)
 	opts.ExcludePatternOptions.Add(f)
 	opts.IncludePatternOptions.Add(f)
+	opts.SigningOptions.AddFlags(f)
 }
 
 // rewriteFilterFunc returns the filtered tree ID or an error. If a snapshot summary is returned, the snapshot will
 // be updated accordingly.
 type rewriteFilterFunc func(ctx context.Context, sn *data.Snapshot, uploader restic.BlobSaver) (restic.ID, *data.SnapshotSummary, error)
 
-func rewriteSnapshot(ctx context.Context, repo *repository.Repository, sn *data.Snapshot, opts RewriteOptions, printer restic.Printer) (bool, error) {
+func rewriteSnapshot(ctx context.Context, repo *repository.Repository, sn *data.Snapshot, opts RewriteOptions, signingKey ed25519.PrivateKey, printer restic.Printer) (bool, error) {
 	if sn.Tree == nil {
 		return false, errors.Errorf("snapshot %v has nil tree", sn.ID().Str())
 	}
@@ -187,11 +197,11 @@ func rewriteSnapshot(ctx context.Context, repo *repository.Repository, sn *data.
 	}
 
 	return filterAndReplaceSnapshot(ctx, repo, sn,
-		filter, opts.DryRun, opts.Forget, metadata, "rewrite", printer, len(includeByNameFuncs) > 0)
+		filter, opts.DryRun, opts.Forget, metadata, "rewrite", signingKey, printer, len(includeByNameFuncs) > 0)
 }
 
 func filterAndReplaceSnapshot(ctx context.Context, repo restic.Repository, sn *data.Snapshot,
-	filter rewriteFilterFunc, dryRun bool, forget bool, newMetadata *snapshotMetadata, addTag string, printer restic.Printer,
+	filter rewriteFilterFunc, dryRun bool, forget bool, newMetadata *snapshotMetadata, addTag string, signingKey ed25519.PrivateKey, printer restic.Printer,
 	keepEmptySnapshot bool) (bool, error) {
 
 	var filteredTree restic.ID
@@ -210,6 +220,9 @@ func filterAndReplaceSnapshot(ctx context.Context, repo restic.Repository, sn *d
 			debug.Log("Snapshot %v not modified", sn)
 			return false, nil
 		}
+		if sn.Hold {
+			return false, errors.Fatalf("snapshot %v is on legal hold and cannot be removed although it is empty", sn.ID().Str())
+		}
 		if dryRun {
 			printer.P("would delete empty snapshot")
 		} else {
@@ -233,6 +246,9 @@ func filterAndReplaceSnapshot(ctx context.Context, repo restic.Repository, sn *d
 	}
 
 	debug.Log("Snapshot %v modified", sn)
+	if forget && sn.Hold {
+		return false, errors.Fatalf("snapshot %v is on legal hold and cannot be removed, use \"restic tag --release\" first", sn.ID().Str())
+	}
 	if dryRun {
 		printer.P("would save new snapshot")
 
@@ -248,6 +264,10 @@ func filterAndReplaceSnapshot(ctx context.Context, repo restic.Repository, sn *d
 			printer.P("would set hostname to %s", newMetadata.Hostname)
 		}
 
+		if newMetadata != nil && !newMetadata.ExpireAfter.Zero() {
+			printer.P("would set expiry to %v after the snapshot time", newMetadata.ExpireAfter)
+		}
+
 		return true, nil
 	}
 
@@ -272,6 +292,15 @@ func filterAndReplaceSnapshot(ctx context.Context, repo restic.Repository, sn *d
 		sn.Hostname = newMetadata.Hostname
 	}
 
+	if newMetadata != nil && !newMetadata.ExpireAfter.Zero() {
+		sn.SetExpiry(newMetadata.ExpireAfter)
+		printer.P("setting expiry to %s", sn.Expiry)
+	}
+
+	if err := resignSnapshot(sn, signingKey); err != nil {
+		return false, err
+	}
+
 	// Save the new snapshot.
 	id, err := data.SaveSnapshot(ctx, repo, sn)
 	if err != nil {
@@ -300,10 +329,14 @@ func runRewrite(ctx context.Context, opts RewriteOptions, gopts global.Options,
 
 	printer := progress.NewTerminalPrinter(false, gopts.Verbosity, term)
 
+	signingKey, err := opts.SigningOptions.load()
+	if err != nil {
+		return err
+	}
+
 	var (
 		repo   *repository.Repository
 		unlock func()
-		err    error
 	)
 
 	if opts.Forget {
@@ -325,6 +358,10 @@ func runRewrite(ctx context.Context, opts RewriteOptions, gopts global.Options,
 	if err = repo.LoadIndex(ctx, printer); err != nil {
 		return err
 	}
+	// packs marked for deletion by a non-exclusive prune must not be used for deduplication
+	if err = repo.ExcludePendingDeletions(ctx); err != nil {
+		return err
+	}
 
 	changedCount := 0
 	err = opts.SnapshotFilter.FindAll(ctx, snapshotLister, repo, args, func(_ string, sn *data.Snapshot, err error) error {
@@ -332,7 +369,7 @@ func runRewrite(ctx context.Context, opts RewriteOptions, gopts global.Options,
 			return err
 		}
 		printer.P("\n%v", sn)
-		changed, err := rewriteSnapshot(ctx, repo, sn, opts, printer)
+		changed, err := rewriteSnapshot(ctx, repo, sn, opts, signingKey, printer)
 		if err != nil {
 			return errors.Fatalf("unable to rewrite snapshot ID %q: %v", sn.ID().Str(), err)
 		}
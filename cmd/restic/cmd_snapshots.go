@@ -59,6 +59,7 @@ type SnapshotOptions struct {
 	last    bool // Deprecated in favour of Latest.
 	Latest  int
 	GroupBy data.SnapshotGroupByOptions
+	SignatureOptions
 }
 
 func (opts *SnapshotOptions) AddFlags(f *pflag.FlagSet) {
@@ -71,7 +72,8 @@ func (opts *SnapshotOptions) AddFlags(f *pflag.FlagSet) {
 		panic(err)
 	}
 	f.IntVar(&opts.Latest, "latest", 0, "only show the last `n` snapshots for each host and path")
-	f.VarP(&opts.GroupBy, "group-by", "g", "`group` snapshots by host, paths and/or tags, separated by comma")
+	f.VarP(&opts.GroupBy, "group-by", "g", "`group` snapshots by host, paths, tags, user, first-path, tag:<prefix>* and/or label:<key>, separated by comma")
+	opts.SignatureOptions.AddFlags(f)
 }
 
 func (opts *SnapshotOptions) Finalize() error {
@@ -83,6 +85,11 @@ func (opts *SnapshotOptions) Finalize() error {
 
 func runSnapshots(ctx context.Context, opts SnapshotOptions, gopts global.Options, args []string, term ui.Terminal) error {
 	printer := progress.NewTerminalPrinter(gopts.JSON, gopts.Verbosity, term)
+	trusted, err := opts.SignatureOptions.load()
+	if err != nil {
+		return err
+	}
+
 	ctx, repo, unlock, err := openWithReadLock(ctx, gopts, gopts.NoLock, printer)
 	if err != nil {
 		return err
@@ -101,6 +108,8 @@ func runSnapshots(ctx context.Context, opts SnapshotOptions, gopts global.Option
 		return err
 	}
 
+	signatures := verifySnapshotSignatures(snapshots, trusted)
+
 	snapshotGroups, grouped, err := data.GroupSnapshots(snapshots, opts.GroupBy)
 	if err != nil {
 		return err
@@ -123,7 +132,7 @@ func runSnapshots(ctx context.Context, opts SnapshotOptions, gopts global.Option
 	}
 
 	if gopts.JSON {
-		err := printSnapshotGroupJSON(gopts.Term.OutputWriter(), snapshotGroups, grouped)
+		err := printSnapshotGroupJSON(gopts.Term.OutputWriter(), snapshotGroups, grouped, signatures)
 		if err != nil {
 			printer.E("error printing snapshots: %v", err)
 		}
@@ -141,7 +150,7 @@ func runSnapshots(ctx context.Context, opts SnapshotOptions, gopts global.Option
 				return err
 			}
 		}
-		err := PrintSnapshots(gopts.Term.OutputWriter(), list, nil, opts.Compact)
+		err := PrintSnapshots(gopts.Term.OutputWriter(), list, nil, signatures, opts.Compact)
 		if err != nil {
 			return err
 		}
@@ -199,8 +208,9 @@ func filterLatestSnapshotsInGroup(list data.Snapshots, limit int) data.Snapshots
 	return list[:min(limit, len(list))]
 }
 
-// PrintSnapshots prints a text table of the snapshots in list to stdout.
-func PrintSnapshots(stdout io.Writer, list data.Snapshots, reasons []data.KeepReason, compact bool) error {
+// PrintSnapshots prints a text table of the snapshots in list to stdout. If
+// signatures is not nil, the signature status of each snapshot is shown.
+func PrintSnapshots(stdout io.Writer, list data.Snapshots, reasons []data.KeepReason, signatures map[restic.ID]data.SignatureStatus, compact bool) error {
 	// keep the reasons a snasphot is being kept in a map, so that it doesn't
 	// get lost when the list of snapshots is sorted
 	keepReasons := make(map[restic.ID]data.KeepReason, len(reasons))
@@ -244,6 +254,9 @@ func PrintSnapshots(stdout io.Writer, list data.Snapshots, reasons []data.KeepRe
 		if hasSize {
 			tab.AddColumn("Size", `{{ .Size }}`)
 		}
+		if signatures != nil {
+			tab.AddColumn("Signature", `{{ .Signature }}`)
+		}
 	} else {
 		tab.AddColumn("ID", "{{ .ID }}")
 		tab.AddColumn("Time", "{{ .Timestamp }}")
@@ -256,6 +269,9 @@ func PrintSnapshots(stdout io.Writer, list data.Snapshots, reasons []data.KeepRe
 		if hasSize {
 			tab.AddColumn("Size", `{{ .Size }}`)
 		}
+		if signatures != nil {
+			tab.AddColumn("Signature", `{{ .Signature }}`)
+		}
 	}
 
 	type snapshot struct {
@@ -266,6 +282,7 @@ func PrintSnapshots(stdout io.Writer, list data.Snapshots, reasons []data.KeepRe
 		Reasons   []string
 		Paths     []string
 		Size      string
+		Signature string
 	}
 
 	var multiline bool
@@ -291,6 +308,10 @@ func PrintSnapshots(stdout io.Writer, list data.Snapshots, reasons []data.KeepRe
 			data.Size = ui.FormatBytes(sn.Summary.TotalBytesProcessed)
 		}
 
+		if signatures != nil {
+			data.Signature = signatures[*sn.ID()].String()
+		}
+
 		tab.AddRow(data)
 	}
 
@@ -334,7 +355,7 @@ func PrintSnapshotGroupHeader(stdout io.Writer, groupKeyJSON string) error {
 		return err
 	}
 
-	if key.Hostname == "" && key.Tags == nil && key.Paths == nil {
+	if key.Hostname == "" && key.Tags == nil && key.Paths == nil && key.Username == "" && key.FirstPaths == nil {
 		return nil
 	}
 
@@ -350,6 +371,12 @@ func PrintSnapshotGroupHeader(stdout io.Writer, groupKeyJSON string) error {
 	if key.Paths != nil {
 		infoStrings = append(infoStrings, "paths ["+strings.Join(key.Paths, ", ")+"]")
 	}
+	if key.Username != "" {
+		infoStrings = append(infoStrings, "user ["+key.Username+"]")
+	}
+	if key.FirstPaths != nil {
+		infoStrings = append(infoStrings, "first path ["+strings.Join(key.FirstPaths, ", ")+"]")
+	}
 	if infoStrings != nil {
 		header += " for (" + strings.Join(infoStrings, ", ") + ")"
 	}
@@ -364,6 +391,8 @@ type Snapshot struct {
 
 	ID      *restic.ID `json:"id"`
 	ShortID string     `json:"short_id"` // deprecated
+
+	SignatureStatus string `json:"signature_status,omitempty"`
 }
 
 // SnapshotGroup helps to print SnapshotGroups as JSON with their GroupReasons included.
@@ -373,7 +402,7 @@ type SnapshotGroup struct {
 }
 
 // printSnapshotGroupJSON writes the JSON representation of list to stdout.
-func printSnapshotGroupJSON(stdout io.Writer, snGroups map[string]data.Snapshots, grouped bool) error {
+func printSnapshotGroupJSON(stdout io.Writer, snGroups map[string]data.Snapshots, grouped bool, signatures map[restic.ID]data.SignatureStatus) error {
 	if grouped {
 		snapshotGroups := []SnapshotGroup{}
 
@@ -393,6 +422,9 @@ func printSnapshotGroupJSON(stdout io.Writer, snGroups map[string]data.Snapshots
 					ID:       sn.ID(),
 					ShortID:  sn.ID().Str(),
 				}
+				if signatures != nil {
+					k.SignatureStatus = signatures[*sn.ID()].String()
+				}
 				snapshots = append(snapshots, k)
 			}
 
@@ -416,6 +448,9 @@ func printSnapshotGroupJSON(stdout io.Writer, snGroups map[string]data.Snapshots
 				ID:       sn.ID(),
 				ShortID:  sn.ID().Str(),
 			}
+			if signatures != nil {
+				k.SignatureStatus = signatures[*sn.ID()].String()
+			}
 			snapshots = append(snapshots, k)
 		}
 	}
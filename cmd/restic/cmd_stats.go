@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/restic/chunker"
@@ -39,7 +40,8 @@ It operates on all snapshots matching the selection criteria or all
 snapshots if nothing is specified. The special snapshot ID "latest"
 is also supported. Some modes make more sense over
 just a single snapshot, while others are useful across all snapshots,
-depending on what you are trying to calculate.
+depending on what you are trying to calculate. With "--group-by", the
+statistics are shown separately for each group of snapshots.
 
 The modes are:
 
@@ -82,11 +84,13 @@ type StatsOptions struct {
 	countMode string
 
 	data.SnapshotFilter
+	GroupBy data.SnapshotGroupByOptions
 }
 
 func (opts *StatsOptions) AddFlags(f *pflag.FlagSet) {
 	f.StringVar(&opts.countMode, "mode", countModeRestoreSize, "counting mode: restore-size (default), files-by-contents, blobs-per-file or raw-data")
 	initMultiSnapshotFilter(f, &opts.SnapshotFilter, true)
+	f.VarP(&opts.GroupBy, "group-by", "g", "show statistics per `group` of snapshots by host, paths, tags, user, first-path, tag:<prefix>* and/or label:<key>, separated by comma")
 }
 
 func must(err error) {
@@ -125,14 +129,6 @@ func runStats(ctx context.Context, opts StatsOptions, gopts global.Options, args
 		printer.S("scanning...")
 	}
 
-	// create a container for the stats (and other needed state)
-	stats := &statsContainer{
-		uniqueFiles:    make(map[fileID]struct{}),
-		fileBlobs:      make(map[string]restic.IDSet),
-		blobs:          repo.NewAssociatedBlobSet(),
-		SnapshotsCount: 0,
-	}
-
 	var snapshots data.Snapshots
 	err = opts.SnapshotFilter.FindAll(ctx, snapshotLister, repo, args, func(_ string, sn *data.Snapshot, err error) error {
 		if err != nil {
@@ -148,14 +144,92 @@ func runStats(ctx context.Context, opts StatsOptions, gopts global.Options, args
 	statsProgress := statsui.NewProgress(term, gopts.Quiet, gopts.JSON, uint64(len(snapshots)))
 	defer statsProgress.Done()
 
+	if opts.GroupBy.Empty() {
+		stats, err := statsCollect(ctx, repo, opts, snapshots, statsProgress)
+		if err != nil {
+			return err
+		}
+		// stop progress bar to prevent mangled output
+		statsProgress.Done()
+
+		if gopts.JSON {
+			err = json.NewEncoder(gopts.Term.OutputWriter()).Encode(stats)
+			if err != nil {
+				return fmt.Errorf("encoding output: %v", err)
+			}
+			return nil
+		}
+		printStats(printer, opts, stats)
+		return nil
+	}
+
+	snapshotGroups, _, err := data.GroupSnapshots(snapshots, opts.GroupBy)
+	if err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(snapshotGroups))
+	for k := range snapshotGroups {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	groups := make([]StatsGroup, 0, len(keys))
+	for _, k := range keys {
+		stats, err := statsCollect(ctx, repo, opts, snapshotGroups[k], statsProgress)
+		if err != nil {
+			return err
+		}
+		var key data.SnapshotGroupKey
+		if err := json.Unmarshal([]byte(k), &key); err != nil {
+			return err
+		}
+		groups = append(groups, StatsGroup{GroupKey: key, Stats: stats})
+	}
+	statsProgress.Done()
+
+	if gopts.JSON {
+		err = json.NewEncoder(gopts.Term.OutputWriter()).Encode(groups)
+		if err != nil {
+			return fmt.Errorf("encoding output: %v", err)
+		}
+		return nil
+	}
+	for i, k := range keys {
+		if i > 0 {
+			printer.S("")
+		}
+		if err := PrintSnapshotGroupHeader(gopts.Term.OutputWriter(), k); err != nil {
+			return err
+		}
+		printStats(printer, opts, groups[i].Stats)
+	}
+	return nil
+}
+
+// StatsGroup is the JSON representation of the statistics for a snapshot group.
+type StatsGroup struct {
+	GroupKey data.SnapshotGroupKey `json:"group_key"`
+	Stats    *statsContainer       `json:"stats"`
+}
+
+// statsCollect accumulates the statistics for the given snapshots.
+func statsCollect(ctx context.Context, repo restic.Repository, opts StatsOptions, snapshots data.Snapshots, statsProgress *statsui.Progress) (*statsContainer, error) {
+	// create a container for the stats (and other needed state)
+	stats := &statsContainer{
+		uniqueFiles:    make(map[fileID]struct{}),
+		fileBlobs:      make(map[string]restic.IDSet),
+		blobs:          repo.NewAssociatedBlobSet(),
+		SnapshotsCount: 0,
+	}
+
 	for _, sn := range snapshots {
-		err = statsWalkSnapshot(ctx, sn, repo, opts, stats, statsProgress)
+		err := statsWalkSnapshot(ctx, sn, repo, opts, stats, statsProgress)
 		if err != nil {
-			return fmt.Errorf("error walking snapshot: %v", err)
+			return nil, fmt.Errorf("error walking snapshot: %v", err)
 		}
 	}
 	if ctx.Err() != nil {
-		return ctx.Err()
+		return nil, ctx.Err()
 	}
 
 	if opts.countMode == countModeRawData {
@@ -163,7 +237,7 @@ func runStats(ctx context.Context, opts StatsOptions, gopts global.Options, args
 		for blobHandle := range stats.blobs.Keys() {
 			pbs := repo.LookupBlob(blobHandle)
 			if len(pbs) == 0 {
-				return fmt.Errorf("blob %v not found", blobHandle)
+				return nil, fmt.Errorf("blob %v not found", blobHandle)
 			}
 			stats.TotalSize += uint64(pbs[0].CiphertextLength())
 			if repo.Config().Version >= 2 {
@@ -184,17 +258,10 @@ func runStats(ctx context.Context, opts StatsOptions, gopts global.Options, args
 			stats.CompressionSpaceSaving = (1 - float64(stats.TotalSize)/float64(stats.TotalUncompressedSize)) * 100
 		}
 	}
-	// stop progress bar to prevent mangled output
-	statsProgress.Done()
-
-	if gopts.JSON {
-		err = json.NewEncoder(gopts.Term.OutputWriter()).Encode(stats)
-		if err != nil {
-			return fmt.Errorf("encoding output: %v", err)
-		}
-		return nil
-	}
+	return stats, nil
+}
 
+func printStats(printer restic.Printer, opts StatsOptions, stats *statsContainer) {
 	printer.S("Stats in %s mode:", opts.countMode)
 	printer.S("     Snapshots processed:  %d", stats.SnapshotsCount)
 	if stats.TotalBlobCount > 0 {
@@ -216,8 +283,6 @@ func runStats(ctx context.Context, opts StatsOptions, gopts global.Options, args
 	if stats.CompressionSpaceSaving > 0 {
 		printer.S("Compression Space Saving:  %.2f%%", stats.CompressionSpaceSaving)
 	}
-
-	return nil
 }
 
 func statsWalkSnapshot(ctx context.Context, snapshot *data.Snapshot, repo restic.Loader, opts StatsOptions, stats *statsContainer, sp *statsui.Progress) error {
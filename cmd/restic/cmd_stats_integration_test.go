@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/restic/restic/internal/data"
+	"github.com/restic/restic/internal/global"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestStatsGroupBy(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	dir := []string{filepath.Join(env.testdata, "0", "0", "9")}
+	testRunBackup(t, "", dir, BackupOptions{Tags: data.TagLists{{"app=web", "daily"}}}, env.gopts)
+	testRunBackup(t, "", dir, BackupOptions{Tags: data.TagLists{{"app=web"}}}, env.gopts)
+	testRunBackup(t, "", dir, BackupOptions{Tags: data.TagLists{{"app=db"}}}, env.gopts)
+
+	opts := StatsOptions{countMode: countModeRestoreSize}
+	rtest.OK(t, opts.GroupBy.Set("label:app"))
+	buf, err := withCaptureStdout(t, env.gopts, func(ctx context.Context, gopts global.Options) error {
+		gopts.JSON = true
+		return runStats(ctx, opts, gopts, nil, gopts.Term)
+	})
+	rtest.OK(t, err)
+
+	var groups []StatsGroup
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &groups))
+	rtest.Equals(t, 2, len(groups))
+	rtest.Equals(t, []string{"app=db"}, groups[0].GroupKey.Tags)
+	rtest.Equals(t, 1, groups[0].Stats.SnapshotsCount)
+	rtest.Equals(t, []string{"app=web"}, groups[1].GroupKey.Tags)
+	rtest.Equals(t, 2, groups[1].Stats.SnapshotsCount)
+	rtest.Equals(t, 2*groups[0].Stats.TotalSize, groups[1].Stats.TotalSize)
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/restic/restic/internal/data"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/global"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui"
+	copyui "github.com/restic/restic/internal/ui/copy"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+func newSyncCommand(globalOptions *global.Options) *cobra.Command {
+	var opts SyncOptions
+	cmd := &cobra.Command{
+		Use:   "sync [flags]",
+		Short: "Synchronize the snapshots of two repositories",
+		Long: `
+The "sync" command makes two repositories hold the same set of snapshots. Each
+snapshot which is only contained in one of the repositories is copied to the
+other repository, in the same way as the "copy" command does. Snapshots are
+matched using their original snapshot ID, such that snapshots are not copied
+again after changing their tags.
+
+After each run, the snapshots contained in both repositories are recorded in
+both repositories. With "--propagate-forget", a recorded snapshot which was
+removed from one repository since the last run, for example by "forget", is
+also removed from the other repository instead of being copied again.
+Snapshots on legal hold are never removed.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful.
+Exit status is 1 if there was any error.
+Exit status is 10 if the repository does not exist.
+Exit status is 11 if the repository is already locked.
+Exit status is 12 if the password is incorrect.
+`,
+		GroupID:           cmdGroupDefault,
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runSync(cmd.Context(), opts, *globalOptions, args, globalOptions.Term)
+		},
+	}
+
+	opts.AddFlags(cmd.Flags())
+	return cmd
+}
+
+// SyncOptions bundles all options for the sync command.
+type SyncOptions struct {
+	global.SecondaryRepoOptions
+	data.SnapshotFilter
+	PropagateForget bool
+}
+
+func (opts *SyncOptions) AddFlags(f *pflag.FlagSet) {
+	opts.SecondaryRepoOptions.AddFlags(f, "other", "to synchronize with")
+	initMultiSnapshotFilter(f, &opts.SnapshotFilter, true)
+	f.BoolVar(&opts.PropagateForget, "propagate-forget", false, "remove snapshots which were removed from the other repository since the last sync")
+}
+
+// syncState records the snapshots which were contained in both repositories
+// after a sync. A recorded snapshot which is missing in one of the
+// repositories was removed since then, thus the state serves as a tombstone
+// record for it. The state is stored in both repositories.
+type syncState struct {
+	Time time.Time `json:"time"`
+	// Peer is the ID of the other repository.
+	Peer string `json:"peer"`
+	// Snapshots contains the original IDs of the snapshots.
+	Snapshots restic.IDs `json:"snapshots"`
+}
+
+// syncRepo is one of the two repositories synchronized by sync.
+type syncRepo struct {
+	repo   *repository.Repository
+	lister restic.Lister
+	// snapshots maps the original ID to all snapshots, regardless of the
+	// snapshot filter
+	snapshots map[restic.ID][]*data.Snapshot
+	// originals maps the snapshot ID to the original ID
+	originals map[restic.ID]restic.ID
+	// state are the recorded snapshots and files the state files for the peer
+	state restic.IDSet
+	files restic.IDs
+}
+
+func (r *syncRepo) String() string {
+	return r.repo.Config().ID[:8]
+}
+
+// originalSnapshotID returns the ID which identifies the snapshot across
+// copies and changes of its metadata.
+func originalSnapshotID(sn *data.Snapshot) restic.ID {
+	if sn.Original != nil && !sn.Original.IsNull() {
+		return *sn.Original
+	}
+	return *sn.ID()
+}
+
+func openSyncRepo(ctx context.Context, opts SyncOptions, gopts global.Options, printer restic.Printer) (context.Context, *syncRepo, func(), error) {
+	openWithLock := openWithAppendLock
+	if opts.PropagateForget {
+		// removing snapshots requires the same lock as forget
+		openWithLock = openWithExclusiveLock
+	}
+	ctx, repo, unlock, err := openWithLock(ctx, gopts, false, printer)
+	if err != nil {
+		return ctx, nil, nil, err
+	}
+
+	r := &syncRepo{
+		repo:      repo,
+		snapshots: make(map[restic.ID][]*data.Snapshot),
+		originals: make(map[restic.ID]restic.ID),
+	}
+	r.lister, err = restic.MemorizeList(ctx, repo, restic.SnapshotFile)
+	if err != nil {
+		unlock()
+		return ctx, nil, nil, err
+	}
+	return ctx, r, unlock, nil
+}
+
+func (r *syncRepo) load(ctx context.Context, peer string, printer restic.Printer) error {
+	if err := r.repo.LoadIndex(ctx, printer); err != nil {
+		return err
+	}
+	// both repositories receive snapshots, packs marked for deletion by a
+	// non-exclusive prune must not be used for deduplication
+	if err := r.repo.ExcludePendingDeletions(ctx); err != nil {
+		return err
+	}
+
+	err := data.ForAllSnapshots(ctx, r.lister, r.repo, nil, func(_ restic.ID, sn *data.Snapshot, err error) error {
+		if err != nil {
+			return err
+		}
+		id := originalSnapshotID(sn)
+		r.snapshots[id] = append(r.snapshots[id], sn)
+		r.originals[*sn.ID()] = id
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	r.state = restic.NewIDSet()
+	return r.repo.List(ctx, restic.SyncFile, func(id restic.ID, _ int64) error {
+		var state syncState
+		err := restic.LoadJSONUnpacked(ctx, r.repo, restic.SyncFile, id, &state)
+		if err != nil {
+			return fmt.Errorf("failed to load sync state %v: %w", id.Str(), err)
+		}
+		if state.Peer != peer {
+			return nil
+		}
+		r.files = append(r.files, id)
+		for _, id := range state.Snapshots {
+			r.state.Insert(id)
+		}
+		return nil
+	})
+}
+
+// saveState saves the recorded snapshots and removes the previous states.
+func (r *syncRepo) saveState(ctx context.Context, peer string, snapshots restic.IDSet) error {
+	state := &syncState{
+		Time:      time.Now(),
+		Peer:      peer,
+		Snapshots: snapshots.List(),
+	}
+	id, err := restic.SaveJSONUnpacked(ctx, r.repo, restic.WriteableSyncFile, state)
+	if err != nil {
+		return fmt.Errorf("failed to save sync state: %w", err)
+	}
+	debug.Log("saved sync state %v with %d snapshots", id.Str(), len(state.Snapshots))
+
+	for _, id := range r.files {
+		if err := r.repo.RemoveUnpacked(ctx, restic.WriteableSyncFile, id); err != nil {
+			debug.Log("unable to remove sync state %v: %v", id.Str(), err)
+		}
+	}
+	r.files = restic.IDs{id}
+	return nil
+}
+
+// forgottenSnapshots returns the snapshots of r matched by filter which were
+// removed from peer since the last sync, that is which are recorded in the
+// state but no longer contained in peer.
+func (r *syncRepo) forgottenSnapshots(peer *syncRepo, state restic.IDSet, filter *data.SnapshotFilter, printer restic.Printer) restic.IDSet {
+	remove := restic.NewIDSet()
+	for id := range state {
+		if _, ok := peer.snapshots[id]; ok {
+			continue
+		}
+		for _, sn := range r.snapshots[id] {
+			if !filter.Matches(sn) {
+				continue
+			}
+			if sn.Hold {
+				printer.P("snapshot %s is on legal hold, copying it to repository %v again", sn.ID().Str(), peer)
+				continue
+			}
+			remove.Insert(*sn.ID())
+		}
+	}
+	return remove
+}
+
+// removeSnapshots removes the snapshots from r. Returns the snapshots which
+// could not be removed.
+func (r *syncRepo) removeSnapshots(ctx context.Context, remove restic.IDSet, printer restic.Printer) (restic.IDSet, error) {
+	failed := restic.NewIDSet()
+	if len(remove) == 0 {
+		return failed, nil
+	}
+
+	printer.P("\nremoving %d snapshots from repository %v which were removed from the other repository", len(remove), r)
+	bar := printer.NewCounter("files deleted")
+	err := restic.ParallelRemove(ctx, r.repo, remove, restic.WriteableSnapshotFile, func(id restic.ID, err error) error {
+		if err != nil {
+			printer.E("unable to remove %v/%v from the repository\n", restic.SnapshotFile, id)
+			failed.Insert(id)
+		} else {
+			printer.V("removed snapshot %v", id.Str())
+		}
+		return nil
+	}, bar)
+	bar.Done()
+	return failed, err
+}
+
+// copyMissing copies all snapshots from src which are not contained in dst,
+// except for the snapshots in skip. Returns the original IDs of the copied
+// snapshots.
+func copyMissing(ctx context.Context, opts SyncOptions, src *syncRepo, dst *syncRepo, skip restic.IDSet,
+	progressPrinter copyui.ProgressPrinter, gopts global.Options, term ui.Terminal) (restic.IDSet, error) {
+
+	for id, snapshots := range src.snapshots {
+		if _, ok := dst.snapshots[id]; !ok {
+			continue
+		}
+		for _, sn := range snapshots {
+			skip.Insert(*sn.ID())
+		}
+	}
+
+	progressPrinter.P("\ncopying snapshots from repository %v to repository %v", src, dst)
+	copyOpts := CopyOptions{SnapshotFilter: opts.SnapshotFilter}
+	copied, err := copySnapshots(ctx, copyOpts, src.repo, dst.repo, src.lister, dst.lister, nil, skip, progressPrinter, gopts, term)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := restic.NewIDSet()
+	for _, sn := range copied {
+		ids.Insert(originalSnapshotID(sn))
+	}
+	return ids, nil
+}
+
+func runSync(ctx context.Context, opts SyncOptions, gopts global.Options, args []string, term ui.Terminal) error {
+	if len(args) > 0 {
+		return errors.Fatal("the sync command expects no arguments, only options - please see `restic help sync` for usage and flags")
+	}
+
+	var progressPrinter copyui.ProgressPrinter
+	if gopts.JSON {
+		progressPrinter = copyui.NewJSONProgress(term, gopts.Verbosity)
+	} else {
+		progressPrinter = copyui.NewTextProgress(term, gopts.Verbosity)
+	}
+	var printer restic.Printer = progressPrinter
+
+	otherGopts, _, err := opts.SecondaryRepoOptions.FillGlobalOpts(ctx, gopts, "other")
+	if err != nil {
+		return err
+	}
+
+	ctx, a, unlock, err := openSyncRepo(ctx, opts, gopts, printer)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	ctx, b, unlock, err := openSyncRepo(ctx, opts, otherGopts, printer)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if a.repo.Config().ID == b.repo.Config().ID {
+		return errors.Fatal("cannot synchronize a repository with itself")
+	}
+	if err := a.load(ctx, b.repo.Config().ID, printer); err != nil {
+		return err
+	}
+	if err := b.load(ctx, a.repo.Config().ID, printer); err != nil {
+		return err
+	}
+
+	// the state is saved to both repositories, use both in case saving failed for one
+	state := restic.NewIDSet()
+	state.Merge(a.state)
+	state.Merge(b.state)
+
+	removeA := restic.NewIDSet()
+	removeB := restic.NewIDSet()
+	if opts.PropagateForget {
+		removeA = a.forgottenSnapshots(b, state, &opts.SnapshotFilter, printer)
+		removeB = b.forgottenSnapshots(a, state, &opts.SnapshotFilter, printer)
+	}
+
+	copiedToB, err := copyMissing(ctx, opts, a, b, removeA.Clone(), progressPrinter, gopts, term)
+	if err != nil {
+		return err
+	}
+	copiedToA, err := copyMissing(ctx, opts, b, a, removeB.Clone(), progressPrinter, gopts, term)
+	if err != nil {
+		return err
+	}
+
+	failedA, err := a.removeSnapshots(ctx, removeA, printer)
+	if err != nil {
+		return err
+	}
+	failedB, err := b.removeSnapshots(ctx, removeB, printer)
+	if err != nil {
+		return err
+	}
+
+	// record all snapshots which are now contained in both repositories
+	synced := restic.NewIDSet()
+	synced.Merge(copiedToA)
+	synced.Merge(copiedToB)
+	for id := range a.snapshots {
+		if _, ok := b.snapshots[id]; ok {
+			synced.Insert(id)
+		}
+	}
+	// retry the removal during the next sync
+	for id := range failedA {
+		synced.Insert(a.originals[id])
+	}
+	for id := range failedB {
+		synced.Insert(b.originals[id])
+	}
+
+	if err := a.saveState(ctx, b.repo.Config().ID, synced); err != nil {
+		return err
+	}
+	return b.saveState(ctx, a.repo.Config().ID, synced)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/restic/restic/internal/global"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func testRunSync(t testing.TB, gopts global.Options, otherGopts global.Options, opts SyncOptions) {
+	opts.SecondaryRepoOptions = global.SecondaryRepoOptions{
+		Repo:               otherGopts.Repo,
+		Password:           otherGopts.Password,
+		InsecureNoPassword: otherGopts.InsecureNoPassword,
+	}
+	rtest.OK(t, withTermStatus(t, gopts, func(ctx context.Context, gopts global.Options) error {
+		return runSync(context.TODO(), opts, gopts, nil, gopts.Term)
+	}))
+}
+
+func TestSync(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	env2, cleanup2 := withTestEnvironment(t)
+	defer cleanup2()
+
+	testSetupBackupData(t, env)
+	testRunInit(t, env2.gopts)
+	opts := BackupOptions{}
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9")}, opts, env.gopts)
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9", "2")}, opts, env.gopts)
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9", "3")}, opts, env2.gopts)
+
+	// snapshots are copied in both directions
+	testRunSync(t, env.gopts, env2.gopts, SyncOptions{})
+	snapshotIDs := testListSnapshots(t, env.gopts, 3)
+	testListSnapshots(t, env2.gopts, 3)
+	testRunCheck(t, env.gopts)
+	testRunCheck(t, env2.gopts)
+	rtest.Equals(t, 1, len(testRunList(t, env.gopts, "sync")))
+	rtest.Equals(t, 1, len(testRunList(t, env2.gopts, "sync")))
+
+	// a second run does not copy anything
+	testRunSync(t, env2.gopts, env.gopts, SyncOptions{})
+	testListSnapshots(t, env.gopts, 3)
+	testListSnapshots(t, env2.gopts, 3)
+	rtest.Equals(t, 1, len(testRunList(t, env.gopts, "sync")))
+
+	// without --propagate-forget, forgotten snapshots are copied again
+	testRunForget(t, env.gopts, ForgetOptions{}, snapshotIDs[0].String())
+	testListSnapshots(t, env.gopts, 2)
+	testRunSync(t, env.gopts, env2.gopts, SyncOptions{})
+	testListSnapshots(t, env.gopts, 3)
+	testListSnapshots(t, env2.gopts, 3)
+
+	// with --propagate-forget, the snapshot is removed from the other repository
+	snapshotIDs = testListSnapshots(t, env.gopts, 3)
+	testRunForget(t, env.gopts, ForgetOptions{}, snapshotIDs[0].String())
+	testRunSync(t, env.gopts, env2.gopts, SyncOptions{PropagateForget: true})
+	testListSnapshots(t, env.gopts, 2)
+	testListSnapshots(t, env2.gopts, 2)
+	rtest.Equals(t, 1, len(testRunList(t, env2.gopts, "sync")))
+}
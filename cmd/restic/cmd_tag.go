@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"crypto/ed25519"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
@@ -30,6 +31,11 @@ add tags to/remove tags from the existing set.
 
 When no snapshotID is given, all snapshots matching the host, tag and path filter criteria are modified.
 
+The "--expire-after" option sets the time after which "forget" removes a
+snapshot, relative to the snapshot time. "--no-expiry" removes the expiry
+time again. Snapshots put on legal hold using "--hold" are never removed, also
+not after their expiry, until the hold is lifted using "--release".
+
 EXIT STATUS
 ===========
 
@@ -57,13 +63,64 @@ type TagOptions struct {
 	SetTags    data.TagLists
 	AddTags    data.TagLists
 	RemoveTags data.TagLists
+	snapshotRetention
+	SigningOptions
+}
+
+// snapshotRetention describes changes to the expiry and legal hold of a snapshot.
+type snapshotRetention struct {
+	ExpireAfter data.Duration
+	NoExpiry    bool
+	Hold        bool
+	Release     bool
+}
+
+func (r snapshotRetention) empty() bool {
+	return r.ExpireAfter.Zero() && !r.NoExpiry && !r.Hold && !r.Release
+}
+
+func (r snapshotRetention) check() error {
+	if d := r.ExpireAfter; d.Hours < 0 || d.Days < 0 || d.Months < 0 || d.Years < 0 {
+		return errors.Fatal("--expire-after must not contain negative values")
+	}
+	if !r.ExpireAfter.Zero() && r.NoExpiry {
+		return errors.Fatal("--expire-after and --no-expiry cannot be given at the same time")
+	}
+	if r.Hold && r.Release {
+		return errors.Fatal("--hold and --release cannot be given at the same time")
+	}
+	return nil
+}
+
+// apply modifies the expiry and legal hold of sn and returns whether sn was changed.
+func (r snapshotRetention) apply(sn *data.Snapshot) bool {
+	changed := false
+	if !r.ExpireAfter.Zero() {
+		old := sn.Expiry
+		sn.SetExpiry(r.ExpireAfter)
+		changed = old == nil || !old.Equal(*sn.Expiry)
+	}
+	if r.NoExpiry && sn.Expiry != nil {
+		sn.Expiry = nil
+		changed = true
+	}
+	if (r.Hold && !sn.Hold) || (r.Release && sn.Hold) {
+		sn.Hold = r.Hold
+		changed = true
+	}
+	return changed
 }
 
 func (opts *TagOptions) AddFlags(f *pflag.FlagSet) {
 	f.Var(&opts.SetTags, "set", "`tags` which will replace the existing tags in the format `tag[,tag,...]` (can be given multiple times)")
 	f.Var(&opts.AddTags, "add", "`tags` which will be added to the existing tags in the format `tag[,tag,...]` (can be given multiple times)")
 	f.Var(&opts.RemoveTags, "remove", "`tags` which will be removed from the existing tags in the format `tag[,tag,...]` (can be given multiple times)")
+	f.Var(&opts.ExpireAfter, "expire-after", "let `forget` remove the snapshots once this `duration` has passed since the snapshot time (e.g. 90d, 1y6m)")
+	f.BoolVar(&opts.NoExpiry, "no-expiry", false, "remove the expiry time of the snapshots")
+	f.BoolVar(&opts.Hold, "hold", false, "put the snapshots on legal hold, which prevents their removal by forget")
+	f.BoolVar(&opts.Release, "release", false, "release the snapshots from legal hold")
 	initMultiSnapshotFilter(f, &opts.SnapshotFilter, true)
+	opts.SigningOptions.AddFlags(f)
 }
 
 type changedSnapshot struct {
@@ -77,7 +134,7 @@ type changedSnapshotsSummary struct {
 	ChangedSnapshots int    `json:"changed_snapshots"`
 }
 
-func changeTags(ctx context.Context, repo *repository.Repository, sn *data.Snapshot, setTags, addTags, removeTags []string, printFunc func(changedSnapshot)) (bool, error) {
+func changeTags(ctx context.Context, repo *repository.Repository, sn *data.Snapshot, setTags, addTags, removeTags []string, retention snapshotRetention, signingKey ed25519.PrivateKey, printFunc func(changedSnapshot)) (bool, error) {
 	var changed bool
 
 	if len(setTags) != 0 {
@@ -93,6 +150,9 @@ func changeTags(ctx context.Context, repo *repository.Repository, sn *data.Snaps
 			changed = true
 		}
 	}
+	if retention.apply(sn) {
+		changed = true
+	}
 
 	if changed {
 		// Retain the original snapshot id over all tag changes.
@@ -100,6 +160,10 @@ func changeTags(ctx context.Context, repo *repository.Repository, sn *data.Snaps
 			sn.Original = sn.ID()
 		}
 
+		if err := resignSnapshot(sn, signingKey); err != nil {
+			return false, err
+		}
+
 		// Save the new snapshot.
 		id, err := data.SaveSnapshot(ctx, repo, sn)
 		if err != nil {
@@ -123,12 +187,20 @@ func changeTags(ctx context.Context, repo *repository.Repository, sn *data.Snaps
 func runTag(ctx context.Context, opts TagOptions, gopts global.Options, term ui.Terminal, args []string) error {
 	printer := progress.NewTerminalPrinter(gopts.JSON, gopts.Verbosity, term)
 
-	if len(opts.SetTags) == 0 && len(opts.AddTags) == 0 && len(opts.RemoveTags) == 0 {
+	if len(opts.SetTags) == 0 && len(opts.AddTags) == 0 && len(opts.RemoveTags) == 0 && opts.snapshotRetention.empty() {
 		return errors.Fatal("nothing to do!")
 	}
 	if len(opts.SetTags) != 0 && (len(opts.AddTags) != 0 || len(opts.RemoveTags) != 0) {
 		return errors.Fatal("--set and --add/--remove cannot be given at the same time")
 	}
+	if err := opts.snapshotRetention.check(); err != nil {
+		return err
+	}
+
+	signingKey, err := opts.SigningOptions.load()
+	if err != nil {
+		return err
+	}
 
 	printer.P("create exclusive lock for repository")
 	ctx, repo, unlock, err := openWithExclusiveLock(ctx, gopts, false, printer)
@@ -163,7 +235,7 @@ func runTag(ctx context.Context, opts TagOptions, gopts global.Options, term ui.
 		if err != nil {
 			return err
 		}
-		changed, err := changeTags(ctx, repo, sn, opts.SetTags.Flatten(), opts.AddTags.Flatten(), opts.RemoveTags.Flatten(), printFunc)
+		changed, err := changeTags(ctx, repo, sn, opts.SetTags.Flatten(), opts.AddTags.Flatten(), opts.RemoveTags.Flatten(), opts.snapshotRetention, signingKey, printFunc)
 		if err != nil {
 			printer.E("unable to modify the tags for snapshot ID %q, ignoring: %v", sn.ID(), err)
 			return nil
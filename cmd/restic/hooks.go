@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// hookWaitDelay is the time to wait for the output of a hook after it has
+// exited or was killed. Processes started in the background by a hook can keep
+// the output open, which must not block the backup.
+const hookWaitDelay = 2 * time.Second
+
+// backupHooks runs the commands configured by --pre-hook, --post-hook and
+// --on-failure-hook.
+type backupHooks struct {
+	pre, post, onFailure string
+	timeout              time.Duration
+	printer              restic.Printer
+
+	// env contains the environment variables which are set for all hooks
+	env []string
+}
+
+func newBackupHooks(opts BackupOptions, printer restic.Printer) *backupHooks {
+	host := opts.Host
+	if host == "" {
+		host, _ = os.Hostname()
+	}
+
+	return &backupHooks{
+		pre:       opts.PreHook,
+		post:      opts.PostHook,
+		onFailure: opts.OnFailureHook,
+		timeout:   opts.HookTimeout,
+		printer:   printer,
+		env: []string{
+			"RESTIC_BACKUP_HOST=" + host,
+			"RESTIC_BACKUP_TAGS=" + strings.Join(opts.Tags.Flatten(), ","),
+		},
+	}
+}
+
+// runPre runs the pre-hook. The paths are the arguments passed to the backup
+// command.
+func (h *backupHooks) runPre(ctx context.Context, paths []string) error {
+	return h.run(ctx, "pre-hook", h.pre, []string{
+		"RESTIC_HOOK=pre",
+		"RESTIC_BACKUP_PATHS=" + strings.Join(paths, "\n"),
+	})
+}
+
+// runPost runs the post-hook and, if the backup failed, the on-failure hook.
+// Errors of these hooks are only reported as warnings, the returned error is
+// always backupErr.
+func (h *backupHooks) runPost(ctx context.Context, paths []string, snapshotID restic.ID, backupErr error) error {
+	// hooks which clean up must run even if the backup was interrupted
+	ctx = context.WithoutCancel(ctx)
+	env := resultEnv(paths, snapshotID, backupErr)
+
+	if err := h.run(ctx, "post-hook", h.post, append(env, "RESTIC_HOOK=post")); err != nil {
+		h.printer.E("Warning: %v", err)
+	}
+	if backupErr != nil {
+		h.runOnFailure(ctx, env)
+	}
+	return backupErr
+}
+
+// runPreFailed runs the on-failure hook after the pre-hook failed.
+func (h *backupHooks) runPreFailed(ctx context.Context, paths []string, hookErr error) error {
+	err := errors.Fatalf("%v, backup aborted", hookErr)
+	h.runOnFailure(context.WithoutCancel(ctx), resultEnv(paths, restic.ID{}, err))
+	return err
+}
+
+func (h *backupHooks) runOnFailure(ctx context.Context, env []string) {
+	if err := h.run(ctx, "on-failure-hook", h.onFailure, append(env, "RESTIC_HOOK=failure")); err != nil {
+		h.printer.E("Warning: %v", err)
+	}
+}
+
+// resultEnv returns the environment variables which describe the result of
+// the backup.
+func resultEnv(paths []string, snapshotID restic.ID, backupErr error) []string {
+	result := "success"
+	switch {
+	case backupErr == ErrInvalidSourceData:
+		result = "incomplete"
+	case backupErr != nil:
+		result = "failure"
+	}
+
+	env := []string{
+		"RESTIC_BACKUP_PATHS=" + strings.Join(paths, "\n"),
+		"RESTIC_BACKUP_RESULT=" + result,
+		"RESTIC_BACKUP_EXIT_CODE=" + strconv.Itoa(exitCodeFromError(backupErr)),
+	}
+	if !snapshotID.IsNull() {
+		env = append(env, "RESTIC_SNAPSHOT_ID="+snapshotID.String())
+	}
+	if backupErr != nil {
+		env = append(env, "RESTIC_BACKUP_ERROR="+backupErr.Error())
+	}
+	return env
+}
+
+// run executes command with the additional environment variables in env. The
+// output of the command is passed on to the printer.
+func (h *backupHooks) run(ctx context.Context, name, command string, env []string) error {
+	if command == "" {
+		return nil
+	}
+
+	args, err := backend.SplitShellStrings(command)
+	if err != nil {
+		return fmt.Errorf("invalid %v: %w", name, err)
+	}
+
+	if h.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.timeout)
+		defer cancel()
+	}
+
+	h.printer.V("running %v %q", name, command)
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Env = append(append(os.Environ(), h.env...), env...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = hookWaitDelay
+
+	err = cmd.Run()
+	if errors.Is(err, exec.ErrWaitDelay) {
+		// the hook itself succeeded, but a background process kept the output open
+		err = nil
+	}
+
+	for sc := bufio.NewScanner(&stdout); sc.Scan(); {
+		h.printer.P("%v: %v", name, sc.Text())
+	}
+	for sc := bufio.NewScanner(&stderr); sc.Scan(); {
+		h.printer.E("%v: %v", name, sc.Text())
+	}
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%v %q timed out after %v", name, command, h.timeout)
+	}
+	if err != nil {
+		return fmt.Errorf("%v %q failed: %w", name, command, err)
+	}
+	return nil
+}
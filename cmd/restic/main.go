@@ -88,9 +88,11 @@ The full documentation can be found at https://restic.readthedocs.io/ .
 		newInitCommand(globalOptions),
 		newKeyCommand(globalOptions),
 		newListCommand(globalOptions),
+		newLocksCommand(globalOptions),
 		newLsCommand(globalOptions),
 		newMigrateCommand(globalOptions),
 		newOptionsCommand(globalOptions),
+		newParityCommand(globalOptions),
 		newPruneCommand(globalOptions),
 		newRebuildIndexCommand(globalOptions),
 		newRecoverCommand(globalOptions),
@@ -99,6 +101,7 @@ The full documentation can be found at https://restic.readthedocs.io/ .
 		newRewriteCommand(globalOptions),
 		newSnapshotsCommand(globalOptions),
 		newStatsCommand(globalOptions),
+		newSyncCommand(globalOptions),
 		newTagCommand(globalOptions),
 		newUnlockCommand(globalOptions),
 		newVersionCommand(globalOptions),
@@ -217,28 +220,32 @@ func main() {
 		}
 	}
 
-	var exitCode int
+	exitCode := exitCodeFromError(err)
+	if exitCode != 0 {
+		printExitError(globalOptions, exitCode, exitMessage)
+	}
+	Exit(exitCode)
+}
+
+// exitCodeFromError returns the exit status of restic for the error returned
+// by a command.
+func exitCodeFromError(err error) int {
 	switch {
 	case err == nil:
-		exitCode = 0
+		return 0
 	case err == ErrInvalidSourceData:
-		exitCode = 3
+		return 3
 	case errors.Is(err, ErrFailedToRemoveOneOrMoreSnapshots):
-		exitCode = 3
+		return 3
 	case errors.Is(err, global.ErrNoRepository):
-		exitCode = 10
+		return 10
 	case repository.IsAlreadyLocked(err):
-		exitCode = 11
+		return 11
 	case errors.Is(err, repository.ErrNoKeyFound):
-		exitCode = 12
+		return 12
 	case errors.Is(err, context.Canceled):
-		exitCode = 130
+		return 130
 	default:
-		exitCode = 1
+		return 1
 	}
-
-	if exitCode != 0 {
-		printExitError(globalOptions, exitCode, exitMessage)
-	}
-	Exit(exitCode)
 }
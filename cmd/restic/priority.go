@@ -0,0 +1,69 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// ioPriority is an I/O scheduling class with a priority level within the
+// class, as used by the Linux I/O schedulers.
+type ioPriority struct {
+	class ioPriorityClass
+	level int
+}
+
+type ioPriorityClass int
+
+const (
+	ioPriorityBestEffort ioPriorityClass = iota + 1
+	ioPriorityIdle
+)
+
+// parseIOPriority parses the value of --io-priority, which is either "idle" or
+// "best-effort:N" with a level N from 0 (highest) to 7 (lowest).
+func parseIOPriority(s string) (ioPriority, error) {
+	class, level, hasLevel := strings.Cut(s, ":")
+	switch class {
+	case "idle":
+		if hasLevel {
+			return ioPriority{}, errors.Fatalf("invalid I/O priority %q: the idle class has no level", s)
+		}
+		return ioPriority{class: ioPriorityIdle}, nil
+
+	case "best-effort":
+		if !hasLevel {
+			return ioPriority{}, errors.Fatalf("invalid I/O priority %q: the level is missing, e.g. best-effort:7", s)
+		}
+		n, err := strconv.Atoi(level)
+		if err != nil || n < 0 || n > 7 {
+			return ioPriority{}, errors.Fatalf("invalid I/O priority %q: the level must be between 0 and 7", s)
+		}
+		return ioPriority{class: ioPriorityBestEffort, level: n}, nil
+	}
+
+	return ioPriority{}, errors.Fatalf("invalid I/O priority %q: must be idle or best-effort:N", s)
+}
+
+// setSchedulingPriority changes the I/O priority and the nice value of the
+// process as requested by --io-priority and --cpu-nice.
+func setSchedulingPriority(opts BackupOptions) error {
+	if opts.IOPriority != "" {
+		prio, err := parseIOPriority(opts.IOPriority)
+		if err != nil {
+			return err
+		}
+		if err := setIOPriority(prio); err != nil {
+			return errors.Fatalf("unable to set I/O priority: %v", err)
+		}
+	}
+
+	if opts.CPUNice != 0 {
+		if err := setCPUNice(opts.CPUNice); err != nil {
+			return errors.Fatalf("unable to set nice value: %v", err)
+		}
+	}
+
+	return nil
+}
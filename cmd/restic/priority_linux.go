@@ -0,0 +1,71 @@
+package main
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/restic/restic/internal/errors"
+	"golang.org/x/sys/unix"
+)
+
+// constants from linux/ioprio.h
+const (
+	ioprioWhoProcess = 1
+	ioprioClassShift = 13
+)
+
+// setIOPriority sets the I/O priority of all threads of the process.
+func setIOPriority(prio ioPriority) error {
+	value := uintptr(prio.class)<<ioprioClassShift | uintptr(prio.level)
+	return forEachThread(func(tid int) error {
+		_, _, errno := unix.Syscall(unix.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), value)
+		if errno != 0 {
+			return errno
+		}
+		return nil
+	})
+}
+
+// setCPUNice sets the nice value of all threads of the process.
+func setCPUNice(nice int) error {
+	return forEachThread(func(tid int) error {
+		return unix.Setpriority(unix.PRIO_PROCESS, tid, nice)
+	})
+}
+
+// forEachThread calls fn for all threads of the process. On Linux, the I/O
+// priority and the nice value are attributes of a thread, which are inherited
+// by the threads it creates. Thus the threads are listed until no new threads
+// show up, afterwards all threads of the Go runtime, including those of the
+// goroutines reading files, use the new setting.
+func forEachThread(fn func(tid int) error) error {
+	done := make(map[int]struct{})
+	for {
+		entries, err := os.ReadDir("/proc/self/task")
+		if err != nil {
+			return err
+		}
+
+		found := false
+		for _, entry := range entries {
+			tid, err := strconv.Atoi(entry.Name())
+			if err != nil {
+				continue
+			}
+			if _, ok := done[tid]; ok {
+				continue
+			}
+			found = true
+			done[tid] = struct{}{}
+
+			// the thread may have exited in the meantime
+			if err := fn(tid); err != nil && !errors.Is(err, unix.ESRCH) {
+				return err
+			}
+		}
+
+		if !found {
+			return nil
+		}
+	}
+}
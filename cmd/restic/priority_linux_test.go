@@ -0,0 +1,22 @@
+package main
+
+import (
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+	"golang.org/x/sys/unix"
+)
+
+func TestSetSchedulingPriority(t *testing.T) {
+	// getpriority returns 20 - nice on Linux, keep the current nice value
+	prio, err := unix.Getpriority(unix.PRIO_PROCESS, 0)
+	rtest.OK(t, err)
+	rtest.OK(t, setCPUNice(20-prio))
+
+	// best-effort:4 is the default priority for processes without an
+	// explicitly set I/O priority
+	rtest.OK(t, setIOPriority(ioPriority{class: ioPriorityBestEffort, level: 4}))
+	value, _, errno := unix.Syscall(unix.SYS_IOPRIO_GET, ioprioWhoProcess, 0, 0)
+	rtest.Assert(t, errno == 0, "ioprio_get failed: %v", errno)
+	rtest.Equals(t, uintptr(ioPriorityBestEffort)<<ioprioClassShift|4, value)
+}
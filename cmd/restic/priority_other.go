@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+import "github.com/restic/restic/internal/errors"
+
+func setIOPriority(_ ioPriority) error {
+	return errors.New("only supported on Linux")
+}
+
+func setCPUNice(_ int) error {
+	return errors.New("only supported on Linux")
+}
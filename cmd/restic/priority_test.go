@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestParseIOPriority(t *testing.T) {
+	for _, test := range []struct {
+		input string
+		prio  ioPriority
+		err   bool
+	}{
+		{"idle", ioPriority{class: ioPriorityIdle}, false},
+		{"best-effort:0", ioPriority{class: ioPriorityBestEffort, level: 0}, false},
+		{"best-effort:7", ioPriority{class: ioPriorityBestEffort, level: 7}, false},
+		{"best-effort", ioPriority{}, true},
+		{"best-effort:8", ioPriority{}, true},
+		{"best-effort:-1", ioPriority{}, true},
+		{"best-effort:x", ioPriority{}, true},
+		{"idle:3", ioPriority{}, true},
+		{"realtime:0", ioPriority{}, true},
+		{"", ioPriority{}, true},
+	} {
+		t.Run(test.input, func(t *testing.T) {
+			prio, err := parseIOPriority(test.input)
+			if test.err {
+				rtest.Assert(t, err != nil, "expected error for %q", test.input)
+				return
+			}
+			rtest.OK(t, err)
+			rtest.Equals(t, test.prio, prio)
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"os"
+
+	"github.com/restic/restic/internal/data"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	"github.com/spf13/pflag"
+)
+
+// SigningOptions bundles the options for commands which create or modify snapshots.
+type SigningOptions struct {
+	SigningKeyFile string
+}
+
+func (opts *SigningOptions) AddFlags(f *pflag.FlagSet) {
+	f.StringVar(&opts.SigningKeyFile, "signing-key-file", "", "sign snapshots using the key stored in `file` (default: $RESTIC_SIGNING_KEY_FILE)")
+
+	if keyFile := os.Getenv("RESTIC_SIGNING_KEY_FILE"); keyFile != "" {
+		opts.SigningKeyFile = keyFile
+	}
+}
+
+// load returns the signing key or nil if no signing key is configured.
+func (opts SigningOptions) load() (ed25519.PrivateKey, error) {
+	if opts.SigningKeyFile == "" {
+		return nil, nil
+	}
+	buf, err := os.ReadFile(opts.SigningKeyFile)
+	if err != nil {
+		return nil, errors.Fatalf("unable to read signing key: %v", err)
+	}
+	key, err := data.ParseSigningKey(buf)
+	if err != nil {
+		return nil, errors.Fatalf("unable to load signing key %v: %v", opts.SigningKeyFile, err)
+	}
+	return key, nil
+}
+
+// SignatureOptions bundles the options for commands which verify snapshot signatures.
+type SignatureOptions struct {
+	TrustedKeysFile string
+}
+
+func (opts *SignatureOptions) AddFlags(f *pflag.FlagSet) {
+	f.StringVar(&opts.TrustedKeysFile, "trusted-keys-file", "", "verify snapshot signatures using the trusted keys listed in `file` (default: $RESTIC_TRUSTED_KEYS_FILE)")
+
+	if keyFile := os.Getenv("RESTIC_TRUSTED_KEYS_FILE"); keyFile != "" {
+		opts.TrustedKeysFile = keyFile
+	}
+}
+
+// load returns the trusted keys or nil if no trusted keys are configured.
+func (opts SignatureOptions) load() (data.TrustedKeys, error) {
+	if opts.TrustedKeysFile == "" {
+		return nil, nil
+	}
+	f, err := os.Open(opts.TrustedKeysFile)
+	if err != nil {
+		return nil, errors.Fatalf("unable to read trusted keys: %v", err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	trusted, err := data.ParseTrustedKeys(f)
+	if err != nil {
+		return nil, errors.Fatalf("unable to load trusted keys %v: %v", opts.TrustedKeysFile, err)
+	}
+	return trusted, nil
+}
+
+// resignSnapshot updates the signature of a modified snapshot. Without a
+// signing key, the outdated signature is removed.
+func resignSnapshot(sn *data.Snapshot, key ed25519.PrivateKey) error {
+	if key == nil {
+		sn.Signature = nil
+		return nil
+	}
+	return sn.Sign(key)
+}
+
+// verifySnapshotSignatures returns the signature status of all snapshots. It
+// returns nil if no trusted keys are configured and none of the snapshots is
+// signed.
+func verifySnapshotSignatures(list data.Snapshots, trusted data.TrustedKeys) map[restic.ID]data.SignatureStatus {
+	signed := trusted != nil
+	for _, sn := range list {
+		signed = signed || sn.Signature != nil
+	}
+	if !signed {
+		return nil
+	}
+
+	signatures := make(map[restic.ID]data.SignatureStatus, len(list))
+	for _, sn := range list {
+		signatures[*sn.ID()] = sn.VerifySignature(trusted)
+	}
+	return signatures
+}
+
+// checkSnapshotSignature verifies the signature of a snapshot before using
+// it. Snapshots with an invalid signature are always rejected. If trusted keys
+// are configured, the snapshot must have a valid signature.
+func checkSnapshotSignature(sn *data.Snapshot, trusted data.TrustedKeys) (data.SignatureStatus, error) {
+	status := sn.VerifySignature(trusted)
+	if status == data.SignatureInvalid || (trusted != nil && status != data.SignatureValid) {
+		return status, errors.Fatalf("signature of snapshot %v is %v", sn.ID().Str(), status)
+	}
+	return status, nil
+}
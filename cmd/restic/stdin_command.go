@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+)
+
+// stdinCommand is a command set by --stdin-command. Its output is stored as
+// the file name in the snapshot.
+type stdinCommand struct {
+	name string
+	args []string
+}
+
+// parseStdinCommands parses the name=command values of --stdin-command.
+func parseStdinCommands(values []string) ([]stdinCommand, error) {
+	cmds := make([]stdinCommand, 0, len(values))
+	for _, value := range values {
+		name, command, _ := strings.Cut(value, "=")
+		if name == "" || command == "" {
+			return nil, errors.Fatalf("invalid --stdin-command %q, must be name=command", value)
+		}
+
+		args, err := backend.SplitShellStrings(command)
+		if err != nil {
+			return nil, errors.Fatalf("invalid --stdin-command %q: %v", value, err)
+		}
+		if len(args) == 0 {
+			return nil, errors.Fatalf("invalid --stdin-command %q, must be name=command", value)
+		}
+
+		cmds = append(cmds, stdinCommand{name: path.Join("/", name), args: args})
+	}
+	return cmds, nil
+}
+
+// newStdinCommandsFS starts all commands and returns a file system which
+// contains their output as files, together with the names of these files.
+// Reading a file returns an error if its command exits with a non-zero exit
+// code, which aborts the snapshot.
+func newStdinCommandsFS(ctx context.Context, cmds []stdinCommand, modTime time.Time, errorOutput func(msg string, args ...interface{})) (fs.FS, []string, error) {
+	files := make([]fs.ReaderFile, 0, len(cmds))
+	targets := make([]string, 0, len(cmds))
+	closeAll := func() {
+		for _, file := range files {
+			_ = file.Reader.Close()
+		}
+	}
+
+	for _, cmd := range cmds {
+		source, err := fs.NewCommandReader(ctx, cmd.args, errorOutput)
+		if err != nil {
+			closeAll()
+			return nil, nil, fmt.Errorf("command for %v: %w", cmd.name, err)
+		}
+		files = append(files, fs.ReaderFile{Name: cmd.name, Reader: source})
+		targets = append(targets, cmd.name)
+	}
+
+	targetFS, err := fs.NewMultiReader(files, fs.ReaderOptions{
+		ModTime: modTime,
+		Mode:    0644,
+	})
+	if err != nil {
+		closeAll()
+		return nil, nil, err
+	}
+	return targetFS, targets, nil
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestParseStdinCommands(t *testing.T) {
+	cmds, err := parseStdinCommands([]string{
+		"db1.sql=pg_dump db1",
+		`dumps/db2.sql=sh -c "mysqldump db2 | gzip"`,
+	})
+	rtest.OK(t, err)
+	rtest.Equals(t, []stdinCommand{
+		{name: "/db1.sql", args: []string{"pg_dump", "db1"}},
+		{name: "/dumps/db2.sql", args: []string{"sh", "-c", "mysqldump db2 | gzip"}},
+	}, cmds)
+
+	for _, value := range []string{"db.sql", "db.sql=", "=pg_dump", "db.sql= ", `db.sql=sh -c "unterminated`} {
+		_, err := parseStdinCommands([]string{value})
+		rtest.Assert(t, err != nil, "expected error for %q", value)
+	}
+}
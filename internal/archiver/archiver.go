@@ -2,6 +2,7 @@ package archiver
 
 import (
 	"context"
+	"crypto/ed25519"
 	"fmt"
 	"os"
 	"path"
@@ -11,6 +12,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/restic/restic/internal/backend/limiter"
 	"github.com/restic/restic/internal/data"
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
@@ -54,6 +56,9 @@ type Summary struct {
 	BackupEnd      time.Time
 	Files, Dirs    ChangeStats
 	ProcessedBytes uint64
+	// FilesModifiedWhileReading counts the files which were modified while
+	// being read, their content in the snapshot may be inconsistent
+	FilesModifiedWhileReading uint
 	ItemStats
 }
 
@@ -74,10 +79,13 @@ type toNoder interface {
 
 type archiverRepo interface {
 	restic.Loader
+	restic.LoaderUnpacked
 	restic.WithBlobUploader
-	restic.SaverUnpacked[restic.WriteableFileType]
+	restic.SaverRemoverUnpacked[restic.WriteableFileType]
 
 	ChunkerFactory() restic.ChunkerFactory
+	FlushIndex(ctx context.Context) error
+	FlushPacks(ctx context.Context) error
 }
 
 // Archiver saves a directory structure to the repo.
@@ -98,8 +106,12 @@ type Archiver struct {
 
 	fileSaver *fileSaver
 	treeSaver *treeSaver
-	mu        sync.Mutex
-	summary   *Summary
+	resume    *resumeTracker
+	changes   *changeSet
+	// checkpoint is nil if no checkpoint snapshots are saved
+	checkpoint *checkpointTracker
+	mu         sync.Mutex
+	summary    *Summary
 
 	// Error is called for all errors that occur during backup.
 	Error ErrorFunc
@@ -130,8 +142,20 @@ type Archiver struct {
 	// Flags controlling change detection. See doc/040_backup.rst for details.
 	ChangeIgnoreFlags uint
 
+	// ModifiedFileRetries is the number of times a file which was modified
+	// while being read is read again before saving it anyway.
+	ModifiedFileRetries uint
+
 	// for excluded items
 	ExcludedItem func(path string)
+
+	// ModifiedItem is called for files which were still modified while being
+	// read after all retries.
+	ModifiedItem func(path string)
+
+	// Warn is called for problems which do not affect the snapshot, for
+	// example if saving the resume state failed.
+	Warn func(msg string, args ...interface{})
 }
 
 // Flags for the ChangeIgnoreFlags bitfield.
@@ -150,6 +174,10 @@ type Options struct {
 	// SaveTreeConcurrency sets how many trees are marshalled and saved to the
 	// repo concurrently.
 	SaveTreeConcurrency uint
+
+	// MaxReadRate limits reading the content of files to the given rate in
+	// KiB/s for all files together. Zero means unlimited.
+	MaxReadRate int
 }
 
 // applyDefaults returns a copy of o with the default options set for all unset
@@ -187,6 +215,8 @@ func New(repo archiverRepo, filesystem fs.FS, opts Options) *Archiver {
 		StartFile:    func(string) {},
 		CompleteBlob: func(uint64) {},
 		ExcludedItem: func(string) {},
+		ModifiedItem: func(string) {},
+		Warn:         func(string, ...interface{}) {},
 	}
 
 	return arch
@@ -247,6 +277,15 @@ func (arch *Archiver) trackItem(item string, previous, current *data.Node, s Ite
 	}
 }
 
+// trackModified records a file which was modified while being read.
+func (arch *Archiver) trackModified(item string) {
+	arch.ModifiedItem(item)
+
+	arch.mu.Lock()
+	defer arch.mu.Unlock()
+	arch.summary.FilesModifiedWhileReading++
+}
+
 // nodeFromFileInfo returns the restic node from an os.FileInfo.
 func (arch *Archiver) nodeFromFileInfo(snPath, filename string, meta toNoder, ignoreXattrListError bool) (*data.Node, error) {
 	node, err := meta.ToNode(ignoreXattrListError, func(format string, args ...any) {
@@ -313,6 +352,7 @@ func (arch *Archiver) saveDir(ctx context.Context, snPath string, dir string, me
 	if err != nil {
 		return futureNode{}, err
 	}
+	arch.checkpoint.startDir(snPath, treeNode)
 
 	nodes := make([]futureNode, 0, len(names))
 
@@ -489,6 +529,14 @@ func (arch *Archiver) save(ctx context.Context, snPath, target string, previous
 		return futureNode{}, true, nil
 	}
 
+	// items which have not changed according to the change set are taken
+	// from the parent snapshot without accessing them
+	if arch.changes != nil && previous != nil && arch.changes.unchanged(abstarget) {
+		if fn, ok := arch.reuseUnchanged(snPath, target, previous); ok {
+			return fn, false, nil
+		}
+	}
+
 	meta, err := arch.FS.OpenFile(target, fs.O_NOFOLLOW, true)
 	if err != nil {
 		debug.Log("open metadata for %v returned error: %v", target, err)
@@ -536,6 +584,7 @@ func (arch *Archiver) save(ctx context.Context, snPath, target string, previous
 
 				// copy list of blobs
 				node.Content = previous.Content
+				arch.checkpoint.complete(snPath, node)
 
 				fn = newFutureNodeWithResult(futureNodeResult{
 					snPath: snPath,
@@ -554,6 +603,29 @@ func (arch *Archiver) save(ctx context.Context, snPath, target string, previous
 			}
 		}
 
+		// the file may have been completed by an interrupted backup
+		if arch.resume != nil {
+			if content, ok := arch.resume.lookup(arch, snPath, fi); ok {
+				debug.Log("%v was completed by an interrupted backup, using its list of blobs", target)
+				node, err := arch.nodeFromFileInfo(snPath, target, meta, false)
+				if err != nil {
+					return futureNode{}, false, err
+				}
+				node.Content = content
+				arch.trackItem(snPath, previous, node, ItemStats{}, time.Since(start))
+				arch.CompleteBlob(node.Size)
+				arch.resume.complete(snPath, node)
+				arch.checkpoint.complete(snPath, node)
+
+				fn = newFutureNodeWithResult(futureNodeResult{
+					snPath: snPath,
+					target: target,
+					node:   node,
+				})
+				return fn, false, nil
+			}
+		}
+
 		// reopen file and do an fstat() on the open file to check it is still
 		// a file (and has not been exchanged for e.g. a symlink)
 		err := meta.MakeReadable()
@@ -583,6 +655,13 @@ func (arch *Archiver) save(ctx context.Context, snPath, target string, previous
 			arch.trackItem(snPath, nil, nil, ItemStats{}, 0)
 		}, func(node *data.Node, stats ItemStats) {
 			arch.trackItem(snPath, previous, node, stats, time.Since(start))
+			if node != nil && node.Error == ModifiedWhileReading {
+				arch.trackModified(abstarget)
+			}
+			if arch.resume != nil {
+				arch.resume.complete(snPath, node)
+			}
+			arch.checkpoint.complete(snPath, node)
 		})
 
 	case fi.Mode.IsDir():
@@ -600,6 +679,7 @@ func (arch *Archiver) save(ctx context.Context, snPath, target string, previous
 		fn, err = arch.saveDir(ctx, snPath, target, meta, oldSubtree,
 			func(node *data.Node, stats ItemStats) {
 				arch.trackItem(snItem, previous, node, stats, time.Since(start))
+				arch.checkpoint.complete(snPath, node)
 			})
 		if err != nil {
 			debug.Log("SaveDir for %v returned error: %v", snPath, err)
@@ -617,6 +697,7 @@ func (arch *Archiver) save(ctx context.Context, snPath, target string, previous
 		if err != nil {
 			return futureNode{}, false, err
 		}
+		arch.checkpoint.complete(snPath, node)
 		fn = newFutureNodeWithResult(futureNodeResult{
 			snPath: snPath,
 			target: target,
@@ -678,6 +759,7 @@ func (arch *Archiver) saveTree(ctx context.Context, snPath string, atree *tree,
 		if err != nil {
 			return futureNode{}, 0, err
 		}
+		arch.checkpoint.startDir(snPath, node)
 	} else {
 		// fake root node
 		node = &data.Node{}
@@ -743,6 +825,7 @@ func (arch *Archiver) saveTree(ctx context.Context, snPath string, atree *tree,
 		// not a leaf node, archive subtree
 		fn, _, err := arch.saveTree(ctx, join(snPath, name), &subatree, oldSubtree, func(n *data.Node, is ItemStats) {
 			arch.trackItem(snItem, oldNode, n, is, time.Since(start))
+			arch.checkpoint.complete(join(snPath, name), n)
 		})
 		if err != nil {
 			err = arch.error(join(snPath, name), err)
@@ -837,6 +920,29 @@ type SnapshotOptions struct {
 	ProgramVersion string
 	// SkipIfUnchanged omits the snapshot creation if it is identical to the parent snapshot.
 	SkipIfUnchanged bool
+	// SigningKey is used to sign the snapshot if set.
+	SigningKey ed25519.PrivateKey
+	// ExpireAfter sets the expiry time of the snapshot relative to its time if not zero.
+	ExpireAfter data.Duration
+	// Hold protects the snapshot from being removed.
+	Hold bool
+	// Resume is the state of an interrupted backup of the same targets. Files
+	// completed by that backup are not read again if they are unchanged.
+	Resume *ResumeState
+	// ResumeInterval sets how often the resume state is saved while the
+	// backup is running. Zero disables saving the resume state.
+	ResumeInterval time.Duration
+	// ChangedPaths lists the absolute paths which changed since the parent
+	// snapshot. If it is not nil, only these paths are scanned, all other
+	// items are taken from the parent snapshot.
+	ChangedPaths []string
+	// PartialScans is stored in the snapshot, see data.Snapshot.
+	PartialScans uint
+	// CheckpointInterval sets how often a checkpoint snapshot of the items
+	// archived so far is saved while the backup is running. The checkpoint
+	// snapshots are removed once the backup has completed. Zero disables
+	// checkpoint snapshots.
+	CheckpointInterval time.Duration
 }
 
 // loadParentTree loads a tree referenced by snapshot id. If id is null, nil is returned.
@@ -860,6 +966,48 @@ func (arch *Archiver) loadParentTree(ctx context.Context, sn *data.Snapshot) dat
 	return tree
 }
 
+// removeResumeState removes the resume states which are no longer necessary
+// as the backup has completed.
+func (arch *Archiver) removeResumeState(ctx context.Context) {
+	if arch.resume != nil {
+		arch.resume.removeObsolete(ctx)
+	}
+}
+
+// removeCheckpoints removes the checkpoint snapshots which are replaced by the
+// final snapshot. This includes the parent snapshot if it is a checkpoint
+// snapshot of an interrupted backup, and its parents as long as they are
+// checkpoint snapshots of earlier interrupted backups.
+func (arch *Archiver) removeCheckpoints(ctx context.Context, opts SnapshotOptions) {
+	if arch.checkpoint == nil {
+		return
+	}
+	arch.checkpoint.removeObsolete(ctx)
+
+	visited := restic.NewIDSet()
+	for sn := opts.ParentSnapshot; sn != nil && sn.ID() != nil && sn.Checkpoint; {
+		id := *sn.ID()
+		if visited.Has(id) {
+			break
+		}
+		visited.Insert(id)
+
+		if err := arch.Repo.RemoveUnpacked(ctx, restic.WriteableSnapshotFile, id); err != nil {
+			debug.Log("unable to remove checkpoint snapshot %v: %v", id.Str(), err)
+		}
+		if sn.Parent == nil {
+			break
+		}
+		parent, err := data.LoadSnapshot(ctx, arch.Repo, *sn.Parent)
+		if err != nil {
+			// the parent is not a leftover checkpoint if it was already removed
+			debug.Log("unable to load parent snapshot %v: %v", sn.Parent.Str(), err)
+			break
+		}
+		sn = parent
+	}
+}
+
 // runWorkers starts the worker pools, which are stopped when the context is cancelled.
 func (arch *Archiver) runWorkers(ctx context.Context, wg *errgroup.Group, uploader restic.BlobSaverAsync) {
 	arch.fileSaver = newFileSaver(ctx, wg,
@@ -868,6 +1016,13 @@ func (arch *Archiver) runWorkers(ctx context.Context, wg *errgroup.Group, upload
 		arch.Options.ReadConcurrency)
 	arch.fileSaver.CompleteBlob = arch.CompleteBlob
 	arch.fileSaver.NodeFromFileInfo = arch.nodeFromFileInfo
+	arch.fileSaver.FS = arch.FS
+	arch.fileSaver.ModifiedFileRetries = arch.ModifiedFileRetries
+	arch.fileSaver.ChangeIgnoreFlags = arch.ChangeIgnoreFlags
+	if arch.Options.MaxReadRate > 0 {
+		// the files are read by restic, just like data downloaded from a backend
+		arch.fileSaver.ReadLimiter = limiter.NewStaticLimiter(limiter.Limits{DownloadKb: arch.Options.MaxReadRate})
+	}
 
 	arch.treeSaver = newTreeSaver(ctx, wg, arch.Options.SaveTreeConcurrency, uploader, arch.Error)
 }
@@ -897,11 +1052,40 @@ func (arch *Archiver) Snapshot(ctx context.Context, targets []string, opts Snaps
 
 	var rootTreeID restic.ID
 
+	arch.changes = nil
+	if opts.ChangedPaths != nil && opts.ParentSnapshot != nil {
+		arch.changes = newChangeSet(opts.ChangedPaths)
+	}
+
+	arch.resume = nil
+	if opts.Resume != nil || opts.ResumeInterval > 0 {
+		arch.resume = newResumeTracker(arch.Repo, targets, opts)
+	}
+
+	arch.checkpoint = nil
+	if opts.CheckpointInterval > 0 {
+		arch.checkpoint = newCheckpointTracker(arch.Repo, targets, opts)
+	}
+
 	err = arch.Repo.WithBlobUploader(ctx, func(ctx context.Context, uploader restic.BlobSaverWithAsync) error {
 		wg, wgCtx := errgroup.WithContext(ctx)
 		start := time.Now()
+		done := make(chan struct{})
+
+		if arch.resume != nil && opts.ResumeInterval > 0 {
+			wg.Go(func() error {
+				arch.resume.run(wgCtx, done, arch.Warn)
+				return nil
+			})
+		}
+		if arch.checkpoint != nil {
+			wg.Go(func() error {
+				return arch.checkpoint.run(wgCtx, done, uploader)
+			})
+		}
 
 		wg.Go(func() error {
+			defer close(done)
 			arch.runWorkers(wgCtx, wg, uploader)
 
 			debug.Log("starting snapshot")
@@ -945,7 +1129,10 @@ func (arch *Archiver) Snapshot(ctx context.Context, targets []string, opts Snaps
 
 	if opts.ParentSnapshot != nil && opts.SkipIfUnchanged {
 		ps := opts.ParentSnapshot
-		if ps.Tree != nil && rootTreeID.Equal(*ps.Tree) {
+		// a checkpoint parent is removed below, thus the final snapshot must be saved
+		if ps.Tree != nil && rootTreeID.Equal(*ps.Tree) && !ps.Checkpoint {
+			arch.removeResumeState(ctx)
+			arch.removeCheckpoints(ctx, opts)
 			arch.summary.BackupEnd = time.Now()
 			return nil, restic.ID{}, arch.summary, nil
 		}
@@ -958,6 +1145,11 @@ func (arch *Archiver) Snapshot(ctx context.Context, targets []string, opts Snaps
 
 	sn.ProgramVersion = opts.ProgramVersion
 	sn.Excludes = opts.Excludes
+	if !opts.ExpireAfter.Zero() {
+		sn.SetExpiry(opts.ExpireAfter)
+	}
+	sn.Hold = opts.Hold
+	sn.PartialScans = opts.PartialScans
 	if opts.ParentSnapshot != nil {
 		sn.Parent = opts.ParentSnapshot.ID()
 	}
@@ -979,12 +1171,22 @@ func (arch *Archiver) Snapshot(ctx context.Context, targets []string, opts Snaps
 		DataAddedPacked:     arch.summary.ItemStats.DataSizeInRepo + arch.summary.ItemStats.TreeSizeInRepo,
 		TotalFilesProcessed: arch.summary.Files.New + arch.summary.Files.Changed + arch.summary.Files.Unchanged,
 		TotalBytesProcessed: arch.summary.ProcessedBytes,
+
+		FilesModifiedWhileReading: arch.summary.FilesModifiedWhileReading,
+	}
+
+	if opts.SigningKey != nil {
+		if err := sn.Sign(opts.SigningKey); err != nil {
+			return nil, restic.ID{}, nil, err
+		}
 	}
 
 	id, err := data.SaveSnapshot(ctx, arch.Repo, sn)
 	if err != nil {
 		return nil, restic.ID{}, nil, err
 	}
+	arch.removeResumeState(ctx)
+	arch.removeCheckpoints(ctx, opts)
 
 	return sn, id, arch.summary, nil
 }
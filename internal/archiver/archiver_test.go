@@ -2776,3 +2776,54 @@ func TestDisappearedFile(t *testing.T) {
 		rtest.Assert(t, excluded, "testfile should have been excluded")
 	}
 }
+
+func TestArchiverModifiedWhileReading(t *testing.T) {
+	tempdir, repo := prepareTempdirRepoSrc(t, TestDir{
+		"file": TestFile{Content: "foo"},
+	})
+
+	back := rtest.Chdir(t, tempdir)
+	defer back()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	arch := New(repo, &modifyingFS{FS: fs.NewLocal(), t: t, modifications: 1}, Options{})
+	var modified []string
+	arch.ModifiedItem = func(item string) {
+		modified = append(modified, item)
+	}
+
+	sn, _, summary, err := arch.Snapshot(ctx, []string{"file"}, SnapshotOptions{Time: time.Now()})
+	rtest.OK(t, err)
+	rtest.Equals(t, []string{filepath.Join(tempdir, "file")}, modified)
+	rtest.Equals(t, uint(1), summary.FilesModifiedWhileReading)
+	rtest.Equals(t, uint(1), sn.Summary.FilesModifiedWhileReading)
+
+	nodes := treeNames(t, repo, *sn.Tree)
+	rtest.Equals(t, ModifiedWhileReading, nodes["file"].Error)
+}
+
+func TestArchiverMaxReadRate(t *testing.T) {
+	tempdir, repo := prepareTempdirRepoSrc(t, TestDir{
+		"file": TestFile{Content: string(rtest.Random(23, 2<<20))},
+	})
+
+	back := rtest.Chdir(t, tempdir)
+	defer back()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// reading 2 MiB at 1 MiB/s takes at least one second, as the limiter
+	// allows reading up to 1 MiB at once
+	arch := New(repo, fs.NewLocal(), Options{MaxReadRate: 1024})
+	start := time.Now()
+	_, id, _, err := arch.Snapshot(ctx, []string{"file"}, SnapshotOptions{Time: time.Now()})
+	rtest.OK(t, err)
+	rtest.Assert(t, time.Since(start) >= 900*time.Millisecond, "reading was not limited, took %v", time.Since(start))
+
+	TestEnsureSnapshot(t, repo, id, TestDir{
+		"file": TestFile{Content: string(rtest.Random(23, 2<<20))},
+	})
+}
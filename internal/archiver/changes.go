@@ -0,0 +1,94 @@
+package archiver
+
+import (
+	"path/filepath"
+
+	"github.com/restic/restic/internal/data"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/restic"
+)
+
+// changeSet contains the paths which were reported as changed since the
+// parent snapshot by an external source, e.g. a file system change journal.
+// All items which are neither contained in the change set nor have a changed
+// item below them are taken from the parent snapshot without accessing them.
+type changeSet struct {
+	// paths contains the changed paths, everything below them is scanned
+	paths map[string]struct{}
+	// parents contains all parent directories of the changed paths
+	parents map[string]struct{}
+}
+
+// newChangeSet returns a change set for the absolute paths.
+func newChangeSet(paths []string) *changeSet {
+	c := &changeSet{
+		paths:   make(map[string]struct{}, len(paths)),
+		parents: make(map[string]struct{}),
+	}
+
+	for _, p := range paths {
+		p = filepath.Clean(p)
+		c.paths[p] = struct{}{}
+
+		for dir := filepath.Dir(p); ; dir = filepath.Dir(dir) {
+			if _, ok := c.parents[dir]; ok {
+				break
+			}
+			c.parents[dir] = struct{}{}
+			if filepath.Dir(dir) == dir {
+				break
+			}
+		}
+	}
+
+	return c
+}
+
+// unchanged reports whether neither the absolute path nor any item below it
+// nor any of its parents is contained in the change set.
+func (c *changeSet) unchanged(path string) bool {
+	if _, ok := c.parents[path]; ok {
+		return false
+	}
+
+	for p := path; ; p = filepath.Dir(p) {
+		if _, ok := c.paths[p]; ok {
+			return false
+		}
+		if filepath.Dir(p) == p {
+			return true
+		}
+	}
+}
+
+// reuseUnchanged returns the node of an unchanged item from the parent
+// snapshot. The item itself is not accessed. If the data referenced by the
+// node is not present in the repository, ok is false and the item must be
+// scanned.
+func (arch *Archiver) reuseUnchanged(snPath, target string, previous *data.Node) (fn futureNode, ok bool) {
+	switch previous.Type {
+	case data.NodeTypeFile:
+		if !arch.allBlobsPresent(previous) {
+			return futureNode{}, false
+		}
+		arch.trackItem(snPath, previous, previous, ItemStats{}, 0)
+		arch.CompleteBlob(previous.Size)
+
+	case data.NodeTypeDir:
+		if previous.Subtree == nil {
+			return futureNode{}, false
+		}
+		if _, ok := arch.Repo.LookupBlobSize(restic.BlobHandle{Type: restic.TreeBlob, ID: *previous.Subtree}); !ok {
+			return futureNode{}, false
+		}
+		arch.trackItem(snPath+"/", previous, previous, ItemStats{}, 0)
+	}
+
+	arch.checkpoint.complete(snPath, previous)
+	debug.Log("%v is not in the change set, using node from parent snapshot", target)
+	return newFutureNodeWithResult(futureNodeResult{
+		snPath: snPath,
+		target: target,
+		node:   previous,
+	}), true
+}
@@ -0,0 +1,109 @@
+package archiver
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/checker"
+	"github.com/restic/restic/internal/fs"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestChangeSetUnchanged(t *testing.T) {
+	c := newChangeSet([]string{"/data/a/changed", "/data/b"})
+
+	var tests = []struct {
+		path      string
+		unchanged bool
+	}{
+		{"/", false},
+		{"/data", false},
+		{"/data/a", false},
+		{"/data/a/changed", false},
+		{"/data/a/changed/sub/file", false},
+		{"/data/a/other", true},
+		{"/data/b", false},
+		{"/data/b/file", false},
+		{"/data/c", true},
+		{"/data/c/file", true},
+		{"/other", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			rtest.Equals(t, test.unchanged, c.unchanged(filepath.FromSlash(test.path)))
+		})
+	}
+}
+
+// openRecordingFS records the names of all opened files.
+type openRecordingFS struct {
+	fs.FS
+
+	m      sync.Mutex
+	opened []string
+}
+
+func (f *openRecordingFS) OpenFile(name string, flag int, metadataOnly bool) (fs.File, error) {
+	f.m.Lock()
+	f.opened = append(f.opened, filepath.ToSlash(name))
+	f.m.Unlock()
+	return f.FS.OpenFile(name, flag, metadataOnly)
+}
+
+func TestArchiverChangedPaths(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tempdir, repo := prepareTempdirRepoSrc(t, TestDir{
+		"changed": TestDir{
+			"file":  TestFile{Content: "changed file"},
+			"other": TestFile{Content: "other file"},
+		},
+		"unchanged": TestDir{
+			"file": TestFile{Content: "unchanged file"},
+		},
+	})
+
+	testFS := &openRecordingFS{FS: fs.NewLocal()}
+	arch := New(repo, testFS, Options{})
+
+	back := rtest.Chdir(t, tempdir)
+	defer back()
+
+	parent, _, _, err := arch.Snapshot(ctx, []string{"."}, SnapshotOptions{Time: time.Now()})
+	rtest.OK(t, err)
+
+	save(t, filepath.Join(tempdir, "changed", "file"), []byte("modified file"))
+	// not listed in the change list, thus the modification is not noticed
+	save(t, filepath.Join(tempdir, "unchanged", "file"), []byte("modified unchanged file"))
+
+	testFS.opened = nil
+	_, id, _, err := arch.Snapshot(ctx, []string{"."}, SnapshotOptions{
+		Time:           time.Now(),
+		ParentSnapshot: parent,
+		ChangedPaths:   []string{filepath.Join(tempdir, "changed", "file")},
+		PartialScans:   1,
+	})
+	rtest.OK(t, err)
+
+	for _, name := range testFS.opened {
+		rtest.Assert(t, !strings.HasPrefix(name, "unchanged") && !strings.HasPrefix(name, "changed/other"),
+			"unchanged item %v was accessed", name)
+	}
+
+	TestEnsureSnapshot(t, repo, id, TestDir{
+		"changed": TestDir{
+			"file":  TestFile{Content: "modified file"},
+			"other": TestFile{Content: "other file"},
+		},
+		"unchanged": TestDir{
+			"file": TestFile{Content: "unchanged file"},
+		},
+	})
+	checker.TestCheckRepo(t, repo)
+}
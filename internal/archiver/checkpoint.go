@@ -0,0 +1,248 @@
+package archiver
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/data"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/restic"
+)
+
+// CheckpointTag is added to the tags of checkpoint snapshots. Checkpoint
+// snapshots are identified using Snapshot.Checkpoint, the tag only helps
+// users to recognize them.
+const CheckpointTag = "checkpoint"
+
+// checkpointTracker collects the items completed by a running backup and
+// periodically saves them as checkpoint snapshot. The checkpoint snapshots
+// are removed once the final snapshot has been saved.
+type checkpointTracker struct {
+	repo     archiverRepo
+	interval time.Duration
+	targets  []string
+	opts     SnapshotOptions
+
+	mu   sync.Mutex
+	root *checkpointDir
+	// saved contains the checkpoint snapshots saved by this backup
+	saved restic.IDs
+}
+
+// checkpointDir is a directory which is currently being archived.
+type checkpointDir struct {
+	// node contains the metadata of the directory
+	node *data.Node
+	// items contains the completed items in the directory
+	items map[string]*data.Node
+	// dirs contains the subdirectories which are currently being archived
+	dirs map[string]*checkpointDir
+}
+
+func newCheckpointDir(node *data.Node) *checkpointDir {
+	return &checkpointDir{
+		node:  node,
+		items: make(map[string]*data.Node),
+		dirs:  make(map[string]*checkpointDir),
+	}
+}
+
+func newCheckpointTracker(repo archiverRepo, targets []string, opts SnapshotOptions) *checkpointTracker {
+	return &checkpointTracker{
+		repo:     repo,
+		interval: opts.CheckpointInterval,
+		targets:  targets,
+		opts:     opts,
+		root:     newCheckpointDir(nil),
+	}
+}
+
+// dir returns the in-progress directory for the components of snPath,
+// creating it if necessary.
+func (t *checkpointTracker) dir(components []string) *checkpointDir {
+	d := t.root
+	for _, name := range components {
+		sub, ok := d.dirs[name]
+		if !ok {
+			sub = newCheckpointDir(nil)
+			d.dirs[name] = sub
+		}
+		d = sub
+	}
+	return d
+}
+
+func splitSnapshotPath(snPath string) (parent []string, name string) {
+	components := strings.Split(strings.Trim(snPath, "/"), "/")
+	return components[:len(components)-1], components[len(components)-1]
+}
+
+// startDir records that the directory at snPath is being archived. The
+// tracker is nil if no checkpoints are saved.
+func (t *checkpointTracker) startDir(snPath string, node *data.Node) {
+	if t == nil || snPath == "/" {
+		return
+	}
+	// the tree saver sets the subtree of node later on
+	n := *node
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	parent, name := splitSnapshotPath(snPath)
+	t.dir(append(parent, name)).node = &n
+}
+
+// complete records that the item at snPath has been archived. The tracker is
+// nil if no checkpoints are saved.
+func (t *checkpointTracker) complete(snPath string, node *data.Node) {
+	if t == nil || node == nil || snPath == "/" {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	parent, name := splitSnapshotPath(snPath)
+	d := t.dir(parent)
+	d.items[name] = node
+	// the completed directory contains all items below it
+	delete(d.dirs, name)
+}
+
+// run saves a checkpoint snapshot every interval until ctx is cancelled or
+// done is closed.
+func (t *checkpointTracker) run(ctx context.Context, done <-chan struct{}, saver restic.BlobSaver) error {
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-done:
+			return nil
+		case <-ticker.C:
+			if err := t.save(ctx, saver); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// save stores all items completed so far as checkpoint snapshot and removes
+// the previous checkpoint snapshot.
+func (t *checkpointTracker) save(ctx context.Context, saver restic.BlobSaver) error {
+	t.mu.Lock()
+	root := t.root.clone()
+	t.mu.Unlock()
+
+	treeID, err := root.save(ctx, saver)
+	if err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+
+	// the snapshot must only reference data which is stored in the repository
+	if err := t.repo.FlushPacks(ctx); err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+
+	tags := t.opts.Tags
+	if !slices.Contains(tags, CheckpointTag) {
+		tags = append(slices.Clone(tags), CheckpointTag)
+	}
+	sn, err := data.NewSnapshot(t.targets, tags, t.opts.Hostname, time.Now())
+	if err != nil {
+		return err
+	}
+	sn.ProgramVersion = t.opts.ProgramVersion
+	sn.Excludes = t.opts.Excludes
+	if t.opts.ParentSnapshot != nil {
+		sn.Parent = t.opts.ParentSnapshot.ID()
+	}
+	sn.Tree = &treeID
+	sn.Checkpoint = true
+	if t.opts.SigningKey != nil {
+		if err := sn.Sign(t.opts.SigningKey); err != nil {
+			return err
+		}
+	}
+
+	id, err := data.SaveSnapshot(ctx, t.repo, sn)
+	if err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+	debug.Log("saved checkpoint snapshot %v", id.Str())
+
+	t.removeObsolete(ctx)
+	t.saved = append(t.saved, id)
+	return nil
+}
+
+// removeObsolete removes all checkpoint snapshots saved by this backup. A
+// leftover checkpoint snapshot is only redundant, thus errors are ignored.
+func (t *checkpointTracker) removeObsolete(ctx context.Context) {
+	for _, id := range t.saved {
+		if err := t.repo.RemoveUnpacked(ctx, restic.WriteableSnapshotFile, id); err != nil {
+			debug.Log("unable to remove checkpoint snapshot %v: %v", id.Str(), err)
+		}
+	}
+	t.saved = nil
+}
+
+func (d *checkpointDir) clone() *checkpointDir {
+	c := &checkpointDir{
+		node:  d.node,
+		items: maps.Clone(d.items),
+		dirs:  make(map[string]*checkpointDir, len(d.dirs)),
+	}
+	for name, sub := range d.dirs {
+		c.dirs[name] = sub.clone()
+	}
+	return c
+}
+
+// save stores the tree of the directory, which contains the completed items
+// and the incomplete subdirectories.
+func (d *checkpointDir) save(ctx context.Context, saver restic.BlobSaver) (restic.ID, error) {
+	nodes := make([]*data.Node, 0, len(d.items)+len(d.dirs))
+	for _, node := range d.items {
+		nodes = append(nodes, node)
+	}
+
+	for name, sub := range d.dirs {
+		if _, ok := d.items[name]; ok {
+			continue
+		}
+		id, err := sub.save(ctx, saver)
+		if err != nil {
+			return restic.ID{}, err
+		}
+
+		var node data.Node
+		if sub.node != nil {
+			node = *sub.node
+		} else {
+			node = data.Node{Type: data.NodeTypeDir, Mode: os.ModeDir | 0755}
+		}
+		node.Name = name
+		node.Subtree = &id
+		nodes = append(nodes, &node)
+	}
+
+	slices.SortFunc(nodes, func(a, b *data.Node) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	tw := data.NewTreeWriter(saver)
+	for _, node := range nodes {
+		if err := tw.AddNode(node); err != nil {
+			return restic.ID{}, err
+		}
+	}
+	return tw.Finalize(ctx)
+}
@@ -0,0 +1,146 @@
+package archiver
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/checker"
+	"github.com/restic/restic/internal/data"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func listSnapshotIDs(t testing.TB, repo restic.Lister) restic.IDs {
+	t.Helper()
+	var ids restic.IDs
+	rtest.OK(t, repo.List(context.TODO(), restic.SnapshotFile, func(id restic.ID, _ int64) error {
+		ids = append(ids, id)
+		return nil
+	}))
+	return ids
+}
+
+func treeNames(t testing.TB, repo restic.Loader, id restic.ID) map[string]*data.Node {
+	t.Helper()
+	tree, err := data.LoadTree(context.TODO(), repo, id)
+	rtest.OK(t, err)
+	nodes := make(map[string]*data.Node)
+	for item := range tree {
+		rtest.OK(t, item.Error)
+		nodes[item.Node.Name] = item.Node
+	}
+	return nodes
+}
+
+func TestCheckpointTrackerSave(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.TestRepository(t)
+
+	tracker := newCheckpointTracker(repo, []string{"/data"}, SnapshotOptions{
+		Hostname: "host",
+		Tags:     data.TagList{"foo"},
+	})
+	tracker.startDir("/data", &data.Node{Name: "data", Type: data.NodeTypeDir, Mode: 0700})
+	tracker.startDir("/data/sub", &data.Node{Name: "sub", Type: data.NodeTypeDir})
+	tracker.startDir("/data/done", &data.Node{Name: "done", Type: data.NodeTypeDir})
+
+	var emptyTree restic.ID
+	rtest.OK(t, repo.WithBlobUploader(ctx, func(ctx context.Context, uploader restic.BlobSaverWithAsync) error {
+		blob, _, _, err := uploader.SaveBlob(ctx, restic.DataBlob, []byte("content"), restic.ID{}, false)
+		rtest.OK(t, err)
+		tracker.complete("/data/sub/file", &data.Node{Name: "file", Type: data.NodeTypeFile, Size: 7, Content: restic.IDs{blob}})
+		tracker.complete("/data/sub/other/file", &data.Node{Name: "file", Type: data.NodeTypeFile, Content: restic.IDs{}})
+
+		emptyTree, err = data.SaveTree(ctx, uploader, func(func(data.NodeOrError) bool) {})
+		rtest.OK(t, err)
+		tracker.complete("/data/done", &data.Node{Name: "done", Type: data.NodeTypeDir, Subtree: &emptyTree})
+
+		rtest.OK(t, tracker.save(ctx, uploader))
+		rtest.OK(t, tracker.save(ctx, uploader))
+		return nil
+	}))
+
+	// the second checkpoint replaces the first one
+	ids := listSnapshotIDs(t, repo)
+	rtest.Equals(t, 1, len(ids))
+	sn, err := data.LoadSnapshot(ctx, repo, ids[0])
+	rtest.OK(t, err)
+	rtest.Equals(t, []string{"foo", CheckpointTag}, sn.Tags)
+	rtest.Assert(t, sn.Checkpoint, "checkpoint snapshot is not marked as checkpoint")
+	rtest.Equals(t, "host", sn.Hostname)
+
+	root := treeNames(t, repo, *sn.Tree)
+	rtest.Equals(t, 1, len(root))
+	rtest.Equals(t, uint32(0700), uint32(root["data"].Mode))
+
+	dir := treeNames(t, repo, *root["data"].Subtree)
+	rtest.Equals(t, 2, len(dir))
+	rtest.Equals(t, emptyTree, *dir["done"].Subtree)
+
+	sub := treeNames(t, repo, *dir["sub"].Subtree)
+	rtest.Equals(t, 2, len(sub))
+	rtest.Equals(t, uint64(7), sub["file"].Size)
+	// directories which were not started explicitly are created as well
+	rtest.Equals(t, data.NodeTypeDir, sub["other"].Type)
+
+	checker.TestCheckRepo(t, repo)
+
+	tracker.removeObsolete(ctx)
+	rtest.Equals(t, 0, len(listSnapshotIDs(t, repo)))
+}
+
+func TestArchiverCheckpointsRemoved(t *testing.T) {
+	ctx := context.Background()
+	tempdir, repo := prepareTempdirRepoSrc(t, TestDir{
+		"dir": TestDir{
+			"file": TestFile{Content: string(rtest.Random(1, 1<<20))},
+		},
+	})
+	back := rtest.Chdir(t, tempdir)
+	defer back()
+
+	// the tag alone does not mark a snapshot as checkpoint
+	arch := New(repo, fs.NewLocal(), Options{})
+	sn, id, _, err := arch.Snapshot(ctx, []string{"."}, SnapshotOptions{
+		Time:               time.Now(),
+		Tags:               data.TagList{CheckpointTag},
+		CheckpointInterval: time.Millisecond,
+	})
+	rtest.OK(t, err)
+	rtest.Equals(t, restic.IDs{id}, listSnapshotIDs(t, repo))
+	rtest.Assert(t, !sn.Checkpoint, "final snapshot is marked as checkpoint")
+
+	// a checkpoint snapshot used as parent is replaced by the final snapshot,
+	// as are the checkpoints of earlier interrupted backups it is based on
+	finalID := id
+	var checkpointIDs restic.IDs
+	for i := 0; i < 2; i++ {
+		sn.Checkpoint = true
+		sn.Parent = &id
+		id, err = data.SaveSnapshot(ctx, repo, sn)
+		rtest.OK(t, err)
+		checkpointIDs = append(checkpointIDs, id)
+	}
+	sn, err = data.LoadSnapshot(ctx, repo, id)
+	rtest.OK(t, err)
+
+	// the final snapshot is saved although the data is unchanged
+	_, id, _, err = arch.Snapshot(ctx, []string{"."}, SnapshotOptions{
+		Time:               time.Now(),
+		ParentSnapshot:     sn,
+		SkipIfUnchanged:    true,
+		CheckpointInterval: time.Hour,
+	})
+	rtest.OK(t, err)
+	rtest.Assert(t, !id.IsNull(), "final snapshot was skipped")
+	ids := listSnapshotIDs(t, repo)
+	for _, checkpointID := range checkpointIDs {
+		rtest.Assert(t, !slices.Contains(ids, checkpointID), "checkpoint snapshot %v was not removed", checkpointID.Str())
+	}
+	rtest.Assert(t, slices.Contains(ids, finalID), "snapshot %v is missing", finalID.Str())
+	rtest.Assert(t, slices.Contains(ids, id), "snapshot %v is missing", id.Str())
+}
@@ -6,11 +6,15 @@ import (
 	"io"
 	"os"
 	"runtime"
+	"slices"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/restic/restic/internal/data"
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/filter"
 	"github.com/restic/restic/internal/fs"
 )
 
@@ -46,22 +50,24 @@ func CombineRejects(funcs []RejectFunc) SelectFunc {
 	}
 }
 
-type rejectionCache struct {
-	m   map[string]bool
+// rejectionCache stores a value per directory, such that the directory only
+// needs to be evaluated once.
+type rejectionCache[T any] struct {
+	m   map[string]T
 	mtx sync.Mutex
 }
 
-func newRejectionCache() *rejectionCache {
-	return &rejectionCache{m: make(map[string]bool)}
+func newRejectionCache[T any]() *rejectionCache[T] {
+	return &rejectionCache[T]{m: make(map[string]T)}
 }
 
 // Lock locks the mutex in rc.
-func (rc *rejectionCache) Lock() {
+func (rc *rejectionCache[T]) Lock() {
 	rc.mtx.Lock()
 }
 
 // Unlock unlocks the mutex in rc.
-func (rc *rejectionCache) Unlock() {
+func (rc *rejectionCache[T]) Unlock() {
 	rc.mtx.Unlock()
 }
 
@@ -69,7 +75,7 @@ func (rc *rejectionCache) Unlock() {
 // indicates whether that value was actually written to the cache. It is the
 // callers responsibility to call rc.Lock and rc.Unlock before using this
 // method, otherwise data races may occur.
-func (rc *rejectionCache) Get(dir string) (bool, bool) {
+func (rc *rejectionCache[T]) Get(dir string) (T, bool) {
 	v, ok := rc.m[dir]
 	return v, ok
 }
@@ -77,8 +83,8 @@ func (rc *rejectionCache) Get(dir string) (bool, bool) {
 // Store stores a new value for dir.  It is the callers responsibility to call
 // rc.Lock and rc.Unlock before using this method, otherwise data races may
 // occur.
-func (rc *rejectionCache) Store(dir string, rejected bool) {
-	rc.m[dir] = rejected
+func (rc *rejectionCache[T]) Store(dir string, value T) {
+	rc.m[dir] = value
 }
 
 // RejectIfPresent returns a RejectByNameFunc which itself returns whether a path
@@ -104,7 +110,7 @@ func RejectIfPresent(excludeFileSpec string, warnf func(msg string, args ...inte
 		tf = excludeFileSpec
 	}
 	debug.Log("using %q as exclusion tagfile", tf)
-	rc := newRejectionCache()
+	rc := newRejectionCache[bool]()
 	return func(filename string, _ *fs.ExtendedFileInfo, fs fs.FS) bool {
 		return isExcludedByFile(filename, tf, tc, rc, fs, warnf)
 	}, nil
@@ -115,7 +121,7 @@ func RejectIfPresent(excludeFileSpec string, warnf func(msg string, args ...inte
 // tagfile which bears the name specified in tagFilename and starts with
 // header. If rc is non-nil, it is used to expedite the evaluation of a
 // directory based on previous visits.
-func isExcludedByFile(filename, tagFilename, header string, rc *rejectionCache, fs fs.FS, warnf func(msg string, args ...interface{})) bool {
+func isExcludedByFile(filename, tagFilename, header string, rc *rejectionCache[bool], fs fs.FS, warnf func(msg string, args ...interface{})) bool {
 	if tagFilename == "" {
 		return false
 	}
@@ -180,6 +186,156 @@ func isDirExcludedByFile(dir, tagFilename, header string, fsInst fs.FS, warnf fu
 	return true
 }
 
+// RejectByIgnoreFile returns a RejectFunc which rejects files and directories
+// which are excluded by gitignore-style ignore files with the given name. The
+// patterns of an ignore file apply to all items below the directory which
+// contains it, ignore files in subdirectories take precedence. Items within an
+// excluded directory are also rejected.
+func RejectByIgnoreFile(filename string, warnf func(msg string, args ...interface{})) (RejectFunc, error) {
+	if filename == "" {
+		return nil, errors.New("name for ignore file is empty")
+	}
+	if strings.ContainsAny(filename, `/\`) {
+		return nil, fmt.Errorf("name for ignore file %q must not contain a directory", filename)
+	}
+	debug.Log("using %q as ignore file", filename)
+
+	ig := &ignoreFiles{
+		filename: filename,
+		files:    newRejectionCache[*filter.IgnoreFile](),
+		dirs:     newRejectionCache[bool](),
+		warnf:    warnf,
+	}
+	return func(item string, fi *fs.ExtendedFileInfo, fs fs.FS) bool {
+		item = fs.Clean(item)
+		if ig.isDirIgnored(fs.Dir(item), fs) {
+			return true
+		}
+		return ig.isIgnored(item, fi.Mode.IsDir(), fs)
+	}, nil
+}
+
+// ignoreFiles caches the parsed ignore files and the rejected directories.
+type ignoreFiles struct {
+	filename string
+	files    *rejectionCache[*filter.IgnoreFile]
+	dirs     *rejectionCache[bool]
+	warnf    func(msg string, args ...interface{})
+}
+
+// isDirIgnored returns true if dir or one of its parent directories is
+// excluded.
+func (ig *ignoreFiles) isDirIgnored(dir string, fs fs.FS) bool {
+	parent := fs.Dir(dir)
+	if parent == dir {
+		return false
+	}
+
+	ig.dirs.Lock()
+	ignored, ok := ig.dirs.Get(dir)
+	ig.dirs.Unlock()
+	if ok {
+		return ignored
+	}
+
+	ignored = ig.isDirIgnored(parent, fs) || ig.isIgnored(dir, true, fs)
+
+	ig.dirs.Lock()
+	ig.dirs.Store(dir, ignored)
+	ig.dirs.Unlock()
+	return ignored
+}
+
+// isIgnored evaluates the ignore files in all parent directories of item,
+// starting at the root directory. The last matching pattern wins.
+func (ig *ignoreFiles) isIgnored(item string, isDir bool, fs fs.FS) bool {
+	var names []string
+	var dirs []string
+	for dir := item; fs.Dir(dir) != dir; dir = fs.Dir(dir) {
+		names = append(names, fs.Base(dir))
+		dirs = append(dirs, fs.Dir(dir))
+	}
+
+	ignored := false
+	for i := len(dirs) - 1; i >= 0; i-- {
+		f := ig.load(dirs[i], fs)
+		if f == nil {
+			continue
+		}
+
+		rel := make([]string, 0, i+1)
+		for j := i; j >= 0; j-- {
+			rel = append(rel, names[j])
+		}
+		matched, ign, err := f.Match(strings.Join(rel, "/"), isDir)
+		if err != nil {
+			ig.warnf("error matching %v against ignore file in %v: %v", item, dirs[i], err)
+			continue
+		}
+		if matched {
+			ignored = ign
+		}
+	}
+
+	if ignored {
+		debug.Log("%v is excluded by an ignore file", item)
+	}
+	return ignored
+}
+
+// load returns the parsed ignore file in dir or nil if there is none.
+func (ig *ignoreFiles) load(dir string, fsInst fs.FS) *filter.IgnoreFile {
+	ig.files.Lock()
+	f, ok := ig.files.Get(dir)
+	ig.files.Unlock()
+	if ok {
+		return f
+	}
+
+	f = ig.read(fsInst.Join(dir, ig.filename), fsInst)
+
+	ig.files.Lock()
+	ig.files.Store(dir, f)
+	ig.files.Unlock()
+	return f
+}
+
+func (ig *ignoreFiles) read(filename string, fsInst fs.FS) *filter.IgnoreFile {
+	fi, err := fsInst.Lstat(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		ig.warnf("could not access ignore file: %v", err)
+		return nil
+	}
+	if !fi.Mode.IsRegular() {
+		ig.warnf("ignore file %q is not a regular file\n", filename)
+		return nil
+	}
+
+	file, err := fsInst.OpenFile(filename, fs.O_RDONLY, false)
+	if err != nil {
+		ig.warnf("could not open ignore file: %v", err)
+		return nil
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	buf, err := io.ReadAll(file)
+	if err != nil {
+		ig.warnf("could not read ignore file %q: %v\n", filename, err)
+		return nil
+	}
+
+	f, err := filter.ParseIgnoreFile(buf)
+	if err != nil {
+		ig.warnf("invalid ignore file %q: %v\n", filename, err)
+		return nil
+	}
+	return f
+}
+
 // deviceMap is used to track allowed source devices for backup. This is used to
 // check for crossing mount points during backup (for --one-file-system). It
 // maps the name of a source path to its device ID.
@@ -334,3 +490,91 @@ func RejectCloudFiles(warnf func(msg string, args ...interface{})) (RejectFunc,
 		return false
 	}, nil
 }
+
+// RejectByModTime returns a RejectFunc which rejects files that were last
+// modified before the given time. Directories are never rejected.
+func RejectByModTime(before time.Time) (RejectFunc, error) {
+	return func(item string, fi *fs.ExtendedFileInfo, _ fs.FS) bool {
+		if fi.Mode.IsDir() {
+			return false
+		}
+
+		if fi.ModTime.Before(before) {
+			debug.Log("file %s is older than %v: %v", item, before, fi.ModTime)
+			return true
+		}
+
+		return false
+	}, nil
+}
+
+// RejectByOwner returns a RejectFunc which rejects files that are owned by
+// one of the given user IDs or group IDs. Directories are never rejected, such
+// that the files of other owners within them are still included.
+func RejectByOwner(uids []uint32, gids []uint32) (RejectFunc, error) {
+	if runtime.GOOS == "windows" {
+		return nil, errors.New("excluding files by owner is not supported on Windows")
+	}
+
+	return func(item string, fi *fs.ExtendedFileInfo, _ fs.FS) bool {
+		if fi.Mode.IsDir() {
+			return false
+		}
+
+		if slices.Contains(uids, fi.UID) || slices.Contains(gids, fi.GID) {
+			debug.Log("file %s is owned by excluded user %d or group %d", item, fi.UID, fi.GID)
+			return true
+		}
+
+		return false
+	}, nil
+}
+
+// RejectByNodeType returns a RejectFunc which rejects all items of the given
+// node types. Directories cannot be rejected.
+func RejectByNodeType(types []data.NodeType) (RejectFunc, error) {
+	for _, t := range types {
+		switch t {
+		case data.NodeTypeFile, data.NodeTypeSymlink, data.NodeTypeDev, data.NodeTypeCharDev,
+			data.NodeTypeFifo, data.NodeTypeSocket, data.NodeTypeIrregular:
+		case data.NodeTypeDir:
+			return nil, errors.New("directories cannot be excluded by type")
+		default:
+			return nil, fmt.Errorf("invalid node type %q", t)
+		}
+	}
+
+	return func(item string, fi *fs.ExtendedFileInfo, _ fs.FS) bool {
+		t := fi.NodeType()
+		if slices.Contains(types, t) {
+			debug.Log("item %s has excluded type %v", item, t)
+			return true
+		}
+
+		return false
+	}, nil
+}
+
+// RejectByPermissions returns a RejectFunc which rejects files that have at
+// least one of the given permission bits set. Only the permission bits and
+// the setuid, setgid and sticky bits of perm are used. Directories are never
+// rejected.
+func RejectByPermissions(perm os.FileMode) (RejectFunc, error) {
+	perm &= os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+	if perm == 0 {
+		return nil, errors.New("no permission bits given")
+	}
+
+	return func(item string, fi *fs.ExtendedFileInfo, _ fs.FS) bool {
+		if fi.Mode.IsDir() {
+			return false
+		}
+
+		if fi.Mode&perm != 0 {
+			debug.Log("file %s has excluded permission bits %v", item, fi.Mode&perm)
+			return true
+		}
+
+		return false
+	}, nil
+}
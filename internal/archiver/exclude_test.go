@@ -3,8 +3,11 @@ package archiver
 import (
 	"os"
 	"path/filepath"
+	"runtime"
 	"testing"
+	"time"
 
+	"github.com/restic/restic/internal/data"
 	"github.com/restic/restic/internal/fs"
 	"github.com/restic/restic/internal/test"
 )
@@ -49,7 +52,7 @@ func TestIsExcludedByFile(t *testing.T) {
 			if tc.content == "" {
 				h = ""
 			}
-			if got := isExcludedByFile(foo, tagFilename, h, newRejectionCache(), fs.NewLocal(), func(msg string, args ...interface{}) { t.Logf(msg, args...) }); tc.want != got {
+			if got := isExcludedByFile(foo, tagFilename, h, newRejectionCache[bool](), fs.NewLocal(), func(msg string, args ...interface{}) { t.Logf(msg, args...) }); tc.want != got {
 				t.Fatalf("expected %v, got %v", tc.want, got)
 			}
 		})
@@ -134,6 +137,75 @@ func TestMultipleIsExcludedByFile(t *testing.T) {
 	}
 }
 
+func TestRejectByIgnoreFile(t *testing.T) {
+	tempDir := test.TempDir(t)
+
+	files := []struct {
+		path    string
+		content string
+		incl    bool
+	}{
+		{".resticignore", "*.o\nbuild/\n/secret\n!keep.o\n", true},
+		{"main.c", "", true},
+		{"main.o", "", false},
+		{"keep.o", "", true},
+		{"secret", "", false},
+		{"build/out", "", false},
+		{"build/sub/out", "", false},
+
+		// patterns are inherited by subdirectories, but anchored patterns
+		// are relative to the directory of the ignore file
+		{"src/lib.o", "", false},
+		{"src/secret", "", true},
+		{"src/build", "", true},
+
+		// ignore files in subdirectories take precedence
+		{"vendor/.resticignore", "!*.o\n*.tmp\ncache/*\n!cache/keep", true},
+		{"vendor/lib.o", "", true},
+		{"vendor/x.tmp", "", false},
+		{"vendor/cache/data", "", false},
+		{"vendor/cache/keep", "", true},
+		{"vendor/sub/x.tmp", "", false},
+	}
+	var errs []error
+	for _, f := range files {
+		// create directories first, then the file
+		p := filepath.Join(tempDir, filepath.FromSlash(f.path))
+		errs = append(errs, os.MkdirAll(filepath.Dir(p), 0700))
+		errs = append(errs, os.WriteFile(p, []byte(f.content), 0600))
+	}
+	test.OKs(t, errs) // see if anything went wrong during the creation
+
+	ignoreExclude, err := RejectByIgnoreFile(".resticignore", func(msg string, args ...interface{}) { t.Errorf(msg, args...) })
+	test.OK(t, err)
+
+	// walk all files, including those in excluded directories
+	m := make(map[string]bool)
+	walk := func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		excluded := ignoreExclude(p, fs.ExtendedStat(fi), fs.NewLocal())
+		// the log message helps debugging in case the test fails
+		t.Logf("%q: %v", p, excluded)
+		m[p] = !excluded
+		return nil
+	}
+	test.OK(t, filepath.Walk(tempDir, walk))
+
+	for _, f := range files {
+		p := filepath.Join(tempDir, filepath.FromSlash(f.path))
+		if m[p] != f.incl {
+			t.Errorf("inclusion status of %s is wrong: want %v, got %v", f.path, f.incl, m[p])
+		}
+	}
+
+	_, err = RejectByIgnoreFile("", nil)
+	test.Assert(t, err != nil, "missing error for empty ignore file name")
+	_, err = RejectByIgnoreFile("dir/.resticignore", nil)
+	test.Assert(t, err != nil, "missing error for ignore file name with directory")
+}
+
 // TestIsExcludedByFileSize is for testing the instance of
 // --exclude-larger-than parameters
 func TestIsExcludedByFileSize(t *testing.T) {
@@ -211,6 +283,64 @@ func TestIsExcludedByFileSize(t *testing.T) {
 	}
 }
 
+func TestRejectByMetadata(t *testing.T) {
+	now := time.Now()
+	old := now.Add(-48 * time.Hour)
+
+	byModTime, err := RejectByModTime(now.Add(-24 * time.Hour))
+	test.OK(t, err)
+	byType, err := RejectByNodeType([]data.NodeType{data.NodeTypeSocket, data.NodeTypeFifo})
+	test.OK(t, err)
+	byPerm, err := RejectByPermissions(0o002 | os.ModeSetuid)
+	test.OK(t, err)
+
+	type rejectTest struct {
+		name   string
+		reject RejectFunc
+		fi     fs.ExtendedFileInfo
+		want   bool
+	}
+	tests := []rejectTest{
+		{"NewFile", byModTime, fs.ExtendedFileInfo{Mode: 0o644, ModTime: now}, false},
+		{"OldFile", byModTime, fs.ExtendedFileInfo{Mode: 0o644, ModTime: old}, true},
+		{"OldDir", byModTime, fs.ExtendedFileInfo{Mode: os.ModeDir | 0o755, ModTime: old}, false},
+		{"RegularFile", byType, fs.ExtendedFileInfo{Mode: 0o644}, false},
+		{"Socket", byType, fs.ExtendedFileInfo{Mode: os.ModeSocket | 0o644}, true},
+		{"Fifo", byType, fs.ExtendedFileInfo{Mode: os.ModeNamedPipe | 0o644}, true},
+		{"CharDev", byType, fs.ExtendedFileInfo{Mode: os.ModeDevice | os.ModeCharDevice | 0o644}, false},
+		{"PrivateFile", byPerm, fs.ExtendedFileInfo{Mode: 0o600}, false},
+		{"WorldWritable", byPerm, fs.ExtendedFileInfo{Mode: 0o666}, true},
+		{"Setuid", byPerm, fs.ExtendedFileInfo{Mode: os.ModeSetuid | 0o755}, true},
+		{"WorldWritableDir", byPerm, fs.ExtendedFileInfo{Mode: os.ModeDir | 0o777}, false},
+	}
+
+	if runtime.GOOS != "windows" {
+		byOwner, err := RejectByOwner([]uint32{1000}, []uint32{50})
+		test.OK(t, err)
+		tests = append(tests, []rejectTest{
+			{"OtherOwner", byOwner, fs.ExtendedFileInfo{Mode: 0o644, UID: 1001, GID: 100}, false},
+			{"ExcludedOwner", byOwner, fs.ExtendedFileInfo{Mode: 0o644, UID: 1000, GID: 100}, true},
+			{"ExcludedGroup", byOwner, fs.ExtendedFileInfo{Mode: 0o644, UID: 1001, GID: 50}, true},
+			{"ExcludedOwnerDir", byOwner, fs.ExtendedFileInfo{Mode: os.ModeDir | 0o755, UID: 1000, GID: 50}, false},
+		}...)
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.reject("/foo", &tc.fi, nil); got != tc.want {
+				t.Fatalf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+
+	_, err = RejectByNodeType([]data.NodeType{data.NodeTypeDir})
+	test.Assert(t, err != nil, "missing error for directory type")
+	_, err = RejectByNodeType([]data.NodeType{"foo"})
+	test.Assert(t, err != nil, "missing error for invalid type")
+	_, err = RejectByPermissions(os.ModeDir)
+	test.Assert(t, err != nil, "missing error for missing permission bits")
+}
+
 func TestDeviceMap(t *testing.T) {
 	deviceMap := deviceMap{
 		filepath.FromSlash("/"):          1,
@@ -6,6 +6,7 @@ import (
 	"io"
 	"sync"
 
+	"github.com/restic/restic/internal/backend/limiter"
 	"github.com/restic/restic/internal/data"
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
@@ -28,8 +29,24 @@ type fileSaver struct {
 	CompleteBlob func(bytes uint64)
 
 	NodeFromFileInfo func(snPath, filename string, meta toNoder, ignoreXattrListError bool) (*data.Node, error)
+
+	// FS is used to detect files which were modified while being read and to
+	// open them again. If FS is nil, modifications are not detected.
+	FS fs.FS
+	// ModifiedFileRetries is the number of times a file which was modified
+	// while being read is read again.
+	ModifiedFileRetries uint
+	// ChangeIgnoreFlags controls the change detection, see Archiver.
+	ChangeIgnoreFlags uint
+	// ReadLimiter throttles reading the files, reads are not limited if it
+	// is nil.
+	ReadLimiter limiter.Limiter
 }
 
+// ModifiedWhileReading is stored in the Error field of the node of a file
+// which was still modified while being read after all retries.
+const ModifiedWhileReading = "file was modified while being read"
+
 // newFileSaver returns a new file saver. A worker pool with fileWorkers is
 // started, it is stopped when ctx is cancelled.
 func newFileSaver(ctx context.Context, wg *errgroup.Group, uploader restic.BlobSaverAsync, chunkerFactory restic.ChunkerFactory, fileWorkers uint) *fileSaver {
@@ -156,10 +173,40 @@ func (s *fileChunkState) readNextChunk(rd io.Reader, chnker restic.Chunker, data
 	}
 }
 
-// saveFile stores the file f in the repo, then closes it.
+// saveFile stores the file f in the repo, then closes it. A file which is
+// modified while being read is read again up to ModifiedFileRetries times.
 func (s *fileSaver) saveFile(ctx context.Context, chnker restic.Chunker, chunkState *fileChunkState, snPath string, target string, f fs.File, start func(), finishReading func(), finish func(res futureNodeResult)) {
 	start()
 
+	// the bytes passed to CompleteBlob, shared by all attempts
+	var reported uint64
+	for attempt := uint(0); ; attempt++ {
+		retry := attempt < s.ModifiedFileRetries
+		if !s.saveFileAttempt(ctx, chnker, chunkState, snPath, target, f, retry, &reported, finishReading, finish) {
+			return
+		}
+
+		debug.Log("%v was modified while being read, reading it again", target)
+		var err error
+		f, err = s.FS.OpenFile(target, fs.O_NOFOLLOW, false)
+		if err != nil {
+			finish(futureNodeResult{
+				snPath: snPath,
+				target: target,
+				err:    fmt.Errorf("failed to save %v: %w", target, err),
+			})
+			return
+		}
+	}
+}
+
+// saveFileAttempt reads the file f once and closes it. If the file was
+// modified while being read and retry is set, the attempt is abandoned and
+// true is returned, finish is not called in this case. Otherwise, finish is
+// called once all data has been saved. The bytes read by an attempt are only
+// passed to CompleteBlob once they exceed reported, which contains the bytes
+// already reported by abandoned attempts.
+func (s *fileSaver) saveFileAttempt(ctx context.Context, chnker restic.Chunker, chunkState *fileChunkState, snPath string, target string, f fs.File, retry bool, reported *uint64, finishReading func(), finish func(res futureNodeResult)) (modified bool) {
 	fnr := futureNodeResult{
 		snPath: snPath,
 		target: target,
@@ -167,11 +214,16 @@ func (s *fileSaver) saveFile(ctx context.Context, chnker restic.Chunker, chunkSt
 	var lock sync.Mutex
 	remaining := 0
 	isCompleted := false
+	// blobs of an abandoned attempt must not complete the file
+	abandoned := false
 
 	completeBlob := func() {
 		lock.Lock()
 		defer lock.Unlock()
 
+		if abandoned {
+			return
+		}
 		remaining--
 		if remaining == 0 && fnr.err == nil {
 			if isCompleted {
@@ -190,7 +242,7 @@ func (s *fileSaver) saveFile(ctx context.Context, chnker restic.Chunker, chunkSt
 		lock.Lock()
 		defer lock.Unlock()
 
-		if fnr.err == nil {
+		if fnr.err == nil && !abandoned {
 			if isCompleted {
 				panic("completed twice")
 			}
@@ -208,24 +260,32 @@ func (s *fileSaver) saveFile(ctx context.Context, chnker restic.Chunker, chunkSt
 	if err != nil {
 		_ = f.Close()
 		completeError(err)
-		return
+		return false
 	}
 
 	if node.Type != data.NodeTypeFile {
 		_ = f.Close()
 		completeError(errors.Errorf("node type %q is wrong", node.Type))
-		return
+		return false
 	}
 
+	// metadata of the file before reading it
+	before := *node
+
 	chnker.Reset()
 	chunkState.reset()
 
+	var rd io.Reader = f
+	if s.ReadLimiter != nil {
+		rd = s.ReadLimiter.Downstream(f)
+	}
+
 	node.Content = []restic.ID{}
 	node.Size = 0
 	var idx int
 	for {
 		buf := s.saveFilePool.Get()
-		chunkData, err := chunkState.readNextChunk(f, chnker, buf.Data)
+		chunkData, err := chunkState.readNextChunk(rd, chnker, buf.Data)
 		if err == io.EOF {
 			buf.Release()
 			break
@@ -234,7 +294,7 @@ func (s *fileSaver) saveFile(ctx context.Context, chnker restic.Chunker, chunkSt
 			buf.Release()
 			_ = f.Close()
 			completeError(err)
-			return
+			return false
 		}
 
 		// put result buffer back for later reuse
@@ -246,7 +306,7 @@ func (s *fileSaver) saveFile(ctx context.Context, chnker restic.Chunker, chunkSt
 			buf.Release()
 			_ = f.Close()
 			completeError(ctx.Err())
-			return
+			return false
 		}
 
 		// add a place to store the saveBlob result
@@ -280,16 +340,31 @@ func (s *fileSaver) saveFile(ctx context.Context, chnker restic.Chunker, chunkSt
 		if ctx.Err() != nil {
 			_ = f.Close()
 			completeError(ctx.Err())
-			return
+			return false
 		}
 
-		s.CompleteBlob(uint64(len(chunkData)))
+		if node.Size > *reported {
+			s.CompleteBlob(node.Size - *reported)
+			*reported = node.Size
+		}
 	}
 
 	err = f.Close()
 	if err != nil {
 		completeError(err)
-		return
+		return false
+	}
+
+	if s.modified(target, &before) {
+		if retry {
+			lock.Lock()
+			defer lock.Unlock()
+			// the file has already been completed if saving a blob failed
+			abandoned = fnr.err == nil
+			return abandoned
+		}
+		debug.Log("%v was modified while being read", target)
+		node.Error = ModifiedWhileReading
 	}
 
 	fnr.node = node
@@ -300,6 +375,23 @@ func (s *fileSaver) saveFile(ctx context.Context, chnker restic.Chunker, chunkSt
 	lock.Unlock()
 	finishReading()
 	completeBlob()
+	return false
+}
+
+// modified reports whether the file at target was modified since node was
+// created from its metadata.
+func (s *fileSaver) modified(target string, node *data.Node) bool {
+	if s.FS == nil {
+		return false
+	}
+
+	fi, err := s.FS.Lstat(target)
+	if err != nil {
+		// the data read so far is still usable if the file was removed
+		debug.Log("lstat() for %v returned error: %v", target, err)
+		return false
+	}
+	return fileChanged(fi, node, s.ChangeIgnoreFlags)
 }
 
 func (s *fileSaver) worker(ctx context.Context, jobs <-chan saveFileJob) {
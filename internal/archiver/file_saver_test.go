@@ -6,6 +6,8 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"sync"
+	"sync/atomic"
 	"testing"
 
 	"github.com/restic/restic/internal/data"
@@ -30,7 +32,7 @@ func createTestFiles(t testing.TB, num int) (files []string) {
 	return files
 }
 
-func startFileSaver(ctx context.Context, t testing.TB, _ fs.FS) (*fileSaver, *mockSaver, context.Context, *errgroup.Group) {
+func startFileSaver(ctx context.Context, t testing.TB, testFs fs.FS) (*fileSaver, *mockSaver, context.Context, *errgroup.Group) {
 	wg, ctx := errgroup.WithContext(ctx)
 
 	workers := uint(runtime.NumCPU())
@@ -41,6 +43,7 @@ func startFileSaver(ctx context.Context, t testing.TB, _ fs.FS) (*fileSaver, *mo
 	s.NodeFromFileInfo = func(snPath, filename string, meta toNoder, ignoreXattrListError bool) (*data.Node, error) {
 		return meta.ToNode(ignoreXattrListError, t.Logf)
 	}
+	s.FS = testFs
 
 	return s, saver, ctx, wg
 }
@@ -85,3 +88,100 @@ func TestFileSaver(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+// modifyingFS appends to a file when it is read for the first time after
+// opening it, for the first modifications opened files.
+type modifyingFS struct {
+	fs.FS
+	t testing.TB
+
+	m             sync.Mutex
+	modifications int
+}
+
+func (f *modifyingFS) OpenFile(name string, flag int, metadataOnly bool) (fs.File, error) {
+	file, err := f.FS.OpenFile(name, flag, metadataOnly)
+	if err != nil {
+		return nil, err
+	}
+	return &modifyingFile{File: file, fs: f, name: name}, nil
+}
+
+func (f *modifyingFS) modify(name string) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	if f.modifications == 0 {
+		return
+	}
+	f.modifications--
+
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0)
+	test.OK(f.t, err)
+	_, err = file.Write([]byte("modified"))
+	test.OK(f.t, err)
+	test.OK(f.t, file.Close())
+}
+
+type modifyingFile struct {
+	fs.File
+	fs   *modifyingFS
+	name string
+	read bool
+}
+
+func (f *modifyingFile) Read(p []byte) (int, error) {
+	if !f.read {
+		f.read = true
+		f.fs.modify(f.name)
+	}
+	return f.File.Read(p)
+}
+
+func TestFileSaverModifiedWhileReading(t *testing.T) {
+	var tests = []struct {
+		modifications int
+		retries       uint
+		modified      bool
+	}{
+		{0, 0, false},
+		{1, 0, true},
+		{1, 1, false},
+		{2, 1, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(fmt.Sprintf("modifications-%d-retries-%d", tc.modifications, tc.retries), func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			filename := createTestFiles(t, 1)[0]
+			testFs := &modifyingFS{FS: fs.NewLocal(), t: t, modifications: tc.modifications}
+			s, _, ctx, wg := startFileSaver(ctx, t, testFs)
+			s.ModifiedFileRetries = tc.retries
+			var completed atomic.Uint64
+			s.CompleteBlob = func(bytes uint64) {
+				completed.Add(bytes)
+			}
+
+			f, err := testFs.OpenFile(filename, fs.O_NOFOLLOW, false)
+			test.OK(t, err)
+			fn := s.Save(ctx, filename, filename, f, func() {}, func() {}, func(*data.Node, ItemStats) {})
+			fnr := fn.take(ctx)
+			test.OK(t, fnr.err)
+
+			if tc.modified {
+				test.Equals(t, ModifiedWhileReading, fnr.node.Error)
+			} else {
+				test.Equals(t, "", fnr.node.Error)
+				fi, err := os.Stat(filename)
+				test.OK(t, err)
+				test.Equals(t, uint64(fi.Size()), fnr.node.Size)
+			}
+			// the bytes of abandoned attempts must not be counted again
+			test.Equals(t, fnr.node.Size, completed.Load())
+
+			s.TriggerShutdown()
+			test.OK(t, wg.Wait())
+		})
+	}
+}
@@ -0,0 +1,232 @@
+package archiver
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/data"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+)
+
+// ResumeState records the progress of a backup. It is saved periodically
+// while the backup is running and removed once the snapshot has been saved.
+// If the backup is interrupted, the next backup of the same paths uses it to
+// skip reading the files which were already completed.
+type ResumeState struct {
+	Time     time.Time             `json:"time"`
+	Hostname string                `json:"hostname"`
+	Paths    []string              `json:"paths"`
+	Files    map[string]ResumeFile `json:"files"`
+
+	id *restic.ID // plaintext ID
+}
+
+// ResumeFile contains the metadata of a completed file that is required to
+// detect whether the file has changed since.
+type ResumeFile struct {
+	Size       uint64     `json:"size"`
+	ModTime    time.Time  `json:"mtime"`
+	ChangeTime time.Time  `json:"ctime"`
+	Inode      uint64     `json:"inode,omitempty"`
+	Content    restic.IDs `json:"content"`
+}
+
+// ID returns the resume state's ID.
+func (s *ResumeState) ID() *restic.ID {
+	return s.id
+}
+
+func newResumeFile(node *data.Node) ResumeFile {
+	return ResumeFile{
+		Size:       node.Size,
+		ModTime:    node.ModTime,
+		ChangeTime: node.ChangeTime,
+		Inode:      node.Inode,
+		Content:    node.Content,
+	}
+}
+
+// node returns a node which only contains the fields required by fileChanged.
+func (f ResumeFile) node() *data.Node {
+	return &data.Node{
+		Type:       data.NodeTypeFile,
+		Size:       f.Size,
+		ModTime:    f.ModTime,
+		ChangeTime: f.ChangeTime,
+		Inode:      f.Inode,
+		Content:    f.Content,
+	}
+}
+
+// resumePaths returns the absolute and sorted paths of targets, such that
+// backups of the same paths can be matched independent of their order.
+func resumePaths(targets []string) []string {
+	paths := make([]string, 0, len(targets))
+	for _, target := range targets {
+		p, err := filepath.Abs(target)
+		if err != nil {
+			p = target
+		}
+		paths = append(paths, p)
+	}
+	slices.Sort(paths)
+	return paths
+}
+
+// FindResumeState returns the most recent resume state for a backup of
+// targets from hostname. If no such state exists, nil is returned.
+func FindResumeState(ctx context.Context, repo restic.ListerLoaderUnpacked, hostname string, targets []string) (*ResumeState, error) {
+	paths := resumePaths(targets)
+
+	var latest *ResumeState
+	err := repo.List(ctx, restic.ResumeFile, func(id restic.ID, _ int64) error {
+		state := &ResumeState{id: &id}
+		err := restic.LoadJSONUnpacked(ctx, repo, restic.ResumeFile, id, state)
+		if err != nil {
+			// an unreadable state only means that files are read again
+			debug.Log("unable to load resume state %v: %v", id.Str(), err)
+			return nil
+		}
+		if state.Hostname != hostname || !slices.Equal(state.Paths, paths) {
+			return nil
+		}
+		if latest == nil || state.Time.After(latest.Time) {
+			latest = state
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list resume states: %w", err)
+	}
+	return latest, nil
+}
+
+// resumeTracker collects the completed files of a running backup and
+// periodically saves them as resume state.
+type resumeTracker struct {
+	repo     archiverRepo
+	interval time.Duration
+	hostname string
+	paths    []string
+	previous *ResumeState
+
+	mu    sync.Mutex
+	files map[string]ResumeFile
+	// obsolete contains the resume states which are replaced by the next save
+	obsolete restic.IDs
+}
+
+func newResumeTracker(repo archiverRepo, targets []string, opts SnapshotOptions) *resumeTracker {
+	t := &resumeTracker{
+		repo:     repo,
+		interval: opts.ResumeInterval,
+		hostname: opts.Hostname,
+		paths:    resumePaths(targets),
+		previous: opts.Resume,
+		files:    make(map[string]ResumeFile),
+	}
+	if opts.Resume != nil {
+		// keep the files of the interrupted backup until they are completed again
+		maps.Copy(t.files, opts.Resume.Files)
+		if opts.Resume.ID() != nil {
+			t.obsolete = append(t.obsolete, *opts.Resume.ID())
+		}
+	}
+	return t
+}
+
+// lookup returns the content of the file at snPath if it was completed by the
+// interrupted backup, is unchanged and all its blobs are known.
+func (t *resumeTracker) lookup(arch *Archiver, snPath string, fi *fs.ExtendedFileInfo) (restic.IDs, bool) {
+	if t.previous == nil {
+		return nil, false
+	}
+	file, ok := t.previous.Files[snPath]
+	if !ok {
+		return nil, false
+	}
+	node := file.node()
+	if fileChanged(fi, node, arch.ChangeIgnoreFlags) || !arch.allBlobsPresent(node) {
+		return nil, false
+	}
+	return file.Content, true
+}
+
+// complete records that the file at snPath has been saved. Files which were
+// modified while being read are read again when resuming.
+func (t *resumeTracker) complete(snPath string, node *data.Node) {
+	if node == nil || node.Type != data.NodeTypeFile || node.Error != "" {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.files[snPath] = newResumeFile(node)
+}
+
+// run saves the resume state every interval until ctx is cancelled or done is
+// closed. The backup does not depend on the resume state, thus errors are only
+// passed to warn.
+func (t *resumeTracker) run(ctx context.Context, done <-chan struct{}, warn func(msg string, args ...interface{})) {
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := t.save(ctx); err != nil && ctx.Err() == nil {
+				warn("%v", err)
+			}
+		}
+	}
+}
+
+// save stores the completed files as new resume state and removes the
+// previous state.
+func (t *resumeTracker) save(ctx context.Context) error {
+	t.mu.Lock()
+	state := &ResumeState{
+		Time:     time.Now(),
+		Hostname: t.hostname,
+		Paths:    t.paths,
+		Files:    maps.Clone(t.files),
+	}
+	t.mu.Unlock()
+
+	// the index must contain the blobs referenced by the state, otherwise
+	// the files are read again
+	if err := t.repo.FlushIndex(ctx); err != nil {
+		return fmt.Errorf("failed to save index: %w", err)
+	}
+
+	id, err := restic.SaveJSONUnpacked(ctx, t.repo, restic.WriteableResumeFile, state)
+	if err != nil {
+		return fmt.Errorf("failed to save resume state: %w", err)
+	}
+	debug.Log("saved resume state %v with %d files", id.Str(), len(state.Files))
+
+	t.removeObsolete(ctx)
+	t.obsolete = append(t.obsolete, id)
+	return nil
+}
+
+// removeObsolete removes all resume states saved or resumed by this backup.
+// Leftover states are harmless, thus errors are ignored.
+func (t *resumeTracker) removeObsolete(ctx context.Context) {
+	for _, id := range t.obsolete {
+		if err := t.repo.RemoveUnpacked(ctx, restic.WriteableResumeFile, id); err != nil {
+			debug.Log("unable to remove resume state %v: %v", id.Str(), err)
+		}
+	}
+	t.obsolete = nil
+}
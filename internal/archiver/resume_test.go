@@ -0,0 +1,150 @@
+package archiver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/data"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func countResumeStates(t testing.TB, repo restic.Lister) int {
+	t.Helper()
+	count := 0
+	rtest.OK(t, repo.List(context.TODO(), restic.ResumeFile, func(restic.ID, int64) error {
+		count++
+		return nil
+	}))
+	return count
+}
+
+func TestResumeTrackerSave(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.TestRepository(t)
+	targets := []string{"/home/user/work", "/home/user/documents"}
+
+	tracker := newResumeTracker(repo, targets, SnapshotOptions{Hostname: "host"})
+	tracker.complete("/home/user/work/foo", &data.Node{Type: data.NodeTypeFile, Size: 42, Content: restic.IDs{restic.NewRandomID()}})
+	tracker.complete("/home/user/work", &data.Node{Type: data.NodeTypeDir})
+	rtest.OK(t, tracker.save(ctx))
+	rtest.OK(t, tracker.save(ctx))
+	// the second save replaces the first state
+	rtest.Equals(t, 1, countResumeStates(t, repo))
+
+	// the order of the targets does not matter
+	state, err := FindResumeState(ctx, repo, "host", []string{"/home/user/documents", "/home/user/work"})
+	rtest.OK(t, err)
+	rtest.Assert(t, state != nil, "resume state not found")
+	rtest.Equals(t, 1, len(state.Files))
+	rtest.Equals(t, uint64(42), state.Files["/home/user/work/foo"].Size)
+
+	for _, test := range []struct {
+		hostname string
+		targets  []string
+	}{
+		{"other", targets},
+		{"host", targets[:1]},
+	} {
+		state, err := FindResumeState(ctx, repo, test.hostname, test.targets)
+		rtest.OK(t, err)
+		rtest.Assert(t, state == nil, "unexpected resume state for %v %v", test.hostname, test.targets)
+	}
+
+	tracker.removeObsolete(ctx)
+	rtest.Equals(t, 0, countResumeStates(t, repo))
+}
+
+func TestArchiverResume(t *testing.T) {
+	ctx := context.Background()
+	src := TestDir{
+		"done":    TestFile{Content: string(rtest.Random(23, 1234))},
+		"pending": TestFile{Content: string(rtest.Random(42, 4321))},
+	}
+	tempdir, repo := prepareTempdirRepoSrc(t, src)
+	back := rtest.Chdir(t, tempdir)
+	defer back()
+
+	// simulate an interrupted backup which has only completed the first file
+	arch := New(repo, fs.NewLocal(), Options{})
+	opts := SnapshotOptions{Time: time.Now(), Hostname: "host"}
+	sn, _, _, err := arch.Snapshot(ctx, []string{"."}, opts)
+	rtest.OK(t, err)
+	tree, err := data.LoadTree(ctx, repo, *sn.Tree)
+	rtest.OK(t, err)
+
+	tracker := newResumeTracker(repo, []string{"."}, opts)
+	for item := range tree {
+		rtest.OK(t, item.Error)
+		if item.Node.Name == "done" {
+			tracker.complete("/done", item.Node)
+		}
+	}
+	rtest.OK(t, tracker.save(ctx))
+
+	state, err := FindResumeState(ctx, repo, "host", []string{"."})
+	rtest.OK(t, err)
+	rtest.Assert(t, state != nil, "resume state not found")
+
+	testFS := &MockFS{
+		FS:        fs.NewLocal(),
+		bytesRead: make(map[string]int),
+	}
+	arch = New(repo, testFS, Options{})
+	opts.Resume = state
+	opts.ResumeInterval = time.Millisecond
+	_, _, summary, err := arch.Snapshot(ctx, []string{"."}, opts)
+	rtest.OK(t, err)
+
+	rtest.Equals(t, map[string]int{"pending": 4321}, testFS.bytesRead)
+	rtest.Equals(t, ChangeStats{2, 0, 0}, summary.Files)
+	// the resume state is removed after the backup has completed
+	rtest.Equals(t, 0, countResumeStates(t, repo))
+}
+
+// failResumeRepo is unable to save resume states.
+type failResumeRepo struct {
+	archiverRepo
+}
+
+func (r *failResumeRepo) SaveUnpacked(ctx context.Context, t restic.WriteableFileType, buf []byte) (restic.ID, error) {
+	if t == restic.WriteableResumeFile {
+		return restic.ID{}, errors.New("unsupported file type")
+	}
+	return r.archiverRepo.SaveUnpacked(ctx, t, buf)
+}
+
+func TestResumeTrackerRunSaveFails(t *testing.T) {
+	repo := &failResumeRepo{archiverRepo: repository.TestRepository(t)}
+	tracker := newResumeTracker(repo, []string{"/home/user/work"}, SnapshotOptions{Hostname: "host", ResumeInterval: time.Millisecond})
+
+	// saving the resume state keeps failing, but only results in warnings
+	warnings := make(chan string)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		tracker.run(context.Background(), done, func(msg string, args ...interface{}) {
+			warnings <- fmt.Sprintf(msg, args...)
+		})
+		close(stopped)
+	}()
+
+	for i := 0; i < 2; i++ {
+		msg := <-warnings
+		rtest.Assert(t, strings.Contains(msg, "unsupported file type"), "unexpected warning %q", msg)
+	}
+	close(done)
+	for {
+		select {
+		case <-warnings:
+		case <-stopped:
+			return
+		}
+	}
+}
@@ -18,6 +18,13 @@ const (
 	SnapshotFile
 	IndexFile
 	ConfigFile
+	ParityFile
+	ResumeFile
+	PruneFile
+	DeletionFile
+	LedgerFile
+	CopyFile
+	SyncFile
 )
 
 // Keep in sync with restic.FileType.String().
@@ -37,6 +44,20 @@ func (t FileType) String() string {
 		s = "index"
 	case ConfigFile:
 		s = "config"
+	case ParityFile:
+		s = "parity"
+	case ResumeFile:
+		s = "resume"
+	case PruneFile:
+		s = "prune"
+	case DeletionFile:
+		s = "deletion"
+	case LedgerFile:
+		s = "ledger"
+	case CopyFile:
+		s = "copy"
+	case SyncFile:
+		s = "sync"
 	}
 	return s
 }
@@ -65,6 +86,13 @@ func (h Handle) Valid() error {
 	case SnapshotFile:
 	case IndexFile:
 	case ConfigFile:
+	case ParityFile:
+	case ResumeFile:
+	case PruneFile:
+	case DeletionFile:
+	case LedgerFile:
+	case CopyFile:
+	case SyncFile:
 	default:
 		return errors.Errorf("invalid Type %d", h.Type)
 	}
@@ -25,6 +25,13 @@ var defaultLayoutPaths = map[backend.FileType]string{
 	backend.IndexFile:    "index",
 	backend.LockFile:     "locks",
 	backend.KeyFile:      "keys",
+	backend.ParityFile:   "parity",
+	backend.ResumeFile:   "resume",
+	backend.PruneFile:    "prune",
+	backend.DeletionFile: "deletions",
+	backend.LedgerFile:   "ledger",
+	backend.CopyFile:     "copy",
+	backend.SyncFile:     "sync",
 }
 
 func NewDefaultLayout(path string, join func(...string) string) *DefaultLayout {
@@ -110,6 +110,13 @@ func TestDefaultLayout(t *testing.T) {
 			filepath.Join(tempdir, "index"),
 			filepath.Join(tempdir, "locks"),
 			filepath.Join(tempdir, "keys"),
+			filepath.Join(tempdir, "parity"),
+			filepath.Join(tempdir, "resume"),
+			filepath.Join(tempdir, "prune"),
+			filepath.Join(tempdir, "deletions"),
+			filepath.Join(tempdir, "ledger"),
+			filepath.Join(tempdir, "copy"),
+			filepath.Join(tempdir, "sync"),
 		}
 
 		for i := 0; i < 256; i++ {
@@ -185,6 +192,13 @@ func TestRESTLayout(t *testing.T) {
 			strings.Join([]string{url, "index"}, "/"),
 			strings.Join([]string{url, "locks"}, "/"),
 			strings.Join([]string{url, "keys"}, "/"),
+			strings.Join([]string{url, "parity"}, "/"),
+			strings.Join([]string{url, "resume"}, "/"),
+			strings.Join([]string{url, "prune"}, "/"),
+			strings.Join([]string{url, "deletions"}, "/"),
+			strings.Join([]string{url, "ledger"}, "/"),
+			strings.Join([]string{url, "copy"}, "/"),
+			strings.Join([]string{url, "sync"}, "/"),
 		}
 
 		sort.Strings(want)
@@ -31,7 +31,14 @@ func DefaultDelete(ctx context.Context, be backend.Backend) error {
 		backend.KeyFile,
 		backend.LockFile,
 		backend.SnapshotFile,
-		backend.IndexFile}
+		backend.IndexFile,
+		backend.ParityFile,
+		backend.ResumeFile,
+		backend.PruneFile,
+		backend.DeletionFile,
+		backend.LedgerFile,
+		backend.CopyFile,
+		backend.SyncFile}
 
 	for _, t := range alltypes {
 		err := be.List(ctx, t, func(fi backend.FileInfo) error {
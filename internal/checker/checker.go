@@ -32,6 +32,8 @@ type Checker struct {
 	// when snapshot filtering is being used
 	snapshotFilter *data.SnapshotFilter
 	args           []string
+
+	trustedKeys data.TrustedKeys
 }
 
 type checkerRepository interface {
@@ -60,6 +62,13 @@ func (c *Checker) LoadSnapshots(ctx context.Context, snapshotFilter *data.Snapsh
 	return err
 }
 
+// SetTrustedKeys configures the keys used to verify snapshot signatures. By
+// default, only snapshots with an invalid signature are reported. Once trusted
+// keys are set, all snapshots without a valid signature are reported.
+func (c *Checker) SetTrustedKeys(trusted data.TrustedKeys) {
+	c.trustedKeys = trusted
+}
+
 // IsFiltered returns true if snapshot filtering is active
 func (c *Checker) IsFiltered() bool {
 	return len(c.args) != 0 || !c.snapshotFilter.Empty()
@@ -98,12 +107,35 @@ func (e *SnapshotError) Error() string {
 	return fmt.Sprintf("snapshot %v: %v", e.ID, e.Message)
 }
 
-func loadSnapshotTreeIDs(ctx context.Context, lister restic.Lister, repo restic.LoaderUnpacked) (ids restic.IDs, errs []error) {
-	err := data.ForAllSnapshots(ctx, lister, repo, nil, func(id restic.ID, sn *data.Snapshot, err error) error {
+// SignatureError is returned for snapshots whose signature cannot be trusted.
+type SignatureError struct {
+	ID     restic.ID
+	Status data.SignatureStatus
+}
+
+func (e *SignatureError) Error() string {
+	return fmt.Sprintf("snapshot %v: signature is %v", e.ID.Str(), e.Status)
+}
+
+// checkSignature returns an error if the signature of the snapshot is invalid
+// or, if trusted keys are configured, not valid.
+func (c *Checker) checkSignature(sn *data.Snapshot) error {
+	status := sn.VerifySignature(c.trustedKeys)
+	if status == data.SignatureInvalid || (c.trustedKeys != nil && status != data.SignatureValid) {
+		return &SignatureError{ID: *sn.ID(), Status: status}
+	}
+	return nil
+}
+
+func (c *Checker) loadSnapshotTreeIDs(ctx context.Context) (ids restic.IDs, errs []error) {
+	err := data.ForAllSnapshots(ctx, c.snapshots, c.repo, nil, func(id restic.ID, sn *data.Snapshot, err error) error {
 		if err != nil {
 			errs = append(errs, &SnapshotError{ID: id.String(), Message: err})
 			return nil
 		}
+		if err := c.checkSignature(sn); err != nil {
+			errs = append(errs, err)
+		}
 		treeID := *sn.Tree
 		debug.Log("snapshot %v has tree %v", id, treeID)
 		ids = append(ids, treeID)
@@ -121,7 +153,7 @@ func (c *Checker) loadActiveTrees(ctx context.Context, snapshotFilter *data.Snap
 	errs = []error{}
 
 	if !c.IsFiltered() {
-		return loadSnapshotTreeIDs(ctx, c.snapshots, c.repo)
+		return c.loadSnapshotTreeIDs(ctx)
 	}
 
 	err := snapshotFilter.FindAll(ctx, c.snapshots, c.repo, args, func(id string, sn *data.Snapshot, err error) error {
@@ -129,6 +161,9 @@ func (c *Checker) loadActiveTrees(ctx context.Context, snapshotFilter *data.Snap
 			errs = append(errs, &SnapshotError{ID: id, Message: err})
 			return nil
 		} else if sn != nil {
+			if err := c.checkSignature(sn); err != nil {
+				errs = append(errs, err)
+			}
 			trees = append(trees, *sn.Tree)
 		}
 		return nil
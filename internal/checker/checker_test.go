@@ -2,6 +2,7 @@ package checker_test
 
 import (
 	"context"
+	"crypto/ed25519"
 	"io"
 	"math/rand"
 	"path/filepath"
@@ -469,6 +470,49 @@ func (r *delayRepository) Unblock() {
 	})
 }
 
+func TestCheckerSignatures(t *testing.T) {
+	repo, _, _ := repository.TestRepositoryWithVersion(t, 0)
+	unsigned := data.TestCreateSnapshot(t, repo, time.Unix(1470492820, 207401672), 1)
+
+	key, err := data.NewSigningKey()
+	test.OK(t, err)
+
+	sn := *unsigned
+	sn.Signature = nil
+	test.OK(t, sn.Sign(key))
+	_, err = data.SaveSnapshot(context.TODO(), repo, &sn)
+	test.OK(t, err)
+
+	// tampered snapshot
+	sn.Hostname = "bar"
+	invalidID, err := data.SaveSnapshot(context.TODO(), repo, &sn)
+	test.OK(t, err)
+
+	signatureErrors := func(trusted data.TrustedKeys) map[restic.ID]data.SignatureStatus {
+		chkr := checker.New(repo, false)
+		chkr.SetTrustedKeys(trusted)
+		hints, errs := chkr.LoadIndex(context.TODO(), restic.NoopTerminalCounterFactory)
+		test.Assert(t, len(hints) == 0 && len(errs) == 0, "unexpected errors: %v %v", hints, errs)
+
+		found := make(map[restic.ID]data.SignatureStatus)
+		for _, err := range checkStruct(chkr) {
+			var sigErr *checker.SignatureError
+			test.Assert(t, errors.As(err, &sigErr), "unexpected error %v", err)
+			found[sigErr.ID] = sigErr.Status
+		}
+		return found
+	}
+
+	test.Equals(t, map[restic.ID]data.SignatureStatus{
+		invalidID: data.SignatureInvalid,
+	}, signatureErrors(nil))
+
+	test.Equals(t, map[restic.ID]data.SignatureStatus{
+		*unsigned.ID(): data.SignatureUnsigned,
+		invalidID:      data.SignatureInvalid,
+	}, signatureErrors(data.TrustedKeys{"foo": {key.Public().(ed25519.PublicKey)}}))
+}
+
 func TestCheckerBlobTypeConfusion(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
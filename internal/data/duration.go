@@ -125,6 +125,11 @@ func (d *Duration) Set(s string) error {
 	return nil
 }
 
+// UnmarshalText calls ParseDuration and updates d.
+func (d *Duration) UnmarshalText(text []byte) error {
+	return d.Set(string(text))
+}
+
 // Type returns the type of Duration, usable within github.com/spf13/pflag and
 // in help texts.
 func (d Duration) Type() string {
@@ -25,10 +25,27 @@ type Snapshot struct {
 	Excludes []string   `json:"excludes,omitempty"`
 	Tags     []string   `json:"tags,omitempty"`
 	Original *restic.ID `json:"original,omitempty"`
+	// OriginalTree is the tree of the original snapshot if the file contents
+	// were split into new blobs while copying the snapshot.
+	OriginalTree *restic.ID `json:"original_tree,omitempty"`
+
+	// Expiry is the time after which forget removes the snapshot.
+	Expiry *time.Time `json:"expiry,omitempty"`
+	// Hold protects the snapshot from being removed, also after its expiry.
+	Hold bool `json:"hold,omitempty"`
+	// PartialScans is the number of consecutive backups, including this one,
+	// which only scanned the paths from a change list since the last backup
+	// which scanned all files.
+	PartialScans uint `json:"partial_scans,omitempty"`
+	// Checkpoint is set for the checkpoint snapshots saved while a backup is
+	// running. They are removed once a later backup has completed.
+	Checkpoint bool `json:"checkpoint,omitempty"`
 
 	ProgramVersion string           `json:"program_version,omitempty"`
 	Summary        *SnapshotSummary `json:"summary,omitempty"`
 
+	Signature *SnapshotSignature `json:"signature,omitempty"`
+
 	id *restic.ID // plaintext ID, used during restore
 }
 
@@ -49,6 +66,8 @@ type SnapshotSummary struct {
 	DataAddedPacked     uint64 `json:"data_added_packed"`
 	TotalFilesProcessed uint   `json:"total_files_processed"`
 	TotalBytesProcessed uint64 `json:"total_bytes_processed"`
+
+	FilesModifiedWhileReading uint `json:"files_modified_while_reading,omitempty"`
 }
 
 // NewSnapshot returns an initialized snapshot struct for the current user and
@@ -79,6 +98,18 @@ func NewSnapshot(paths []string, tags []string, hostname string, time time.Time)
 	return sn, nil
 }
 
+// SetExpiry sets the expiry time of sn to d after the snapshot time.
+func (sn *Snapshot) SetExpiry(d Duration) {
+	t := sn.Time.AddDate(d.Years, d.Months, d.Days).Add(time.Duration(d.Hours) * time.Hour)
+	sn.Expiry = &t
+}
+
+// Expired returns true if the expiry time of sn has passed. Snapshots on hold
+// never expire.
+func (sn *Snapshot) Expired(now time.Time) bool {
+	return !sn.Hold && sn.Expiry != nil && !sn.Expiry.After(now)
+}
+
 // LoadSnapshot loads the snapshot with the id and returns it.
 func LoadSnapshot(ctx context.Context, loader restic.LoaderUnpacked, id restic.ID) (*Snapshot, error) {
 	sn := &Snapshot{id: &id}
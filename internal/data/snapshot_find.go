@@ -29,7 +29,8 @@ func (f *SnapshotFilter) Empty() bool {
 	return len(f.Hosts)+len(f.Tags)+len(f.Paths) == 0
 }
 
-func (f *SnapshotFilter) matches(sn *Snapshot) bool {
+// Matches returns whether sn is matched by the hosts, tags and paths of the filter.
+func (f *SnapshotFilter) Matches(sn *Snapshot) bool {
 	return sn.HasHostname(f.Hosts) && sn.HasTagList(f.Tags) && sn.HasPaths(f.Paths)
 }
 
@@ -65,7 +66,7 @@ func (f *SnapshotFilter) findLatest(ctx context.Context, be restic.Lister, loade
 			return nil
 		}
 
-		if !f.matches(snapshot) {
+		if !f.Matches(snapshot) {
 			return nil
 		}
 
@@ -190,7 +191,7 @@ func (f *SnapshotFilter) FindAll(ctx context.Context, be restic.Lister, loader r
 	}
 
 	err := ForAllSnapshots(ctx, be, loader, nil, func(id restic.ID, sn *Snapshot, err error) error {
-		if err == nil && !f.matches(sn) {
+		if err == nil && !f.Matches(sn) {
 			return nil
 		}
 
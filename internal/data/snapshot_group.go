@@ -3,6 +3,8 @@ package data
 import (
 	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
 	"sort"
 	"strings"
 )
@@ -11,6 +13,11 @@ type SnapshotGroupByOptions struct {
 	Tag  bool
 	Host bool
 	Path bool
+	User bool
+	// FirstPath groups by the first component of the paths.
+	FirstPath bool
+	// TagPrefixes groups by the tags starting with one of the prefixes.
+	TagPrefixes []string
 }
 
 func splitSnapshotGroupBy(s string) (SnapshotGroupByOptions, error) {
@@ -23,8 +30,25 @@ func splitSnapshotGroupBy(s string) (SnapshotGroupByOptions, error) {
 			l.Path = true
 		case "tag", "tags":
 			l.Tag = true
+		case "user", "username":
+			l.User = true
+		case "first-path":
+			l.FirstPath = true
 		case "":
 		default:
+			if prefix, ok := strings.CutPrefix(option, "tag:"); ok {
+				prefix, ok = strings.CutSuffix(prefix, "*")
+				if !ok || prefix == "" || strings.Contains(prefix, "*") {
+					return SnapshotGroupByOptions{}, fmt.Errorf("invalid tag grouping option %q, expected tag:<prefix>*", option)
+				}
+				l.TagPrefixes = append(l.TagPrefixes, prefix)
+				continue
+			}
+			// labels are stored as tags of the form key=value
+			if key, ok := strings.CutPrefix(option, "label:"); ok && key != "" && !strings.ContainsAny(key, "=*") {
+				l.TagPrefixes = append(l.TagPrefixes, key+"=")
+				continue
+			}
 			return SnapshotGroupByOptions{}, fmt.Errorf("unknown grouping option: %q", option)
 		}
 	}
@@ -42,9 +66,23 @@ func (l SnapshotGroupByOptions) String() string {
 	if l.Tag {
 		parts = append(parts, "tags")
 	}
+	if l.User {
+		parts = append(parts, "user")
+	}
+	if l.FirstPath {
+		parts = append(parts, "first-path")
+	}
+	for _, prefix := range l.TagPrefixes {
+		parts = append(parts, "tag:"+prefix+"*")
+	}
 	return strings.Join(parts, ",")
 }
 
+// Empty returns true if no grouping option is set.
+func (l SnapshotGroupByOptions) Empty() bool {
+	return !l.Tag && !l.Host && !l.Path && !l.User && !l.FirstPath && len(l.TagPrefixes) == 0
+}
+
 func (l *SnapshotGroupByOptions) Set(s string) error {
 	parts, err := splitSnapshotGroupBy(s)
 	if err != nil {
@@ -61,9 +99,11 @@ func (l *SnapshotGroupByOptions) Type() string {
 // SnapshotGroupKey is the structure for identifying groups in a grouped
 // snapshot list. This is used by GroupSnapshots()
 type SnapshotGroupKey struct {
-	Hostname string   `json:"hostname"`
-	Paths    []string `json:"paths"`
-	Tags     []string `json:"tags"`
+	Hostname   string   `json:"hostname"`
+	Paths      []string `json:"paths"`
+	Tags       []string `json:"tags"`
+	Username   string   `json:"username,omitempty"`
+	FirstPaths []string `json:"first_paths,omitempty"`
 }
 
 func (s *SnapshotGroupKey) String() string {
@@ -77,9 +117,95 @@ func (s *SnapshotGroupKey) String() string {
 	if len(s.Tags) != 0 {
 		parts = append(parts, fmt.Sprintf("tags %v", s.Tags))
 	}
+	if s.Username != "" {
+		parts = append(parts, fmt.Sprintf("user %v", s.Username))
+	}
+	if len(s.FirstPaths) != 0 {
+		parts = append(parts, fmt.Sprintf("first path %v", s.FirstPaths))
+	}
 	return strings.Join(parts, ", ")
 }
 
+// GroupKey returns the key of the group sn belongs to.
+func (l SnapshotGroupByOptions) GroupKey(sn *Snapshot) SnapshotGroupKey {
+	var key SnapshotGroupKey
+	if l.Host {
+		key.Hostname = sn.Hostname
+	}
+	if l.Path {
+		key.Paths = sortedCopy(sn.Paths)
+	}
+	if l.Tag {
+		key.Tags = sortedCopy(sn.Tags)
+	} else if len(l.TagPrefixes) > 0 {
+		for _, tag := range sn.Tags {
+			for _, prefix := range l.TagPrefixes {
+				if strings.HasPrefix(tag, prefix) {
+					key.Tags = append(key.Tags, tag)
+					break
+				}
+			}
+		}
+		sort.Strings(key.Tags)
+	}
+	if l.User {
+		key.Username = sn.Username
+	}
+	if l.FirstPath {
+		seen := make(map[string]struct{})
+		for _, p := range sn.Paths {
+			first := firstPathComponent(p)
+			if _, ok := seen[first]; !ok {
+				seen[first] = struct{}{}
+				key.FirstPaths = append(key.FirstPaths, first)
+			}
+		}
+		sort.Strings(key.FirstPaths)
+	}
+	return key
+}
+
+// SameGroup returns true if both snapshots belong to the same group.
+func (l SnapshotGroupByOptions) SameGroup(a, b *Snapshot) (bool, error) {
+	ka, err := json.Marshal(l.GroupKey(a))
+	if err != nil {
+		return false, err
+	}
+	kb, err := json.Marshal(l.GroupKey(b))
+	if err != nil {
+		return false, err
+	}
+	return string(ka) == string(kb), nil
+}
+
+func sortedCopy(list []string) []string {
+	if list == nil {
+		return nil
+	}
+	list = append([]string{}, list...)
+	sort.Strings(list)
+	return list
+}
+
+// firstPathComponent returns p up to and including its first component below
+// the root, e.g. "/home" for "/home/user/work".
+func firstPathComponent(p string) string {
+	p = filepath.Clean(p)
+	vol := filepath.VolumeName(p)
+	rest := p[len(vol):]
+	root := ""
+	if len(rest) > 0 && os.IsPathSeparator(rest[0]) {
+		root, rest = rest[:1], rest[1:]
+	}
+	for i := 0; i < len(rest); i++ {
+		if os.IsPathSeparator(rest[i]) {
+			rest = rest[:i]
+			break
+		}
+	}
+	return vol + root + rest
+}
+
 // GroupSnapshots takes a list of snapshots and a grouping criteria and creates
 // a grouped list of snapshots.
 func GroupSnapshots(snapshots Snapshots, groupBy SnapshotGroupByOptions) (map[string]Snapshots, bool, error) {
@@ -87,33 +213,17 @@ func GroupSnapshots(snapshots Snapshots, groupBy SnapshotGroupByOptions) (map[st
 	snapshotGroups := make(map[string]Snapshots)
 
 	for _, sn := range snapshots {
-		// Determining grouping-keys
-		var tags []string
-		var hostname string
-		var paths []string
-
 		if groupBy.Tag {
-			tags = sn.Tags
-			sort.Strings(tags)
+			sort.Strings(sn.Tags)
 		}
-		if groupBy.Host {
-			hostname = sn.Hostname
-		}
-		if groupBy.Path {
-			paths = sn.Paths
-		}
-
 		sort.Strings(sn.Paths)
-		var k []byte
-		var err error
-
-		k, err = json.Marshal(SnapshotGroupKey{Tags: tags, Hostname: hostname, Paths: paths})
 
+		k, err := json.Marshal(groupBy.GroupKey(sn))
 		if err != nil {
 			return nil, false, err
 		}
 		snapshotGroups[string(k)] = append(snapshotGroups[string(k)], sn)
 	}
 
-	return snapshotGroups, groupBy.Tag || groupBy.Host || groupBy.Path, nil
+	return snapshotGroups, !groupBy.Empty(), nil
 }
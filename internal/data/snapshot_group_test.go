@@ -34,6 +34,16 @@ func TestGroupByOptions(t *testing.T) {
 			opts:       data.SnapshotGroupByOptions{Host: true, Path: true, Tag: true},
 			normalized: "host,paths,tags",
 		},
+		{
+			from:       "host,username,first-path",
+			opts:       data.SnapshotGroupByOptions{Host: true, User: true, FirstPath: true},
+			normalized: "host,user,first-path",
+		},
+		{
+			from:       "tag:app=*,label:env",
+			opts:       data.SnapshotGroupByOptions{TagPrefixes: []string{"app=", "env="}},
+			normalized: "tag:app=*,tag:env=*",
+		},
 	} {
 		var opts data.SnapshotGroupByOptions
 		test.OK(t, opts.Set(exp.from))
@@ -48,3 +58,70 @@ func TestGroupByOptions(t *testing.T) {
 	test.Assert(t, err != nil, "missing error on invalid tags")
 	test.Assert(t, !opts.Host && !opts.Path && !opts.Tag, "unexpected opts %s %s %s", opts.Host, opts.Path, opts.Tag)
 }
+
+func TestGroupByOptionsInvalidTagPrefix(t *testing.T) {
+	for _, option := range []string{"tag:app", "tag:*", "tag:a*b*", "label:", "label:app=x"} {
+		var opts data.SnapshotGroupByOptions
+		err := opts.Set(option)
+		test.Assert(t, err != nil, "missing error for %q", option)
+	}
+}
+
+func TestGroupSnapshotsByMetadata(t *testing.T) {
+	snapshots := data.Snapshots{
+		{Hostname: "a", Username: "alice", Paths: []string{"/home/alice", "/home/bob"}, Tags: []string{"app=web", "daily"}},
+		{Hostname: "a", Username: "alice", Paths: []string{"/home/alice"}, Tags: []string{"app=web"}},
+		{Hostname: "b", Username: "bob", Paths: []string{"/srv/data"}, Tags: []string{"app=db", "env=prod"}},
+		{Hostname: "b", Username: "alice", Paths: []string{"/srv/www"}},
+	}
+
+	for _, tc := range []struct {
+		groupBy string
+		keys    []data.SnapshotGroupKey
+		groups  int
+	}{
+		{
+			groupBy: "user",
+			keys: []data.SnapshotGroupKey{
+				{Username: "alice"}, {Username: "alice"}, {Username: "bob"}, {Username: "alice"},
+			},
+			groups: 2,
+		},
+		{
+			groupBy: "first-path",
+			keys: []data.SnapshotGroupKey{
+				{FirstPaths: []string{"/home"}}, {FirstPaths: []string{"/home"}},
+				{FirstPaths: []string{"/srv"}}, {FirstPaths: []string{"/srv"}},
+			},
+			groups: 2,
+		},
+		{
+			groupBy: "tag:app=*",
+			keys: []data.SnapshotGroupKey{
+				{Tags: []string{"app=web"}}, {Tags: []string{"app=web"}}, {Tags: []string{"app=db"}}, {},
+			},
+			groups: 3,
+		},
+		{
+			groupBy: "host,label:app,label:env",
+			keys: []data.SnapshotGroupKey{
+				{Hostname: "a", Tags: []string{"app=web"}}, {Hostname: "a", Tags: []string{"app=web"}},
+				{Hostname: "b", Tags: []string{"app=db", "env=prod"}}, {Hostname: "b"},
+			},
+			groups: 3,
+		},
+	} {
+		t.Run(tc.groupBy, func(t *testing.T) {
+			var opts data.SnapshotGroupByOptions
+			test.OK(t, opts.Set(tc.groupBy))
+			for i, sn := range snapshots {
+				test.Equals(t, tc.keys[i], opts.GroupKey(sn))
+			}
+
+			groups, grouped, err := data.GroupSnapshots(snapshots, opts)
+			test.OK(t, err)
+			test.Assert(t, grouped, "snapshots were not grouped")
+			test.Equals(t, tc.groups, len(groups))
+		})
+	}
+}
@@ -12,19 +12,20 @@ import (
 
 // ExpirePolicy configures which snapshots should be automatically removed.
 type ExpirePolicy struct {
-	Last          int       // keep the last n snapshots
-	Hourly        int       // keep the last n hourly snapshots
-	Daily         int       // keep the last n daily snapshots
-	Weekly        int       // keep the last n weekly snapshots
-	Monthly       int       // keep the last n monthly snapshots
-	Yearly        int       // keep the last n yearly snapshots
-	Within        Duration  // keep snapshots made within this duration
-	WithinHourly  Duration  // keep hourly snapshots made within this duration
-	WithinDaily   Duration  // keep daily snapshots made within this duration
-	WithinWeekly  Duration  // keep weekly snapshots made within this duration
-	WithinMonthly Duration  // keep monthly snapshots made within this duration
-	WithinYearly  Duration  // keep yearly snapshots made within this duration
-	Tags          []TagList // keep all snapshots that include at least one of the tag lists.
+	Last          int           // keep the last n snapshots
+	Hourly        int           // keep the last n hourly snapshots
+	Daily         int           // keep the last n daily snapshots
+	Weekly        int           // keep the last n weekly snapshots
+	Monthly       int           // keep the last n monthly snapshots
+	Yearly        int           // keep the last n yearly snapshots
+	Within        Duration      // keep snapshots made within this duration
+	WithinHourly  Duration      // keep hourly snapshots made within this duration
+	WithinDaily   Duration      // keep daily snapshots made within this duration
+	WithinWeekly  Duration      // keep weekly snapshots made within this duration
+	WithinMonthly Duration      // keep monthly snapshots made within this duration
+	WithinYearly  Duration      // keep yearly snapshots made within this duration
+	Tags          []TagList     // keep all snapshots that include at least one of the tag lists.
+	Calendar      CalendarRules // keep the first or last snapshot of calendar periods
 }
 
 func (e ExpirePolicy) String() (s string) {
@@ -69,6 +70,10 @@ func (e ExpirePolicy) String() (s string) {
 		keepw = append(keepw, fmt.Sprintf("yearly snapshots within %v", e.WithinYearly))
 	}
 
+	for _, r := range e.Calendar {
+		keepw = append(keepw, r.description())
+	}
+
 	if len(keeps) > 0 {
 		s = fmt.Sprintf("%s snapshots", strings.Join(keeps, ", "))
 	}
@@ -105,11 +110,11 @@ func (e ExpirePolicy) String() (s string) {
 
 // Empty returns true if no policy has been configured (all values zero).
 func (e ExpirePolicy) Empty() bool {
-	if len(e.Tags) != 0 {
+	if len(e.Tags) != 0 || len(e.Calendar) != 0 {
 		return false
 	}
 
-	empty := ExpirePolicy{Tags: e.Tags}
+	empty := ExpirePolicy{Tags: e.Tags, Calendar: e.Calendar}
 	return reflect.DeepEqual(e, empty)
 }
 
@@ -223,6 +228,13 @@ func ApplyPolicy(list Snapshots, p ExpirePolicy) (keep, remove Snapshots, reason
 		{p.WithinYearly, y, -1, "yearly within"},
 	}
 
+	// Calendar rules count the periods for which a snapshot was kept
+	calendarCounts := make([]int, len(p.Calendar))
+	calendarLast := make([]int, len(p.Calendar))
+	for i := range calendarLast {
+		calendarLast[i] = -1
+	}
+
 	latest := findLatestTimestamp(list)
 
 	for nr, cur := range list {
@@ -288,6 +300,37 @@ func ApplyPolicy(list Snapshots, p ExpirePolicy) (keep, remove Snapshots, reason
 			}
 		}
 
+		// Keep the first or last snapshot of each calendar period. As the
+		// list is sorted newest first, the last snapshot of a period is the
+		// first one found, while the first snapshot is followed by a snapshot
+		// of another period.
+		for i, r := range p.Calendar {
+			if r.Count > 0 && calendarCounts[i] >= r.Count {
+				continue
+			}
+			if !r.Within.Zero() {
+				t := latest.AddDate(-r.Within.Years, -r.Within.Months, -r.Within.Days).Add(time.Hour * time.Duration(-r.Within.Hours))
+				if !cur.Time.After(t) {
+					continue
+				}
+			}
+
+			val := r.period(cur.Time)
+			var match bool
+			if r.First {
+				match = nr == len(list)-1 || r.period(list[nr+1].Time) != val
+			} else {
+				match = val != calendarLast[i]
+			}
+			calendarLast[i] = val
+			if match {
+				debug.Log("keep %v %v, calendar rule %v, val %v\n", cur.Time, cur.id.Str(), r, val)
+				keepSnap = true
+				calendarCounts[i]++
+				keepSnapReasons = append(keepSnapReasons, r.description())
+			}
+		}
+
 		if keepSnap {
 			keep = append(keep, cur)
 			kr := KeepReason{
@@ -308,3 +351,31 @@ func ApplyPolicy(list Snapshots, p ExpirePolicy) (keep, remove Snapshots, reason
 
 	return keep, remove, reasons
 }
+
+// TaggedPolicy is an ExpirePolicy which only applies to snapshots that have
+// all tags in Tags. A policy without tags applies to all snapshots.
+type TaggedPolicy struct {
+	Tags   TagList
+	Policy ExpirePolicy
+}
+
+// SplitByPolicy assigns each snapshot in list to the first policy it matches.
+// lists contains the snapshots for each policy, unmatched the snapshots which
+// match no policy.
+func SplitByPolicy(list Snapshots, policies []TaggedPolicy) (lists []Snapshots, unmatched Snapshots) {
+	lists = make([]Snapshots, len(policies))
+	for _, sn := range list {
+		matched := false
+		for i, p := range policies {
+			if sn.HasTags(p.Tags) {
+				lists[i] = append(lists[i], sn)
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			unmatched = append(unmatched, sn)
+		}
+	}
+	return lists, unmatched
+}
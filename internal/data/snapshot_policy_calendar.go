@@ -0,0 +1,206 @@
+package data
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// CalendarPeriod is a calendar based time period.
+type CalendarPeriod string
+
+// Calendar periods supported by CalendarRule.
+const (
+	PeriodDay     CalendarPeriod = "day"
+	PeriodWeek    CalendarPeriod = "week"
+	PeriodMonth   CalendarPeriod = "month"
+	PeriodQuarter CalendarPeriod = "quarter"
+	PeriodYear    CalendarPeriod = "year"
+)
+
+// CalendarRule keeps the first or last snapshot of each calendar period. In
+// contrast to the hourly to yearly buckets of ExpirePolicy, the oldest
+// snapshot is not kept additionally.
+type CalendarRule struct {
+	Period CalendarPeriod
+	First  bool     // keep the first instead of the last snapshot of each period
+	Count  int      // keep at most n periods, zero means unlimited
+	Within Duration // only keep snapshots made within this duration relative to the latest snapshot
+
+	// WeekStart is the first day of each week. ParseCalendarRule defaults to Monday.
+	WeekStart time.Weekday
+	// Location is the time zone of the period boundaries. If nil, the time
+	// zone of each snapshot is used.
+	Location *time.Location
+}
+
+// ParseCalendarRule parses a rule of the form
+// `period=quarter,select=first,count=4,within=7y,week-start=sunday,tz=Europe/Berlin`.
+// Only the period is required, select defaults to `last`.
+func ParseCalendarRule(s string) (CalendarRule, error) {
+	r := CalendarRule{WeekStart: time.Monday}
+	for _, opt := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(opt), "=")
+		if !ok {
+			return CalendarRule{}, errors.Errorf("invalid calendar rule option %q, expected key=value", opt)
+		}
+
+		switch key {
+		case "period":
+			switch p := CalendarPeriod(value); p {
+			case PeriodDay, PeriodWeek, PeriodMonth, PeriodQuarter, PeriodYear:
+				r.Period = p
+			default:
+				return CalendarRule{}, errors.Errorf("invalid period %q, must be one of day, week, month, quarter or year", value)
+			}
+		case "select":
+			switch value {
+			case "first":
+				r.First = true
+			case "last":
+				r.First = false
+			default:
+				return CalendarRule{}, errors.Errorf("invalid select %q, must be first or last", value)
+			}
+		case "count":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return CalendarRule{}, errors.Errorf("invalid count %q", value)
+			}
+			r.Count = n
+		case "within":
+			d, err := ParseDuration(value)
+			if err != nil {
+				return CalendarRule{}, err
+			}
+			if d.Hours < 0 || d.Days < 0 || d.Months < 0 || d.Years < 0 {
+				return CalendarRule{}, errors.Errorf("invalid duration %q, negative values are not allowed", value)
+			}
+			r.Within = d
+		case "week-start":
+			day, err := parseWeekday(value)
+			if err != nil {
+				return CalendarRule{}, err
+			}
+			r.WeekStart = day
+		case "tz":
+			loc, err := time.LoadLocation(value)
+			if err != nil {
+				return CalendarRule{}, errors.Errorf("invalid time zone %q: %v", value, err)
+			}
+			r.Location = loc
+		default:
+			return CalendarRule{}, errors.Errorf("unknown calendar rule option %q", key)
+		}
+	}
+
+	if r.Period == "" {
+		return CalendarRule{}, errors.Errorf("calendar rule %q does not specify a period", s)
+	}
+	return r, nil
+}
+
+func parseWeekday(s string) (time.Weekday, error) {
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if strings.EqualFold(s, day.String()) {
+			return day, nil
+		}
+	}
+	return 0, errors.Errorf("invalid weekday %q", s)
+}
+
+// String returns the rule in the format parsed by ParseCalendarRule.
+func (r CalendarRule) String() string {
+	sel := "last"
+	if r.First {
+		sel = "first"
+	}
+	s := fmt.Sprintf("period=%s,select=%s", r.Period, sel)
+	if r.Count > 0 {
+		s += fmt.Sprintf(",count=%d", r.Count)
+	}
+	if !r.Within.Zero() {
+		s += fmt.Sprintf(",within=%v", r.Within)
+	}
+	if r.Period == PeriodWeek {
+		s += ",week-start=" + strings.ToLower(r.WeekStart.String())
+	}
+	if r.Location != nil {
+		s += ",tz=" + r.Location.String()
+	}
+	return s
+}
+
+// description returns a human readable description of the rule.
+func (r CalendarRule) description() string {
+	sel := "last"
+	if r.First {
+		sel = "first"
+	}
+	s := fmt.Sprintf("%s snapshot of each %s", sel, r.Period)
+	if r.Period == PeriodWeek && r.WeekStart != time.Monday {
+		s += fmt.Sprintf(" starting %v", r.WeekStart)
+	}
+	if r.Location != nil {
+		s += fmt.Sprintf(" in %v", r.Location)
+	}
+	if r.Count > 0 {
+		s += fmt.Sprintf(" for %d periods", r.Count)
+	}
+	if !r.Within.Zero() {
+		s += fmt.Sprintf(" within %v", r.Within)
+	}
+	return s
+}
+
+// period returns a number which is unique for the calendar period containing d.
+func (r CalendarRule) period(d time.Time) int {
+	if r.Location != nil {
+		d = d.In(r.Location)
+	}
+
+	switch r.Period {
+	case PeriodDay:
+		return ymd(d, 0)
+	case PeriodWeek:
+		offset := (int(d.Weekday()) - int(r.WeekStart) + 7) % 7
+		start := time.Date(d.Year(), d.Month(), d.Day()-offset, 0, 0, 0, 0, d.Location())
+		return ymd(start, 0)
+	case PeriodMonth:
+		return ym(d, 0)
+	case PeriodQuarter:
+		return d.Year()*10 + (int(d.Month())-1)/3 + 1
+	case PeriodYear:
+		return y(d, 0)
+	}
+	panic(fmt.Sprintf("invalid calendar period %q", r.Period))
+}
+
+// CalendarRules consists of several CalendarRule.
+type CalendarRules []CalendarRule
+
+func (l CalendarRules) String() string {
+	rules := make([]string, 0, len(l))
+	for _, r := range l {
+		rules = append(rules, r.String())
+	}
+	return "[" + strings.Join(rules, "; ") + "]"
+}
+
+// Set parses a CalendarRule and adds it to the list.
+func (l *CalendarRules) Set(s string) error {
+	r, err := ParseCalendarRule(s)
+	if err != nil {
+		return err
+	}
+	*l = append(*l, r)
+	return nil
+}
+
+// Type returns a description of the type.
+func (CalendarRules) Type() string {
+	return "rule"
+}
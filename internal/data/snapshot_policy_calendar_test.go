@@ -0,0 +1,131 @@
+package data_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/data"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestParseCalendarRule(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	rtest.OK(t, err)
+
+	for _, test := range []struct {
+		input string
+		rule  data.CalendarRule
+		str   string
+	}{
+		{"period=month", data.CalendarRule{Period: data.PeriodMonth, WeekStart: time.Monday}, "period=month,select=last"},
+		{"period=quarter,select=first,within=7y", data.CalendarRule{Period: data.PeriodQuarter, First: true, Within: data.Duration{Years: 7}, WeekStart: time.Monday}, "period=quarter,select=first,within=7y"},
+		{"period=week, week-start=Sunday, tz=Europe/Berlin, count=4", data.CalendarRule{Period: data.PeriodWeek, Count: 4, WeekStart: time.Sunday, Location: berlin}, "period=week,select=last,count=4,week-start=sunday,tz=Europe/Berlin"},
+	} {
+		t.Run("", func(t *testing.T) {
+			rule, err := data.ParseCalendarRule(test.input)
+			rtest.OK(t, err)
+			rtest.Equals(t, test.rule, rule)
+			rtest.Equals(t, test.str, rule.String())
+
+			// the string representation can be parsed again
+			rule, err = data.ParseCalendarRule(rule.String())
+			rtest.OK(t, err)
+			rtest.Equals(t, test.rule, rule)
+		})
+	}
+
+	for _, input := range []string{
+		"",
+		"select=first",
+		"period=decade",
+		"period=month,select=middle",
+		"period=month,count=-1",
+		"period=month,within=-1y",
+		"period=week,week-start=someday",
+		"period=day,tz=Nowhere/Special",
+		"period=day,foo=bar",
+		"period",
+	} {
+		_, err := data.ParseCalendarRule(input)
+		rtest.Assert(t, err != nil, "expected error for %q", input)
+	}
+}
+
+func parseCalendarRule(t *testing.T, s string) data.CalendarRule {
+	r, err := data.ParseCalendarRule(s)
+	rtest.OK(t, err)
+	return r
+}
+
+func TestApplyPolicyCalendar(t *testing.T) {
+	list := data.Snapshots{
+		{Time: parseTimeUTC("2020-01-05 10:00:00")},
+		{Time: parseTimeUTC("2020-02-29 10:00:00")},
+		{Time: parseTimeUTC("2020-03-31 10:00:00")},
+		{Time: parseTimeUTC("2020-04-01 10:00:00")},
+		{Time: parseTimeUTC("2020-04-11 22:30:00")}, // Sunday 00:30 in Europe/Berlin
+		{Time: parseTimeUTC("2020-04-11 21:30:00")}, // Saturday 23:30 in Europe/Berlin
+		{Time: parseTimeUTC("2020-04-09 10:00:00")},
+		{Time: parseTimeUTC("2021-01-01 10:00:00")},
+		{Time: parseTimeUTC("2021-01-02 10:00:00")},
+	}
+
+	for _, test := range []struct {
+		rules data.CalendarRules
+		keep  []string
+	}{
+		{
+			data.CalendarRules{parseCalendarRule(t, "period=quarter,select=first")},
+			[]string{"2021-01-01 10:00:00", "2020-04-01 10:00:00", "2020-01-05 10:00:00"},
+		},
+		{
+			data.CalendarRules{parseCalendarRule(t, "period=quarter,select=first,within=6m")},
+			[]string{"2021-01-01 10:00:00"},
+		},
+		{
+			data.CalendarRules{parseCalendarRule(t, "period=month,select=last,count=3")},
+			[]string{"2021-01-02 10:00:00", "2020-04-11 22:30:00", "2020-03-31 10:00:00"},
+		},
+		{
+			data.CalendarRules{parseCalendarRule(t, "period=year,select=last")},
+			[]string{"2021-01-02 10:00:00", "2020-04-11 22:30:00"},
+		},
+		{
+			// the last snapshot before each Sunday 00:00 in Europe/Berlin
+			data.CalendarRules{parseCalendarRule(t, "period=week,select=last,week-start=sunday,tz=Europe/Berlin")},
+			[]string{"2021-01-02 10:00:00", "2020-04-11 22:30:00", "2020-04-11 21:30:00", "2020-04-01 10:00:00", "2020-02-29 10:00:00", "2020-01-05 10:00:00"},
+		},
+	} {
+		t.Run(test.rules.String(), func(t *testing.T) {
+			keep, remove, reasons := data.ApplyPolicy(list, data.ExpirePolicy{Calendar: test.rules})
+			rtest.Equals(t, len(list), len(keep)+len(remove))
+			rtest.Equals(t, len(keep), len(reasons))
+
+			var kept []string
+			for _, sn := range keep {
+				kept = append(kept, sn.Time.Format("2006-01-02 15:04:05"))
+			}
+			rtest.Equals(t, test.keep, kept)
+		})
+	}
+}
+
+func TestSplitByPolicy(t *testing.T) {
+	list := data.Snapshots{
+		{Time: parseTimeUTC("2020-01-01 10:00:00"), Tags: []string{"db", "daily"}},
+		{Time: parseTimeUTC("2020-01-02 10:00:00"), Tags: []string{"db"}},
+		{Time: parseTimeUTC("2020-01-03 10:00:00"), Tags: []string{"web"}},
+	}
+
+	lists, unmatched := data.SplitByPolicy(list, []data.TaggedPolicy{
+		{Tags: data.TagList{"db", "daily"}},
+		{Tags: data.TagList{"db"}},
+	})
+	rtest.Equals(t, []data.Snapshots{list[:1], list[1:2]}, lists)
+	rtest.Equals(t, list[2:], unmatched)
+
+	// a policy without tags matches all remaining snapshots
+	lists, unmatched = data.SplitByPolicy(list, []data.TaggedPolicy{{Tags: data.TagList{"db"}}, {}})
+	rtest.Equals(t, []data.Snapshots{list[:2], list[2:]}, lists)
+	rtest.Equals(t, data.Snapshots(nil), unmatched)
+}
@@ -0,0 +1,110 @@
+package data
+
+import (
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// maxSimulatedBackups limits the number of backups created by SimulatePolicy.
+const maxSimulatedBackups = 100000
+
+// SimulationPoint is the state of a simulated snapshot group at a point in time.
+type SimulationPoint struct {
+	Time time.Time
+	// Snapshots are the snapshots that exist at Time, newest first.
+	// Simulated snapshots have no ID.
+	Snapshots Snapshots
+	// Reasons lists why each snapshot was kept by the last forget run.
+	Reasons []KeepReason
+}
+
+// Cadence returns the median interval between the snapshots in list, or zero
+// if it cannot be determined.
+func Cadence(list Snapshots) time.Duration {
+	times := make([]time.Time, 0, len(list))
+	for _, sn := range list {
+		times = append(times, sn.Time)
+	}
+	slices.SortFunc(times, func(a, b time.Time) int { return a.Compare(b) })
+
+	var intervals []time.Duration
+	for i := 1; i < len(times); i++ {
+		if d := times[i].Sub(times[i-1]); d > 0 {
+			intervals = append(intervals, d)
+		}
+	}
+	if len(intervals) == 0 {
+		return 0
+	}
+	slices.Sort(intervals)
+	return intervals[len(intervals)/2]
+}
+
+// SimulatePolicy replays a retention policy as if backups continued at the
+// given cadence for the duration until after the latest snapshot in list.
+// After each simulated backup, apply is called with the existing snapshots
+// and the time of the backup, and returns the snapshots kept by a forget run.
+// The state is reported at the latest snapshot, every step thereafter and at
+// the end of the simulation. The simulated snapshots copy the host, paths
+// and tags of the latest snapshot.
+func SimulatePolicy(list Snapshots, cadence time.Duration, until, step Duration,
+	apply func(list Snapshots, now time.Time) (keep Snapshots, reasons []KeepReason, err error)) ([]SimulationPoint, error) {
+
+	if len(list) == 0 {
+		return nil, nil
+	}
+	if cadence <= 0 {
+		return nil, errors.New("invalid backup cadence")
+	}
+
+	current := slices.Clone(list)
+	sort.Stable(current)
+	latest := current[0]
+	start := latest.Time
+	end := start.AddDate(until.Years, until.Months, until.Days).Add(time.Duration(until.Hours) * time.Hour)
+	if !end.After(start) {
+		return nil, errors.New("the simulation must end after the latest snapshot")
+	}
+	if end.Sub(start)/cadence > maxSimulatedBackups {
+		return nil, errors.Errorf("simulating more than %d backups is not supported", maxSimulatedBackups)
+	}
+
+	advance := func(t time.Time) time.Time {
+		return t.AddDate(step.Years, step.Months, step.Days).Add(time.Duration(step.Hours) * time.Hour)
+	}
+	if !advance(start).After(start) {
+		return nil, errors.New("the simulation step must be positive")
+	}
+
+	current, reasons, err := apply(current, start)
+	if err != nil {
+		return nil, err
+	}
+	points := []SimulationPoint{{Time: start, Snapshots: current, Reasons: reasons}}
+	report := advance(start)
+
+	for t := start.Add(cadence); !t.After(end); t = t.Add(cadence) {
+		for ; report.Before(t) && report.Before(end); report = advance(report) {
+			points = append(points, SimulationPoint{Time: report, Snapshots: current, Reasons: reasons})
+		}
+
+		sn := &Snapshot{
+			Time:     t,
+			Hostname: latest.Hostname,
+			Paths:    latest.Paths,
+			Tags:     latest.Tags,
+		}
+		current, reasons, err = apply(append(Snapshots{sn}, current...), t)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for ; report.Before(end); report = advance(report) {
+		points = append(points, SimulationPoint{Time: report, Snapshots: current, Reasons: reasons})
+	}
+	return append(points, SimulationPoint{Time: end, Snapshots: current, Reasons: reasons}), nil
+}
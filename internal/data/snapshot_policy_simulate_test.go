@@ -0,0 +1,68 @@
+package data_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/data"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestCadence(t *testing.T) {
+	list := data.Snapshots{
+		{Time: parseTimeUTC("2020-01-01 10:00:00")},
+		{Time: parseTimeUTC("2020-01-03 10:00:00")},
+		{Time: parseTimeUTC("2020-01-02 10:00:00")},
+		{Time: parseTimeUTC("2020-01-02 10:00:00")},
+		{Time: parseTimeUTC("2020-01-10 10:00:00")},
+	}
+	rtest.Equals(t, 24*time.Hour, data.Cadence(list))
+	rtest.Equals(t, time.Duration(0), data.Cadence(list[:1]))
+}
+
+func TestSimulatePolicy(t *testing.T) {
+	list := data.Snapshots{
+		{Time: parseTimeUTC("2020-01-01 10:00:00")},
+		{Time: parseTimeUTC("2020-01-02 10:00:00")},
+	}
+	policy := data.ExpirePolicy{Daily: 7, Weekly: 4}
+	apply := func(list data.Snapshots, _ time.Time) (data.Snapshots, []data.KeepReason, error) {
+		keep, _, reasons := data.ApplyPolicy(list, policy)
+		return keep, reasons, nil
+	}
+
+	points, err := data.SimulatePolicy(list, 24*time.Hour, data.Duration{Days: 30}, data.Duration{Days: 7}, apply)
+	rtest.OK(t, err)
+
+	var times []time.Time
+	for _, p := range points {
+		times = append(times, p.Time)
+		rtest.Equals(t, len(p.Snapshots), len(p.Reasons))
+	}
+	rtest.Equals(t, []time.Time{
+		parseTimeUTC("2020-01-02 10:00:00"),
+		parseTimeUTC("2020-01-09 10:00:00"),
+		parseTimeUTC("2020-01-16 10:00:00"),
+		parseTimeUTC("2020-01-23 10:00:00"),
+		parseTimeUTC("2020-01-30 10:00:00"),
+		parseTimeUTC("2020-02-01 10:00:00"),
+	}, times)
+
+	// the initial state contains the existing snapshots
+	rtest.Equals(t, 2, len(points[0].Snapshots))
+	// the state at each point includes the backup made at the same time
+	rtest.Equals(t, parseTimeUTC("2020-01-09 10:00:00"), points[1].Snapshots[0].Time)
+
+	// eventually, seven daily and two more weekly snapshots remain
+	last := points[len(points)-1]
+	rtest.Equals(t, parseTimeUTC("2020-02-01 10:00:00"), last.Snapshots[0].Time)
+	rtest.Equals(t, 9, len(last.Snapshots))
+	for _, sn := range last.Snapshots {
+		rtest.Assert(t, sn.ID() == nil, "existing snapshot %v was kept", sn)
+	}
+
+	_, err = data.SimulatePolicy(list, 0, data.Duration{Days: 30}, data.Duration{Days: 7}, apply)
+	rtest.Assert(t, err != nil, "missing error for invalid cadence")
+	_, err = data.SimulatePolicy(list, time.Second, data.Duration{Years: 10}, data.Duration{Days: 7}, apply)
+	rtest.Assert(t, err != nil, "missing error for too many simulated backups")
+}
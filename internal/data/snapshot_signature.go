@@ -0,0 +1,185 @@
+package data
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// signatureContext is prepended to the signed data to prevent signatures from
+// being valid in a different context.
+const signatureContext = "restic snapshot signature v1\n"
+
+// SnapshotSignature is an Ed25519 signature of a snapshot.
+type SnapshotSignature struct {
+	PublicKey []byte `json:"public_key"`
+	Signature []byte `json:"signature"`
+}
+
+// SignatureStatus is the result of verifying the signature of a snapshot.
+type SignatureStatus int
+
+const (
+	// SignatureUnsigned means the snapshot does not contain a signature.
+	SignatureUnsigned SignatureStatus = iota
+	// SignatureInvalid means the signature does not match the snapshot.
+	SignatureInvalid
+	// SignatureUntrusted means the signature is correct, but the key is not
+	// trusted for the hostname of the snapshot.
+	SignatureUntrusted
+	// SignatureValid means the signature is correct and the key is trusted.
+	SignatureValid
+)
+
+func (s SignatureStatus) String() string {
+	switch s {
+	case SignatureUnsigned:
+		return "unsigned"
+	case SignatureInvalid:
+		return "invalid"
+	case SignatureUntrusted:
+		return "untrusted"
+	case SignatureValid:
+		return "valid"
+	}
+	return fmt.Sprintf("SignatureStatus(%d)", int(s))
+}
+
+// signedData returns the data covered by the signature of the snapshot. The
+// fields Parent and Original are excluded, as they are changed when copying a
+// snapshot to a different repository.
+func (sn *Snapshot) signedData() ([]byte, error) {
+	c := *sn
+	c.Signature = nil
+	c.Parent = nil
+	c.Original = nil
+
+	buf, err := json.Marshal(&c)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(signatureContext), buf...), nil
+}
+
+// Sign signs the snapshot using key. The signature covers all fields of the
+// snapshot including the tree ID, but not the fields Parent and Original. Any
+// change to the snapshot afterwards invalidates the signature.
+func (sn *Snapshot) Sign(key ed25519.PrivateKey) error {
+	buf, err := sn.signedData()
+	if err != nil {
+		return err
+	}
+	sn.Signature = &SnapshotSignature{
+		PublicKey: key.Public().(ed25519.PublicKey),
+		Signature: ed25519.Sign(key, buf),
+	}
+	return nil
+}
+
+// VerifySignature checks the signature of the snapshot. A correct signature is
+// only considered valid if the public key is trusted for the hostname of the
+// snapshot.
+func (sn *Snapshot) VerifySignature(trusted TrustedKeys) SignatureStatus {
+	if sn.Signature == nil {
+		return SignatureUnsigned
+	}
+	if len(sn.Signature.PublicKey) != ed25519.PublicKeySize {
+		return SignatureInvalid
+	}
+	buf, err := sn.signedData()
+	if err != nil {
+		return SignatureInvalid
+	}
+	if !ed25519.Verify(sn.Signature.PublicKey, buf, sn.Signature.Signature) {
+		return SignatureInvalid
+	}
+	if !trusted.Trusts(sn.Hostname, sn.Signature.PublicKey) {
+		return SignatureUntrusted
+	}
+	return SignatureValid
+}
+
+// TrustedKeys maps hostnames to the public keys which are allowed to sign
+// snapshots for the host.
+type TrustedKeys map[string][]ed25519.PublicKey
+
+// Trusts returns true if key is trusted for hostname.
+func (t TrustedKeys) Trusts(hostname string, key ed25519.PublicKey) bool {
+	for _, k := range t[hostname] {
+		if k.Equal(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTrustedKeys reads a list of trusted keys. Each line contains a hostname
+// followed by a base64 encoded public key, as printed by FormatTrustedKey.
+// Empty lines and lines starting with '#' are ignored.
+func ParseTrustedKeys(rd io.Reader) (TrustedKeys, error) {
+	trusted := make(TrustedKeys)
+	sc := bufio.NewScanner(rd)
+	lineNum := 0
+	for sc.Scan() {
+		lineNum++
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, errors.Errorf("line %d: expected hostname and public key", lineNum)
+		}
+		key, err := base64.StdEncoding.DecodeString(fields[1])
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return nil, errors.Errorf("line %d: invalid public key", lineNum)
+		}
+		trusted[fields[0]] = append(trusted[fields[0]], ed25519.PublicKey(key))
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return trusted, nil
+}
+
+// FormatTrustedKey returns the line for a list of trusted keys which allows key
+// to sign snapshots for hostname.
+func FormatTrustedKey(hostname string, key ed25519.PublicKey) string {
+	return hostname + " " + base64.StdEncoding.EncodeToString(key)
+}
+
+// signingKeyHeader is the first line of a file containing a signing key.
+const signingKeyHeader = "restic snapshot signing key"
+
+// NewSigningKey generates a new key for signing snapshots.
+func NewSigningKey() (ed25519.PrivateKey, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	return key, err
+}
+
+// MarshalSigningKey encodes key for storing it in a file.
+func MarshalSigningKey(key ed25519.PrivateKey) []byte {
+	return []byte(signingKeyHeader + "\n" + base64.StdEncoding.EncodeToString(key.Seed()) + "\n")
+}
+
+// ParseSigningKey decodes a key encoded by MarshalSigningKey.
+func ParseSigningKey(buf []byte) (ed25519.PrivateKey, error) {
+	header, seed, ok := bytes.Cut(bytes.TrimSpace(buf), []byte("\n"))
+	if !ok || string(bytes.TrimSpace(header)) != signingKeyHeader {
+		return nil, errors.New("not a snapshot signing key")
+	}
+	key, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(seed)))
+	if err != nil || len(key) != ed25519.SeedSize {
+		return nil, errors.New("invalid snapshot signing key")
+	}
+	return ed25519.NewKeyFromSeed(key), nil
+}
@@ -0,0 +1,116 @@
+package data_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/data"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestSnapshotSignature(t *testing.T) {
+	key, err := data.NewSigningKey()
+	rtest.OK(t, err)
+	other, err := data.NewSigningKey()
+	rtest.OK(t, err)
+
+	trusted, err := data.ParseTrustedKeys(strings.NewReader("# comment\n\n" + data.FormatTrustedKey("foo", key.Public().(ed25519.PublicKey)) + "\n"))
+	rtest.OK(t, err)
+
+	tree := restic.NewRandomID()
+	newSnapshot := func() *data.Snapshot {
+		sn, err := data.NewSnapshot([]string{"/home/foobar"}, []string{"tag"}, "foo", time.Now())
+		rtest.OK(t, err)
+		sn.Tree = &tree
+		return sn
+	}
+
+	sn := newSnapshot()
+	rtest.Equals(t, data.SignatureUnsigned, sn.VerifySignature(trusted))
+
+	rtest.OK(t, sn.Sign(key))
+	rtest.Equals(t, data.SignatureValid, sn.VerifySignature(trusted))
+	rtest.Equals(t, data.SignatureUntrusted, sn.VerifySignature(nil))
+
+	// copying a snapshot does not invalidate the signature
+	id := restic.NewRandomID()
+	sn.Parent = nil
+	sn.Original = &id
+	rtest.Equals(t, data.SignatureValid, sn.VerifySignature(trusted))
+
+	// the key is only trusted for host foo
+	sn.Hostname = "bar"
+	rtest.OK(t, sn.Sign(key))
+	rtest.Equals(t, data.SignatureUntrusted, sn.VerifySignature(trusted))
+
+	sn = newSnapshot()
+	rtest.OK(t, sn.Sign(other))
+	rtest.Equals(t, data.SignatureUntrusted, sn.VerifySignature(trusted))
+
+	for _, modify := range []func(sn *data.Snapshot){
+		func(sn *data.Snapshot) { tree := restic.NewRandomID(); sn.Tree = &tree },
+		func(sn *data.Snapshot) { sn.Hostname = "bar" },
+		func(sn *data.Snapshot) { sn.Time = sn.Time.Add(time.Second) },
+		func(sn *data.Snapshot) { sn.AddTags([]string{"other"}) },
+		func(sn *data.Snapshot) { sn.Signature.PublicKey = other.Public().(ed25519.PublicKey) },
+	} {
+		sn := newSnapshot()
+		rtest.OK(t, sn.Sign(key))
+		modify(sn)
+		rtest.Equals(t, data.SignatureInvalid, sn.VerifySignature(trusted))
+	}
+}
+
+func TestSnapshotSignatureRoundtrip(t *testing.T) {
+	repository.TestAllVersions(t, testSnapshotSignatureRoundtrip)
+}
+
+func testSnapshotSignatureRoundtrip(t *testing.T, version uint) {
+	repo, _, _ := repository.TestRepositoryWithVersion(t, version)
+
+	key, err := data.NewSigningKey()
+	rtest.OK(t, err)
+	trusted := data.TrustedKeys{"foo": {key.Public().(ed25519.PublicKey)}}
+
+	sn, err := data.NewSnapshot([]string{"/home/foobar"}, nil, "foo", time.Now())
+	rtest.OK(t, err)
+	tree := restic.NewRandomID()
+	sn.Tree = &tree
+	sn.Summary = &data.SnapshotSummary{BackupStart: time.Now(), BackupEnd: time.Now(), FilesNew: 3}
+	rtest.OK(t, sn.Sign(key))
+
+	id, err := data.SaveSnapshot(context.TODO(), repo, sn)
+	rtest.OK(t, err)
+	sn2, err := data.LoadSnapshot(context.TODO(), repo, id)
+	rtest.OK(t, err)
+	rtest.Equals(t, data.SignatureValid, sn2.VerifySignature(trusted))
+}
+
+func TestSigningKeyEncoding(t *testing.T) {
+	key, err := data.NewSigningKey()
+	rtest.OK(t, err)
+
+	key2, err := data.ParseSigningKey(data.MarshalSigningKey(key))
+	rtest.OK(t, err)
+	rtest.Assert(t, key.Equal(key2), "signing key changed after decoding")
+
+	_, err = data.ParseSigningKey([]byte("foo\nbar\n"))
+	rtest.Assert(t, err != nil, "expected error for invalid key")
+}
+
+func TestParseTrustedKeysInvalid(t *testing.T) {
+	for _, input := range []string{
+		"foo",
+		"foo bar",
+		"foo AAAA",
+		"foo bar baz",
+	} {
+		_, err := data.ParseTrustedKeys(strings.NewReader(input))
+		rtest.Assert(t, err != nil, "expected error for %q", input)
+	}
+}
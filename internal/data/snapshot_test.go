@@ -27,6 +27,20 @@ func TestTagList(t *testing.T) {
 	rtest.Assert(t, r, "Failed to match untagged snapshot")
 }
 
+func TestSnapshotExpiry(t *testing.T) {
+	sn, err := data.NewSnapshot(nil, nil, "foo", time.Date(2020, 1, 31, 10, 0, 0, 0, time.UTC))
+	rtest.OK(t, err)
+	rtest.Assert(t, !sn.Expired(sn.Time.AddDate(100, 0, 0)), "snapshot without expiry time expired")
+
+	sn.SetExpiry(data.Duration{Months: 1, Hours: 2})
+	rtest.Equals(t, time.Date(2020, 3, 2, 12, 0, 0, 0, time.UTC), *sn.Expiry)
+	rtest.Assert(t, !sn.Expired(sn.Expiry.Add(-time.Second)), "snapshot expired too early")
+	rtest.Assert(t, sn.Expired(*sn.Expiry), "snapshot did not expire")
+
+	sn.Hold = true
+	rtest.Assert(t, !sn.Expired(*sn.Expiry), "snapshot on hold expired")
+}
+
 func TestLoadJSONUnpacked(t *testing.T) {
 	repository.TestAllVersions(t, testLoadJSONUnpacked)
 }
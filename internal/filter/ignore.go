@@ -0,0 +1,134 @@
+package filter
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// endOfPath is appended to ignore patterns and to the matched paths. As it
+// cannot occur in a file name, a pattern only matches complete paths and not
+// just a prefix of a path.
+var endOfPath = patternPart{"\x00", true}
+
+// ignorePattern is a single pattern from an ignore file.
+type ignorePattern struct {
+	pattern Pattern
+	// dirOnly is set for patterns with a trailing slash
+	dirOnly bool
+}
+
+// IgnoreFile contains the patterns of a gitignore-style ignore file. The
+// patterns are evaluated relative to the directory which contains the file.
+type IgnoreFile struct {
+	patterns []ignorePattern
+}
+
+// ParseIgnoreFile parses the content of an ignore file using the syntax of
+// gitignore files:
+//
+//   - Empty lines and lines starting with "#" are ignored.
+//   - A leading "!" negates the pattern, such that a matching path is included
+//     again. Use "\!" and "\#" for patterns starting with a literal "!" or "#".
+//   - A pattern with a trailing "/" only matches directories.
+//   - A pattern which contains a "/" at the beginning or in the middle is
+//     relative to the directory of the ignore file. Otherwise, it matches a
+//     file or directory of that name at any depth.
+//   - "**" matches an arbitrary number of directories.
+func ParseIgnoreFile(data []byte) (*IgnoreFile, error) {
+	f := &IgnoreFile{}
+
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; sc.Scan(); line++ {
+		pattern, ok, err := parseIgnoreLine(sc.Text())
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if ok {
+			f.patterns = append(f.patterns, pattern)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func parseIgnoreLine(line string) (ignorePattern, bool, error) {
+	line = strings.TrimSuffix(line, "\r")
+	if line == "" || line[0] == '#' {
+		return ignorePattern{}, false, nil
+	}
+
+	// trailing spaces are removed unless they are escaped with a backslash
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[:len(line)-1]
+	}
+
+	original := line
+	negate := false
+	if line[0] == '!' {
+		negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, "\\!") || strings.HasPrefix(line, "\\#") {
+		line = line[1:]
+	}
+
+	dirOnly := strings.HasSuffix(line, "/")
+	line = strings.TrimRight(line, "/")
+	if line == "" {
+		return ignorePattern{}, false, nil
+	}
+
+	if strings.Contains(line, "/") {
+		// anchored at the directory of the ignore file
+		line = "/" + strings.TrimLeft(line, "/")
+	} else {
+		line = "/**/" + line
+	}
+	if strings.HasSuffix(line, "/**") {
+		// "foo/**" matches everything inside foo, but not foo itself
+		line += "/*"
+	}
+
+	pattern := preparePattern(filepath.FromSlash(line))
+	for _, part := range pattern.parts {
+		if _, err := filepath.Match(part.pattern, part.pattern); err != nil {
+			return ignorePattern{}, false, fmt.Errorf("invalid pattern %q: %w", original, err)
+		}
+	}
+	pattern.original = original
+	pattern.isNegated = negate
+	pattern.parts = append(pattern.parts, endOfPath)
+
+	return ignorePattern{pattern: pattern, dirOnly: dirOnly}, true, nil
+}
+
+// Match reports whether one of the patterns matches the slash-separated path
+// relPath, which is relative to the directory of the ignore file. If this is
+// the case, ignored reports whether the path is excluded by the last matching
+// pattern.
+func (f *IgnoreFile) Match(relPath string, isDir bool) (matched bool, ignored bool, err error) {
+	strs := append([]string{"/"}, strings.Split(relPath, "/")...)
+	strs = append(strs, endOfPath.pattern)
+
+	for _, pat := range f.patterns {
+		if pat.dirOnly && !isDir {
+			continue
+		}
+
+		m, err := match(pat.pattern, strs)
+		if err != nil {
+			return false, false, err
+		}
+		if m {
+			matched = true
+			ignored = !pat.pattern.isNegated
+		}
+	}
+
+	return matched, ignored, nil
+}
@@ -0,0 +1,64 @@
+package filter_test
+
+import (
+	"testing"
+
+	"github.com/restic/restic/internal/filter"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestIgnoreFileMatch(t *testing.T) {
+	var tests = []struct {
+		patterns string
+		path     string
+		isDir    bool
+		matched  bool
+		ignored  bool
+	}{
+		{"*.o", "main.o", false, true, true},
+		{"*.o", "sub/dir/main.o", false, true, true},
+		{"*.o", "main.c", false, false, false},
+		{"# comment\n\n*.o", "main.o", false, true, true},
+		{"build", "build", true, true, true},
+		{"build", "src/build", false, true, true},
+		{"build", "build/output", false, false, false},
+		{"/build", "build", true, true, true},
+		{"/build", "src/build", true, false, false},
+		{"doc/*.html", "doc/index.html", false, true, true},
+		{"doc/*.html", "src/doc/index.html", false, false, false},
+		{"doc/*.html", "doc/api/index.html", false, false, false},
+		{"doc/**/*.html", "doc/api/index.html", false, true, true},
+		{"**/tmp", "a/b/tmp", true, true, true},
+		{"out/**", "out", true, false, false},
+		{"out/**", "out/a/b", false, true, true},
+		{"cache/", "cache", true, true, true},
+		{"cache/", "cache", false, false, false},
+		{"cache/", "sub/cache", true, true, true},
+		{"*.log\n!keep.log", "keep.log", false, true, false},
+		{"*.log\n!keep.log", "other.log", false, true, true},
+		{"!keep.log\n*.log", "keep.log", false, true, true},
+		{"\\!important", "!important", false, true, true},
+		{"\\#notes", "#notes", false, true, true},
+		{"trailing   ", "trailing", false, true, true},
+		{"*.tmp\r\n", "x.tmp", false, true, true},
+	}
+
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			f, err := filter.ParseIgnoreFile([]byte(test.patterns))
+			rtest.OK(t, err)
+
+			matched, ignored, err := f.Match(test.path, test.isDir)
+			rtest.OK(t, err)
+			if matched != test.matched || ignored != test.ignored {
+				t.Errorf("patterns %q, path %q, dir %v: want matched %v, ignored %v, got %v, %v",
+					test.patterns, test.path, test.isDir, test.matched, test.ignored, matched, ignored)
+			}
+		})
+	}
+}
+
+func TestIgnoreFileInvalidPattern(t *testing.T) {
+	_, err := filter.ParseIgnoreFile([]byte("*.o\n[x"))
+	rtest.Assert(t, err != nil, "missing error for invalid pattern")
+}
@@ -0,0 +1,202 @@
+package fs
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// LocalSnapshot is a wrapper around the local file system which reads all
+// files and directories from snapshots of the file systems they are stored
+// on. Similar to LocalVss, the snapshots are created on demand by a
+// SnapshotProvider, once for each mount point, and the paths are rewritten
+// transparently. Thus the original paths are recorded in the restic snapshot.
+type LocalSnapshot struct {
+	FS
+	provider SnapshotProvider
+	// snapshots maps a mount point to the directory of its snapshot
+	snapshots       map[string]string
+	failedSnapshots map[string]struct{}
+	// mountPoints caches the mount point of directories
+	mountPoints map[string]string
+	mutex       sync.Mutex
+	msgError    ErrorHandler
+	msgMessage  MessageHandler
+}
+
+// statically ensure that LocalSnapshot implements FS.
+var _ FS = &LocalSnapshot{}
+
+// NewLocalSnapshot creates a new wrapper around the local file system which
+// uses provider to create snapshots of the file systems.
+func NewLocalSnapshot(provider SnapshotProvider, msgError ErrorHandler, msgMessage MessageHandler) *LocalSnapshot {
+	return &LocalSnapshot{
+		FS:              NewLocal(),
+		provider:        provider,
+		snapshots:       make(map[string]string),
+		failedSnapshots: make(map[string]struct{}),
+		mountPoints:     make(map[string]string),
+		msgError:        msgError,
+		msgMessage:      msgMessage,
+	}
+}
+
+// DeleteSnapshots deletes all snapshots that were created automatically.
+func (fs *LocalSnapshot) DeleteSnapshots() {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	activeSnapshots := make(map[string]string)
+
+	for mountPoint, dir := range fs.snapshots {
+		fs.msgMessage("deleting file system snapshot for [%s]\n", mountPoint)
+		if err := fs.provider.Delete(context.Background(), mountPoint, dir); err != nil {
+			fs.msgError(mountPoint, errors.Errorf("failed to delete file system snapshot %s: %s", dir, err))
+			activeSnapshots[mountPoint] = dir
+		}
+	}
+
+	fs.snapshots = activeSnapshots
+}
+
+// OpenFile wraps the OpenFile method of the underlying file system.
+func (fs *LocalSnapshot) OpenFile(name string, flag int, metadataOnly bool) (File, error) {
+	path, known := fs.snapshotPath(name)
+	f, err := fs.FS.OpenFile(path, flag, metadataOnly)
+	if err != nil || known {
+		return f, err
+	}
+
+	// the file info is cached by the file, thus this does not cost an additional syscall
+	fi, err := f.Stat()
+	if err != nil || !fi.Mode.IsDir() {
+		return f, nil
+	}
+	// a directory can be the mount point of a different file system
+	if dirPath := fs.pathIn(fs.dirMountPoint(filepath.Clean(name)), name); dirPath != path {
+		_ = f.Close()
+		return fs.FS.OpenFile(dirPath, flag, metadataOnly)
+	}
+	return f, nil
+}
+
+// Lstat wraps the Lstat method of the underlying file system.
+func (fs *LocalSnapshot) Lstat(name string) (*ExtendedFileInfo, error) {
+	path, known := fs.snapshotPath(name)
+	fi, err := fs.FS.Lstat(path)
+	if err != nil || known || !fi.Mode.IsDir() {
+		return fi, err
+	}
+
+	// a directory can be the mount point of a different file system
+	if dirPath := fs.pathIn(fs.dirMountPoint(filepath.Clean(name)), name); dirPath != path {
+		return fs.FS.Lstat(dirPath)
+	}
+	return fi, nil
+}
+
+// snapshotPath returns the path inside the snapshot of the file system which
+// contains path. Unless path is a known directory, the file system of its
+// parent directory is used without accessing path in the live file system.
+// Thus, items which were removed after creating the snapshot are still found.
+// known is false in this case, then path could be the mount point of a
+// different file system if it is a directory.
+func (fs *LocalSnapshot) snapshotPath(path string) (snapshotPath string, known bool) {
+	if !filepath.IsAbs(path) {
+		return path, true
+	}
+	path = filepath.Clean(path)
+
+	fs.mutex.Lock()
+	mountPoint, known := fs.mountPoints[path]
+	fs.mutex.Unlock()
+	if !known {
+		parent := filepath.Dir(path)
+		if parent == path {
+			mountPoint, known = path, true
+		} else {
+			mountPoint = fs.dirMountPoint(parent)
+		}
+	}
+	return fs.pathIn(mountPoint, path), known
+}
+
+// pathIn returns the path inside the snapshot of mountPoint. The snapshot is
+// created if it does not exist yet. If the creation of the snapshot fails,
+// the original path is returned as a fallback.
+func (fs *LocalSnapshot) pathIn(mountPoint string, path string) string {
+	dir, ok := fs.snapshotDir(mountPoint)
+	if !ok {
+		// no snapshot is available for the requested path:
+		//  -> try to backup without a snapshot
+		return path
+	}
+
+	// filepath.Rel() always succeeds because mountPoint is a parent of path
+	rel, err := filepath.Rel(mountPoint, filepath.Clean(path))
+	if err != nil {
+		panic(err)
+	}
+	return filepath.Join(dir, rel)
+}
+
+// snapshotDir returns the directory of the snapshot of mountPoint. The
+// snapshot is created if it does not exist yet.
+func (fs *LocalSnapshot) snapshotDir(mountPoint string) (string, bool) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	if dir, ok := fs.snapshots[mountPoint]; ok {
+		return dir, true
+	}
+	if _, ok := fs.failedSnapshots[mountPoint]; ok {
+		return "", false
+	}
+
+	fs.msgMessage("creating file system snapshot for [%s]\n", mountPoint)
+	dir, err := fs.provider.Create(context.Background(), mountPoint)
+	if err != nil {
+		fs.msgError(mountPoint, errors.Errorf("failed to create file system snapshot for [%s]: %s", mountPoint, err))
+		fs.failedSnapshots[mountPoint] = struct{}{}
+		return "", false
+	}
+
+	fs.msgMessage("successfully created file system snapshot for [%s] in [%s]\n", mountPoint, dir)
+	fs.snapshots[mountPoint] = dir
+	return dir, true
+}
+
+// dirMountPoint returns the mount point of the directory dir. A directory is a
+// mount point if it resides on a different device than its parent directory.
+// Directories which do not exist in the live file system, for example because
+// they were removed after creating the snapshot, belong to the file system of
+// their parent directory.
+func (fs *LocalSnapshot) dirMountPoint(dir string) string {
+	fs.mutex.Lock()
+	mountPoint, ok := fs.mountPoints[dir]
+	fs.mutex.Unlock()
+	if ok {
+		return mountPoint
+	}
+
+	parent := filepath.Dir(dir)
+	if parent == dir {
+		mountPoint = dir
+	} else {
+		mountPoint = fs.dirMountPoint(parent)
+		fi, err := fs.FS.Lstat(dir)
+		if err == nil {
+			parentFi, err := fs.FS.Lstat(parent)
+			if err == nil && fi.DeviceID != parentFi.DeviceID {
+				mountPoint = dir
+			}
+		}
+	}
+
+	fs.mutex.Lock()
+	fs.mountPoints[dir] = mountPoint
+	fs.mutex.Unlock()
+	return mountPoint
+}
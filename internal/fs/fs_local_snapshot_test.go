@@ -0,0 +1,199 @@
+package fs_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/options"
+	"github.com/restic/restic/internal/test"
+)
+
+// testSnapshotProvider creates "snapshots" by writing a modified copy of a
+// single file to a temporary directory.
+type testSnapshotProvider struct {
+	dir     string
+	file    string
+	err     error
+	created []string
+	deleted []string
+}
+
+func (p *testSnapshotProvider) Create(_ context.Context, mountPoint string) (string, error) {
+	p.created = append(p.created, mountPoint)
+	if p.err != nil {
+		return "", p.err
+	}
+
+	rel, err := filepath.Rel(mountPoint, p.file)
+	if err != nil {
+		return "", err
+	}
+	target := filepath.Join(p.dir, rel)
+	if err := os.MkdirAll(filepath.Dir(target), 0o700); err != nil {
+		return "", err
+	}
+	return p.dir, os.WriteFile(target, []byte("snapshot"), 0o600)
+}
+
+func (p *testSnapshotProvider) Delete(_ context.Context, mountPoint string, snapshotDir string) error {
+	if snapshotDir != p.dir {
+		return errors.New("unknown snapshot directory")
+	}
+	p.deleted = append(p.deleted, mountPoint)
+	return nil
+}
+
+func readSnapshotFile(t *testing.T, filesystem fs.FS, name string) string {
+	f, err := filesystem.OpenFile(name, fs.O_RDONLY, false)
+	test.OK(t, err)
+	buf, err := io.ReadAll(f)
+	test.OK(t, err)
+	test.OK(t, f.Close())
+	return string(buf)
+}
+
+func TestLocalSnapshot(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file system snapshots are not used on Windows")
+	}
+
+	tempdir := test.TempDir(t)
+	file := filepath.Join(tempdir, "live", "dir", "file")
+	test.OK(t, os.MkdirAll(filepath.Dir(file), 0o700))
+	test.OK(t, os.WriteFile(file, []byte("live"), 0o600))
+
+	provider := &testSnapshotProvider{dir: filepath.Join(tempdir, "snapshot"), file: file}
+	var errs []string
+	snapshotFS := fs.NewLocalSnapshot(provider, func(item string, err error) {
+		errs = append(errs, item)
+	}, func(msg string, args ...interface{}) {})
+
+	test.Equals(t, "snapshot", readSnapshotFile(t, snapshotFS, file))
+	fi, err := snapshotFS.Lstat(file)
+	test.OK(t, err)
+	test.Equals(t, int64(len("snapshot")), fi.Size)
+	fi, err = snapshotFS.Lstat(filepath.Dir(file))
+	test.OK(t, err)
+	test.Assert(t, fi.Mode.IsDir(), "expected directory, got %v", fi.Mode)
+
+	// the snapshot is only created once per mount point
+	test.Equals(t, 1, len(provider.created))
+	test.Equals(t, 0, len(errs))
+
+	_, err = snapshotFS.Lstat(filepath.Join(tempdir, "missing"))
+	test.Assert(t, errors.Is(err, os.ErrNotExist), "unexpected error %v", err)
+
+	snapshotFS.DeleteSnapshots()
+	test.Equals(t, provider.created, provider.deleted)
+}
+
+func TestLocalSnapshotRemovedItems(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file system snapshots are not used on Windows")
+	}
+
+	tempdir := test.TempDir(t)
+	file := filepath.Join(tempdir, "live", "dir", "file")
+	test.OK(t, os.MkdirAll(filepath.Dir(file), 0o700))
+	test.OK(t, os.WriteFile(file, []byte("live"), 0o600))
+
+	provider := &testSnapshotProvider{dir: filepath.Join(tempdir, "snapshot"), file: file}
+	var errs []string
+	snapshotFS := fs.NewLocalSnapshot(provider, func(item string, err error) {
+		errs = append(errs, item)
+	}, func(msg string, args ...interface{}) {})
+
+	_, err := snapshotFS.Lstat(filepath.Join(tempdir, "live"))
+	test.OK(t, err)
+	test.Equals(t, 1, len(provider.created))
+
+	// items removed after creating the snapshot are still read from the snapshot
+	test.OK(t, os.RemoveAll(filepath.Dir(file)))
+	fi, err := snapshotFS.Lstat(filepath.Dir(file))
+	test.OK(t, err)
+	test.Assert(t, fi.Mode.IsDir(), "expected directory, got %v", fi.Mode)
+	fi, err = snapshotFS.Lstat(file)
+	test.OK(t, err)
+	test.Equals(t, int64(len("snapshot")), fi.Size)
+	test.Equals(t, "snapshot", readSnapshotFile(t, snapshotFS, file))
+
+	test.Equals(t, 1, len(provider.created))
+	test.Equals(t, 0, len(errs))
+}
+
+func TestLocalSnapshotFailed(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file system snapshots are not used on Windows")
+	}
+
+	tempdir := test.TempDir(t)
+	file := filepath.Join(tempdir, "file")
+	test.OK(t, os.WriteFile(file, []byte("live"), 0o600))
+
+	provider := &testSnapshotProvider{err: errors.New("unsupported file system")}
+	var errs []string
+	snapshotFS := fs.NewLocalSnapshot(provider, func(item string, err error) {
+		errs = append(errs, item)
+	}, func(msg string, args ...interface{}) {})
+
+	// the live file system is used if the snapshot cannot be created
+	test.Equals(t, "live", readSnapshotFile(t, snapshotFS, file))
+	test.Equals(t, "live", readSnapshotFile(t, snapshotFS, file))
+	test.Equals(t, 1, len(provider.created))
+	test.Equals(t, 1, len(errs))
+
+	snapshotFS.DeleteSnapshots()
+	test.Equals(t, 0, len(provider.deleted))
+}
+
+func TestCommandSnapshotProvider(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sh is not available on Windows")
+	}
+
+	tempdir := test.TempDir(t)
+	t.Setenv("TEST_SNAPSHOT_BASE", tempdir)
+	provider, err := fs.NewSnapshotProvider(fs.SnapshotConfig{
+		Provider: "command",
+		Create:   `dir="$TEST_SNAPSHOT_BASE/$RESTIC_FS_SNAPSHOT_NAME" && mkdir "$dir" && echo "creating snapshot of $RESTIC_FS_SNAPSHOT_MOUNTPOINT" && echo "$dir"`,
+		Delete:   `test -d "$RESTIC_FS_SNAPSHOT_DIR/../$RESTIC_FS_SNAPSHOT_NAME" && rmdir "$RESTIC_FS_SNAPSHOT_DIR"`,
+	})
+	test.OK(t, err)
+
+	dir, err := provider.Create(context.TODO(), "/")
+	test.OK(t, err)
+	test.Equals(t, tempdir, filepath.Dir(dir))
+	_, err = os.Stat(dir)
+	test.OK(t, err)
+
+	test.OK(t, provider.Delete(context.TODO(), "/", dir))
+	_, err = os.Stat(dir)
+	test.Assert(t, errors.Is(err, os.ErrNotExist), "snapshot directory %v was not deleted", dir)
+
+	provider, err = fs.NewSnapshotProvider(fs.SnapshotConfig{Provider: "command", Create: "false", Delete: "true"})
+	test.OK(t, err)
+	_, err = provider.Create(context.TODO(), "/")
+	test.Assert(t, err != nil, "missing error for failed command")
+}
+
+func TestSnapshotConfig(t *testing.T) {
+	cfg, err := fs.ParseSnapshotConfig(options.Options{"fs-snapshot.provider": "zfs", "fs-snapshot.timeout": "5m"})
+	test.OK(t, err)
+	test.Equals(t, "zfs", cfg.Provider)
+	test.Equals(t, "1G", cfg.LVMSize)
+	test.Equals(t, "5m0s", cfg.Timeout.String())
+
+	for _, cfg := range []fs.SnapshotConfig{
+		{Provider: "foo"},
+		{Provider: "command", Create: "true"},
+	} {
+		_, err = fs.NewSnapshotProvider(cfg)
+		test.Assert(t, err != nil, "missing error for config %v", cfg)
+	}
+}
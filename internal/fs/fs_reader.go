@@ -43,53 +43,72 @@ var _ FS = &reader{}
 // be opened once, all subsequent open calls return syscall.EIO. For Lstat(),
 // the provided FileInfo is returned.
 func NewReader(name string, r io.ReadCloser, opts ReaderOptions) (FS, error) {
+	return NewMultiReader([]ReaderFile{{Name: name, Reader: r}}, opts)
+}
+
+// ReaderFile is a file provided by the FS returned by NewMultiReader.
+type ReaderFile struct {
+	Name   string
+	Reader io.ReadCloser
+}
+
+// NewMultiReader returns a new FS like NewReader, which provides several files.
+// The options apply to all files.
+func NewMultiReader(files []ReaderFile, opts ReaderOptions) (FS, error) {
 	items := make(map[string]readerItem)
-	name = readerCleanPath(name)
-	if name == "/" {
-		return nil, fmt.Errorf("invalid filename specified")
-	}
+	for _, file := range files {
+		name := readerCleanPath(file.Name)
+		if name == "/" {
+			return nil, fmt.Errorf("invalid filename specified")
+		}
+		if _, ok := items[name]; ok {
+			return nil, fmt.Errorf("filename %v is used more than once", name)
+		}
 
-	isFile := true
-	for {
-		if isFile {
-			fi := &ExtendedFileInfo{
+		items[name] = readerItem{
+			open: &sync.Once{},
+			fi: &ExtendedFileInfo{
 				Name:    path.Base(name),
 				Mode:    opts.Mode,
 				ModTime: opts.ModTime,
 				Size:    opts.Size,
+			},
+			rc:             file.Reader,
+			allowEmptyFile: opts.AllowEmptyFile,
+		}
+
+		for {
+			parent := path.Dir(name)
+			if parent == name {
+				break
 			}
-			items[name] = readerItem{
-				open:           &sync.Once{},
-				fi:             fi,
-				rc:             r,
-				allowEmptyFile: opts.AllowEmptyFile,
+
+			item, exists := items[parent]
+			if exists && item.rc != nil {
+				return nil, fmt.Errorf("filename %v is used for a file and a directory", parent)
 			}
-			isFile = false
-		} else {
-			fi := &ExtendedFileInfo{
-				Name:    path.Base(name),
-				Mode:    os.ModeDir | 0755,
-				ModTime: opts.ModTime,
-				Size:    0,
+			if !exists {
+				item.fi = &ExtendedFileInfo{
+					Name:    path.Base(parent),
+					Mode:    os.ModeDir | 0755,
+					ModTime: opts.ModTime,
+					Size:    0,
+				}
 			}
-			items[name] = readerItem{
-				fi: fi,
-				// keep the children set during the previous iteration
-				children: items[name].children,
+			// add the current file to the children of the parent directory
+			if !slices.Contains(item.children, path.Base(name)) {
+				item.children = append(item.children, path.Base(name))
 			}
-		}
+			items[parent] = item
 
-		parent := path.Dir(name)
-		if parent == name {
-			break
+			// the parents of an existing directory exist as well
+			if exists {
+				break
+			}
+			name = parent
 		}
-		// add the current file to the children of the parent directory
-		item := items[parent]
-		item.children = append(item.children, path.Base(name))
-		items[parent] = item
-
-		name = parent
 	}
+
 	return &reader{
 		items: items,
 	}, nil
@@ -267,6 +267,38 @@ func TestFSReaderDir(t *testing.T) {
 	}
 }
 
+func TestFSReaderMulti(t *testing.T) {
+	reader := func(data string) io.ReadCloser {
+		return io.NopCloser(strings.NewReader(data))
+	}
+
+	fs, err := NewMultiReader([]ReaderFile{
+		{Name: "db1.sql", Reader: reader("db1")},
+		{Name: "dumps/db2.sql", Reader: reader("db2")},
+		{Name: "/dumps/db3.sql", Reader: reader("db3")},
+	}, ReaderOptions{Mode: 0644, ModTime: time.Now()})
+	test.OK(t, err)
+
+	verifyDirectoryContents(t, fs, "/", []string{"db1.sql", "dumps"})
+	verifyDirectoryContents(t, fs, "/dumps", []string{"db2.sql", "db3.sql"})
+	verifyFileContentOpenFile(t, fs, "/db1.sql", []byte("db1"))
+	verifyFileContentOpenFile(t, fs, "/dumps/db2.sql", []byte("db2"))
+	verifyFileContentOpenFile(t, fs, "/dumps/db3.sql", []byte("db3"))
+
+	for _, names := range [][]string{
+		{"db.sql", "/db.sql"},
+		{"dumps", "dumps/db.sql"},
+		{"dumps/db.sql", "dumps"},
+	} {
+		var files []ReaderFile
+		for _, name := range names {
+			files = append(files, ReaderFile{Name: name, Reader: reader("")})
+		}
+		_, err := NewMultiReader(files, ReaderOptions{})
+		test.Assert(t, err != nil, "expected error for filenames %v", names)
+	}
+}
+
 func TestFSReaderMinFileSize(t *testing.T) {
 	var tests = []struct {
 		name        string
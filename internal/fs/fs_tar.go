@@ -0,0 +1,378 @@
+package fs
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/restic/restic/internal/data"
+	"github.com/restic/restic/internal/errors"
+)
+
+// paxXattrPrefix is the prefix of PAX records which contain extended attributes.
+const paxXattrPrefix = "SCHILY.xattr."
+
+// TarReaderOptions configures the file system created by NewTarReader.
+type TarReaderOptions struct {
+	// ModTime is used for directories which are not contained in the archive.
+	ModTime time.Time
+	// TempDir is the directory for the temporary file which stores the file
+	// contents. Uses the default directory for temporary files if empty.
+	TempDir string
+	// Warnf is called for entries which cannot be represented.
+	Warnf func(msg string, args ...interface{})
+}
+
+// TarReader is a read-only FS which provides the contents of a tar archive
+// below a root directory. All files, directories, symlinks, hardlinks and
+// special files are represented with their metadata from the archive.
+type TarReader struct {
+	items map[string]*tarItem
+	// spool stores the contents of all files in the archive
+	spool *os.File
+}
+
+type tarItem struct {
+	fi         *ExtendedFileInfo
+	linkTarget string
+	user       string
+	group      string
+	xattrs     []data.ExtendedAttribute
+
+	// offset of the content in the spool file
+	offset int64
+
+	children []string
+}
+
+// statically ensure that TarReader implements FS.
+var _ FS = &TarReader{}
+
+// NewTarReader reads the tar archive from r and returns a FS which contains the
+// entries of the archive below the directory root. As the order of the
+// entries in an archive is arbitrary, the whole archive is read before
+// returning. The file contents are stored in a temporary file, which is
+// removed by Close.
+func NewTarReader(root string, r io.Reader, opts TarReaderOptions) (*TarReader, error) {
+	root = readerCleanPath(root)
+	if root == "/" {
+		return nil, fmt.Errorf("invalid directory name specified")
+	}
+	if opts.Warnf == nil {
+		opts.Warnf = func(_ string, _ ...interface{}) {}
+	}
+
+	spool, err := os.CreateTemp(opts.TempDir, "restic-tar-")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	fs := &TarReader{
+		items: map[string]*tarItem{"/": newTarDir("/", opts.ModTime)},
+		spool: spool,
+	}
+	fs.add(root, newTarDir(root, opts.ModTime), opts.ModTime)
+
+	err = fs.readArchive(root, r, opts)
+	if err != nil {
+		_ = fs.Close()
+		return nil, err
+	}
+	return fs, nil
+}
+
+func (fs *TarReader) readArchive(root string, r io.Reader, opts TarReaderOptions) error {
+	tr := tar.NewReader(r)
+	var offset int64
+	var inode uint64
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			fs.countLinks()
+			// read the remainder of the stream, such that a command reports its exit status
+			if _, err := io.Copy(io.Discard, r); err != nil {
+				return fmt.Errorf("reading tar archive failed: %w", err)
+			}
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading tar archive failed: %w", err)
+		}
+
+		name := path.Join(root, readerCleanPath(hdr.Name))
+		if name == root && hdr.Typeflag != tar.TypeDir {
+			opts.Warnf("ignoring tar entry %q of type %q without name", hdr.Name, hdr.Typeflag)
+			continue
+		}
+
+		inode++
+		fi := &ExtendedFileInfo{
+			Name:       path.Base(name),
+			Mode:       hdr.FileInfo().Mode(),
+			Inode:      inode,
+			Links:      1,
+			UID:        uint32(hdr.Uid),
+			GID:        uint32(hdr.Gid),
+			AccessTime: hdr.AccessTime,
+			ModTime:    hdr.ModTime,
+			ChangeTime: hdr.ChangeTime,
+		}
+		if fi.ChangeTime.IsZero() {
+			fi.ChangeTime = fi.ModTime
+		}
+		item := &tarItem{
+			fi:     fi,
+			user:   hdr.Uname,
+			group:  hdr.Gname,
+			xattrs: tarXattrs(hdr),
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeReg, tar.TypeGNUSparse:
+			n, err := io.Copy(fs.spool, tr)
+			if err != nil {
+				return fmt.Errorf("reading %v from tar archive failed: %w", hdr.Name, err)
+			}
+			item.offset = offset
+			fi.Size = n
+			offset += n
+		case tar.TypeDir:
+			if existing, ok := fs.items[name]; ok && existing.fi.Mode.IsDir() {
+				// keep the entries of the directory if it was created implicitly
+				item.children = existing.children
+			}
+		case tar.TypeSymlink:
+			item.linkTarget = hdr.Linkname
+		case tar.TypeLink:
+			target, ok := fs.items[path.Join(root, readerCleanPath(hdr.Linkname))]
+			if !ok || !target.fi.Mode.IsRegular() {
+				opts.Warnf("ignoring hardlink %q to missing file %q", hdr.Name, hdr.Linkname)
+				continue
+			}
+			// hardlinks share the inode with the link target
+			linked := *target.fi
+			linked.Name = fi.Name
+			item = &tarItem{
+				fi:     &linked,
+				user:   target.user,
+				group:  target.group,
+				xattrs: target.xattrs,
+				offset: target.offset,
+			}
+		case tar.TypeChar, tar.TypeBlock:
+			fi.Device = tarMkdev(hdr.Devmajor, hdr.Devminor)
+		case tar.TypeFifo:
+		default:
+			opts.Warnf("ignoring tar entry %q of unsupported type %q", hdr.Name, hdr.Typeflag)
+			continue
+		}
+
+		fs.add(name, item, opts.ModTime)
+	}
+}
+
+// tarXattrs returns the extended attributes stored in the PAX records of hdr.
+func tarXattrs(hdr *tar.Header) []data.ExtendedAttribute {
+	var xattrs []data.ExtendedAttribute
+	for key, value := range hdr.PAXRecords {
+		if name, ok := strings.CutPrefix(key, paxXattrPrefix); ok {
+			xattrs = append(xattrs, data.ExtendedAttribute{Name: name, Value: []byte(value)})
+		}
+	}
+	slices.SortFunc(xattrs, func(a, b data.ExtendedAttribute) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return xattrs
+}
+
+// add stores item at name and creates the missing parent directories.
+func (fs *TarReader) add(name string, item *tarItem, modTime time.Time) {
+	parent := path.Dir(name)
+	if _, ok := fs.items[parent]; !ok {
+		fs.add(parent, newTarDir(parent, modTime), modTime)
+	}
+	if _, ok := fs.items[name]; !ok {
+		fs.items[parent].children = append(fs.items[parent].children, path.Base(name))
+	}
+	fs.items[name] = item
+}
+
+// countLinks sets the number of links of all entries which share an inode.
+func (fs *TarReader) countLinks() {
+	links := make(map[uint64]uint64)
+	for _, item := range fs.items {
+		links[item.fi.Inode]++
+	}
+	for _, item := range fs.items {
+		if item.fi.Inode != 0 {
+			item.fi.Links = links[item.fi.Inode]
+		}
+	}
+}
+
+// newTarDir returns a directory which is not contained in the archive.
+func newTarDir(name string, modTime time.Time) *tarItem {
+	return &tarItem{
+		fi: &ExtendedFileInfo{
+			Name:       path.Base(name),
+			Mode:       os.ModeDir | 0755,
+			Links:      1,
+			UID:        uint32(os.Getuid()),
+			GID:        uint32(os.Getgid()),
+			ModTime:    modTime,
+			ChangeTime: modTime,
+		},
+	}
+}
+
+// Close removes the temporary file which stores the file contents.
+func (fs *TarReader) Close() error {
+	err := fs.spool.Close()
+	if rerr := os.Remove(fs.spool.Name()); err == nil {
+		err = rerr
+	}
+	return errors.WithStack(err)
+}
+
+// VolumeName returns leading volume name, for the TarReader file system it's
+// always the empty string.
+func (fs *TarReader) VolumeName(_ string) string {
+	return ""
+}
+
+func (fs *TarReader) OpenFile(name string, flag int, _ bool) (File, error) {
+	if flag & ^(O_RDONLY|O_NOFOLLOW|O_DIRECTORY) != 0 {
+		return nil, pathError("open", name,
+			fmt.Errorf("invalid combination of flags 0x%x", flag))
+	}
+
+	name = readerCleanPath(name)
+	item, ok := fs.items[name]
+	if !ok {
+		return nil, pathError("open", name, syscall.ENOENT)
+	}
+	if flag&O_DIRECTORY != 0 && !item.fi.Mode.IsDir() {
+		return nil, pathError("open", name, syscall.ENOTDIR)
+	}
+
+	f := &tarFile{
+		item: item,
+		fakeFile: fakeFile{
+			name: item.fi.Name,
+			fi:   item.fi,
+		},
+	}
+	if item.fi.Mode.IsRegular() {
+		f.rd = io.NewSectionReader(fs.spool, item.offset, item.fi.Size)
+	}
+	return f, nil
+}
+
+// Lstat returns the FileInfo structure describing the named file.
+// If there is an error, it will be of type *os.PathError.
+func (fs *TarReader) Lstat(name string) (*ExtendedFileInfo, error) {
+	name = readerCleanPath(name)
+	item, ok := fs.items[name]
+	if !ok {
+		return nil, pathError("lstat", name, os.ErrNotExist)
+	}
+	return item.fi, nil
+}
+
+// Join joins any number of path elements into a single path, adding a
+// Separator if necessary. Join calls Clean on the result.
+func (fs *TarReader) Join(elem ...string) string {
+	return path.Join(elem...)
+}
+
+// Separator returns the OS and FS dependent separator for dirs/subdirs/files.
+func (fs *TarReader) Separator() string {
+	return "/"
+}
+
+// IsAbs reports whether the path is absolute. For the TarReader, this is always the case.
+func (fs *TarReader) IsAbs(_ string) bool {
+	return true
+}
+
+// Abs returns an absolute representation of path. For the TarReader, all
+// paths are absolute.
+func (fs *TarReader) Abs(p string) (string, error) {
+	return readerCleanPath(p), nil
+}
+
+// Clean returns the cleaned path. For details, see filepath.Clean.
+func (fs *TarReader) Clean(p string) string {
+	return path.Clean(p)
+}
+
+// Base returns the last element of p.
+func (fs *TarReader) Base(p string) string {
+	return path.Base(p)
+}
+
+// Dir returns p without the last element.
+func (fs *TarReader) Dir(p string) string {
+	return path.Dir(p)
+}
+
+// tarFile is a file, directory or other entry of a tar archive.
+type tarFile struct {
+	item *tarItem
+	rd   io.Reader
+
+	fakeFile
+}
+
+// ensure that tarFile implements File
+var _ File = &tarFile{}
+
+func (f *tarFile) Read(p []byte) (int, error) {
+	if f.rd == nil {
+		return f.fakeFile.Read(p)
+	}
+	return f.rd.Read(p)
+}
+
+func (f *tarFile) Readdirnames(n int) ([]string, error) {
+	if !f.fi.Mode.IsDir() {
+		return f.fakeFile.Readdirnames(n)
+	}
+	if n > 0 {
+		return nil, pathError("readdirnames", f.name, errors.New("not implemented"))
+	}
+	return slices.Clone(f.item.children), nil
+}
+
+func (f *tarFile) ToNode(_ bool, _ func(format string, args ...any)) (*data.Node, error) {
+	node := buildBasicNode(f.name, f.fi)
+
+	node.Inode = f.fi.Inode
+	node.DeviceID = f.fi.DeviceID
+	node.AccessTime = f.fi.AccessTime
+	node.ChangeTime = f.fi.ChangeTime
+	node.UID = f.fi.UID
+	node.GID = f.fi.GID
+	node.User = f.item.user
+	node.Group = f.item.group
+	node.ExtendedAttributes = f.item.xattrs
+
+	switch node.Type {
+	case data.NodeTypeFile:
+		node.Links = f.fi.Links
+	case data.NodeTypeSymlink:
+		node.LinkTarget = f.item.linkTarget
+		node.Links = f.fi.Links
+	case data.NodeTypeDev, data.NodeTypeCharDev:
+		node.Device = f.fi.Device
+		node.Links = f.fi.Links
+	}
+	return node, nil
+}
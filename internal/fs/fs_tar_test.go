@@ -0,0 +1,118 @@
+package fs
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/data"
+	"github.com/restic/restic/internal/test"
+)
+
+func buildTestTar(t testing.TB, entries []tar.Header, contents map[string]string) *bytes.Buffer {
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for _, hdr := range entries {
+		content := contents[hdr.Name]
+		if hdr.Typeflag == tar.TypeReg {
+			hdr.Size = int64(len(content))
+		}
+		test.OK(t, tw.WriteHeader(&hdr))
+		_, err := tw.Write([]byte(content))
+		test.OK(t, err)
+	}
+	test.OK(t, tw.Close())
+	return buf
+}
+
+func TestTarReader(t *testing.T) {
+	mtime := time.Unix(1700000000, 0)
+	now := time.Now()
+	archive := buildTestTar(t, []tar.Header{
+		{Name: "dir/", Typeflag: tar.TypeDir, Mode: 0750, ModTime: mtime, Uid: 1000, Gid: 1001, Uname: "alice", Gname: "staff"},
+		{Name: "dir/file", Typeflag: tar.TypeReg, Mode: 0640, ModTime: mtime, Uid: 1000, Gid: 1001, Uname: "alice",
+			PAXRecords: map[string]string{"SCHILY.xattr.user.comment": "hello"}, Format: tar.FormatPAX},
+		{Name: "dir/link", Typeflag: tar.TypeSymlink, Linkname: "file", Mode: 0777, ModTime: mtime},
+		{Name: "hardlink", Typeflag: tar.TypeLink, Linkname: "dir/file", ModTime: mtime},
+		{Name: "implicit/sub/other", Typeflag: tar.TypeReg, Mode: 0600, ModTime: mtime},
+		{Name: "fifo", Typeflag: tar.TypeFifo, Mode: 0600, ModTime: mtime},
+		{Name: "../escape", Typeflag: tar.TypeReg, Mode: 0600, ModTime: mtime},
+	}, map[string]string{
+		"dir/file":           "file content",
+		"implicit/sub/other": "other content",
+		"../escape":          "escape",
+	})
+
+	var warnings []string
+	fs, err := NewTarReader("export", archive, TarReaderOptions{
+		ModTime: now,
+		Warnf: func(msg string, _ ...interface{}) {
+			warnings = append(warnings, msg)
+		},
+	})
+	test.OK(t, err)
+	defer func() {
+		test.OK(t, fs.Close())
+	}()
+	test.Equals(t, 0, len(warnings))
+
+	verifyDirectoryContents(t, fs, "/", []string{"export"})
+	verifyDirectoryContents(t, fs, "/export", []string{"dir", "hardlink", "implicit", "fifo", "escape"})
+	verifyDirectoryContents(t, fs, "/export/dir", []string{"file", "link"})
+	verifyDirectoryContents(t, fs, "/export/implicit", []string{"sub"})
+	verifyFileContentOpenFile(t, fs, "/export/dir/file", []byte("file content"))
+	verifyFileContentOpenFile(t, fs, "/export/hardlink", []byte("file content"))
+	verifyFileContentOpenFile(t, fs, "/export/implicit/sub/other", []byte("other content"))
+	verifyFileContentOpenFile(t, fs, "/export/escape", []byte("escape"))
+
+	fi, err := fs.Lstat("/export/dir")
+	test.OK(t, err)
+	checkFileInfo(t, fi, "dir", mtime, os.ModeDir|0750, true)
+	fi, err = fs.Lstat("/export/implicit")
+	test.OK(t, err)
+	checkFileInfo(t, fi, "implicit", now, os.ModeDir|0755, true)
+
+	toNode := func(name string) *data.Node {
+		f, err := fs.OpenFile(name, O_RDONLY|O_NOFOLLOW, true)
+		test.OK(t, err)
+		node, err := f.ToNode(false, t.Logf)
+		test.OK(t, err)
+		test.OK(t, f.Close())
+		return node
+	}
+
+	file := toNode("/export/dir/file")
+	test.Equals(t, data.NodeTypeFile, file.Type)
+	test.Equals(t, os.FileMode(0640), file.Mode)
+	test.Equals(t, uint64(12), file.Size)
+	test.Equals(t, uint32(1000), file.UID)
+	test.Equals(t, uint32(1001), file.GID)
+	test.Equals(t, "alice", file.User)
+	test.Equals(t, uint64(2), file.Links)
+	test.Equals(t, []data.ExtendedAttribute{{Name: "user.comment", Value: []byte("hello")}}, file.ExtendedAttributes)
+
+	hardlink := toNode("/export/hardlink")
+	test.Equals(t, "hardlink", hardlink.Name)
+	test.Equals(t, file.Inode, hardlink.Inode)
+	test.Equals(t, uint64(2), hardlink.Links)
+
+	link := toNode("/export/dir/link")
+	test.Equals(t, data.NodeTypeSymlink, link.Type)
+	test.Equals(t, "file", link.LinkTarget)
+
+	test.Equals(t, data.NodeTypeFifo, toNode("/export/fifo").Type)
+
+	_, err = fs.OpenFile("/export/missing", O_RDONLY, false)
+	test.Assert(t, errors.Is(err, os.ErrNotExist), "unexpected error %v", err)
+}
+
+func TestTarReaderInvalid(t *testing.T) {
+	_, err := NewTarReader("export", bytes.NewReader([]byte("not a tar archive, but long enough to contain a header")), TarReaderOptions{})
+	test.Assert(t, err != nil, "missing error for invalid archive")
+
+	_, err = NewTarReader("/", &bytes.Buffer{}, TarReaderOptions{})
+	test.Assert(t, err != nil, "missing error for invalid directory name")
+}
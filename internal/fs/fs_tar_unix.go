@@ -0,0 +1,11 @@
+//go:build !windows
+
+package fs
+
+import "golang.org/x/sys/unix"
+
+// tarMkdev returns the device number for the major and minor number of a
+// device in a tar archive.
+func tarMkdev(major, minor int64) uint64 {
+	return unix.Mkdev(uint32(major), uint32(minor))
+}
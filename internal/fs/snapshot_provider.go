@@ -0,0 +1,192 @@
+package fs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/options"
+)
+
+// SnapshotConfig holds extended options of file system snapshots on
+// non-windows platforms.
+type SnapshotConfig struct {
+	Provider string        `option:"provider" help:"file system snapshot provider: btrfs, zfs, lvm or command (default: btrfs)"`
+	Create   string        `option:"create" help:"shell command which creates a snapshot and prints its directory, used by the command provider"`
+	Delete   string        `option:"delete" help:"shell command which deletes a snapshot, used by the command provider"`
+	LVMSize  string        `option:"lvm-size" help:"size of the copy-on-write storage of LVM snapshots (default: 1G)"`
+	Timeout  time.Duration `option:"timeout" help:"time that the creation or deletion of a snapshot may take before timing out"`
+}
+
+func init() {
+	if runtime.GOOS != "windows" {
+		options.Register("fs-snapshot", SnapshotConfig{})
+	}
+}
+
+// ParseSnapshotConfig parses the extended options for file system snapshots.
+func ParseSnapshotConfig(o options.Options) (SnapshotConfig, error) {
+	cfg := SnapshotConfig{
+		Provider: "btrfs",
+		LVMSize:  "1G",
+		Timeout:  time.Second * 120,
+	}
+	o = o.Extract("fs-snapshot")
+	if err := o.Apply("fs-snapshot", &cfg); err != nil {
+		return SnapshotConfig{}, err
+	}
+
+	return cfg, nil
+}
+
+// SnapshotProvider creates and deletes snapshots of file systems.
+type SnapshotProvider interface {
+	// Create creates a snapshot of the file system mounted at mountPoint and
+	// returns the directory from which the snapshot can be read.
+	Create(ctx context.Context, mountPoint string) (snapshotDir string, err error)
+	// Delete deletes the snapshot of mountPoint which was created by Create.
+	Delete(ctx context.Context, mountPoint string, snapshotDir string) error
+}
+
+// The commands of the built-in providers. They are run using "sh -c" with the
+// environment variables set by CommandSnapshotProvider.
+const (
+	btrfsCreateCommand = `dir="$RESTIC_FS_SNAPSHOT_MOUNTPOINT/.$RESTIC_FS_SNAPSHOT_NAME" && ` +
+		`btrfs subvolume snapshot -r "$RESTIC_FS_SNAPSHOT_MOUNTPOINT" "$dir" >&2 && echo "$dir"`
+	btrfsDeleteCommand = `btrfs subvolume delete "$RESTIC_FS_SNAPSHOT_DIR" >&2`
+
+	zfsCreateCommand = `dataset=$(zfs list -H -o name "$RESTIC_FS_SNAPSHOT_MOUNTPOINT") && ` +
+		`zfs snapshot "$dataset@$RESTIC_FS_SNAPSHOT_NAME" && ` +
+		`echo "$RESTIC_FS_SNAPSHOT_MOUNTPOINT/.zfs/snapshot/$RESTIC_FS_SNAPSHOT_NAME"`
+	zfsDeleteCommand = `dataset=$(zfs list -H -o name "$RESTIC_FS_SNAPSHOT_MOUNTPOINT") && ` +
+		`zfs destroy "$dataset@$RESTIC_FS_SNAPSHOT_NAME"`
+
+	lvmCreateCommand = `device=$(findmnt -n -o SOURCE --mountpoint "$RESTIC_FS_SNAPSHOT_MOUNTPOINT") && ` +
+		`lv=$(lvs --noheadings -o vg_name,lv_name "$device" | awk '{print $1 "/" $2}') && ` +
+		`lvcreate -q -s -n "$RESTIC_FS_SNAPSHOT_NAME" -L "$RESTIC_FS_SNAPSHOT_LVM_SIZE" "$lv" >&2 && ` +
+		`dir=$(mktemp -d) && mount -o ro "/dev/${lv%/*}/$RESTIC_FS_SNAPSHOT_NAME" "$dir" && echo "$dir"`
+	lvmDeleteCommand = `device=$(findmnt -n -o SOURCE --mountpoint "$RESTIC_FS_SNAPSHOT_DIR") && ` +
+		`umount "$RESTIC_FS_SNAPSHOT_DIR" && rmdir "$RESTIC_FS_SNAPSHOT_DIR" && lvremove -q -f "$device" >&2`
+)
+
+// NewSnapshotProvider returns the snapshot provider selected by cfg.
+func NewSnapshotProvider(cfg SnapshotConfig) (SnapshotProvider, error) {
+	p := &CommandSnapshotProvider{
+		Timeout: cfg.Timeout,
+		Env:     []string{"RESTIC_FS_SNAPSHOT_LVM_SIZE=" + cfg.LVMSize},
+	}
+
+	switch cfg.Provider {
+	case "btrfs":
+		p.CreateCommand, p.DeleteCommand = btrfsCreateCommand, btrfsDeleteCommand
+	case "zfs":
+		p.CreateCommand, p.DeleteCommand = zfsCreateCommand, zfsDeleteCommand
+	case "lvm":
+		p.CreateCommand, p.DeleteCommand = lvmCreateCommand, lvmDeleteCommand
+	case "command":
+		if cfg.Create == "" || cfg.Delete == "" {
+			return nil, errors.New("the command provider requires fs-snapshot.create and fs-snapshot.delete")
+		}
+		p.CreateCommand, p.DeleteCommand = cfg.Create, cfg.Delete
+	default:
+		return nil, errors.Errorf("unknown file system snapshot provider %q", cfg.Provider)
+	}
+
+	return p, nil
+}
+
+// commandWaitDelay is the time to wait for the output of a command after it
+// has exited or was killed.
+const commandWaitDelay = 2 * time.Second
+
+// CommandSnapshotProvider creates and deletes snapshots by running shell
+// commands. The commands can use the following environment variables:
+//
+//   - RESTIC_FS_SNAPSHOT_MOUNTPOINT: the mount point of the file system
+//   - RESTIC_FS_SNAPSHOT_NAME: a unique name for the snapshot
+//   - RESTIC_FS_SNAPSHOT_DIR: the directory of the snapshot, only for DeleteCommand
+//
+// CreateCommand must print the directory from which the snapshot can be read
+// as the last line of its output.
+type CommandSnapshotProvider struct {
+	CreateCommand string
+	DeleteCommand string
+	// Env contains additional environment variables for the commands.
+	Env     []string
+	Timeout time.Duration
+
+	// names stores the snapshot name for each mount point
+	names map[string]string
+}
+
+// statically ensure that CommandSnapshotProvider implements SnapshotProvider.
+var _ SnapshotProvider = &CommandSnapshotProvider{}
+
+func (p *CommandSnapshotProvider) Create(ctx context.Context, mountPoint string) (string, error) {
+	if p.names == nil {
+		p.names = make(map[string]string)
+	}
+	name := fmt.Sprintf("restic-%s-%d", time.Now().Format("20060102-150405"), len(p.names))
+	p.names[mountPoint] = name
+
+	out, err := p.run(ctx, p.CreateCommand,
+		"RESTIC_FS_SNAPSHOT_MOUNTPOINT="+mountPoint,
+		"RESTIC_FS_SNAPSHOT_NAME="+name)
+	if err != nil {
+		return "", err
+	}
+
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	dir := strings.TrimSpace(lines[len(lines)-1])
+	if dir == "" {
+		return "", errors.New("snapshot command did not print the snapshot directory")
+	}
+	return dir, nil
+}
+
+func (p *CommandSnapshotProvider) Delete(ctx context.Context, mountPoint string, snapshotDir string) error {
+	_, err := p.run(ctx, p.DeleteCommand,
+		"RESTIC_FS_SNAPSHOT_MOUNTPOINT="+mountPoint,
+		"RESTIC_FS_SNAPSHOT_NAME="+p.names[mountPoint],
+		"RESTIC_FS_SNAPSHOT_DIR="+snapshotDir)
+	return err
+}
+
+// run runs command using "sh -c" and returns its standard output.
+func (p *CommandSnapshotProvider) run(ctx context.Context, command string, env ...string) (string, error) {
+	if p.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.Timeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Env = append(append(os.Environ(), p.Env...), env...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// processes started in the background can keep the output open
+	cmd.WaitDelay = commandWaitDelay
+
+	err := cmd.Run()
+	if errors.Is(err, exec.ErrWaitDelay) {
+		err = nil
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return "", errors.Errorf("command timed out after %v", p.Timeout)
+	}
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg != "" {
+			return "", errors.Errorf("command failed: %v: %v", err, msg)
+		}
+		return "", errors.Errorf("command failed: %v", err)
+	}
+	return stdout.String(), nil
+}
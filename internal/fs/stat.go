@@ -3,6 +3,8 @@ package fs
 import (
 	"os"
 	"time"
+
+	"github.com/restic/restic/internal/data"
 )
 
 // ExtendedFileInfo is an extended stat_t, filled with attributes that are
@@ -37,3 +39,8 @@ func ExtendedStat(fi os.FileInfo) *ExtendedFileInfo {
 
 	return extendedStat(fi)
 }
+
+// NodeType returns the type of the node described by fi.
+func (fi *ExtendedFileInfo) NodeType() data.NodeType {
+	return nodeTypeFromFileInfo(fi.Mode)
+}
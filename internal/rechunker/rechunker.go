@@ -0,0 +1,148 @@
+package rechunker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/restic/restic/internal/data"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/walker"
+
+	"github.com/hashicorp/golang-lru/v2/simplelru"
+)
+
+// fileCacheSize is the maximum number of content lists whose rechunked
+// content is remembered. Files with the same content are split only once as
+// long as their content list is cached.
+const fileCacheSize = 64 * 1024
+
+// Rechunker rewrites trees such that the contents of all files are split into
+// blobs by the chunker of the destination repository. This allows file
+// contents to deduplicate against data which was stored in the destination
+// repository by a backup.
+type Rechunker struct {
+	chunker restic.Chunker
+	// files maps the hash of a content list to the rechunked content
+	files *simplelru.LRU[restic.ID, restic.IDs]
+
+	rewriter *walker.TreeRewriter
+
+	// state of the running RewriteTree call, used by rewriteNode
+	ctx    context.Context
+	cancel context.CancelFunc
+	err    error
+	loader restic.BlobLoader
+	saver  restic.BlobSaver
+
+	buf   []byte
+	chunk []byte
+}
+
+// New returns a Rechunker which splits file contents using chunkers created
+// by chunkerFactory. Rewritten trees are cached, such that trees shared
+// between snapshots are only processed once.
+func New(chunkerFactory restic.ChunkerFactory) *Rechunker {
+	files, err := simplelru.NewLRU[restic.ID, restic.IDs](fileCacheSize, nil)
+	if err != nil {
+		panic(err) // can't happen
+	}
+	r := &Rechunker{
+		chunker: chunkerFactory.NewChunker(),
+		files:   files,
+	}
+	r.rewriter = walker.NewTreeRewriter(walker.RewriteOpts{
+		RewriteNode: r.rewriteNode,
+	})
+	return r
+}
+
+// RewriteTree loads the tree with the given ID and all its subtrees using
+// loader, splits the file contents again and stores the new data blobs and
+// trees using saver. Returns the ID of the rewritten tree.
+func (r *Rechunker) RewriteTree(ctx context.Context, loader restic.BlobLoader, saver restic.BlobSaver, treeID restic.ID) (restic.ID, error) {
+	// the node rewrite function cannot return errors, it cancels the context instead
+	r.ctx, r.cancel = context.WithCancel(ctx)
+	defer r.cancel()
+	r.err = nil
+	r.loader = loader
+	r.saver = saver
+
+	newID, err := r.rewriter.RewriteTree(r.ctx, loader, saver, "/", treeID)
+	if r.err != nil {
+		return restic.ID{}, r.err
+	}
+	return newID, err
+}
+
+func (r *Rechunker) rewriteNode(node *data.Node, path string) *data.Node {
+	if r.err != nil || node.Type != data.NodeTypeFile || len(node.Content) == 0 {
+		return node
+	}
+
+	content, err := r.rechunkFile(r.ctx, node.Content)
+	if err != nil {
+		r.err = fmt.Errorf("rechunking %v failed: %w", path, err)
+		r.cancel()
+		return node
+	}
+	node.Content = content
+	return node
+}
+
+// rechunkFile loads the blobs in content, splits the data into new chunks and
+// saves them. Returns the IDs of the new blobs.
+func (r *Rechunker) rechunkFile(ctx context.Context, content restic.IDs) (restic.IDs, error) {
+	buf := make([]byte, 0, len(content)*len(restic.ID{}))
+	for _, id := range content {
+		buf = append(buf, id[:]...)
+	}
+	key := restic.Hash(buf)
+	if newContent, ok := r.files.Get(key); ok {
+		return newContent, nil
+	}
+
+	newContent := make(restic.IDs, 0, len(content))
+	save := func() error {
+		id, _, _, err := r.saver.SaveBlob(ctx, restic.DataBlob, r.chunk, restic.ID{}, false)
+		if err != nil {
+			return err
+		}
+		newContent = append(newContent, id)
+		r.chunk = r.chunk[:0]
+		return nil
+	}
+
+	r.chunker.Reset()
+	r.chunk = r.chunk[:0]
+	for _, id := range content {
+		var err error
+		r.buf, err = r.loader.LoadBlob(ctx, restic.BlobHandle{ID: id, Type: restic.DataBlob}, r.buf)
+		if err != nil {
+			return nil, err
+		}
+
+		buf := r.buf
+		for len(buf) > 0 {
+			split := r.chunker.NextSplitPoint(buf)
+			if split == -1 {
+				r.chunk = append(r.chunk, buf...)
+				break
+			}
+			r.chunk = append(r.chunk, buf[:split]...)
+			buf = buf[split:]
+			if err := save(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(r.chunk) > 0 {
+		if err := save(); err != nil {
+			return nil, err
+		}
+	}
+
+	debug.Log("rechunked %d blobs into %d blobs", len(content), len(newContent))
+	r.files.Add(key, newContent)
+	return newContent, nil
+}
@@ -0,0 +1,154 @@
+package rechunker
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/restic/restic/internal/data"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+// fixedChunker splits data into chunks of a fixed size.
+type fixedChunker struct {
+	size int
+	pos  int
+}
+
+func (c *fixedChunker) Reset() {
+	c.pos = 0
+}
+
+func (c *fixedChunker) NextSplitPoint(buf []byte) int {
+	if c.pos+len(buf) < c.size {
+		c.pos += len(buf)
+		return -1
+	}
+	split := c.size - c.pos
+	c.pos = 0
+	return split
+}
+
+type fixedChunkerFactory struct {
+	size int
+}
+
+func (f *fixedChunkerFactory) NewChunker() restic.Chunker {
+	return &fixedChunker{size: f.size}
+}
+
+func (f *fixedChunkerFactory) MaxChunkSize() int {
+	return f.size
+}
+
+func (f *fixedChunkerFactory) ZeroChunk() restic.ID {
+	return restic.Hash(make([]byte, f.size))
+}
+
+func saveFile(t *testing.T, ctx context.Context, uploader restic.BlobSaver, name string, blobs ...[]byte) *data.Node {
+	node := &data.Node{Name: name, Type: data.NodeTypeFile, Content: restic.IDs{}}
+	for _, buf := range blobs {
+		id, _, _, err := uploader.SaveBlob(ctx, restic.DataBlob, buf, restic.ID{}, false)
+		rtest.OK(t, err)
+		node.Content = append(node.Content, id)
+		node.Size += uint64(len(buf))
+	}
+	return node
+}
+
+func loadFile(t *testing.T, repo restic.Repository, node *data.Node) (content []byte, sizes []int) {
+	for _, id := range node.Content {
+		buf, err := repo.LoadBlob(context.TODO(), restic.BlobHandle{ID: id, Type: restic.DataBlob}, nil)
+		rtest.OK(t, err)
+		content = append(content, buf...)
+		sizes = append(sizes, len(buf))
+	}
+	return content, sizes
+}
+
+func loadNodes(t *testing.T, repo restic.Repository, treeID restic.ID) map[string]*data.Node {
+	tree, err := data.LoadTree(context.TODO(), repo, treeID)
+	rtest.OK(t, err)
+	nodes := make(map[string]*data.Node)
+	for item := range tree {
+		rtest.OK(t, item.Error)
+		nodes[item.Node.Name] = item.Node
+	}
+	return nodes
+}
+
+func TestRechunk(t *testing.T) {
+	repo := repository.TestRepository(t)
+	rnd := rtest.Random(42, 2500+1200+300)
+	blobs := [][]byte{rnd[:2500], rnd[2500:3700], rnd[3700:]}
+
+	var root restic.ID
+	rtest.OK(t, repo.WithBlobUploader(context.TODO(), func(ctx context.Context, uploader restic.BlobSaverWithAsync) error {
+		sub := data.NewTreeWriter(uploader)
+		rtest.OK(t, sub.AddNode(saveFile(t, ctx, uploader, "copy", blobs...)))
+		subID, err := sub.Finalize(ctx)
+		rtest.OK(t, err)
+
+		tree := data.NewTreeWriter(uploader)
+		rtest.OK(t, tree.AddNode(saveFile(t, ctx, uploader, "empty")))
+		rtest.OK(t, tree.AddNode(saveFile(t, ctx, uploader, "file", blobs...)))
+		rtest.OK(t, tree.AddNode(&data.Node{Name: "sub", Type: data.NodeTypeDir, Subtree: &subID}))
+		root, err = tree.Finalize(ctx)
+		return err
+	}))
+
+	rechunker := New(&fixedChunkerFactory{size: 1000})
+	var newRoot restic.ID
+	rtest.OK(t, repo.WithBlobUploader(context.TODO(), func(ctx context.Context, uploader restic.BlobSaverWithAsync) error {
+		var err error
+		newRoot, err = rechunker.RewriteTree(ctx, repo, uploader, root)
+		return err
+	}))
+	rtest.Assert(t, !newRoot.Equal(root), "expected a new tree")
+
+	nodes := loadNodes(t, repo, newRoot)
+	rtest.Equals(t, 0, len(nodes["empty"].Content))
+
+	content, sizes := loadFile(t, repo, nodes["file"])
+	rtest.Equals(t, rnd, content)
+	rtest.Equals(t, []int{1000, 1000, 1000, 1000}, sizes)
+	rtest.Equals(t, uint64(len(rnd)), nodes["file"].Size)
+
+	// files with the same content are only rechunked once
+	subNodes := loadNodes(t, repo, *nodes["sub"].Subtree)
+	rtest.Equals(t, nodes["file"].Content, subNodes["copy"].Content)
+	rtest.Equals(t, 1, rechunker.files.Len())
+
+	// rewritten trees are cached
+	var cachedRoot restic.ID
+	rtest.OK(t, repo.WithBlobUploader(context.TODO(), func(ctx context.Context, uploader restic.BlobSaverWithAsync) error {
+		var err error
+		cachedRoot, err = rechunker.RewriteTree(ctx, repo, uploader, root)
+		return err
+	}))
+	rtest.Equals(t, newRoot, cachedRoot)
+}
+
+func TestRechunkLoadError(t *testing.T) {
+	repo := repository.TestRepository(t)
+
+	var root restic.ID
+	rtest.OK(t, repo.WithBlobUploader(context.TODO(), func(ctx context.Context, uploader restic.BlobSaverWithAsync) error {
+		tree := data.NewTreeWriter(uploader)
+		node := &data.Node{Name: "missing", Type: data.NodeTypeFile, Content: restic.IDs{restic.NewRandomID()}}
+		rtest.OK(t, tree.AddNode(node))
+		var err error
+		root, err = tree.Finalize(ctx)
+		return err
+	}))
+
+	rechunker := New(&fixedChunkerFactory{size: 1000})
+	err := repo.WithBlobUploader(context.TODO(), func(ctx context.Context, uploader restic.BlobSaverWithAsync) error {
+		_, err := rechunker.RewriteTree(ctx, repo, uploader, root)
+		return err
+	})
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "rechunking /missing failed"),
+		"unexpected error %v", err)
+}
@@ -14,4 +14,11 @@ var (
 	_ = [1]struct{}{}[backend.SnapshotFile-backend.FileType(restic.SnapshotFile)]
 	_ = [1]struct{}{}[backend.IndexFile-backend.FileType(restic.IndexFile)]
 	_ = [1]struct{}{}[backend.ConfigFile-backend.FileType(restic.ConfigFile)]
+	_ = [1]struct{}{}[backend.ParityFile-backend.FileType(restic.ParityFile)]
+	_ = [1]struct{}{}[backend.ResumeFile-backend.FileType(restic.ResumeFile)]
+	_ = [1]struct{}{}[backend.PruneFile-backend.FileType(restic.PruneFile)]
+	_ = [1]struct{}{}[backend.DeletionFile-backend.FileType(restic.DeletionFile)]
+	_ = [1]struct{}{}[backend.LedgerFile-backend.FileType(restic.LedgerFile)]
+	_ = [1]struct{}{}[backend.CopyFile-backend.FileType(restic.CopyFile)]
+	_ = [1]struct{}{}[backend.SyncFile-backend.FileType(restic.SyncFile)]
 )
@@ -17,7 +17,9 @@ import (
 type MasterIndex struct {
 	idx          []*Index
 	pendingBlobs map[restic.BlobHandle]uint
-	idxMutex     sync.RWMutex
+	// unavailablePacks are ignored when checking whether a blob is already known
+	unavailablePacks restic.IDSet
+	idxMutex         sync.RWMutex
 }
 
 // NewMasterIndex creates a new master index.
@@ -62,15 +64,39 @@ func (mi *MasterIndex) LookupSize(bh restic.BlobHandle) (uint, bool) {
 		return size, true
 	}
 
+	return mi.lookupAvailableSize(bh)
+}
+
+// lookupAvailableSize returns the plaintext size of the blob if it is stored
+// in a pack which is not unavailable. The caller must hold idxMutex.
+func (mi *MasterIndex) lookupAvailableSize(bh restic.BlobHandle) (uint, bool) {
 	for _, idx := range mi.idx {
-		if size, found := idx.LookupSize(bh); found {
-			return size, found
+		if len(mi.unavailablePacks) == 0 {
+			if size, found := idx.LookupSize(bh); found {
+				return size, found
+			}
+			continue
+		}
+		for _, pb := range idx.Lookup(bh, nil) {
+			if !mi.unavailablePacks.Has(pb.PackID()) {
+				return pb.PlaintextLength(), true
+			}
 		}
 	}
 
 	return 0, false
 }
 
+// SetUnavailablePacks marks the given packs as unavailable. Blobs which are
+// only stored in these packs are not reported by LookupSize and are saved
+// again by AddPending. Lookup still returns them, such that they can be loaded.
+func (mi *MasterIndex) SetUnavailablePacks(packs restic.IDSet) {
+	mi.idxMutex.Lock()
+	defer mi.idxMutex.Unlock()
+
+	mi.unavailablePacks = packs
+}
+
 // AddPending adds a given blob to list of pending Blobs
 // Before doing so it checks if this blob is already known.
 // Returns true if adding was successful and false if the blob
@@ -85,10 +111,8 @@ func (mi *MasterIndex) AddPending(bh restic.BlobHandle, size uint) bool {
 		return false
 	}
 
-	for _, idx := range mi.idx {
-		if idx.Has(bh) {
-			return false
-		}
+	if _, ok := mi.lookupAvailableSize(bh); ok {
+		return false
 	}
 
 	// really not known -> insert
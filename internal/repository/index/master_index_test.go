@@ -154,6 +154,40 @@ func TestMasterIndexAddPending(t *testing.T) {
 	rtest.Equals(t, uint(100), size)
 }
 
+func TestMasterIndexUnavailablePacks(t *testing.T) {
+	bhUnavailable := restic.NewRandomBlobHandle()
+	bhDuplicate := restic.NewRandomBlobHandle()
+	unavailablePack := restic.NewRandomID()
+	otherPack := restic.NewRandomID()
+
+	newBlob := func(bh restic.BlobHandle) pack.Blob {
+		return pack.Blob{
+			BlobHandle:         bh,
+			Length:             uint(crypto.CiphertextLength(50)),
+			UncompressedLength: 50,
+		}
+	}
+	idx := index.NewIndex()
+	idx.StorePack(unavailablePack, pack.Blobs{newBlob(bhUnavailable), newBlob(bhDuplicate)})
+	idx.StorePack(otherPack, pack.Blobs{newBlob(bhDuplicate)})
+
+	mIdx := index.NewMasterIndex()
+	mIdx.Insert(idx)
+	mIdx.SetUnavailablePacks(restic.NewIDSet(unavailablePack))
+
+	// blobs only stored in unavailable packs are unknown, but can still be loaded
+	_, found := mIdx.LookupSize(bhUnavailable)
+	rtest.Equals(t, false, found)
+	rtest.Equals(t, 1, len(mIdx.Lookup(bhUnavailable)))
+	rtest.Equals(t, true, mIdx.AddPending(bhUnavailable, 50))
+
+	// blobs which are also stored in other packs are still known
+	size, found := mIdx.LookupSize(bhDuplicate)
+	rtest.Equals(t, true, found)
+	rtest.Equals(t, uint(50), size)
+	rtest.Equals(t, false, mIdx.AddPending(bhDuplicate, 50))
+}
+
 // noopSaver is a no-op implementation of SaverUnpacked for testing.
 type noopSaver struct{}
 
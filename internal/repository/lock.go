@@ -289,6 +289,31 @@ func RemoveStaleLocks(ctx context.Context, repo *Repository) (uint, error) {
 	return processed, err
 }
 
+// ListLocks calls fn for all lock files in the repository. If a lock file
+// cannot be loaded, fn is called with a nil LockInfo and the error.
+func ListLocks(ctx context.Context, repo *Repository, fn func(id restic.ID, info *LockInfo, err error) error) error {
+	return forAllLocks(ctx, repo, nil, func(id restic.ID, lock *lockHandle, err error) error {
+		if err != nil {
+			return fn(id, nil, err)
+		}
+		return fn(id, &LockInfo{Lock: lock.Lock, ID: id, Stale: lock.stale()}, nil)
+	})
+}
+
+// RemoveLocks removes the given lock files regardless of whether they are stale.
+// It returns the number of removed lock files.
+func RemoveLocks(ctx context.Context, repo *Repository, ids restic.IDs) (uint, error) {
+	var processed uint
+	for _, id := range ids {
+		err := (&internalRepository{repo}).RemoveUnpacked(ctx, restic.LockFile, id)
+		if err != nil {
+			return processed, err
+		}
+		processed++
+	}
+	return processed, nil
+}
+
 // RemoveAllLocks removes all locks forcefully.
 func RemoveAllLocks(ctx context.Context, repo *Repository) (uint, error) {
 	var processed uint32
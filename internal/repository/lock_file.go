@@ -32,6 +32,27 @@ type Lock struct {
 	PID       int       `json:"pid"`
 	UID       uint32    `json:"uid,omitempty"`
 	GID       uint32    `json:"gid,omitempty"`
+	// Created is the time the lock was acquired. Time is updated on each refresh.
+	Created time.Time `json:"created,omitzero"`
+}
+
+// CreatedAt returns the time the lock was acquired. Locks created by older
+// versions of restic do not record this time, for these the time of the last
+// refresh is returned.
+func (l Lock) CreatedAt() time.Time {
+	if l.Created.IsZero() {
+		return l.Time
+	}
+	return l.Created
+}
+
+// LockInfo describes a lock file stored in the repository.
+type LockInfo struct {
+	Lock
+	ID restic.ID
+	// Stale is true if the lock is no longer refreshed or, for locks created
+	// on this host, if the process holding the lock is not running.
+	Stale bool
 }
 
 // lockHandle is a reference to a lock file in the repository.
@@ -100,9 +121,11 @@ func TestSetLockTimeout(t testing.TB, d time.Duration) {
 // that satisfies IsAlreadyLocked. If the new lock is exclusive, then other
 // non-exclusive locks also result in an IsAlreadyLocked error.
 func newLock(ctx context.Context, repo restic.Unpacked[restic.FileType], exclusive bool) (*lockHandle, error) {
+	now := time.Now()
 	lock := &lockHandle{
 		Lock: Lock{
-			Time:      time.Now(),
+			Time:      now,
+			Created:   now,
 			PID:       os.Getpid(),
 			Exclusive: exclusive,
 		},
@@ -217,6 +217,8 @@ func testLockRefresh(t *testing.T, refresh func(lock *lockHandle) error) {
 	rtest.OK(t, err)
 	rtest.Assert(t, lock2.Time.After(time0),
 		"expected a later timestamp after lock refresh")
+	rtest.Assert(t, lock2.Created.Equal(time0),
+		"expected the creation time to be retained after lock refresh")
 	rtest.OK(t, lock.unlock(context.TODO()))
 }
 
@@ -379,3 +379,56 @@ func TestRemoveAllLocks(t *testing.T) {
 		"number of locks removed does not match: expected %d, got %d",
 		3, processed)
 }
+
+func TestListLocks(t *testing.T) {
+	repo := TestRepository(t)
+
+	id1, err := createFakeLock(repo, time.Now().Add(-time.Hour), os.Getpid())
+	rtest.OK(t, err)
+
+	id2, err := createFakeLock(repo, time.Now().Add(-time.Minute), os.Getpid())
+	rtest.OK(t, err)
+
+	// invalid lock file
+	id3, err := restic.SaveJSONUnpacked(context.TODO(), &internalRepository{repo}, restic.LockFile, []string{"invalid"})
+	rtest.OK(t, err)
+
+	locks := make(map[restic.ID]*LockInfo)
+	var failed restic.IDs
+	rtest.OK(t, ListLocks(context.TODO(), repo, func(id restic.ID, info *LockInfo, err error) error {
+		if err != nil {
+			failed = append(failed, id)
+			return nil
+		}
+		rtest.Equals(t, id, info.ID)
+		locks[id] = info
+		return nil
+	}))
+
+	rtest.Equals(t, restic.IDs{id3}, failed)
+	rtest.Equals(t, 2, len(locks))
+	rtest.Assert(t, locks[id1].Stale, "old lock is not stale")
+	rtest.Assert(t, !locks[id2].Stale, "recent lock is stale")
+	rtest.Equals(t, os.Getpid(), locks[id2].PID)
+	// locks without creation time report the time of the last refresh
+	rtest.Equals(t, locks[id2].Time, locks[id2].CreatedAt())
+}
+
+func TestRemoveLocks(t *testing.T) {
+	repo := TestRepository(t)
+
+	id1, err := createFakeLock(repo, time.Now().Add(-time.Minute), os.Getpid())
+	rtest.OK(t, err)
+
+	id2, err := createFakeLock(repo, time.Now().Add(-time.Minute), os.Getpid())
+	rtest.OK(t, err)
+
+	processed, err := RemoveLocks(context.TODO(), repo, restic.IDs{id1})
+	rtest.OK(t, err)
+	rtest.Equals(t, uint(1), processed)
+
+	rtest.Assert(t, lockExists(repo, t, id1) == false,
+		"lock still exists after RemoveLocks was called")
+	rtest.Assert(t, lockExists(repo, t, id2) == true,
+		"other lock was removed by RemoveLocks")
+}
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"sync"
 
 	"github.com/restic/restic/internal/restic"
 	"golang.org/x/sync/errgroup"
@@ -15,15 +16,23 @@ type savePacker interface {
 type uploadTask struct {
 	packer *packer
 	tpe    restic.BlobType
+	// done is closed once the pack has been uploaded
+	done chan struct{}
 }
 
 type packerUploader struct {
 	uploadQueue chan uploadTask
+
+	mu sync.Mutex
+	// pending contains the done channels of all queued packs which have not
+	// been uploaded yet
+	pending map[chan struct{}]struct{}
 }
 
 func newPackerUploader(ctx context.Context, wg *errgroup.Group, repo savePacker, connections uint) *packerUploader {
 	pu := &packerUploader{
 		uploadQueue: make(chan uploadTask),
+		pending:     make(map[chan struct{}]struct{}),
 	}
 
 	for i := 0; i < int(connections); i++ {
@@ -38,6 +47,10 @@ func newPackerUploader(ctx context.Context, wg *errgroup.Group, repo savePacker,
 					if err != nil {
 						return err
 					}
+					pu.mu.Lock()
+					delete(pu.pending, t.done)
+					pu.mu.Unlock()
+					close(t.done)
 				case <-ctx.Done():
 					return ctx.Err()
 				}
@@ -49,12 +62,39 @@ func newPackerUploader(ctx context.Context, wg *errgroup.Group, repo savePacker,
 }
 
 func (pu *packerUploader) QueuePacker(ctx context.Context, t restic.BlobType, p *packer) (err error) {
+	done := make(chan struct{})
+	pu.mu.Lock()
+	pu.pending[done] = struct{}{}
+	pu.mu.Unlock()
+
 	select {
 	case <-ctx.Done():
+		pu.mu.Lock()
+		delete(pu.pending, done)
+		pu.mu.Unlock()
 		return ctx.Err()
-	case pu.uploadQueue <- uploadTask{tpe: t, packer: p}:
+	case pu.uploadQueue <- uploadTask{tpe: t, packer: p, done: done}:
+	}
+
+	return nil
+}
+
+// Wait waits until all packs queued so far have been uploaded.
+func (pu *packerUploader) Wait(ctx context.Context) error {
+	pu.mu.Lock()
+	pending := make([]chan struct{}, 0, len(pu.pending))
+	for done := range pu.pending {
+		pending = append(pending, done)
 	}
+	pu.mu.Unlock()
 
+	for _, done := range pending {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
 	return nil
 }
 
@@ -0,0 +1,359 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository/parity"
+	"github.com/restic/restic/internal/restic"
+)
+
+// ParityOptions configures the layout of newly created parity files.
+type ParityOptions struct {
+	// PacksPerGroup is the number of pack files protected by one parity file.
+	PacksPerGroup uint
+	// ShardsPerPack is the number of data shards each pack file is split into.
+	ShardsPerPack uint
+	// ParityShards is the number of parity shards stored in each parity file.
+	ParityShards uint
+}
+
+// Check returns an error if the options are invalid.
+func (opts ParityOptions) Check() error {
+	if opts.PacksPerGroup == 0 || opts.ShardsPerPack == 0 || opts.ParityShards == 0 {
+		return errors.New("packs per group, shards per pack and parity shards must be positive")
+	}
+	if opts.PacksPerGroup*opts.ShardsPerPack+opts.ParityShards > parity.MaxShards {
+		return fmt.Errorf("packs per group * shards per pack + parity shards must not exceed %d", parity.MaxShards)
+	}
+	return nil
+}
+
+// parityIndex maps pack files to the parity files protecting them.
+type parityIndex struct {
+	headers map[restic.ID]*parity.Header
+	packs   map[restic.ID]restic.IDs
+}
+
+// loadParityIndex reads the headers of all parity files. Parity files whose
+// header cannot be read are reported and ignored.
+func (r *Repository) loadParityIndex(ctx context.Context, printer restic.Printer) (*parityIndex, error) {
+	idx := &parityIndex{
+		headers: make(map[restic.ID]*parity.Header),
+		packs:   make(map[restic.ID]restic.IDs),
+	}
+
+	var m sync.Mutex
+	err := restic.ParallelList(ctx, r, restic.ParityFile, r.Connections(), func(ctx context.Context, id restic.ID, size int64) error {
+		h := backend.Handle{Type: backend.ParityFile, Name: id.String()}
+		hdr, err := parity.ReadHeader(r.key, backend.ReaderAt(ctx, r.be, h), size)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			printer.E("unable to read parity file %v: %v", id.Str(), err)
+			return nil
+		}
+
+		m.Lock()
+		defer m.Unlock()
+		idx.headers[id] = hdr
+		for _, p := range hdr.Packs {
+			idx.packs[p.ID] = append(idx.packs[p.ID], id)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// UpdateParity creates parity files for all pack files which are not yet
+// protected by a parity file. Parity files which refer to pack files that no
+// longer exist are replaced.
+func UpdateParity(ctx context.Context, repo *Repository, opts ParityOptions, printer restic.Printer) error {
+	if err := opts.Check(); err != nil {
+		return err
+	}
+
+	printer.P("loading parity files")
+	pidx, err := repo.loadParityIndex(ctx, printer)
+	if err != nil {
+		return err
+	}
+
+	packs := make(map[restic.ID]int64)
+	err = repo.List(ctx, restic.PackFile, func(id restic.ID, size int64) error {
+		packs[id] = size
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	obsolete := restic.NewIDSet()
+	protected := restic.NewIDSet()
+	for id, hdr := range pidx.headers {
+		complete := true
+		for _, p := range hdr.Packs {
+			if size, ok := packs[p.ID]; !ok || uint(size) != p.Size {
+				complete = false
+				break
+			}
+		}
+		if !complete {
+			debug.Log("parity file %v refers to removed pack files", id)
+			obsolete.Insert(id)
+			continue
+		}
+		for _, p := range hdr.Packs {
+			protected.Insert(p.ID)
+		}
+	}
+
+	var todo restic.IDs
+	for id := range packs {
+		if !protected.Has(id) {
+			todo = append(todo, id)
+		}
+	}
+	// sort to get a deterministic grouping
+	slices.SortFunc(todo, func(a, b restic.ID) int {
+		return bytes.Compare(a[:], b[:])
+	})
+
+	printer.P("creating parity data for %d pack files", len(todo))
+	bar := printer.NewCounter("pack files")
+	bar.SetMax(uint64(len(todo)))
+	for len(todo) > 0 {
+		n := min(int(opts.PacksPerGroup), len(todo))
+		group := todo[:n]
+		todo = todo[n:]
+
+		sizes := make([]int64, len(group))
+		for i, id := range group {
+			sizes[i] = packs[id]
+		}
+		if err := repo.saveParityGroup(ctx, group, sizes, opts, printer); err != nil {
+			return err
+		}
+		bar.Add(uint64(n))
+	}
+	bar.Done()
+
+	if len(obsolete) > 0 {
+		printer.P("removing %d outdated parity files", len(obsolete))
+		bar := printer.NewCounter("files deleted")
+		err := restic.ParallelRemove(ctx, &internalRepository{repo}, obsolete, restic.ParityFile, func(id restic.ID, err error) error {
+			if err != nil {
+				printer.E("failed to remove parity file %v: %v", id.Str(), err)
+			}
+			return nil
+		}, bar)
+		bar.Done()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveParityGroup computes and saves a parity file for the given pack files.
+// Pack files which cannot be read correctly are skipped.
+func (r *Repository) saveParityGroup(ctx context.Context, ids restic.IDs, sizes []int64, opts ParityOptions, printer restic.Printer) error {
+	maxSize := int64(0)
+	for _, size := range sizes {
+		maxSize = max(maxSize, size)
+	}
+
+	hdr := &parity.Header{
+		ShardSize:     parity.ShardSize(uint(maxSize), opts.ShardsPerPack),
+		ShardsPerPack: opts.ShardsPerPack,
+	}
+	if hdr.ShardSize == 0 {
+		return nil
+	}
+	enc, err := parity.NewEncoder(len(ids)*int(opts.ShardsPerPack), int(opts.ParityShards))
+	if err != nil {
+		return err
+	}
+	parityShards := make([][]byte, opts.ParityShards)
+	for i := range parityShards {
+		parityShards[i] = make([]byte, hdr.ShardSize)
+	}
+
+	for _, id := range ids {
+		buf, err := r.LoadRaw(ctx, restic.PackFile, id)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			printer.E("skipping damaged pack file %v: %v", id, err)
+			continue
+		}
+
+		entry := parity.Pack{ID: id, Size: uint(len(buf))}
+		for _, shard := range parity.SplitPack(buf, hdr.ShardSize, hdr.ShardsPerPack) {
+			err := enc.Update(hdr.DataShards()+len(entry.Shards), shard, parityShards)
+			if err != nil {
+				return err
+			}
+			entry.Shards = append(entry.Shards, restic.Hash(shard))
+		}
+		hdr.Packs = append(hdr.Packs, entry)
+	}
+
+	if len(hdr.Packs) == 0 {
+		return nil
+	}
+	for _, shard := range parityShards {
+		hdr.Parity = append(hdr.Parity, restic.Hash(shard))
+	}
+
+	var buf bytes.Buffer
+	if err := parity.Write(&buf, r.key, hdr, parityShards); err != nil {
+		return err
+	}
+	id := restic.Hash(buf.Bytes())
+	h := backend.Handle{Type: backend.ParityFile, Name: id.String()}
+	debug.Log("saving parity file %v for %d packs", id, len(hdr.Packs))
+	return r.be.Save(ctx, h, backend.NewByteReader(buf.Bytes(), r.be.Hasher()))
+}
+
+// RepairPacksFromParity restores damaged or missing pack files using the
+// parity data. It returns the set of pack files which were restored. Pack files
+// which are intact, not protected by parity data or which cannot be restored
+// are not part of the returned set.
+func RepairPacksFromParity(ctx context.Context, repo *Repository, ids restic.IDSet, printer restic.Printer) (restic.IDSet, error) {
+	repaired := restic.NewIDSet()
+
+	pidx, err := repo.loadParityIndex(ctx, printer)
+	if err != nil {
+		return repaired, err
+	}
+
+	parityFiles := restic.NewIDSet()
+	for id := range ids {
+		for _, parityID := range pidx.packs[id] {
+			parityFiles.Insert(parityID)
+		}
+	}
+	if len(parityFiles) == 0 {
+		return repaired, nil
+	}
+
+	printer.P("restoring pack files from parity data")
+	for _, parityID := range parityFiles.List() {
+		hdr := pidx.headers[parityID]
+		var targets restic.IDs
+		for _, p := range hdr.Packs {
+			if ids.Has(p.ID) && !repaired.Has(p.ID) {
+				targets = append(targets, p.ID)
+			}
+		}
+		if len(targets) == 0 {
+			continue
+		}
+
+		done, err := repo.repairFromParityFile(ctx, parityID, hdr, restic.NewIDSet(targets...), printer)
+		if ctx.Err() != nil {
+			return repaired, ctx.Err()
+		}
+		if err != nil {
+			printer.E("unable to restore pack files using parity file %v: %v", parityID.Str(), err)
+		}
+		repaired.Merge(done)
+	}
+
+	return repaired, nil
+}
+
+func (r *Repository) repairFromParityFile(ctx context.Context, parityID restic.ID, hdr *parity.Header, targets restic.IDSet, printer restic.Printer) (restic.IDSet, error) {
+	repaired := restic.NewIDSet()
+
+	// damaged parity shards are detected using their hash below
+	buf, err := r.LoadRaw(ctx, restic.ParityFile, parityID)
+	if err != nil && buf == nil {
+		return repaired, err
+	}
+
+	spp := int(hdr.ShardsPerPack)
+	shards := make([][]byte, hdr.DataShards()+len(hdr.Parity))
+	damaged := restic.NewIDSet()
+	for i, p := range hdr.Packs {
+		packBuf, err := r.LoadRaw(ctx, restic.PackFile, p.ID)
+		if ctx.Err() != nil {
+			return repaired, ctx.Err()
+		}
+		if err != nil {
+			debug.Log("pack %v is damaged: %v", p.ID, err)
+			damaged.Insert(p.ID)
+			if packBuf == nil {
+				continue
+			}
+		}
+
+		for j, shard := range parity.SplitPack(packBuf, hdr.ShardSize, hdr.ShardsPerPack) {
+			if restic.Hash(shard) == p.Shards[j] {
+				shards[i*spp+j] = shard
+			}
+		}
+	}
+	for i, hash := range hdr.Parity {
+		shard := hdr.ParityShard(buf, i)
+		if shard != nil && restic.Hash(shard) == hash {
+			shards[hdr.DataShards()+i] = shard
+		}
+	}
+
+	for id := range targets {
+		if !damaged.Has(id) {
+			printer.E("pack file %v is intact, parity data cannot repair it", id)
+			targets.Delete(id)
+		}
+	}
+	if len(targets) == 0 {
+		return repaired, nil
+	}
+
+	enc, err := parity.NewEncoder(hdr.DataShards(), len(hdr.Parity))
+	if err != nil {
+		return repaired, err
+	}
+	if err := enc.Reconstruct(shards); err != nil {
+		return repaired, err
+	}
+
+	for i, p := range hdr.Packs {
+		if !targets.Has(p.ID) {
+			continue
+		}
+		packBuf := parity.JoinPack(shards[i*spp:(i+1)*spp], p.Size)
+		if restic.Hash(packBuf) != p.ID {
+			printer.E("restored pack file %v does not match its ID", p.ID)
+			continue
+		}
+		if err := r.replacePackFile(ctx, p.ID, packBuf); err != nil {
+			return repaired, err
+		}
+		printer.P("restored pack file %v", p.ID)
+		repaired.Insert(p.ID)
+	}
+	return repaired, nil
+}
+
+// replacePackFile replaces a damaged or missing pack file with the given content.
+func (r *Repository) replacePackFile(ctx context.Context, id restic.ID, buf []byte) error {
+	h := backend.Handle{Type: backend.PackFile, Name: id.String()}
+	if err := r.be.Remove(ctx, h); err != nil && !r.be.IsNotExist(err) {
+		return err
+	}
+	return r.be.Save(ctx, h, backend.NewByteReader(buf, r.be.Hasher()))
+}
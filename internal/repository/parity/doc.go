@@ -0,0 +1,3 @@
+// Package parity implements Reed-Solomon erasure coding for pack files and the
+// format of the parity files which store the resulting parity shards.
+package parity
@@ -0,0 +1,179 @@
+package parity
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository/crypto"
+	"github.com/restic/restic/internal/restic"
+)
+
+// A parity file consists of the parity shards followed by the encrypted
+// header and the header length:
+//
+//	Parity_1 || ... || Parity_m || EncryptedHeader || HeaderLength
+//
+// The parity shards are computed over the raw, already encrypted pack files
+// and are stored unencrypted. Their integrity is ensured by the hashes stored
+// in the authenticated header.
+
+const headerLengthSize = 4
+
+// MaxHeaderSize is the maximum size of the encrypted header.
+const MaxHeaderSize = 16 * 1024 * 1024
+
+// Header describes the pack files protected by a parity file and the parity
+// shards stored in it.
+type Header struct {
+	// ShardSize is the size of each data and parity shard in bytes.
+	ShardSize uint `json:"shard_size"`
+	// ShardsPerPack is the number of data shards each pack file is split into.
+	ShardsPerPack uint `json:"shards_per_pack"`
+	// Packs lists the protected pack files in the order of their data shards.
+	Packs []Pack `json:"packs"`
+	// Parity contains the hashes of the parity shards.
+	Parity restic.IDs `json:"parity"`
+}
+
+// Pack describes a pack file protected by a parity file.
+type Pack struct {
+	ID   restic.ID `json:"id"`
+	Size uint      `json:"size"`
+	// Shards contains the hashes of the zero-padded data shards of the pack.
+	Shards restic.IDs `json:"shards"`
+}
+
+// DataShards returns the total number of data shards.
+func (h *Header) DataShards() int {
+	return len(h.Packs) * int(h.ShardsPerPack)
+}
+
+// ShardSize returns the shard size required to split a pack file of maxPackSize
+// bytes into shardsPerPack shards.
+func ShardSize(maxPackSize uint, shardsPerPack uint) uint {
+	return (maxPackSize + shardsPerPack - 1) / shardsPerPack
+}
+
+// SplitPack splits the raw pack file into shardsPerPack data shards of
+// shardSize bytes. The last shards are padded with zeros. If buf is shorter
+// than expected, then the missing data is also replaced with zeros.
+func SplitPack(buf []byte, shardSize uint, shardsPerPack uint) [][]byte {
+	shards := make([][]byte, shardsPerPack)
+	for i := range shards {
+		shards[i] = make([]byte, shardSize)
+		start := uint(i) * shardSize
+		if start < uint(len(buf)) {
+			copy(shards[i], buf[start:])
+		}
+	}
+	return shards
+}
+
+// JoinPack reassembles a pack file of the given size from its data shards.
+func JoinPack(shards [][]byte, size uint) []byte {
+	buf := make([]byte, 0, size)
+	for _, shard := range shards {
+		buf = append(buf, shard...)
+	}
+	return buf[:size]
+}
+
+// ParityShard returns the i-th parity shard contained in the parity file buf.
+// It returns nil if the file is too short.
+func (h *Header) ParityShard(buf []byte, i int) []byte {
+	start := uint(i) * h.ShardSize
+	end := start + h.ShardSize
+	if end > uint(len(buf)) {
+		return nil
+	}
+	return buf[start:end]
+}
+
+// Write writes a parity file containing the parity shards and the header to wr.
+func Write(wr io.Writer, k *crypto.Key, h *Header, parity [][]byte) error {
+	if len(parity) != len(h.Parity) {
+		return errors.New("number of parity shards does not match header")
+	}
+	for _, shard := range parity {
+		if uint(len(shard)) != h.ShardSize {
+			return errors.New("invalid parity shard size")
+		}
+		if _, err := wr.Write(shard); err != nil {
+			return err
+		}
+	}
+
+	plaintext, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	nonce := crypto.NewRandomNonce()
+	ciphertext := make([]byte, 0, crypto.CiphertextLength(len(plaintext)))
+	ciphertext = append(ciphertext, nonce...)
+	ciphertext = k.Seal(ciphertext, nonce, plaintext, nil)
+	if len(ciphertext) > MaxHeaderSize {
+		return errors.New("parity header is too large")
+	}
+
+	if _, err := wr.Write(ciphertext); err != nil {
+		return err
+	}
+	return binary.Write(wr, binary.LittleEndian, uint32(len(ciphertext)))
+}
+
+// ReadHeader reads and decrypts the header of the parity file rd of the given size.
+func ReadHeader(k *crypto.Key, rd io.ReaderAt, size int64) (*Header, error) {
+	if size < headerLengthSize+int64(crypto.CiphertextLength(0)) {
+		return nil, errors.New("parity file is too short")
+	}
+
+	var lenBuf [headerLengthSize]byte
+	if _, err := rd.ReadAt(lenBuf[:], size-headerLengthSize); err != nil {
+		return nil, err
+	}
+	hlen := int64(binary.LittleEndian.Uint32(lenBuf[:]))
+	if hlen < int64(crypto.CiphertextLength(0)) || hlen > MaxHeaderSize || hlen > size-headerLengthSize {
+		return nil, fmt.Errorf("invalid parity header length %d", hlen)
+	}
+
+	buf := make([]byte, hlen)
+	if _, err := rd.ReadAt(buf, size-headerLengthSize-hlen); err != nil {
+		return nil, err
+	}
+
+	nonce, ciphertext := buf[:k.NonceSize()], buf[k.NonceSize():]
+	plaintext, err := k.Open(ciphertext[:0], nonce, ciphertext, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &Header{}
+	if err := json.Unmarshal(plaintext, h); err != nil {
+		return nil, err
+	}
+	if err := h.validate(uint64(size - headerLengthSize - hlen)); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *Header) validate(paritySize uint64) error {
+	if h.ShardsPerPack == 0 || len(h.Packs) == 0 || len(h.Parity) == 0 {
+		return errors.New("invalid parity header")
+	}
+	if h.DataShards()+len(h.Parity) > MaxShards {
+		return errors.New("invalid parity header, too many shards")
+	}
+	for _, p := range h.Packs {
+		if uint(len(p.Shards)) != h.ShardsPerPack || p.Size > h.ShardSize*h.ShardsPerPack {
+			return fmt.Errorf("invalid parity header entry for pack %v", p.ID.Str())
+		}
+	}
+	if paritySize != uint64(h.ShardSize)*uint64(len(h.Parity)) {
+		return errors.New("parity data size does not match header")
+	}
+	return nil
+}
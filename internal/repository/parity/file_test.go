@@ -0,0 +1,58 @@
+package parity_test
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/restic/restic/internal/repository/crypto"
+	"github.com/restic/restic/internal/repository/parity"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestSplitJoinPack(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	buf := make([]byte, 1001)
+	random.Read(buf)
+
+	shardSize := parity.ShardSize(uint(len(buf)), 4)
+	rtest.Equals(t, uint(251), shardSize)
+
+	shards := parity.SplitPack(buf, shardSize, 4)
+	rtest.Equals(t, 4, len(shards))
+	for _, shard := range shards {
+		rtest.Equals(t, int(shardSize), len(shard))
+	}
+	rtest.Assert(t, bytes.Equal(buf, parity.JoinPack(shards, uint(len(buf)))), "joined pack differs")
+}
+
+func TestHeaderRoundtrip(t *testing.T) {
+	random := rand.New(rand.NewSource(2))
+	k := crypto.NewRandomKey()
+
+	par := randomShards(random, 2, 300)
+	h := &parity.Header{
+		ShardSize:     300,
+		ShardsPerPack: 1,
+		Packs: []parity.Pack{
+			{ID: restic.NewRandomID(), Size: 250, Shards: restic.IDs{restic.NewRandomID()}},
+			{ID: restic.NewRandomID(), Size: 300, Shards: restic.IDs{restic.NewRandomID()}},
+		},
+		Parity: restic.IDs{restic.Hash(par[0]), restic.Hash(par[1])},
+	}
+
+	var buf bytes.Buffer
+	rtest.OK(t, parity.Write(&buf, k, h, par))
+
+	h2, err := parity.ReadHeader(k, bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	rtest.OK(t, err)
+	rtest.Equals(t, h, h2)
+	rtest.Assert(t, bytes.Equal(par[1], h2.ParityShard(buf.Bytes(), 1)), "wrong parity shard returned")
+
+	// damaged header must be detected
+	damaged := bytes.Clone(buf.Bytes())
+	damaged[len(damaged)-10] ^= 0x01
+	_, err = parity.ReadHeader(k, bytes.NewReader(damaged), int64(len(damaged)))
+	rtest.Assert(t, err != nil, "damaged header was not detected")
+}
@@ -0,0 +1,59 @@
+package parity
+
+// Arithmetic in GF(2^8) using the primitive polynomial x^8+x^4+x^3+x^2+1
+// (0x11d) and the generator 2.
+
+var (
+	expTable [510]byte
+	logTable [256]byte
+	mulTable [256][256]byte
+)
+
+func init() {
+	x := 1
+	for i := 0; i < 255; i++ {
+		expTable[i] = byte(x)
+		expTable[i+255] = byte(x)
+		logTable[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11d
+		}
+	}
+
+	for a := 1; a < 256; a++ {
+		for b := 1; b < 256; b++ {
+			mulTable[a][b] = expTable[int(logTable[a])+int(logTable[b])]
+		}
+	}
+}
+
+func galMul(a, b byte) byte {
+	return mulTable[a][b]
+}
+
+// galInv returns the multiplicative inverse of a, which must not be zero.
+func galInv(a byte) byte {
+	if a == 0 {
+		panic("inverse of zero")
+	}
+	return expTable[255-int(logTable[a])]
+}
+
+// galMulAdd adds c*src to dst. Both slices must have the same length.
+func galMulAdd(dst, src []byte, c byte) {
+	switch c {
+	case 0:
+		return
+	case 1:
+		for i, v := range src {
+			dst[i] ^= v
+		}
+		return
+	}
+
+	row := &mulTable[c]
+	for i, v := range src {
+		dst[i] ^= row[v]
+	}
+}
@@ -0,0 +1,209 @@
+package parity
+
+import (
+	"fmt"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// MaxShards is the maximum number of data and parity shards an Encoder supports.
+const MaxShards = 256
+
+// ErrTooFewShards is returned by Reconstruct if not enough intact shards are
+// available to restore the missing ones.
+var ErrTooFewShards = errors.New("too few intact shards to reconstruct data")
+
+// Encoder computes parity shards for a fixed number of data shards and
+// reconstructs missing data shards. It uses a systematic Reed-Solomon code
+// based on a Cauchy matrix, such that any dataShards out of the
+// dataShards+parityShards shards suffice to restore the data.
+type Encoder struct {
+	dataShards   int
+	parityShards int
+	// coefficients of the parity shards, parityShards rows with dataShards columns
+	matrix [][]byte
+}
+
+// NewEncoder returns a new Encoder. The total number of shards must not exceed MaxShards.
+func NewEncoder(dataShards, parityShards int) (*Encoder, error) {
+	if dataShards <= 0 || parityShards <= 0 {
+		return nil, errors.New("number of data and parity shards must be positive")
+	}
+	if dataShards+parityShards > MaxShards {
+		return nil, fmt.Errorf("too many shards, at most %d data and parity shards are supported", MaxShards)
+	}
+
+	e := &Encoder{
+		dataShards:   dataShards,
+		parityShards: parityShards,
+		matrix:       make([][]byte, parityShards),
+	}
+	// Cauchy matrix with x_i = 255 - i and y_j = j. Every square sub-matrix
+	// of a Cauchy matrix is invertible. The coefficients do not depend on the
+	// number of data shards, thus the parity of the first n data shards is the
+	// same for every encoder with at least n data shards.
+	for i := range e.matrix {
+		e.matrix[i] = make([]byte, dataShards)
+		for j := range e.matrix[i] {
+			e.matrix[i][j] = galInv(byte(MaxShards-1-i) ^ byte(j))
+		}
+	}
+	return e, nil
+}
+
+// DataShards returns the number of data shards.
+func (e *Encoder) DataShards() int {
+	return e.dataShards
+}
+
+// ParityShards returns the number of parity shards.
+func (e *Encoder) ParityShards() int {
+	return e.parityShards
+}
+
+// Update adds the contribution of the data shard with the given index to the
+// parity shards. The parity shards must be zeroed before the first call and
+// all shards must have the same length. Calling Update once for each data
+// shard yields the final parity shards.
+func (e *Encoder) Update(index int, shard []byte, parity [][]byte) error {
+	if index < 0 || index >= e.dataShards {
+		return fmt.Errorf("invalid data shard index %d", index)
+	}
+	if len(parity) != e.parityShards {
+		return fmt.Errorf("expected %d parity shards, got %d", e.parityShards, len(parity))
+	}
+	for i, p := range parity {
+		if len(p) != len(shard) {
+			return errors.New("shard sizes do not match")
+		}
+		galMulAdd(p, shard, e.matrix[i][index])
+	}
+	return nil
+}
+
+// Encode computes the parity shards for the given data shards.
+func (e *Encoder) Encode(data [][]byte, parity [][]byte) error {
+	if len(data) != e.dataShards {
+		return fmt.Errorf("expected %d data shards, got %d", e.dataShards, len(data))
+	}
+	for _, p := range parity {
+		clear(p)
+	}
+	for i, shard := range data {
+		if err := e.Update(i, shard, parity); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reconstruct restores all missing data shards. shards contains the data
+// shards followed by the parity shards, missing shards are nil. Missing
+// parity shards are not restored. All shards which are present must have the
+// same length.
+func (e *Encoder) Reconstruct(shards [][]byte) error {
+	if len(shards) != e.dataShards+e.parityShards {
+		return fmt.Errorf("expected %d shards, got %d", e.dataShards+e.parityShards, len(shards))
+	}
+
+	var missing []int
+	for i := 0; i < e.dataShards; i++ {
+		if shards[i] == nil {
+			missing = append(missing, i)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	// select the first dataShards intact shards and the matching rows of the
+	// encoding matrix
+	present := make([]int, 0, e.dataShards)
+	shardSize := -1
+	for i, shard := range shards {
+		if shard == nil {
+			continue
+		}
+		if shardSize == -1 {
+			shardSize = len(shard)
+		} else if shardSize != len(shard) {
+			return errors.New("shard sizes do not match")
+		}
+		if len(present) < e.dataShards {
+			present = append(present, i)
+		}
+	}
+	if len(present) < e.dataShards {
+		return ErrTooFewShards
+	}
+
+	m := make([][]byte, e.dataShards)
+	for row, idx := range present {
+		m[row] = make([]byte, e.dataShards)
+		if idx < e.dataShards {
+			m[row][idx] = 1
+		} else {
+			copy(m[row], e.matrix[idx-e.dataShards])
+		}
+	}
+	inv, err := invertMatrix(m)
+	if err != nil {
+		return err
+	}
+
+	for _, idx := range missing {
+		out := make([]byte, shardSize)
+		for col, src := range present {
+			galMulAdd(out, shards[src], inv[idx][col])
+		}
+		shards[idx] = out
+	}
+	return nil
+}
+
+// invertMatrix inverts the square matrix m using Gauss-Jordan elimination.
+// The content of m is destroyed.
+func invertMatrix(m [][]byte) ([][]byte, error) {
+	n := len(m)
+	inv := make([][]byte, n)
+	for i := range inv {
+		inv[i] = make([]byte, n)
+		inv[i][i] = 1
+	}
+
+	for col := 0; col < n; col++ {
+		// find pivot
+		pivot := -1
+		for row := col; row < n; row++ {
+			if m[row][col] != 0 {
+				pivot = row
+				break
+			}
+		}
+		if pivot == -1 {
+			return nil, errors.New("matrix is singular")
+		}
+		m[col], m[pivot] = m[pivot], m[col]
+		inv[col], inv[pivot] = inv[pivot], inv[col]
+
+		// scale pivot row to one
+		if c := m[col][col]; c != 1 {
+			f := galInv(c)
+			for j := 0; j < n; j++ {
+				m[col][j] = galMul(m[col][j], f)
+				inv[col][j] = galMul(inv[col][j], f)
+			}
+		}
+
+		// eliminate column in all other rows
+		for row := 0; row < n; row++ {
+			if row == col || m[row][col] == 0 {
+				continue
+			}
+			f := m[row][col]
+			galMulAdd(m[row], m[col], f)
+			galMulAdd(inv[row], inv[col], f)
+		}
+	}
+	return inv, nil
+}
@@ -0,0 +1,96 @@
+package parity_test
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/restic/restic/internal/repository/parity"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func randomShards(random *rand.Rand, count, size int) [][]byte {
+	shards := make([][]byte, count)
+	for i := range shards {
+		shards[i] = make([]byte, size)
+		random.Read(shards[i])
+	}
+	return shards
+}
+
+func TestReconstruct(t *testing.T) {
+	random := rand.New(rand.NewSource(42))
+
+	for _, test := range []struct {
+		data, parity int
+	}{
+		{1, 1},
+		{4, 2},
+		{10, 3},
+		{16, 4},
+		{200, 56},
+	} {
+		enc, err := parity.NewEncoder(test.data, test.parity)
+		rtest.OK(t, err)
+
+		data := randomShards(random, test.data, 1000)
+		par := make([][]byte, test.parity)
+		for i := range par {
+			par[i] = make([]byte, 1000)
+		}
+		rtest.OK(t, enc.Encode(data, par))
+
+		for run := 0; run < 10; run++ {
+			shards := append(append([][]byte{}, data...), par...)
+			// erase as many shards as there are parity shards
+			for _, idx := range random.Perm(len(shards))[:test.parity] {
+				shards[idx] = nil
+			}
+
+			rtest.OK(t, enc.Reconstruct(shards))
+			for i := range data {
+				rtest.Assert(t, bytes.Equal(shards[i], data[i]), "data shard %d was not restored correctly (%d+%d)", i, test.data, test.parity)
+			}
+		}
+	}
+}
+
+func TestReconstructTooFewShards(t *testing.T) {
+	random := rand.New(rand.NewSource(23))
+	enc, err := parity.NewEncoder(4, 2)
+	rtest.OK(t, err)
+
+	data := randomShards(random, 4, 100)
+	par := [][]byte{make([]byte, 100), make([]byte, 100)}
+	rtest.OK(t, enc.Encode(data, par))
+
+	shards := [][]byte{nil, data[1], nil, data[3], nil, par[1]}
+	rtest.Equals(t, parity.ErrTooFewShards, enc.Reconstruct(shards))
+}
+
+func TestEncoderInvalidShards(t *testing.T) {
+	_, err := parity.NewEncoder(0, 1)
+	rtest.Assert(t, err != nil, "expected error for zero data shards")
+	_, err = parity.NewEncoder(1, 0)
+	rtest.Assert(t, err != nil, "expected error for zero parity shards")
+	_, err = parity.NewEncoder(200, 57)
+	rtest.Assert(t, err != nil, "expected error for too many shards")
+}
+
+func TestEncodePrefix(t *testing.T) {
+	random := rand.New(rand.NewSource(5))
+	data := randomShards(random, 3, 100)
+
+	small, err := parity.NewEncoder(3, 2)
+	rtest.OK(t, err)
+	large, err := parity.NewEncoder(8, 2)
+	rtest.OK(t, err)
+
+	par1 := [][]byte{make([]byte, 100), make([]byte, 100)}
+	rtest.OK(t, small.Encode(data, par1))
+	par2 := [][]byte{make([]byte, 100), make([]byte, 100)}
+	for i, shard := range data {
+		rtest.OK(t, large.Update(i, shard, par2))
+	}
+	rtest.Equals(t, par1, par2)
+}
@@ -0,0 +1,125 @@
+package repository_test
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/backend"
+	backendtest "github.com/restic/restic/internal/backend/test"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestRepairPacksFromParity(t *testing.T) {
+	repository.TestAllVersions(t, testRepairPacksFromParity)
+}
+
+func testRepairPacksFromParity(t *testing.T, version uint) {
+	tests := []struct {
+		name   string
+		opts   repository.ParityOptions
+		damage func(t *testing.T, be backend.Backend, h backend.Handle)
+	}{
+		{
+			"missing pack",
+			repository.ParityOptions{PacksPerGroup: 4, ShardsPerPack: 1, ParityShards: 1},
+			func(t *testing.T, be backend.Backend, h backend.Handle) {
+				rtest.OK(t, be.Remove(context.TODO(), h))
+			},
+		},
+		{
+			"damaged pack",
+			repository.ParityOptions{PacksPerGroup: 4, ShardsPerPack: 1, ParityShards: 1},
+			func(t *testing.T, be backend.Backend, h backend.Handle) {
+				replaceFile(t, be, h, func(buf []byte) []byte {
+					buf[len(buf)/2] ^= 0xff
+					return buf
+				})
+			},
+		},
+		{
+			"damaged pack with parity per pack",
+			repository.ParityOptions{PacksPerGroup: 1, ShardsPerPack: 8, ParityShards: 2},
+			func(t *testing.T, be backend.Backend, h backend.Handle) {
+				replaceFile(t, be, h, func(buf []byte) []byte {
+					buf[0] ^= 0xff
+					buf[len(buf)-1] ^= 0xff
+					return buf
+				})
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			repo, be := repository.TestRepositoryWithBackend(t, nil, version, repository.Options{})
+
+			seed := time.Now().UnixNano()
+			random := rand.New(rand.NewSource(seed))
+			t.Logf("rand seed is %v", seed)
+
+			createRandomBlobs(t, random, repo, 5, 0.7, true)
+			packs := listPacks(t, repo)
+			rtest.OK(t, repository.UpdateParity(context.TODO(), repo, test.opts, restic.NewNoopPrinter()))
+			rtest.Assert(t, len(listFiles(t, repo, restic.ParityFile)) > 0, "no parity files were created")
+
+			damagedID := packs.List()[0]
+			h := backend.Handle{Type: backend.PackFile, Name: damagedID.String()}
+			orig, err := backendtest.LoadAll(context.TODO(), be, h)
+			rtest.OK(t, err)
+			test.damage(t, be, h)
+
+			repaired, err := repository.RepairPacksFromParity(context.TODO(), repo, restic.NewIDSet(damagedID), restic.NewNoopPrinter())
+			rtest.OK(t, err)
+			rtest.Equals(t, restic.NewIDSet(damagedID), repaired)
+
+			buf, err := backendtest.LoadAll(context.TODO(), be, h)
+			rtest.OK(t, err)
+			rtest.Equals(t, orig, buf)
+		})
+	}
+}
+
+func TestRepairPacksFromParityIntact(t *testing.T) {
+	repo, _ := repository.TestRepositoryWithBackend(t, nil, 0, repository.Options{})
+	random := rand.New(rand.NewSource(42))
+	createRandomBlobs(t, random, repo, 5, 0.7, true)
+
+	opts := repository.ParityOptions{PacksPerGroup: 2, ShardsPerPack: 1, ParityShards: 1}
+	rtest.OK(t, repository.UpdateParity(context.TODO(), repo, opts, restic.NewNoopPrinter()))
+
+	packs := listPacks(t, repo)
+	repaired, err := repository.RepairPacksFromParity(context.TODO(), repo, packs, restic.NewNoopPrinter())
+	rtest.OK(t, err)
+	rtest.Equals(t, 0, len(repaired))
+}
+
+func TestUpdateParity(t *testing.T) {
+	repo, be := repository.TestRepositoryWithBackend(t, nil, 0, repository.Options{})
+	random := rand.New(rand.NewSource(23))
+	createRandomBlobs(t, random, repo, 20, 0.5, false)
+	packs := listPacks(t, repo)
+	rtest.Assert(t, len(packs) > 2, "test requires at least three packs, got %d", len(packs))
+
+	opts := repository.ParityOptions{PacksPerGroup: 2, ShardsPerPack: 1, ParityShards: 1}
+	rtest.OK(t, repository.UpdateParity(context.TODO(), repo, opts, restic.NewNoopPrinter()))
+	parityFiles := listFiles(t, repo, restic.ParityFile)
+	rtest.Equals(t, (len(packs)+1)/2, len(parityFiles))
+
+	// a second run must not change anything
+	rtest.OK(t, repository.UpdateParity(context.TODO(), repo, opts, restic.NewNoopPrinter()))
+	rtest.Equals(t, parityFiles, listFiles(t, repo, restic.ParityFile))
+
+	// removing a pack file makes its parity file obsolete. The pack with the
+	// lowest ID is part of a complete group, thus the remaining pack of that
+	// group gets a new parity file.
+	removed := packs.List()[0]
+	rtest.OK(t, be.Remove(context.TODO(), backend.Handle{Type: backend.PackFile, Name: removed.String()}))
+	rtest.OK(t, repository.UpdateParity(context.TODO(), repo, opts, restic.NewNoopPrinter()))
+	newParityFiles := listFiles(t, repo, restic.ParityFile)
+	rtest.Equals(t, len(parityFiles), len(newParityFiles))
+	rtest.Assert(t, len(parityFiles.Sub(newParityFiles)) == 1, "expected exactly one parity file to be replaced")
+}
@@ -7,6 +7,7 @@ import (
 	"math"
 	"slices"
 	"sort"
+	"time"
 
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
@@ -30,6 +31,18 @@ type PruneOptions struct {
 
 	RepackCacheableOnly bool
 	RepackUncompressed  bool
+
+	// GracePeriod is the minimum time a pack must be marked for deletion
+	// before PlanNonExclusivePrune deletes it.
+	GracePeriod time.Duration
+
+	// ColdStorage enables repacking data packs only once the storage cost of
+	// their unused data exceeds the cost of retrieving them. Nil disables it.
+	ColdStorage *ColdStorageCosts
+
+	// Deadline stops repacking and deleting packs once it has passed. The
+	// remaining work is saved as prune state. A zero value disables the limit.
+	Deadline time.Time
 }
 
 type PruneStats struct {
@@ -69,6 +82,8 @@ type PruneStats struct {
 		Repack      uint `json:"repack"`
 		Remove      uint `json:"remove"`
 		RemoveTotal uint `json:"remove_total"`
+		Marked      uint `json:"marked"`
+		Warmup      uint `json:"warmup"`
 	} `json:"packfiles"`
 }
 
@@ -78,6 +93,11 @@ type PrunePlan struct {
 	keepBlobs        *index.AssociatedSet[uint8] // blobs to keep during repacking
 	removePacks      restic.IDSet                // packs to remove
 	ignorePacks      restic.IDSet                // packs to ignore when rebuilding the index
+	snapshots        restic.IDs                  // snapshots considered for the plan
+	resumed          *restic.ID                  // prune state continued by the plan
+	deletionMarks    map[restic.ID]time.Time     // packs marked for deletion by a non-exclusive prune
+	markFiles        restic.IDs                  // files containing the previous deletion marks
+	ledger           *coldStorageLedger          // repack decisions for packs on cold storage
 
 	repo  *Repository
 	stats PruneStats
@@ -121,7 +141,8 @@ func PlanPrune(ctx context.Context, opts PruneOptions, repo *Repository, getUsed
 	}
 
 	usedBlobs := index.NewAssociatedSet[uint8](repo.idx)
-	err := getUsedBlobs(ctx, repo, usedBlobs)
+	snapshots := &snapshotRecorder{Repository: repo}
+	err := getUsedBlobs(ctx, snapshots, usedBlobs)
 	if err != nil {
 		return nil, err
 	}
@@ -132,8 +153,16 @@ func PlanPrune(ctx context.Context, opts PruneOptions, repo *Repository, getUsed
 		return nil, err
 	}
 
+	var ledger *coldStorageLedger
+	if opts.ColdStorage != nil {
+		ledger, err = loadColdStorageLedger(ctx, repo, *opts.ColdStorage, time.Now())
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	printer.P("collecting packs for deletion and repacking\n")
-	plan, err := decidePackAction(ctx, opts, repo, indexPack, &stats, printer)
+	plan, err := decidePackAction(ctx, opts, repo, indexPack, ledger, &stats, printer)
 	if err != nil {
 		return nil, err
 	}
@@ -168,6 +197,7 @@ func PlanPrune(ctx context.Context, opts PruneOptions, repo *Repository, getUsed
 	stats.Packs.Total = stats.Packs.Used + stats.Packs.PartlyUsed + stats.Packs.Unused + stats.Packs.Unref
 	stats.Packs.RemoveTotal = stats.Packs.Unref + stats.Packs.Remove
 
+	plan.snapshots = snapshots.ids
 	plan.repo = repo
 	plan.stats = stats
 	plan.opts = opts
@@ -383,13 +413,14 @@ func calculateTargetPacksize(opts PruneOptions, indexPack map[restic.ID]packInfo
 	return targetPackSize
 }
 
-func decidePackAction(ctx context.Context, opts PruneOptions, repo *Repository, indexPack map[restic.ID]packInfo, stats *PruneStats, printer restic.Printer) (PrunePlan, error) {
+func decidePackAction(ctx context.Context, opts PruneOptions, repo *Repository, indexPack map[restic.ID]packInfo, ledger *coldStorageLedger, stats *PruneStats, printer restic.Printer) (PrunePlan, error) {
 	removePacksFirst := restic.NewIDSet()
 	removePacks := restic.NewIDSet()
 	repackPacks := restic.NewIDSet()
 
 	var repackCandidates []packInfoWithID
 	var repackSmallCandidates []packInfoWithID
+	var repackColdCandidates []packInfoWithID
 	repoVersion := repo.Config().Version
 
 	targetPackSize := calculateTargetPacksize(opts, indexPack)
@@ -447,6 +478,15 @@ func decidePackAction(ctx context.Context, opts PruneOptions, repo *Repository,
 			// if this is a data pack and --repack-cacheable-only is set => keep pack!
 			stats.Packs.Keep++
 
+		case ledger != nil && p.tpe == restic.DataBlob:
+			// data packs on cold storage are only repacked once this is cheaper
+			// than keeping their unused data
+			if ledger.repackJustified(id, p, uint64(packSize)) {
+				repackColdCandidates = append(repackColdCandidates, packInfoWithID{ID: id, packInfo: p, mustCompress: mustCompress})
+			} else {
+				stats.Packs.Keep++
+			}
+
 		case p.unusedBlobs == 0 && p.tpe != restic.InvalidBlob && !mustCompress:
 			if packSize >= int64(targetPackSize) {
 				// All blobs in pack are used and not mixed => keep pack!
@@ -565,6 +605,19 @@ func decidePackAction(ctx context.Context, opts PruneOptions, repo *Repository,
 		}
 	}
 
+	// the warmup for these packs was requested by a previous prune run, thus
+	// repacking them is only limited by repackSize
+	for _, p := range repackColdCandidates {
+		if stats.Size.Repack+p.unusedSize+p.usedSize >= opts.MaxRepackBytes {
+			stats.Packs.Keep++
+		} else {
+			repack(p.ID, p.packInfo)
+		}
+	}
+	if ledger != nil {
+		stats.Packs.Warmup = uint(len(ledger.warmup))
+	}
+
 	stats.Packs.Unref = uint(len(removePacksFirst))
 	stats.Packs.Repack = uint(len(repackPacks))
 	stats.Packs.Remove = uint(len(removePacks))
@@ -578,6 +631,7 @@ func decidePackAction(ctx context.Context, opts PruneOptions, repo *Repository,
 		removePacks: removePacks,
 		repackPacks: repackPacks,
 		ignorePacks: ignorePacks,
+		ledger:      ledger,
 	}, nil
 }
 
@@ -591,6 +645,11 @@ func (plan *PrunePlan) Stats() PruneStats {
 // - rebuild the index while ignoring all files that will be deleted
 // - delete the files
 // plan.removePacks and plan.ignorePacks are modified in this function.
+//
+// If opts.Deadline passes, no further packs are repacked or deleted. The
+// remaining work is saved as prune state, which can be resumed using
+// ResumePrune. Packs are only deleted once they are no longer referenced by
+// the index, thus the repository is consistent when stopping.
 func (plan *PrunePlan) Execute(ctx context.Context, printer restic.Printer) error {
 	if plan.opts.DryRun {
 		printer.V("Repeated prune dry-runs can report slightly different amounts of data to keep or repack. This is expected behavior.\n\n")
@@ -599,6 +658,9 @@ func (plan *PrunePlan) Execute(ctx context.Context, printer restic.Printer) erro
 		}
 		printer.V("Would have repacked and removed the following packs:\n%v\n\n", plan.repackPacks)
 		printer.V("Would have removed the following no longer used packs:\n%v\n\n", plan.removePacks)
+		if plan.ledger != nil && len(plan.ledger.warmup) > 0 {
+			printer.V("Would have requested the warmup of the following packs:\n%v\n\n", plan.ledger.warmup)
+		}
 		// Always quit here if DryRun was set!
 		return nil
 	}
@@ -607,11 +669,21 @@ func (plan *PrunePlan) Execute(ctx context.Context, printer restic.Printer) erro
 	// make sure the plan can only be used once
 	plan.repo = nil
 
+	// packs which could not be deleted before the deadline
+	remaining := restic.NewIDSet()
+
+	if plan.ledger != nil && len(plan.ledger.warmup) != 0 {
+		printer.P("requesting warmup of %d packs to repack them in the next prune run\n", len(plan.ledger.warmup))
+		// the warmup is requested again by the next run if this fails
+		if err := plan.ledger.startWarmup(ctx, repo); err != nil {
+			printer.E("failed to request warmup: %v", err)
+		}
+	}
+
 	// unreferenced packs can be safely deleted first
 	if len(plan.removePacksFirst) != 0 {
 		printer.P("deleting unreferenced packs\n")
-		// ignoring errors is fine here as keeping too many packs cannot damage the repository
-		_ = deleteFiles(ctx, true, &internalRepository{repo}, plan.removePacksFirst, restic.PackFile, printer)
+		remaining.Merge(plan.deletePacks(ctx, repo, plan.removePacksFirst, printer))
 		// forget unused data
 		plan.removePacksFirst = nil
 	}
@@ -619,33 +691,36 @@ func (plan *PrunePlan) Execute(ctx context.Context, printer restic.Printer) erro
 		return ctx.Err()
 	}
 
-	if len(plan.repackPacks) != 0 {
+	if len(plan.repackPacks) != 0 && !plan.deadlineReached() {
 		printer.P("repacking packs\n")
-		bar := printer.NewCounter("packs repacked")
-		err := repo.WithBlobUploader(ctx, func(ctx context.Context, uploader restic.BlobSaverWithAsync) error {
-			return CopyBlobs(ctx, repo, repo, uploader, plan.repackPacks, plan.keepBlobs, bar, printer.P)
-		})
+		repacked, err := plan.repack(ctx, repo, printer)
 		if err != nil {
 			return errors.Fatalf("%s", err)
 		}
 
 		// Also remove repacked packs
-		plan.removePacks.Merge(plan.repackPacks)
-		// forget unused data
-		plan.repackPacks = nil
+		plan.removePacks.Merge(repacked)
+
+		if len(plan.repackPacks) == 0 {
+			if plan.keepBlobs.Len() != 0 {
+				printer.E("%v was not repacked\n\n"+
+					"Integrity check failed.\n"+
+					"Please report this error (along with the output of the 'prune' run) at\n"+
+					"https://github.com/restic/restic/issues/new/choose", plan.keepBlobs)
+				return errors.Fatal("internal error: blobs were not repacked")
+			}
 
-		if plan.keepBlobs.Len() != 0 {
-			printer.E("%v was not repacked\n\n"+
-				"Integrity check failed.\n"+
-				"Please report this error (along with the output of the 'prune' run) at\n"+
-				"https://github.com/restic/restic/issues/new/choose", plan.keepBlobs)
-			return errors.Fatal("internal error: blobs were not repacked")
+			// allow GC of the blob set
+			plan.keepBlobs = nil
 		}
-
-		// allow GC of the blob set
-		plan.keepBlobs = nil
 	}
 
+	// the blobs to keep are tied to the current index
+	state := plan.newPruneState()
+	// forget unused data
+	plan.repackPacks = nil
+	plan.keepBlobs = nil
+
 	if len(plan.ignorePacks) == 0 {
 		plan.ignorePacks = plan.removePacks
 	} else {
@@ -668,8 +743,7 @@ func (plan *PrunePlan) Execute(ctx context.Context, printer restic.Printer) erro
 
 	if len(plan.removePacks) != 0 {
 		printer.P("removing %d old packs", len(plan.removePacks))
-		// ignoring errors is fine here as keeping too many packs cannot damage the repository
-		_ = deleteFiles(ctx, true, &internalRepository{repo}, plan.removePacks, restic.PackFile, printer)
+		remaining.Merge(plan.deletePacks(ctx, repo, plan.removePacks, printer))
 	}
 	if ctx.Err() != nil {
 		return ctx.Err()
@@ -685,10 +759,100 @@ func (plan *PrunePlan) Execute(ctx context.Context, printer restic.Printer) erro
 	// drop outdated in-memory index
 	repo.clearIndex()
 
+	if plan.ledger != nil {
+		if err := plan.ledger.save(ctx, repo, plan.removePacks, printer); err != nil {
+			return errors.Fatalf("%s", err)
+		}
+	}
+
+	if plan.deletionMarks != nil {
+		if err := saveDeletionMarks(ctx, repo, plan.deletionMarks, plan.markFiles, printer); err != nil {
+			return errors.Fatalf("%s", err)
+		}
+		if len(plan.deletionMarks) != 0 {
+			printer.P("%d unused packs are marked for deletion\n", len(plan.deletionMarks))
+		}
+		printer.P("done\n")
+		return nil
+	}
+
+	state.Remove = remaining.List()
+	if err := plan.savePruneState(ctx, repo, state, printer); err != nil {
+		return errors.Fatalf("%s", err)
+	}
+	if len(state.Repack) != 0 || len(state.Remove) != 0 {
+		printer.P("maximum duration reached, %d packs to repack and %d packs to delete remain\n", len(state.Repack), len(state.Remove))
+		printer.P("run `restic prune --resume` to continue\n")
+		return nil
+	}
+
 	printer.P("done\n")
 	return nil
 }
 
+// deadlineReached returns whether the prune run should stop.
+func (plan *PrunePlan) deadlineReached() bool {
+	return !plan.opts.Deadline.IsZero() && time.Now().After(plan.opts.Deadline)
+}
+
+// pruneBatchSize is the number of packs processed at once if a deadline is set.
+const pruneBatchSize = 100
+
+// batches splits packs into batches. Without deadline all packs are returned as a single batch.
+func (plan *PrunePlan) batches(packs restic.IDSet) []restic.IDs {
+	list := packs.List()
+	if plan.opts.Deadline.IsZero() {
+		return []restic.IDs{list}
+	}
+	return slices.Collect(slices.Chunk(list, pruneBatchSize))
+}
+
+// repack repacks plan.repackPacks until the deadline is reached and returns
+// the repacked packs. plan.repackPacks only contains the remaining packs afterwards.
+func (plan *PrunePlan) repack(ctx context.Context, repo *Repository, printer restic.Printer) (restic.IDSet, error) {
+	bar := printer.NewCounter("packs repacked")
+	bar.SetMax(uint64(len(plan.repackPacks)))
+	defer bar.Done()
+
+	repacked := restic.NewIDSet()
+	err := repo.WithBlobUploader(ctx, func(ctx context.Context, uploader restic.BlobSaverWithAsync) error {
+		for _, batch := range plan.batches(plan.repackPacks) {
+			if plan.deadlineReached() {
+				break
+			}
+			packs := restic.NewIDSet(batch...)
+			err := repack(ctx, repo, repo, uploader, packs, plan.keepBlobs, bar, printer.P)
+			if err != nil {
+				return err
+			}
+			repacked.Merge(packs)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	plan.repackPacks = plan.repackPacks.Sub(repacked)
+	return repacked, nil
+}
+
+// deletePacks deletes packs until the deadline is reached. Returned are the
+// packs which have not been deleted.
+func (plan *PrunePlan) deletePacks(ctx context.Context, repo *Repository, packs restic.IDSet, printer restic.Printer) restic.IDSet {
+	remaining := packs.Clone()
+	for _, batch := range plan.batches(packs) {
+		if plan.deadlineReached() {
+			break
+		}
+		ids := restic.NewIDSet(batch...)
+		// ignoring errors is fine here as keeping too many packs cannot damage the repository
+		_ = deleteFiles(ctx, true, &internalRepository{repo}, ids, restic.PackFile, printer)
+		remaining = remaining.Sub(ids)
+	}
+	return remaining
+}
+
 // deleteFiles deletes the given fileList of fileType in parallel
 // if ignoreError=true, it will print a warning if there was an error, else it will abort.
 func deleteFiles(ctx context.Context, ignoreError bool, repo restic.RemoverUnpacked[restic.FileType], fileList restic.IDSet, fileType restic.FileType, printer restic.Printer) error {
@@ -0,0 +1,253 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/repository/index"
+	"github.com/restic/restic/internal/repository/pack"
+	"github.com/restic/restic/internal/restic"
+)
+
+// deletionMarks lists the packs which were marked for deletion by a
+// non-exclusive prune run. A marked pack is only deleted by a later prune run
+// once the grace period has passed and the pack is still unused.
+type deletionMarks struct {
+	Marks []deletionMark `json:"marks"`
+}
+
+// deletionMark contains the packs marked for deletion at the same time.
+type deletionMark struct {
+	Time  time.Time  `json:"time"`
+	Packs restic.IDs `json:"packs"`
+}
+
+// loadDeletionMarks returns the time at which each pack was marked for
+// deletion along with the IDs of the files containing the marks.
+func loadDeletionMarks(ctx context.Context, repo restic.ListerLoaderUnpacked) (map[restic.ID]time.Time, restic.IDs, error) {
+	marked := make(map[restic.ID]time.Time)
+	var files restic.IDs
+	err := repo.List(ctx, restic.DeletionFile, func(id restic.ID, _ int64) error {
+		var marks deletionMarks
+		err := restic.LoadJSONUnpacked(ctx, repo, restic.DeletionFile, id, &marks)
+		if err != nil {
+			return fmt.Errorf("failed to load deletion marks %v: %w", id.Str(), err)
+		}
+		files = append(files, id)
+		for _, mark := range marks.Marks {
+			for _, packID := range mark.Packs {
+				// keep the earliest mark if a pack is marked several times
+				if t, ok := marked[packID]; !ok || mark.Time.Before(t) {
+					marked[packID] = mark.Time
+				}
+			}
+		}
+		return nil
+	})
+	return marked, files, err
+}
+
+// saveDeletionMarks stores marked and removes the old files containing deletion marks.
+func saveDeletionMarks(ctx context.Context, repo *Repository, marked map[restic.ID]time.Time, oldFiles restic.IDs, printer restic.Printer) error {
+	if len(marked) != 0 {
+		byTime := make(map[time.Time]restic.IDs)
+		for id, t := range marked {
+			byTime[t] = append(byTime[t], id)
+		}
+		var marks deletionMarks
+		for t, packs := range byTime {
+			sort.Sort(packs)
+			marks.Marks = append(marks.Marks, deletionMark{Time: t, Packs: packs})
+		}
+		slices.SortFunc(marks.Marks, func(a, b deletionMark) int { return a.Time.Compare(b.Time) })
+
+		id, err := restic.SaveJSONUnpacked(ctx, &internalRepository{repo}, restic.DeletionFile, &marks)
+		if err != nil {
+			return fmt.Errorf("failed to save deletion marks: %w", err)
+		}
+		debug.Log("saved deletion marks %v for %d packs", id.Str(), len(marked))
+	}
+
+	if len(oldFiles) == 0 {
+		return nil
+	}
+	return deleteFiles(ctx, false, &internalRepository{repo}, restic.NewIDSet(oldFiles...), restic.DeletionFile, printer)
+}
+
+// ExcludePendingDeletions loads the packs marked for deletion by a
+// non-exclusive prune run. Blobs which are only stored in these packs are
+// treated as unavailable, such that they are saved again instead of being
+// deduplicated. Must be called after loading the index.
+func (r *Repository) ExcludePendingDeletions(ctx context.Context) error {
+	marked, _, err := loadDeletionMarks(ctx, r)
+	if err != nil {
+		return err
+	}
+	packs := restic.NewIDSet()
+	for id := range marked {
+		packs.Insert(id)
+	}
+	debug.Log("excluding %d packs pending deletion", len(packs))
+	r.idx.SetUnavailablePacks(packs)
+	return nil
+}
+
+// PlanNonExclusivePrune plans a prune run which only requires a non-exclusive
+// lock. Instead of deleting unused packs, they are marked for deletion.
+// Packs are only deleted by a later run once they have been marked for at
+// least opts.GracePeriod and are still unused. The grace period must exceed
+// the duration of the longest backup, such that all backups which might use
+// a marked pack have completed. Marked packs that are used again are unmarked,
+// unless the used blobs are also stored in an unmarked pack. Packs are not
+// repacked.
+//
+// The snapshots passed to getUsedBlobs must have been listed before loading
+// the index.
+func PlanNonExclusivePrune(ctx context.Context, opts PruneOptions, repo *Repository, getUsedBlobs func(ctx context.Context, repo restic.Repository, usedBlobs restic.FindBlobSet) error, printer restic.Printer) (*PrunePlan, error) {
+	if opts.UnsafeRecovery {
+		return nil, fmt.Errorf("non-exclusive prune is not possible in unsafe recovery mode")
+	}
+	if repo.Connections() < 2 {
+		return nil, fmt.Errorf("prune requires a backend connection limit of at least two")
+	}
+	now := time.Now()
+
+	marked, markFiles, err := loadDeletionMarks(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	usedBlobs := index.NewAssociatedSet[uint8](repo.idx)
+	err = getUsedBlobs(ctx, repo, usedBlobs)
+	if err != nil {
+		return nil, err
+	}
+
+	printer.P("searching used packs...\n")
+	isMarked := func(pb *pack.PackedBlob) bool {
+		_, ok := marked[pb.PackID()]
+		return ok
+	}
+	usedPacks := restic.NewIDSet()
+	missingBlobs := restic.NewBlobSet()
+	for bh := range usedBlobs.Keys() {
+		entries := repo.idx.Lookup(bh)
+		if len(entries) == 0 {
+			missingBlobs.Insert(bh)
+			continue
+		}
+		// copies in marked packs are only required if no other copy exists.
+		// Duplicates in unmarked packs are always kept, as these packs would
+		// otherwise be marked at the same time.
+		onlyMarked := !slices.ContainsFunc(entries, func(pb *pack.PackedBlob) bool { return !isMarked(pb) })
+		for _, pb := range entries {
+			if onlyMarked || !isMarked(pb) {
+				usedPacks.Insert(pb.PackID())
+			}
+		}
+	}
+	if len(missingBlobs) != 0 {
+		printer.E("%v not found in the index\n\n"+
+			"Integrity check failed: Data seems to be missing.\n"+
+			"Will not start prune to prevent (additional) data loss!", missingBlobs)
+		return nil, ErrIndexIncomplete
+	}
+
+	stats := PruneStats{MessageType: "summary"}
+	packSize := make(map[restic.ID]uint64)
+	err = repo.ListBlobs(ctx, func(blob restic.PackBlob) {
+		size := uint64(blob.CiphertextLength())
+		packSize[blob.PackID()] += size
+		stats.Blobs.Total++
+		stats.Size.Total += size
+		if usedBlobs.Has(blob.Handle()) {
+			stats.Blobs.Used++
+			stats.Size.Used += size
+		} else {
+			stats.Blobs.Unused++
+			stats.Size.Unused += size
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// unreferenced packs may also belong to a backup which has not saved its index yet
+	unreferenced := make(map[restic.ID]uint64)
+	err = repo.List(ctx, restic.PackFile, func(id restic.ID, size int64) error {
+		if _, ok := packSize[id]; !ok {
+			unreferenced[id] = uint64(size)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	expired := func(id restic.ID) bool {
+		t, ok := marked[id]
+		return ok && now.Sub(t) >= opts.GracePeriod
+	}
+
+	plan := PrunePlan{
+		removePacksFirst: restic.NewIDSet(),
+		repackPacks:      restic.NewIDSet(),
+		removePacks:      restic.NewIDSet(),
+		ignorePacks:      restic.NewIDSet(),
+		deletionMarks:    make(map[restic.ID]time.Time),
+		markFiles:        markFiles,
+	}
+
+	for id, size := range packSize {
+		switch {
+		case usedPacks.Has(id):
+			stats.Packs.Used++
+		case expired(id):
+			stats.Packs.Unused++
+			plan.removePacks.Insert(id)
+			stats.Size.Remove += size
+		default:
+			stats.Packs.Unused++
+			plan.mark(id, marked, now)
+		}
+	}
+	for id, size := range unreferenced {
+		stats.Size.Unref += size
+		if expired(id) {
+			plan.removePacksFirst.Insert(id)
+		} else {
+			plan.mark(id, marked, now)
+		}
+	}
+
+	stats.Packs.Unref = uint(len(unreferenced))
+	stats.Packs.Total = stats.Packs.Used + stats.Packs.Unused + stats.Packs.Unref
+	stats.Packs.Remove = uint(len(plan.removePacks))
+	stats.Packs.RemoveTotal = stats.Packs.Remove + uint(len(plan.removePacksFirst))
+	stats.Packs.Keep = stats.Packs.Total - stats.Packs.RemoveTotal
+	stats.Packs.Marked = uint(len(plan.deletionMarks))
+	stats.Size.RemoveTotal = stats.Size.Remove
+	for id := range plan.removePacksFirst {
+		stats.Size.RemoveTotal += unreferenced[id]
+	}
+	stats.Size.Total += stats.Size.Unref
+	stats.Size.Remain = stats.Size.Total - stats.Size.RemoveTotal
+
+	plan.repo = repo
+	plan.stats = stats
+	plan.opts = opts
+	return &plan, nil
+}
+
+// mark keeps or adds the deletion mark of an unused pack.
+func (plan *PrunePlan) mark(id restic.ID, marked map[restic.ID]time.Time, now time.Time) {
+	if t, ok := marked[id]; ok {
+		plan.deletionMarks[id] = t
+	} else {
+		plan.deletionMarks[id] = now
+	}
+}
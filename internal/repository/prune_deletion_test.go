@@ -0,0 +1,112 @@
+package repository_test
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func planNonExclusivePrune(t *testing.T, repo *repository.Repository, gracePeriod time.Duration, used restic.BlobSet) *repository.PrunePlan {
+	t.Helper()
+	rtest.OK(t, repo.LoadIndex(context.TODO(), restic.NoopTerminalCounterFactory))
+	opts := repository.PruneOptions{GracePeriod: gracePeriod}
+	plan, err := repository.PlanNonExclusivePrune(context.TODO(), opts, repo, func(ctx context.Context, repo restic.Repository, usedBlobs restic.FindBlobSet) error {
+		for blob := range used {
+			usedBlobs.Insert(blob)
+		}
+		return nil
+	}, restic.NewNoopPrinter())
+	rtest.OK(t, err)
+	return plan
+}
+
+func TestPruneNonExclusive(t *testing.T) {
+	seed := time.Now().UnixNano()
+	random := rand.New(rand.NewSource(seed))
+	t.Logf("rand initialized with seed %d", seed)
+
+	repo, _, be := repository.TestRepositoryWithVersion(t, 0)
+	createRandomBlobs(t, random, repo, 5, 0.5, true)
+	createRandomBlobs(t, random, repo, 5, 0.5, true)
+	createRandomBlobs(t, random, repo, 5, 0.5, true)
+	all := listBlobs(repo)
+	packs := listPacks(t, repo)
+
+	// keep all blobs of one pack
+	keep := restic.NewBlobSet()
+	var keepPack restic.ID
+	rtest.OK(t, repo.ListBlobs(context.TODO(), func(pb restic.PackBlob) {
+		if keepPack.IsNull() {
+			keepPack = pb.PackID()
+		}
+		if pb.PackID() == keepPack {
+			keep.Insert(pb.Handle())
+		}
+	}))
+
+	// the first run only marks the unused packs
+	plan := planNonExclusivePrune(t, repo, time.Hour, keep)
+	rtest.Equals(t, uint(0), plan.Stats().Packs.RemoveTotal)
+	rtest.Equals(t, uint(len(packs)-1), plan.Stats().Packs.Marked)
+	rtest.OK(t, plan.Execute(context.TODO(), restic.NewNoopPrinter()))
+	rtest.Equals(t, packs, listPacks(t, repo))
+
+	// blobs only stored in marked packs are not used for deduplication
+	repo = repository.TestOpenBackend(t, be)
+	rtest.OK(t, repo.LoadIndex(context.TODO(), restic.NoopTerminalCounterFactory))
+	rtest.OK(t, repo.ExcludePendingDeletions(context.TODO()))
+	for blob := range all {
+		_, found := repo.LookupBlobSize(blob)
+		rtest.Equals(t, keep.Has(blob), found)
+	}
+
+	// marked packs are not deleted before the grace period has passed
+	plan = planNonExclusivePrune(t, repo, time.Hour, keep)
+	rtest.Equals(t, uint(0), plan.Stats().Packs.RemoveTotal)
+	rtest.OK(t, plan.Execute(context.TODO(), restic.NewNoopPrinter()))
+
+	// marked packs are deleted once the grace period has passed
+	repo = repository.TestOpenBackend(t, be)
+	plan = planNonExclusivePrune(t, repo, 0, keep)
+	rtest.Equals(t, uint(len(packs)-1), plan.Stats().Packs.RemoveTotal)
+	rtest.Equals(t, uint(0), plan.Stats().Packs.Marked)
+	rtest.OK(t, plan.Execute(context.TODO(), restic.NewNoopPrinter()))
+
+	repo = repository.TestOpenBackend(t, be)
+	repository.TestCheckRepo(t, repo)
+	rtest.Equals(t, restic.NewIDSet(keepPack), listPacks(t, repo))
+	rtest.Assert(t, listBlobs(repo).Equals(keep), "unexpected blobs")
+	rtest.OK(t, repo.List(context.TODO(), restic.DeletionFile, func(id restic.ID, _ int64) error {
+		t.Errorf("unexpected deletion marks %v", id)
+		return nil
+	}))
+}
+
+func TestPruneNonExclusiveUnmark(t *testing.T) {
+	seed := time.Now().UnixNano()
+	random := rand.New(rand.NewSource(seed))
+	t.Logf("rand initialized with seed %d", seed)
+
+	repo, _, be := repository.TestRepositoryWithVersion(t, 0)
+	createRandomBlobs(t, random, repo, 5, 0.5, true)
+	createRandomBlobs(t, random, repo, 5, 0.5, true)
+	packs := listPacks(t, repo)
+	all := listBlobs(repo)
+
+	plan := planNonExclusivePrune(t, repo, 0, restic.NewBlobSet())
+	rtest.Equals(t, uint(len(packs)), plan.Stats().Packs.Marked)
+	rtest.OK(t, plan.Execute(context.TODO(), restic.NewNoopPrinter()))
+
+	// a snapshot created in the meantime uses the marked packs again
+	repo = repository.TestOpenBackend(t, be)
+	plan = planNonExclusivePrune(t, repo, 0, all)
+	rtest.Equals(t, uint(0), plan.Stats().Packs.RemoveTotal)
+	rtest.Equals(t, uint(0), plan.Stats().Packs.Marked)
+	rtest.OK(t, plan.Execute(context.TODO(), restic.NewNoopPrinter()))
+	rtest.Equals(t, packs, listPacks(t, repo))
+}
@@ -0,0 +1,201 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository/index"
+	"github.com/restic/restic/internal/restic"
+)
+
+// ErrPrunePlanOutdated is returned if the repository was modified after a prune plan was exported.
+var ErrPrunePlanOutdated = errors.Fatal("repository was modified since the prune plan was created")
+
+// prunePlanVersion is the version of the ExportedPrunePlan format.
+const prunePlanVersion = 1
+
+// ExportedPrunePlan is the serialized form of a PrunePlan. It allows
+// reviewing a plan before it is executed by a later prune run.
+type ExportedPrunePlan struct {
+	Version int       `json:"version"`
+	Time    time.Time `json:"time"`
+	// Fingerprint identifies the repository, index and snapshots the plan was created for
+	Fingerprint restic.ID  `json:"fingerprint"`
+	Stats       PruneStats `json:"stats"`
+
+	Snapshots restic.IDs `json:"snapshots"`
+	// Keep are the packs which are not modified by the plan
+	Keep restic.IDs `json:"keep"`
+	// Repack are the packs to repack while keeping the blobs in KeepData and KeepTree
+	Repack   restic.IDs `json:"repack"`
+	KeepData restic.IDs `json:"keep_data,omitempty"`
+	KeepTree restic.IDs `json:"keep_tree,omitempty"`
+	// Remove are the packs which are deleted after rewriting the index
+	Remove restic.IDs `json:"remove"`
+	// RemoveUnreferenced are the packs not referenced by the index, which are deleted first
+	RemoveUnreferenced restic.IDs `json:"remove_unreferenced"`
+	// Ignore are the packs which are excluded from the rewritten index
+	Ignore restic.IDs `json:"ignore,omitempty"`
+}
+
+// pruneFingerprint returns a hash of the repository ID, the index files and
+// the snapshots. It changes whenever data is added to or removed from the repository.
+func pruneFingerprint(repo *Repository, snapshots restic.IDs) restic.ID {
+	var buf bytes.Buffer
+	buf.WriteString(repo.Config().ID)
+	buf.WriteString("\nindex\n")
+	for _, id := range repo.idx.IDs().List() {
+		buf.WriteString(id.String() + "\n")
+	}
+	buf.WriteString("snapshots\n")
+	for _, id := range restic.NewIDSet(snapshots...).List() {
+		buf.WriteString(id.String() + "\n")
+	}
+	return restic.Hash(buf.Bytes())
+}
+
+// Export returns the serialized form of the plan. It must be called before
+// the plan is executed.
+func (plan *PrunePlan) Export() (*ExportedPrunePlan, error) {
+	if plan.repo == nil {
+		return nil, fmt.Errorf("prune plan was already executed")
+	}
+	if plan.opts.UnsafeRecovery {
+		return nil, fmt.Errorf("exporting the prune plan is not possible in unsafe recovery mode")
+	}
+	if plan.ledger != nil {
+		return nil, fmt.Errorf("exporting the prune plan is not possible for cold storage")
+	}
+
+	modified := restic.NewIDSet()
+	modified.Merge(plan.repackPacks)
+	modified.Merge(plan.removePacks)
+	modified.Merge(plan.ignorePacks)
+
+	state := plan.newPruneState()
+	return &ExportedPrunePlan{
+		Version:     prunePlanVersion,
+		Time:        time.Now(),
+		Fingerprint: pruneFingerprint(plan.repo, plan.snapshots),
+		Stats:       plan.stats,
+
+		Snapshots:          plan.snapshots,
+		Keep:               plan.repo.idx.Packs(modified).List(),
+		Repack:             state.Repack,
+		KeepData:           state.KeepData,
+		KeepTree:           state.KeepTree,
+		Remove:             plan.removePacks.List(),
+		RemoveUnreferenced: plan.removePacksFirst.List(),
+		Ignore:             plan.ignorePacks.List(),
+	}, nil
+}
+
+// ImportPrunePlan returns a plan which executes the exported plan. The index
+// must be loaded. If the repository was modified since the plan was created,
+// ErrPrunePlanOutdated is returned. As the plan may have been edited, it is
+// rejected unless it assigns each indexed pack to exactly one of the lists and
+// all blobs to keep are stored in packs which are kept or repacked.
+func ImportPrunePlan(ctx context.Context, opts PruneOptions, repo *Repository, exported *ExportedPrunePlan) (*PrunePlan, error) {
+	if opts.UnsafeRecovery {
+		return nil, fmt.Errorf("importing a prune plan is not possible in unsafe recovery mode")
+	}
+	if repo.Connections() < 2 {
+		return nil, fmt.Errorf("prune requires a backend connection limit of at least two")
+	}
+	if exported.Version != prunePlanVersion {
+		return nil, fmt.Errorf("unsupported prune plan version %d", exported.Version)
+	}
+
+	var snapshots restic.IDs
+	err := repo.List(ctx, restic.SnapshotFile, func(id restic.ID, _ int64) error {
+		snapshots = append(snapshots, id)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if pruneFingerprint(repo, snapshots) != exported.Fingerprint {
+		return nil, ErrPrunePlanOutdated
+	}
+	if err := validatePrunePlan(repo, exported); err != nil {
+		return nil, fmt.Errorf("invalid prune plan: %w", err)
+	}
+
+	var keepBlobs *index.AssociatedSet[uint8]
+	if len(exported.Repack) != 0 {
+		keepBlobs = index.NewAssociatedSet[uint8](repo.idx)
+		for _, id := range exported.KeepData {
+			keepBlobs.Insert(restic.BlobHandle{ID: id, Type: restic.DataBlob})
+		}
+		for _, id := range exported.KeepTree {
+			keepBlobs.Insert(restic.BlobHandle{ID: id, Type: restic.TreeBlob})
+		}
+	}
+
+	return &PrunePlan{
+		removePacksFirst: restic.NewIDSet(exported.RemoveUnreferenced...),
+		repackPacks:      restic.NewIDSet(exported.Repack...),
+		keepBlobs:        keepBlobs,
+		removePacks:      restic.NewIDSet(exported.Remove...),
+		ignorePacks:      restic.NewIDSet(exported.Ignore...),
+		snapshots:        snapshots,
+
+		repo:  repo,
+		stats: exported.Stats,
+		opts:  opts,
+	}, nil
+}
+
+// validatePrunePlan checks that the lists of the exported plan are consistent
+// with the index.
+func validatePrunePlan(repo *Repository, exported *ExportedPrunePlan) error {
+	indexed := repo.idx.Packs(restic.NewIDSet())
+
+	listed := restic.NewIDSet()
+	for _, list := range []restic.IDs{exported.Keep, exported.Repack, exported.Remove, exported.Ignore} {
+		for _, id := range list {
+			if !indexed.Has(id) {
+				return fmt.Errorf("pack %v is not contained in the index", id.Str())
+			}
+			if listed.Has(id) {
+				return fmt.Errorf("pack %v is listed more than once", id.Str())
+			}
+			listed.Insert(id)
+		}
+	}
+	if len(listed) != len(indexed) {
+		return fmt.Errorf("%d indexed packs are missing from the plan", len(indexed.Sub(listed)))
+	}
+
+	for _, id := range exported.RemoveUnreferenced {
+		if indexed.Has(id) {
+			return fmt.Errorf("unreferenced pack %v is contained in the index", id.Str())
+		}
+	}
+
+	// blobs to keep must not be lost by removing the packs which store them
+	kept := restic.NewIDSet(exported.Keep...)
+	kept.Merge(restic.NewIDSet(exported.Repack...))
+	for _, blobs := range []struct {
+		tpe restic.BlobType
+		ids restic.IDs
+	}{
+		{restic.DataBlob, exported.KeepData},
+		{restic.TreeBlob, exported.KeepTree},
+	} {
+		for _, id := range blobs.ids {
+			bh := restic.BlobHandle{ID: id, Type: blobs.tpe}
+			found := false
+			for _, pb := range repo.idx.Lookup(bh) {
+				found = found || kept.Has(pb.PackID())
+			}
+			if !found {
+				return fmt.Errorf("blob %v is not stored in a pack which is kept or repacked", bh)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package repository_test
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func exportTestPrunePlan(t *testing.T) (*repository.Repository, backend.Backend, *repository.ExportedPrunePlan, restic.BlobSet) {
+	random := rand.New(rand.NewSource(23))
+
+	repo, _, be := repository.TestRepositoryWithVersion(t, 0)
+	createRandomBlobs(t, random, repo, 20, 0.5, true)
+	createRandomBlobs(t, random, repo, 20, 0.5, true)
+	keep := selectEveryOtherBlob(t, repo)
+
+	opts := repository.PruneOptions{
+		MaxRepackBytes: math.MaxUint64,
+		MaxUnusedBytes: func(used uint64) (unused uint64) { return 0 },
+	}
+	plan, err := repository.PlanPrune(context.TODO(), opts, repo, func(ctx context.Context, repo restic.Repository, usedBlobs restic.FindBlobSet) error {
+		for blob := range keep {
+			usedBlobs.Insert(blob)
+		}
+		return nil
+	}, restic.NewNoopPrinter())
+	rtest.OK(t, err)
+
+	exported, err := plan.Export()
+	rtest.OK(t, err)
+	rtest.Equals(t, plan.Stats(), exported.Stats)
+	rtest.Assert(t, len(exported.Repack) > 0, "expected packs to repack")
+
+	// the plan must survive a round trip through JSON
+	buf, err := json.Marshal(exported)
+	rtest.OK(t, err)
+	var loaded repository.ExportedPrunePlan
+	rtest.OK(t, json.Unmarshal(buf, &loaded))
+
+	return repo, be, &loaded, keep
+}
+
+func TestPrunePlanImport(t *testing.T) {
+	repo, be, exported, keep := exportTestPrunePlan(t)
+
+	plan, err := repository.ImportPrunePlan(context.TODO(), repository.PruneOptions{}, repo, exported)
+	rtest.OK(t, err)
+	rtest.OK(t, plan.Execute(context.TODO(), restic.NewNoopPrinter()))
+
+	repo = repository.TestOpenBackend(t, be)
+	repository.TestCheckRepo(t, repo)
+
+	existing := listBlobs(repo)
+	rtest.Assert(t, existing.Equals(keep), "unexpected blobs, wanted %v got %v", keep, existing)
+}
+
+func TestPrunePlanImportOutdated(t *testing.T) {
+	repo, _, exported, _ := exportTestPrunePlan(t)
+
+	// adding data creates a new index file
+	createRandomBlobs(t, rand.New(rand.NewSource(0)), repo, 1, 0.5, true)
+
+	_, err := repository.ImportPrunePlan(context.TODO(), repository.PruneOptions{}, repo, exported)
+	rtest.Equals(t, repository.ErrPrunePlanOutdated, err)
+}
+
+func TestPrunePlanImportInvalid(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		modify func(plan *repository.ExportedPrunePlan)
+	}{
+		{"unknown pack", func(plan *repository.ExportedPrunePlan) {
+			plan.Remove = append(plan.Remove, restic.NewRandomID())
+		}},
+		{"duplicate pack", func(plan *repository.ExportedPrunePlan) {
+			plan.Remove = append(plan.Remove, plan.Repack[0])
+		}},
+		{"missing pack", func(plan *repository.ExportedPrunePlan) {
+			plan.Repack = plan.Repack[1:]
+		}},
+		{"indexed unreferenced pack", func(plan *repository.ExportedPrunePlan) {
+			plan.RemoveUnreferenced = append(plan.RemoveUnreferenced, plan.Repack[0])
+		}},
+		{"removed used pack", func(plan *repository.ExportedPrunePlan) {
+			plan.Remove = append(plan.Remove, plan.Repack...)
+			plan.Repack = nil
+		}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			repo, _, exported, _ := exportTestPrunePlan(t)
+			test.modify(exported)
+
+			_, err := repository.ImportPrunePlan(context.TODO(), repository.PruneOptions{}, repo, exported)
+			rtest.Assert(t, err != nil && strings.Contains(err.Error(), "invalid prune plan"), "unexpected error %v", err)
+		})
+	}
+}
@@ -89,3 +89,36 @@ func TestPruneMaxUnusedDuplicate(t *testing.T) {
 	rtest.Equals(t, rsize.Unref, uint64(0))
 	rtest.Equals(t, rsize.Uncompressed, uint64(0))
 }
+
+func TestColdStorageLedgerCost(t *testing.T) {
+	now := time.Now()
+	var id restic.ID
+	id[0] = 1
+	costs := ColdStorageCosts{RetrievalPerGB: 1, StoragePerGBMonth: 1}
+	p := packInfo{unusedBlobs: 1, unusedSize: gigabyte, usedBlobs: 1, usedSize: gigabyte}
+
+	for _, test := range []struct {
+		elapsed time.Duration
+		warmup  bool
+	}{
+		{month, false},
+		{3 * month, true},
+	} {
+		l := &coldStorageLedger{
+			costs:   costs,
+			now:     now,
+			entries: map[restic.ID]ledgerEntry{id: {ID: id, Updated: now.Add(-test.elapsed), Unused: gigabyte}},
+			next:    make(map[restic.ID]ledgerEntry),
+			warmup:  restic.NewIDSet(),
+		}
+		// the warmup is requested before repacking
+		rtest.Assert(t, !l.repackJustified(id, p, 2*gigabyte), "unexpected repack after %v", test.elapsed)
+		rtest.Equals(t, test.warmup, l.warmup.Has(id))
+		rtest.Equals(t, now, l.next[id].Updated)
+
+		rtest.OK(t, l.startWarmup(context.TODO(), TestRepository(t)))
+		l.entries = l.next
+		l.next = make(map[restic.ID]ledgerEntry)
+		rtest.Equals(t, test.warmup, l.repackJustified(id, p, 2*gigabyte))
+	}
+}
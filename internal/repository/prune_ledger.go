@@ -0,0 +1,162 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/restic"
+)
+
+// ColdStorageCosts describes the costs of a storage class for which reading
+// data requires a slow and costly warmup, for example Amazon S3 Glacier.
+type ColdStorageCosts struct {
+	// RetrievalPerGB is the cost to warm up and download one GB
+	RetrievalPerGB float64
+	// StoragePerGBMonth is the cost to store one GB for one month
+	StoragePerGBMonth float64
+}
+
+const (
+	gigabyte = 1 << 30
+	month    = 30 * 24 * time.Hour
+)
+
+// pruneLedger lists the partly used data packs of a repository on cold
+// storage along with the storage cost caused by their unused data so far.
+type pruneLedger struct {
+	Packs []ledgerEntry `json:"packs"`
+}
+
+// ledgerEntry tracks the unused data of a single pack.
+type ledgerEntry struct {
+	ID      restic.ID `json:"id"`
+	Updated time.Time `json:"updated"`
+	// Unused is the number of unused bytes at the time of the last update
+	Unused uint64 `json:"unused"`
+	// Cost is the accumulated cost of storing the unused bytes
+	Cost float64 `json:"cost"`
+	// WarmupStarted is the time at which the warmup of the pack was requested
+	WarmupStarted time.Time `json:"warmup_started,omitzero"`
+}
+
+// coldStorageLedger decides when to repack partly used data packs on cold
+// storage. A pack is only repacked once the storage cost of its unused data
+// exceeds the cost of retrieving the whole pack. As warming up a pack can take
+// hours, the warmup is requested by one prune run and the pack is repacked by
+// the next run.
+type coldStorageLedger struct {
+	costs ColdStorageCosts
+	now   time.Time
+
+	entries map[restic.ID]ledgerEntry
+	files   restic.IDs // files containing the loaded ledger
+
+	next   map[restic.ID]ledgerEntry // entries to save
+	warmup restic.IDSet              // packs for which to request a warmup
+}
+
+// loadColdStorageLedger loads the ledger saved by previous prune runs.
+func loadColdStorageLedger(ctx context.Context, repo restic.ListerLoaderUnpacked, costs ColdStorageCosts, now time.Time) (*coldStorageLedger, error) {
+	l := &coldStorageLedger{
+		costs:   costs,
+		now:     now,
+		entries: make(map[restic.ID]ledgerEntry),
+		next:    make(map[restic.ID]ledgerEntry),
+		warmup:  restic.NewIDSet(),
+	}
+	err := repo.List(ctx, restic.LedgerFile, func(id restic.ID, _ int64) error {
+		var ledger pruneLedger
+		err := restic.LoadJSONUnpacked(ctx, repo, restic.LedgerFile, id, &ledger)
+		if err != nil {
+			return fmt.Errorf("failed to load prune ledger %v: %w", id.Str(), err)
+		}
+		l.files = append(l.files, id)
+		for _, e := range ledger.Packs {
+			// keep the most recent entry if a pack is listed several times
+			if old, ok := l.entries[e.ID]; !ok || e.Updated.After(old.Updated) {
+				l.entries[e.ID] = e
+			}
+		}
+		return nil
+	})
+	return l, err
+}
+
+// repackJustified updates the ledger entry of a data pack and returns whether
+// the pack should be repacked now. Once the storage cost of the unused data
+// exceeds the retrieval cost, a warmup is requested and the pack is repacked
+// by the next prune run.
+func (l *coldStorageLedger) repackJustified(id restic.ID, p packInfo, packSize uint64) bool {
+	if p.unusedBlobs == 0 {
+		// there is no unused data that would cause costs
+		return false
+	}
+
+	e, ok := l.entries[id]
+	if ok {
+		if elapsed := l.now.Sub(e.Updated); elapsed > 0 {
+			e.Cost += float64(e.Unused) / gigabyte * float64(elapsed) / float64(month) * l.costs.StoragePerGBMonth
+		}
+	} else {
+		e = ledgerEntry{ID: id}
+	}
+	e.Updated = l.now
+	e.Unused = p.unusedSize
+	l.next[id] = e
+
+	if !e.WarmupStarted.IsZero() {
+		return true
+	}
+	if e.Cost >= float64(packSize)/gigabyte*l.costs.RetrievalPerGB {
+		debug.Log("pack %v: storage cost %v of unused data justifies repacking", id.Str(), e.Cost)
+		l.warmup.Insert(id)
+	}
+	return false
+}
+
+// startWarmup requests the warmup of the packs selected by repackJustified.
+func (l *coldStorageLedger) startWarmup(ctx context.Context, repo *Repository) error {
+	if len(l.warmup) == 0 {
+		return nil
+	}
+	job, err := repo.StartWarmup(ctx, l.warmup)
+	if err != nil {
+		return err
+	}
+	debug.Log("warmup requested for %d packs, %d are warming up", len(l.warmup), job.HandleCount())
+	for id := range l.warmup {
+		e := l.next[id]
+		e.WarmupStarted = l.now
+		l.next[id] = e
+	}
+	return nil
+}
+
+// save stores the ledger without the given removed packs and deletes the
+// previous ledger files.
+func (l *coldStorageLedger) save(ctx context.Context, repo *Repository, removed restic.IDSet, printer restic.Printer) error {
+	var ledger pruneLedger
+	for id, e := range l.next {
+		if !removed.Has(id) {
+			ledger.Packs = append(ledger.Packs, e)
+		}
+	}
+
+	if len(ledger.Packs) != 0 {
+		slices.SortFunc(ledger.Packs, func(a, b ledgerEntry) int { return bytes.Compare(a.ID[:], b.ID[:]) })
+		id, err := restic.SaveJSONUnpacked(ctx, &internalRepository{repo}, restic.LedgerFile, &ledger)
+		if err != nil {
+			return fmt.Errorf("failed to save prune ledger: %w", err)
+		}
+		debug.Log("saved prune ledger %v for %d packs", id.Str(), len(ledger.Packs))
+	}
+
+	if len(l.files) == 0 {
+		return nil
+	}
+	return deleteFiles(ctx, false, &internalRepository{repo}, restic.NewIDSet(l.files...), restic.LedgerFile, printer)
+}
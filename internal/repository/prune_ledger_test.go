@@ -0,0 +1,80 @@
+package repository_test
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func planColdStoragePrune(t *testing.T, repo *repository.Repository, costs repository.ColdStorageCosts, used restic.BlobSet) *repository.PrunePlan {
+	t.Helper()
+	rtest.OK(t, repo.LoadIndex(context.TODO(), restic.NoopTerminalCounterFactory))
+	opts := repository.PruneOptions{
+		MaxRepackBytes: math.MaxUint64,
+		MaxUnusedBytes: func(used uint64) (unused uint64) { return 0 },
+		ColdStorage:    &costs,
+	}
+	plan, err := repository.PlanPrune(context.TODO(), opts, repo, func(ctx context.Context, repo restic.Repository, usedBlobs restic.FindBlobSet) error {
+		for blob := range used {
+			usedBlobs.Insert(blob)
+		}
+		return nil
+	}, restic.NewNoopPrinter())
+	rtest.OK(t, err)
+	return plan
+}
+
+func countLedgerFiles(t *testing.T, repo *repository.Repository) int {
+	count := 0
+	rtest.OK(t, repo.List(context.TODO(), restic.LedgerFile, func(restic.ID, int64) error {
+		count++
+		return nil
+	}))
+	return count
+}
+
+func TestPruneColdStorage(t *testing.T) {
+	seed := time.Now().UnixNano()
+	random := rand.New(rand.NewSource(seed))
+	t.Logf("rand initialized with seed %d", seed)
+
+	repo, _, be := repository.TestRepositoryWithVersion(t, 0)
+	// enough blobs to make partly used data packs very likely
+	createRandomBlobs(t, random, repo, 20, 0.5, true)
+	createRandomBlobs(t, random, repo, 20, 0.5, true)
+	keep, _ := selectBlobs(t, random, repo, 0.5)
+
+	// repacking is not justified if retrieving data is expensive
+	plan := planColdStoragePrune(t, repo, repository.ColdStorageCosts{RetrievalPerGB: 1}, keep)
+	rtest.Equals(t, uint(0), plan.Stats().Packs.Warmup)
+	rtest.OK(t, plan.Execute(context.TODO(), restic.NewNoopPrinter()))
+	rtest.Equals(t, 1, countLedgerFiles(t, repo))
+
+	// without retrieval costs, the warmup is requested immediately
+	repo = repository.TestOpenBackend(t, be)
+	plan = planColdStoragePrune(t, repo, repository.ColdStorageCosts{}, keep)
+	warmup := plan.Stats().Packs.Warmup
+	rtest.Assert(t, warmup > 0, "expected packs to warm up")
+	rtest.Equals(t, uint(0), plan.Stats().Packs.Repack)
+	rtest.OK(t, plan.Execute(context.TODO(), restic.NewNoopPrinter()))
+	rtest.Equals(t, 1, countLedgerFiles(t, repo))
+
+	// the next run repacks the warmed up packs
+	repo = repository.TestOpenBackend(t, be)
+	plan = planColdStoragePrune(t, repo, repository.ColdStorageCosts{}, keep)
+	rtest.Equals(t, uint(0), plan.Stats().Packs.Warmup)
+	rtest.Equals(t, warmup, plan.Stats().Packs.Repack)
+	rtest.OK(t, plan.Execute(context.TODO(), restic.NewNoopPrinter()))
+	rtest.Equals(t, 0, countLedgerFiles(t, repo))
+
+	repo = repository.TestOpenBackend(t, be)
+	repository.TestCheckRepo(t, repo)
+	existing := listBlobs(repo)
+	rtest.Assert(t, existing.Equals(keep), "unexpected blobs, wanted %v got %v", keep, existing)
+}
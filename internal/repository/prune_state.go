@@ -0,0 +1,232 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/repository/index"
+	"github.com/restic/restic/internal/repository/pack"
+	"github.com/restic/restic/internal/restic"
+)
+
+// PruneState is the remaining work of a prune run which was stopped after
+// reaching its maximum duration. All packs which are still referenced by the
+// index and must be deleted are contained in Repack, such that backups can
+// run before the prune is resumed.
+type PruneState struct {
+	Time time.Time `json:"time"`
+	// Snapshots are the snapshots which were considered when planning the prune
+	Snapshots restic.IDs `json:"snapshots"`
+	// Repack are the packs which still have to be repacked
+	Repack restic.IDs `json:"repack,omitempty"`
+	// KeepData and KeepTree are the blobs from Repack which must be kept
+	KeepData restic.IDs `json:"keep_data,omitempty"`
+	KeepTree restic.IDs `json:"keep_tree,omitempty"`
+	// Remove are the packs which are no longer referenced by the index but
+	// have not been deleted yet
+	Remove restic.IDs `json:"remove,omitempty"`
+
+	id restic.ID
+}
+
+// ID returns the ID of the prune state.
+func (s *PruneState) ID() restic.ID {
+	return s.id
+}
+
+// LoadPruneState returns the most recent prune state or nil if there is none.
+func LoadPruneState(ctx context.Context, repo *Repository) (*PruneState, error) {
+	var latest *PruneState
+	err := repo.List(ctx, restic.PruneFile, func(id restic.ID, _ int64) error {
+		state := &PruneState{id: id}
+		err := restic.LoadJSONUnpacked(ctx, repo, restic.PruneFile, id, state)
+		if err != nil {
+			return fmt.Errorf("failed to load prune state %v: %w", id.Str(), err)
+		}
+		if latest == nil || state.Time.After(latest.Time) {
+			latest = state
+		}
+		return nil
+	})
+	return latest, err
+}
+
+// removePruneStates removes all prune states except keep.
+func removePruneStates(ctx context.Context, repo *Repository, keep restic.ID, printer restic.Printer) error {
+	ids := restic.NewIDSet()
+	err := repo.List(ctx, restic.PruneFile, func(id restic.ID, _ int64) error {
+		if id != keep {
+			ids.Insert(id)
+		}
+		return nil
+	})
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+	return deleteFiles(ctx, false, &internalRepository{repo}, ids, restic.PruneFile, printer)
+}
+
+// ResumePrune creates a plan which continues the prune run recorded in state.
+// getUsedBlobs must return the blobs used by all snapshots not contained in
+// state.Snapshots, which may have been created since the prune run was stopped.
+func ResumePrune(ctx context.Context, opts PruneOptions, repo *Repository, state *PruneState, getUsedBlobs func(ctx context.Context, repo restic.Repository, usedBlobs restic.FindBlobSet) error, printer restic.Printer) (*PrunePlan, error) {
+	if opts.UnsafeRecovery {
+		return nil, fmt.Errorf("resuming prune is not possible in unsafe recovery mode")
+	}
+	if repo.Connections() < 2 {
+		return nil, fmt.Errorf("prune requires a backend connection limit of at least two")
+	}
+
+	// packs may have been removed by another prune run in the meantime
+	indexPacks := repo.idx.Packs(restic.NewIDSet())
+	repackPacks := restic.NewIDSet()
+	for _, id := range state.Repack {
+		if indexPacks.Has(id) {
+			repackPacks.Insert(id)
+		} else {
+			debug.Log("pack %v to repack is no longer part of the index", id.Str())
+		}
+	}
+
+	removePacks := restic.NewIDSet()
+	if len(state.Remove) != 0 {
+		remove := restic.NewIDSet(state.Remove...)
+		err := repo.List(ctx, restic.PackFile, func(id restic.ID, _ int64) error {
+			if remove.Has(id) && !indexPacks.Has(id) {
+				removePacks.Insert(id)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	keepBlobs := index.NewAssociatedSet[uint8](repo.idx)
+	for _, id := range state.KeepData {
+		keepBlobs.Insert(restic.BlobHandle{ID: id, Type: restic.DataBlob})
+	}
+	for _, id := range state.KeepTree {
+		keepBlobs.Insert(restic.BlobHandle{ID: id, Type: restic.TreeBlob})
+	}
+
+	// blobs used by new snapshots must be kept if they are only stored in packs to repack
+	usedBlobs := index.NewAssociatedSet[uint8](repo.idx)
+	snapshots := &snapshotRecorder{Repository: repo}
+	err := getUsedBlobs(ctx, snapshots, usedBlobs)
+	if err != nil {
+		return nil, err
+	}
+	missingBlobs := restic.NewBlobSet()
+	for bh := range usedBlobs.Keys() {
+		entries := repo.idx.Lookup(bh)
+		if len(entries) == 0 {
+			missingBlobs.Insert(bh)
+			continue
+		}
+		if !slices.ContainsFunc(entries, func(pb *pack.PackedBlob) bool { return !repackPacks.Has(pb.PackID()) }) {
+			keepBlobs.Insert(bh)
+		}
+	}
+	if len(missingBlobs) != 0 {
+		printer.E("%v not found in the index\n\n"+
+			"Integrity check failed: Data seems to be missing.\n"+
+			"Will not resume prune to prevent (additional) data loss!", missingBlobs)
+		return nil, ErrIndexIncomplete
+	}
+
+	// only keep blobs which are still contained in the remaining packs
+	stillContained := index.NewAssociatedSet[uint8](repo.idx)
+	err = repo.ListBlobs(ctx, func(blob restic.PackBlob) {
+		if repackPacks.Has(blob.PackID()) && keepBlobs.Has(blob.Handle()) {
+			stillContained.Insert(blob.Handle())
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	keepBlobs = stillContained
+
+	stats := PruneStats{MessageType: "summary"}
+	stats.Blobs.Repack = uint(keepBlobs.Len())
+	stats.Packs.Unref = uint(len(removePacks))
+	stats.Packs.Repack = uint(len(repackPacks))
+	stats.Packs.RemoveTotal = stats.Packs.Unref
+
+	return &PrunePlan{
+		removePacksFirst: removePacks,
+		repackPacks:      repackPacks,
+		keepBlobs:        keepBlobs,
+		removePacks:      restic.NewIDSet(),
+		ignorePacks:      restic.NewIDSet(),
+		snapshots:        snapshots.ids,
+		resumed:          &state.id,
+
+		repo:  repo,
+		stats: stats,
+		opts:  opts,
+	}, nil
+}
+
+// snapshotRecorder records the snapshots listed by getUsedBlobs. This avoids
+// listing the snapshots a second time, which can be inconsistent for
+// eventually consistent backends.
+type snapshotRecorder struct {
+	restic.Repository
+	ids restic.IDs
+}
+
+func (r *snapshotRecorder) List(ctx context.Context, t restic.FileType, fn func(restic.ID, int64) error) error {
+	if t != restic.SnapshotFile {
+		return r.Repository.List(ctx, t, fn)
+	}
+	r.ids = nil
+	return r.Repository.List(ctx, t, func(id restic.ID, size int64) error {
+		r.ids = append(r.ids, id)
+		return fn(id, size)
+	})
+}
+
+// newPruneState returns the packs which still have to be repacked together
+// with the blobs to keep. It must be called before the index is modified.
+func (plan *PrunePlan) newPruneState() *PruneState {
+	state := &PruneState{
+		Snapshots: plan.snapshots,
+		Repack:    plan.repackPacks.List(),
+	}
+	if len(plan.repackPacks) != 0 {
+		for bh := range plan.keepBlobs.Keys() {
+			if bh.Type == restic.TreeBlob {
+				state.KeepTree = append(state.KeepTree, bh.ID)
+			} else {
+				state.KeepData = append(state.KeepData, bh.ID)
+			}
+		}
+	}
+	return state
+}
+
+// savePruneState stores state if work remains and removes the older prune
+// states. A resumed prune run only removes the state it has continued, as
+// only a single state exists after each prune run.
+func (plan *PrunePlan) savePruneState(ctx context.Context, repo *Repository, state *PruneState, printer restic.Printer) error {
+	var id restic.ID
+	if len(state.Repack) != 0 || len(state.Remove) != 0 {
+		state.Time = time.Now()
+
+		var err error
+		id, err = restic.SaveJSONUnpacked(ctx, &internalRepository{repo}, restic.PruneFile, state)
+		if err != nil {
+			return fmt.Errorf("failed to save prune state: %w", err)
+		}
+		debug.Log("saved prune state %v", id.Str())
+	}
+
+	if plan.resumed != nil {
+		return deleteFiles(ctx, false, &internalRepository{repo}, restic.NewIDSet(*plan.resumed), restic.PruneFile, printer)
+	}
+	return removePruneStates(ctx, repo, id, printer)
+}
@@ -191,3 +191,75 @@ func TestPruneSmall(t *testing.T) {
 	rtest.Equals(t, lenPackfilesBefore > lenPackfilesAfter, true,
 		fmt.Sprintf("the number packfiles before %d and after repack %d", lenPackfilesBefore, lenPackfilesAfter))
 }
+
+// selectEveryOtherBlob returns every other blob of each pack, such that packs
+// with several blobs are partly used.
+func selectEveryOtherBlob(t *testing.T, repo restic.Repository) restic.BlobSet {
+	keep := restic.NewBlobSet()
+	rtest.OK(t, repo.List(context.TODO(), restic.PackFile, func(id restic.ID, size int64) error {
+		handles, err := repo.ListPackHandles(context.TODO(), id, size)
+		for i, h := range handles {
+			if i%2 == 0 {
+				keep.Insert(h)
+			}
+		}
+		return err
+	}))
+	return keep
+}
+
+func TestPruneResume(t *testing.T) {
+	random := rand.New(rand.NewSource(23))
+
+	repo, _, be := repository.TestRepositoryWithVersion(t, 0)
+	createRandomBlobs(t, random, repo, 20, 0.5, true)
+	createRandomBlobs(t, random, repo, 20, 0.5, true)
+
+	keep := selectEveryOtherBlob(t, repo)
+
+	opts := repository.PruneOptions{
+		MaxRepackBytes: math.MaxUint64,
+		MaxUnusedBytes: func(used uint64) (unused uint64) { return 0 },
+		// the deadline has already passed, thus nothing is repacked
+		Deadline: time.Now(),
+	}
+	plan, err := repository.PlanPrune(context.TODO(), opts, repo, func(ctx context.Context, repo restic.Repository, usedBlobs restic.FindBlobSet) error {
+		for blob := range keep {
+			usedBlobs.Insert(blob)
+		}
+		return nil
+	}, restic.NewNoopPrinter())
+	rtest.OK(t, err)
+	rtest.Assert(t, plan.Stats().Packs.Repack > 0, "expected packs to repack")
+	rtest.OK(t, plan.Execute(context.TODO(), restic.NewNoopPrinter()))
+
+	// all used blobs must still be available after stopping. The check is
+	// skipped as the unreferenced packs which were not deleted yet are reported.
+	repo = repository.TestOpenBackend(t, be)
+	rtest.OK(t, repo.LoadIndex(context.TODO(), restic.NoopTerminalCounterFactory))
+	for blob := range keep {
+		_, err := repo.LoadBlob(context.TODO(), blob, nil)
+		rtest.OK(t, err)
+	}
+
+	state, err := repository.LoadPruneState(context.TODO(), repo)
+	rtest.OK(t, err)
+	rtest.Assert(t, state != nil, "prune state not found")
+	rtest.Equals(t, int(plan.Stats().Packs.Repack), len(state.Repack))
+
+	opts.Deadline = time.Time{}
+	plan, err = repository.ResumePrune(context.TODO(), opts, repo, state, func(ctx context.Context, repo restic.Repository, usedBlobs restic.FindBlobSet) error {
+		return nil
+	}, restic.NewNoopPrinter())
+	rtest.OK(t, err)
+	rtest.OK(t, plan.Execute(context.TODO(), restic.NewNoopPrinter()))
+
+	repo = repository.TestOpenBackend(t, be)
+	repository.TestCheckRepo(t, repo)
+
+	existing := listBlobs(repo)
+	rtest.Assert(t, existing.Equals(keep), "unexpected blobs, wanted %v got %v", keep, existing)
+	state, err = repository.LoadPruneState(context.TODO(), repo)
+	rtest.OK(t, err)
+	rtest.Assert(t, state == nil, "prune state was not removed")
+}
@@ -670,6 +670,33 @@ func (r *Repository) flushPackUploader(ctx context.Context) error {
 	return err
 }
 
+// FlushIndex saves the index entries for all pack files uploaded so far. It
+// can be called while blobs are being saved and allows later operations to
+// use the uploaded data even if the current operation is interrupted.
+func (r *Repository) FlushIndex(ctx context.Context) error {
+	return r.idx.Flush(ctx, &internalRepository{r})
+}
+
+// FlushPacks uploads all pending packs and saves the index entries for all
+// pack files uploaded so far. Afterwards, all blobs which were saved before
+// calling FlushPacks are stored in the repository. It can be called while
+// blobs are being saved.
+func (r *Repository) FlushPacks(ctx context.Context) error {
+	if r.packerWg != nil {
+		if err := r.treePM.Flush(ctx); err != nil {
+			return err
+		}
+		if err := r.dataPM.Flush(ctx); err != nil {
+			return err
+		}
+		if err := r.uploader.Wait(ctx); err != nil {
+			return err
+		}
+	}
+
+	return r.FlushIndex(ctx)
+}
+
 func (r *Repository) Connections() uint {
 	return r.be.Properties().Connections
 }
@@ -445,6 +445,29 @@ func testRepositoryIncrementalIndex(t *testing.T, version uint) {
 	}
 }
 
+func TestFlushPacks(t *testing.T) {
+	repo, _, _ := repository.TestRepositoryWithVersion(t, 0)
+	data := rtest.Random(23, 1<<15)
+
+	rtest.OK(t, repo.WithBlobUploader(context.TODO(), func(ctx context.Context, uploader restic.BlobSaverWithAsync) error {
+		id, _, _, err := uploader.SaveBlob(ctx, restic.DataBlob, data, restic.ID{}, false)
+		rtest.OK(t, err)
+		rtest.OK(t, repo.FlushPacks(ctx))
+
+		// the blob must be stored in the repository before the upload has finished
+		found := false
+		rtest.OK(t, repo.List(ctx, restic.IndexFile, func(indexID restic.ID, _ int64) error {
+			idx, err := loadIndex(ctx, repo, indexID)
+			rtest.OK(t, err)
+			_, ok := idx.LookupSize(restic.BlobHandle{Type: restic.DataBlob, ID: id})
+			found = found || ok
+			return nil
+		}))
+		rtest.Assert(t, found, "blob %v not found in saved index", id.Str())
+		return nil
+	}))
+}
+
 func TestInvalidCompression(t *testing.T) {
 	var comp repository.CompressionMode
 	err := comp.Set("nope")
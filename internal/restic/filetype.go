@@ -12,6 +12,13 @@ const (
 	SnapshotFile
 	IndexFile
 	ConfigFile
+	ParityFile
+	ResumeFile
+	PruneFile
+	DeletionFile
+	LedgerFile
+	CopyFile
+	SyncFile
 )
 
 // Keep in sync with backend.FileType.String().
@@ -31,6 +38,20 @@ func (t FileType) String() string {
 		s = "index"
 	case ConfigFile:
 		s = "config"
+	case ParityFile:
+		s = "parity"
+	case ResumeFile:
+		s = "resume"
+	case PruneFile:
+		s = "prune"
+	case DeletionFile:
+		s = "deletion"
+	case LedgerFile:
+		s = "ledger"
+	case CopyFile:
+		s = "copy"
+	case SyncFile:
+		s = "sync"
 	}
 	return s
 }
@@ -41,12 +62,24 @@ type WriteableFileType FileType
 const (
 	// WriteableSnapshotFile is the WriteableFileType for snapshots.
 	WriteableSnapshotFile = WriteableFileType(SnapshotFile)
+	// WriteableResumeFile is the WriteableFileType for the resume state of interrupted backups.
+	WriteableResumeFile = WriteableFileType(ResumeFile)
+	// WriteableCopyFile is the WriteableFileType for the resume state of interrupted copies.
+	WriteableCopyFile = WriteableFileType(CopyFile)
+	// WriteableSyncFile is the WriteableFileType for the state of synchronized repositories.
+	WriteableSyncFile = WriteableFileType(SyncFile)
 )
 
 func (w *WriteableFileType) ToFileType() FileType {
 	switch *w {
 	case WriteableSnapshotFile:
 		return SnapshotFile
+	case WriteableResumeFile:
+		return ResumeFile
+	case WriteableCopyFile:
+		return CopyFile
+	case WriteableSyncFile:
+		return SyncFile
 	default:
 		panic("invalid WriteableFileType")
 	}
@@ -38,6 +38,10 @@ type Repository interface {
 	// the workers are stopped and the index is written to the repository. The callback must use
 	// the passed context and must not keep references to any of its parameters after returning.
 	WithBlobUploader(ctx context.Context, fn func(ctx context.Context, uploader BlobSaverWithAsync) error) error
+	// FlushIndex saves the index entries for all pack files uploaded so far.
+	FlushIndex(ctx context.Context) error
+	// FlushPacks uploads all pending packs and saves their index entries.
+	FlushPacks(ctx context.Context) error
 
 	// List calls the function fn for each file of type t in the repository.
 	// When an error is returned by fn, processing stops and List() returns the
@@ -51,9 +55,12 @@ type Repository interface {
 	LoadRaw(ctx context.Context, t FileType, id ID) (data []byte, err error)
 	// LoadUnpacked loads and decrypts the file with the given type and ID.
 	LoadUnpacked(ctx context.Context, t FileType, id ID) (data []byte, err error)
-	// SaveUnpacked stores a file in the repository. This is restricted to snapshots.
+	// SaveUnpacked stores a file in the repository. This is restricted to snapshots, the resume
+	// states of backup and copy and the sync state. Prune, deletion and ledger files are only
+	// written by prune within the repository package.
 	SaveUnpacked(ctx context.Context, t WriteableFileType, buf []byte) (ID, error)
-	// RemoveUnpacked removes a file from the repository. This is restricted to snapshots.
+	// RemoveUnpacked removes a file from the repository. This is restricted to the same file types
+	// as SaveUnpacked.
 	RemoveUnpacked(ctx context.Context, t WriteableFileType, id ID) error
 
 	// StartWarmup creates a new warmup job, requesting the backend to warmup the specified packs.
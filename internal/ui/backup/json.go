@@ -188,6 +188,8 @@ func (b *jsonProgress) Finish(snapshotID restic.ID, summary *archiver.Summary, d
 		TotalDuration:       summary.BackupEnd.Sub(summary.BackupStart).Seconds(),
 		SnapshotID:          id,
 		DryRun:              dryRun,
+
+		FilesModifiedWhileReading: summary.FilesModifiedWhileReading,
 	})
 }
 
@@ -250,6 +252,8 @@ type summaryOutput struct {
 	BackupEnd           time.Time `json:"backup_end"`
 	SnapshotID          string    `json:"snapshot_id,omitempty"`
 	DryRun              bool      `json:"dry_run,omitempty"`
+
+	FilesModifiedWhileReading uint `json:"files_modified_while_reading,omitempty"`
 }
 
 type VerboseExclude struct {
@@ -266,3 +270,15 @@ func (b *jsonProgress) ExcludedItem(path string) {
 		Item:        path,
 	})
 }
+
+type modifiedItem struct {
+	MessageType string `json:"message_type"` // "modified_item"
+	Item        string `json:"item"`
+}
+
+func (b *jsonProgress) ModifiedItem(path string) {
+	b.print(modifiedItem{
+		MessageType: "modified_item",
+		Item:        path,
+	})
+}
@@ -20,6 +20,7 @@ type ProgressPrinter interface {
 	Finish(snapshotID restic.ID, summary *archiver.Summary, dryRun bool)
 	Reset()
 	ExcludedItem(path string)
+	ModifiedItem(path string)
 
 	restic.Printer
 }
@@ -167,3 +168,8 @@ func (p *Progress) Finish(snapshotID restic.ID, summary *archiver.Summary, dryru
 func (p *Progress) ExcludedItem(path string) {
 	p.printer.ExcludedItem(path)
 }
+
+// ModifiedItem reports a file which was modified while being read.
+func (p *Progress) ModifiedItem(path string) {
+	p.printer.ModifiedItem(path)
+}
@@ -43,6 +43,7 @@ func (p *mockPrinter) Finish(id restic.ID, _ *archiver.Summary, _ bool) {
 
 func (p *mockPrinter) Reset()                {}
 func (p *mockPrinter) ExcludedItem(_ string) {}
+func (p *mockPrinter) ModifiedItem(_ string) {}
 
 func TestProgress(t *testing.T) {
 	t.Parallel()
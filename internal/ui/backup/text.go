@@ -134,6 +134,9 @@ func (b *textProgress) Finish(id restic.ID, summary *archiver.Summary, dryRun bo
 	b.P("\n")
 	b.P("Files:       %5d new, %5d changed, %5d unmodified\n", summary.Files.New, summary.Files.Changed, summary.Files.Unchanged)
 	b.P("Dirs:        %5d new, %5d changed, %5d unmodified\n", summary.Dirs.New, summary.Dirs.Changed, summary.Dirs.Unchanged)
+	if summary.FilesModifiedWhileReading > 0 {
+		b.P("Warning:     %5d files were modified while being read\n", summary.FilesModifiedWhileReading)
+	}
 	b.V("Data Blobs:  %5d new\n", summary.ItemStats.DataBlobs)
 	b.V("Tree Blobs:  %5d new\n", summary.ItemStats.TreeBlobs)
 	verb := "Added"
@@ -162,3 +165,7 @@ func (b *textProgress) Finish(id restic.ID, summary *archiver.Summary, dryRun bo
 func (b *textProgress) ExcludedItem(path string) {
 	b.VV("excluded %s", path)
 }
+
+func (b *textProgress) ModifiedItem(path string) {
+	b.E("warning: %v was modified while being read, the saved content may be inconsistent\n", path)
+}
@@ -0,0 +1,105 @@
+package copy
+
+import (
+	"time"
+
+	"github.com/restic/restic/internal/data"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui"
+	"github.com/restic/restic/internal/ui/progress"
+)
+
+type jsonPrinter struct {
+	restic.Printer
+
+	terminal ui.Terminal
+}
+
+// NewJSONProgress returns a printer for JSON output.
+func NewJSONProgress(terminal ui.Terminal, verbosity uint) ProgressPrinter {
+	return &jsonPrinter{
+		Printer:  progress.NewTerminalPrinter(true, verbosity, terminal),
+		terminal: terminal,
+	}
+}
+
+func (t *jsonPrinter) print(status interface{}) {
+	t.terminal.Print(ui.ToJSONString(status))
+}
+
+func (t *jsonPrinter) Update(p State, duration time.Duration) {
+	t.print(statusUpdate{
+		MessageType:      "status",
+		SecondsElapsed:   uint64(duration / time.Second),
+		SnapshotsCopied:  p.SnapshotsCopied,
+		SnapshotsSkipped: p.SnapshotsSkipped,
+		TotalBlobs:       p.BlobsTotal,
+		TotalBytes:       p.BytesTotal,
+		BlobsCopied:      p.BlobsCopied,
+		BytesCopied:      p.BytesCopied,
+	})
+}
+
+func (t *jsonPrinter) SnapshotSkipped(sn *data.Snapshot, existing *data.Snapshot) {
+	t.print(snapshotUpdate{
+		MessageType:    "snapshot",
+		Action:         "skipped",
+		SourceSnapshot: *sn.ID(),
+		SnapshotID:     existing.ID(),
+	})
+}
+
+func (t *jsonPrinter) SnapshotStarted(sn *data.Snapshot) {
+	t.print(snapshotUpdate{
+		MessageType:    "snapshot",
+		Action:         "started",
+		SourceSnapshot: *sn.ID(),
+	})
+}
+
+func (t *jsonPrinter) SnapshotCopied(sn *data.Snapshot, newID restic.ID) {
+	t.print(snapshotUpdate{
+		MessageType:    "snapshot",
+		Action:         "copied",
+		SourceSnapshot: *sn.ID(),
+		SnapshotID:     &newID,
+	})
+}
+
+func (t *jsonPrinter) Finish(p State, duration time.Duration) {
+	t.print(summaryOutput{
+		MessageType:      "summary",
+		SecondsElapsed:   uint64(duration / time.Second),
+		SnapshotsCopied:  p.SnapshotsCopied,
+		SnapshotsSkipped: p.SnapshotsSkipped,
+		BlobsCopied:      p.BlobsCopied,
+		BytesCopied:      p.BytesCopied,
+	})
+}
+
+type statusUpdate struct {
+	MessageType      string `json:"message_type"` // "status"
+	SecondsElapsed   uint64 `json:"seconds_elapsed,omitempty"`
+	SnapshotsCopied  uint64 `json:"snapshots_copied"`
+	SnapshotsSkipped uint64 `json:"snapshots_skipped"`
+	TotalBlobs       uint64 `json:"total_blobs"`
+	TotalBytes       uint64 `json:"total_bytes"`
+	BlobsCopied      uint64 `json:"blobs_copied"`
+	BytesCopied      uint64 `json:"bytes_copied"`
+}
+
+type snapshotUpdate struct {
+	MessageType    string     `json:"message_type"` // "snapshot"
+	Action         string     `json:"action"`
+	SourceSnapshot restic.ID  `json:"source_snapshot"`
+	SnapshotID     *restic.ID `json:"snapshot_id,omitempty"`
+}
+
+type summaryOutput struct {
+	MessageType      string `json:"message_type"` // "summary"
+	SecondsElapsed   uint64 `json:"seconds_elapsed,omitempty"`
+	SnapshotsCopied  uint64 `json:"snapshots_copied"`
+	SnapshotsSkipped uint64 `json:"snapshots_skipped"`
+	BlobsCopied      uint64 `json:"blobs_copied"`
+	BytesCopied      uint64 `json:"bytes_copied"`
+}
@@ -0,0 +1,55 @@
+package copy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/data"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/test"
+	"github.com/restic/restic/internal/ui"
+)
+
+func createJSONProgress() (*ui.MockTerminal, ProgressPrinter) {
+	term := &ui.MockTerminal{}
+	printer := NewJSONProgress(term, 3)
+	return term, printer
+}
+
+func testSnapshot(t testing.TB, id string) *data.Snapshot {
+	sn := &data.Snapshot{}
+	data.TestSetSnapshotID(t, sn, restic.TestParseID(id))
+	return sn
+}
+
+const (
+	testSourceID = "1111111111111111111111111111111111111111111111111111111111111111"
+	testCopyID   = "2222222222222222222222222222222222222222222222222222222222222222"
+)
+
+func TestJSONPrintUpdate(t *testing.T) {
+	term, printer := createJSONProgress()
+	printer.Update(State{1, 2, 10, 4096, 3, 1024}, 5*time.Second)
+	test.Equals(t, []string{"{\"message_type\":\"status\",\"seconds_elapsed\":5,\"snapshots_copied\":1,\"snapshots_skipped\":2,\"total_blobs\":10,\"total_bytes\":4096,\"blobs_copied\":3,\"bytes_copied\":1024}\n"}, term.Output)
+}
+
+func TestJSONPrintSnapshot(t *testing.T) {
+	term, printer := createJSONProgress()
+	sn := testSnapshot(t, testSourceID)
+	existing := testSnapshot(t, testCopyID)
+
+	printer.SnapshotSkipped(sn, existing)
+	printer.SnapshotStarted(sn)
+	printer.SnapshotCopied(sn, *existing.ID())
+	test.Equals(t, []string{
+		"{\"message_type\":\"snapshot\",\"action\":\"skipped\",\"source_snapshot\":\"" + testSourceID + "\",\"snapshot_id\":\"" + testCopyID + "\"}\n",
+		"{\"message_type\":\"snapshot\",\"action\":\"started\",\"source_snapshot\":\"" + testSourceID + "\"}\n",
+		"{\"message_type\":\"snapshot\",\"action\":\"copied\",\"source_snapshot\":\"" + testSourceID + "\",\"snapshot_id\":\"" + testCopyID + "\"}\n",
+	}, term.Output)
+}
+
+func TestJSONPrintSummary(t *testing.T) {
+	term, printer := createJSONProgress()
+	printer.Finish(State{2, 1, 10, 4096, 10, 4096}, 5*time.Second)
+	test.Equals(t, []string{"{\"message_type\":\"summary\",\"seconds_elapsed\":5,\"snapshots_copied\":2,\"snapshots_skipped\":1,\"blobs_copied\":10,\"bytes_copied\":4096}\n"}, term.Output)
+}
@@ -0,0 +1,113 @@
+package copy
+
+import (
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/data"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui/progress"
+)
+
+// State is the progress of a copy operation.
+type State struct {
+	SnapshotsCopied  uint64
+	SnapshotsSkipped uint64
+	// BlobsTotal and BytesTotal count the blobs which were found to be
+	// missing in the destination repository so far.
+	BlobsTotal  uint64
+	BytesTotal  uint64
+	BlobsCopied uint64
+	BytesCopied uint64
+}
+
+// ProgressPrinter prints the progress of a copy operation.
+type ProgressPrinter interface {
+	Update(progress State, duration time.Duration)
+	SnapshotSkipped(sn *data.Snapshot, existing *data.Snapshot)
+	SnapshotStarted(sn *data.Snapshot)
+	SnapshotCopied(sn *data.Snapshot, newID restic.ID)
+	Finish(progress State, duration time.Duration)
+	restic.Printer
+}
+
+// Progress tracks the progress of a copy operation.
+type Progress struct {
+	updater progress.Updater
+	m       sync.Mutex
+	s       State
+
+	printer ProgressPrinter
+}
+
+// NewProgress returns a new copy progress reporter.
+func NewProgress(printer ProgressPrinter, quiet, json, canUpdateStatus bool) *Progress {
+	return newProgress(printer, progress.CalculateProgressInterval(!quiet, json, canUpdateStatus))
+}
+
+func newProgress(printer ProgressPrinter, interval time.Duration) *Progress {
+	p := &Progress{printer: printer}
+	p.updater = *progress.NewUpdater(interval, p.update)
+	return p
+}
+
+func (p *Progress) update(runtime time.Duration, final bool) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	if !final {
+		p.printer.Update(p.s, runtime)
+	} else {
+		p.printer.Finish(p.s, runtime)
+	}
+}
+
+// SkipSnapshot records that sn was not copied, as the destination already
+// contains the copy existing.
+func (p *Progress) SkipSnapshot(sn *data.Snapshot, existing *data.Snapshot) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	p.s.SnapshotsSkipped++
+	p.printer.SnapshotSkipped(sn, existing)
+}
+
+// StartSnapshot records that copying sn has started.
+func (p *Progress) StartSnapshot(sn *data.Snapshot) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	p.printer.SnapshotStarted(sn)
+}
+
+// AddBlobs records blobs which must be copied.
+func (p *Progress) AddBlobs(count uint64, size uint64) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	p.s.BlobsTotal += count
+	p.s.BytesTotal += size
+}
+
+// CompleteBlob records that a blob of the given size was copied.
+func (p *Progress) CompleteBlob(size uint64) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	p.s.BlobsCopied++
+	p.s.BytesCopied += size
+}
+
+// CompleteSnapshot records that sn was saved as newID in the destination repository.
+func (p *Progress) CompleteSnapshot(sn *data.Snapshot, newID restic.ID) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	p.s.SnapshotsCopied++
+	p.printer.SnapshotCopied(sn, newID)
+}
+
+// Finish stops the progress reporting and prints the summary.
+func (p *Progress) Finish() {
+	p.updater.Done()
+}
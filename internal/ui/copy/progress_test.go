@@ -0,0 +1,88 @@
+package copy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/data"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/test"
+)
+
+type printerTraceEntry struct {
+	progress State
+
+	isFinished bool
+}
+
+type printerTrace []printerTraceEntry
+
+type mockPrinter struct {
+	trace     printerTrace
+	snapshots []string
+	restic.Printer
+}
+
+func (p *mockPrinter) Update(progress State, _ time.Duration) {
+	p.trace = append(p.trace, printerTraceEntry{progress, false})
+}
+func (p *mockPrinter) SnapshotSkipped(sn *data.Snapshot, _ *data.Snapshot) {
+	p.snapshots = append(p.snapshots, "skipped "+sn.ID().Str())
+}
+func (p *mockPrinter) SnapshotStarted(sn *data.Snapshot) {
+	p.snapshots = append(p.snapshots, "started "+sn.ID().Str())
+}
+func (p *mockPrinter) SnapshotCopied(sn *data.Snapshot, _ restic.ID) {
+	p.snapshots = append(p.snapshots, "copied "+sn.ID().Str())
+}
+func (p *mockPrinter) Finish(progress State, _ time.Duration) {
+	p.trace = append(p.trace, printerTraceEntry{progress, true})
+}
+
+func testProgress(fn func(progress *Progress) bool) (printerTrace, []string) {
+	printer := &mockPrinter{Printer: restic.NewNoopPrinter()}
+	progress := newProgress(printer, 0)
+	final := fn(progress)
+	progress.update(0, final)
+	trace := append(printerTrace{}, printer.trace...)
+	snapshots := append([]string{}, printer.snapshots...)
+	// cleanup to avoid goroutine leak, but copy trace first
+	progress.Finish()
+	return trace, snapshots
+}
+
+func TestNew(t *testing.T) {
+	result, snapshots := testProgress(func(progress *Progress) bool {
+		return false
+	})
+	test.Equals(t, printerTrace{
+		printerTraceEntry{State{}, false},
+	}, result)
+	test.Equals(t, []string{}, snapshots)
+}
+
+func TestBlobs(t *testing.T) {
+	result, _ := testProgress(func(progress *Progress) bool {
+		progress.AddBlobs(3, 300)
+		progress.CompleteBlob(100)
+		progress.CompleteBlob(50)
+		return false
+	})
+	test.Equals(t, printerTrace{
+		printerTraceEntry{State{0, 0, 3, 300, 2, 150}, false},
+	}, result)
+}
+
+func TestSnapshots(t *testing.T) {
+	sn := testSnapshot(t, testSourceID)
+	result, snapshots := testProgress(func(progress *Progress) bool {
+		progress.SkipSnapshot(sn, sn)
+		progress.StartSnapshot(sn)
+		progress.CompleteSnapshot(sn, *sn.ID())
+		return true
+	})
+	test.Equals(t, printerTrace{
+		printerTraceEntry{State{1, 1, 0, 0, 0, 0}, true},
+	}, result)
+	test.Equals(t, []string{"skipped 11111111", "started 11111111", "copied 11111111"}, snapshots)
+}
@@ -0,0 +1,47 @@
+package copy
+
+import (
+	"time"
+
+	"github.com/restic/restic/internal/data"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui"
+	"github.com/restic/restic/internal/ui/progress"
+)
+
+type textPrinter struct {
+	restic.Printer
+}
+
+// NewTextProgress returns a printer for human readable output.
+func NewTextProgress(terminal ui.Terminal, verbosity uint) ProgressPrinter {
+	return &textPrinter{
+		Printer: progress.NewTerminalPrinter(false, verbosity, terminal),
+	}
+}
+
+func (t *textPrinter) Update(_ State, _ time.Duration) {
+	// the progress of each snapshot is shown by the packs counter
+}
+
+func (t *textPrinter) SnapshotSkipped(sn *data.Snapshot, existing *data.Snapshot) {
+	t.V("\n%v", sn)
+	t.V("skipping source snapshot %s, was already copied to snapshot %s", sn.ID().Str(), existing.ID().Str())
+}
+
+func (t *textPrinter) SnapshotStarted(sn *data.Snapshot) {
+	t.P("\n%v", sn)
+	t.P("  copy started, this may take a while...")
+}
+
+func (t *textPrinter) SnapshotCopied(sn *data.Snapshot, newID restic.ID) {
+	t.P("snapshot %s saved, copied from source snapshot %s", newID.Str(), sn.ID().Str())
+}
+
+func (t *textPrinter) Finish(p State, duration time.Duration) {
+	if p.SnapshotsCopied == 0 && p.SnapshotsSkipped == 0 {
+		return
+	}
+	t.P("\ncopied %d snapshots with %d blobs (%s) in %s, skipped %d snapshots already present in the destination",
+		p.SnapshotsCopied, p.BlobsCopied, ui.FormatBytes(p.BytesCopied), ui.FormatDuration(duration), p.SnapshotsSkipped)
+}
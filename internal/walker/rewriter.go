@@ -90,6 +90,17 @@ func NewSnapshotSizeRewriter(rewriteNode NodeRewriteFunc, keepEmptyDirectoryFilt
 	return t, ss
 }
 
+// idSaver computes the ID of a blob without storing it. This avoids storing
+// the original tree if the loader and saver belong to different repositories.
+type idSaver struct{}
+
+func (idSaver) SaveBlob(_ context.Context, _ restic.BlobType, buf []byte, id restic.ID, _ bool) (restic.ID, bool, int, error) {
+	if id.IsNull() {
+		id = restic.Hash(buf)
+	}
+	return id, false, 0, nil
+}
+
 func (t *TreeRewriter) RewriteTree(ctx context.Context, loader restic.BlobLoader, saver restic.BlobSaver, nodepath string, nodeID restic.ID) (newNodeID restic.ID, err error) {
 	// check if tree was already changed
 	newID, ok := t.replaces[nodeID]
@@ -118,7 +129,7 @@ func (t *TreeRewriter) RewriteTree(ctx context.Context, loader restic.BlobLoader
 		// check that we can properly encode this tree without losing information
 		// The alternative of using json/Decoder.DisallowUnknownFields() doesn't work as we use
 		// a custom UnmarshalJSON to decode trees, see also https://github.com/golang/go/issues/41144
-		testID, err := data.SaveTree(ctx, saver, curTree)
+		testID, err := data.SaveTree(ctx, idSaver{}, curTree)
 		if err != nil {
 			return restic.ID{}, err
 		}